@@ -0,0 +1,314 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/donovansolms/ut4-update-packager/src/packager"
+	"github.com/kelseyhightower/envconfig"
+)
+
+// runCommand migrates the database and packages a new release if one is
+// available. The blog post history is pruned to keepBlogPosts and the
+// packages from each version to keepPackages when set
+func runCommand(
+	packager *packager.Packager,
+	keepBlogPosts int,
+	keepPackages int) {
+	err := packager.Migrate()
+	if err != nil {
+		panic(err)
+	}
+
+	// TODO: Remove later
+	result, err := packager.Run()
+	if err != nil {
+		panic(err)
+	}
+	if keepBlogPosts > 0 {
+		_, err = packager.PruneBlogPosts(keepBlogPosts)
+		if err != nil {
+			panic(err)
+		}
+	}
+	if keepPackages > 0 {
+		_, err = packager.PrunePackages(keepPackages)
+		if err != nil {
+			panic(err)
+		}
+	}
+	if len(result.Failures) > 0 {
+		log.Fatalf("%d upgrade package(s) failed", len(result.Failures))
+	}
+}
+
+// watchCommand polls the watch dir for release zips
+func watchCommand(packager *packager.Packager, interval time.Duration) {
+	err := packager.Migrate()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	// Watch only returns when it can't run at all
+	err = packager.Watch(interval)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+}
+
+// listPostsCommand prints the release posts found in the feed
+func listPostsCommand(packager *packager.Packager) {
+	posts, err := packager.ListReleasePosts()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	for _, post := range posts {
+		published := "unknown"
+		if post.Published != nil {
+			published = post.Published.Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("%s\n  guid: %s\n  published: %s\n", post.Title, post.GUID, published)
+		if post.Error != "" {
+			fmt.Printf("  error: %s\n", post.Error)
+			continue
+		}
+		size := "unknown"
+		if post.DownloadSize >= 0 {
+			size = fmt.Sprintf("%.2fMB", post.DownloadSize/1024.00/1024.00)
+		}
+		fmt.Printf("  link: %s\n  size: %s\n", post.DownloadURL, size)
+	}
+}
+
+// showDeltaCommand prints what changed between fromVersion and the newest
+// installed version
+func showDeltaCommand(packager *packager.Packager, fromVersion string) {
+	summary, err := packager.ShowDelta(fromVersion)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	fmt.Print(summary)
+}
+
+// reuploadMissingCommand uploads the packages with a missing or dead URL
+// again
+func reuploadMissingCommand(packager *packager.Packager) {
+	err := packager.ReuploadMissing()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+}
+
+// auditCommand prints the drift between the recorded hashes of version and
+// its files on disk, exiting with an error when there is any
+func auditCommand(packager *packager.Packager, version string) {
+	report, err := packager.AuditVersion(version)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	for _, path := range report.Modified {
+		fmt.Printf("modified %s\n", path)
+	}
+	for _, path := range report.Missing {
+		fmt.Printf("missing  %s\n", path)
+	}
+	for _, path := range report.Extra {
+		fmt.Printf("extra    %s\n", path)
+	}
+	if report.HasDrift() {
+		log.Fatalf("Version %s drifted from its recorded hashes (%s)",
+			version, report.Source)
+	}
+	fmt.Printf("Version %s matches its recorded hashes (%s)\n",
+		version, report.Source)
+}
+
+// doctorCommand prints the result of every self-test check, exiting with an
+// error when any failed
+func doctorCommand(packager *packager.Packager, checkDownload bool) {
+	failed := 0
+	for _, check := range packager.SelfTest(checkDownload) {
+		if check.Err != nil {
+			failed++
+			fmt.Printf("FAIL %s: %s\n", check.Name, check.Err.Error())
+			continue
+		}
+		fmt.Printf("ok   %s\n", check.Name)
+	}
+	if failed > 0 {
+		log.Fatalf("%d self-test checks failed", failed)
+	}
+}
+
+// fullPackageCommand builds the full install package of version
+func fullPackageCommand(packager *packager.Packager, version string) {
+	err := packager.Migrate()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	updateURL, err := packager.GenerateFullPackage(version)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	fmt.Printf("Full package of %s: %s\n", version, updateURL)
+}
+
+// serveCommand answers POST /upgrades on listenAddress until it fails
+func serveCommand(packager *packager.Packager, listenAddress string) {
+	err := packager.Migrate()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	log.Printf("Serving upgrades on %s", listenAddress)
+	err = http.ListenAndServe(listenAddress, packager.UpgradesHandler())
+	log.Fatal(err.Error())
+}
+
+// compactHashCacheCommand moves the per version hash cache files into the
+// hash cache index
+func compactHashCacheCommand(packager *packager.Packager) {
+	versions, err := packager.CompactHashCache()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	for _, version := range versions {
+		fmt.Printf("compacted %s\n", version)
+	}
+	fmt.Printf("Compacted %d hash caches\n", len(versions))
+}
+
+// auditChainsCommand prints the upgrade chain of every installed version
+// with its problems, exiting with an error when any chain is broken
+func auditChainsCommand(packager *packager.Packager) {
+	audits, err := packager.AuditChains()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	broken := 0
+	for _, audit := range audits {
+		if !audit.Broken() {
+			fmt.Printf("ok     %s -> %s (%d packages)\n",
+				audit.FromVersion, audit.ToVersion, len(audit.Packages))
+			continue
+		}
+		broken++
+		fmt.Printf("broken %s -> %s\n", audit.FromVersion, audit.ToVersion)
+		if audit.Error != "" {
+			fmt.Printf("  %s\n", audit.Error)
+		}
+		for _, problem := range audit.Problems {
+			fmt.Printf("  %s\n", problem)
+		}
+	}
+	if broken > 0 {
+		log.Fatalf("%d upgrade chains are broken", broken)
+	}
+}
+
+// parseVersionPairs is reachable from commands, where the packager
+// parameter shadows the package
+var parseVersionPairs = packager.ParseVersionPairs
+
+// generatePairsCommand builds the packages of the from:to pairs in specs,
+// or in the lines of the file at pairsPath when set, skipping the feed
+func generatePairsCommand(
+	packager *packager.Packager,
+	specs []string,
+	pairsPath string) {
+	if pairsPath != "" {
+		pairsBytes, err := ioutil.ReadFile(pairsPath)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		specs = strings.Split(string(pairsBytes), "\n")
+	}
+	pairs, err := parseVersionPairs(specs)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	if len(pairs) == 0 {
+		log.Fatal("No version pairs given")
+	}
+	err = packager.Migrate()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	updatePackages, failures, err := packager.GeneratePackages(pairs)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	for _, updatePackage := range updatePackages {
+		fmt.Printf("ok     %s -> %s: %s\n",
+			updatePackage.FromVersion,
+			updatePackage.ToVersion,
+			updatePackage.UpdateURL)
+	}
+	for _, failure := range failures {
+		fmt.Printf("failed %s -> %s: %s\n",
+			failure.FromVersion,
+			failure.ToVersion,
+			failure.Error)
+	}
+	if len(failures) > 0 {
+		log.Fatalf("%d upgrade package(s) failed", len(failures))
+	}
+}
+
+// superviseCommand runs a Packager for every feed in config.Feeds
+// concurrently until interrupted. Each feed is configured by its own
+// PACKAGER_<NAME>_* variables and must use its own dirs
+func superviseCommand(config Config) {
+	if len(config.Feeds) == 0 {
+		log.Fatal("No feeds to supervise, set PACKAGER_FEEDS")
+	}
+	supervisor := packager.NewSupervisor(
+		config.MaxConcurrentRuns,
+		config.RunInterval,
+		config.RestartDelay)
+	feedDirs := make(map[string]string)
+	feedConfigs := make([]Config, len(config.Feeds))
+	for i, name := range config.Feeds {
+		if _, ok := feedDirs["working dir of feed "+name]; ok {
+			log.Fatalf("Feed %s is listed twice", name)
+		}
+		err := envconfig.Process("packager_"+name, &feedConfigs[i])
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		feedDirs["working dir of feed "+name] = feedConfigs[i].WorkingDir
+		feedDirs["release dir of feed "+name] = feedConfigs[i].ReleaseDir
+		feedDirs["package dir of feed "+name] = feedConfigs[i].PackageDir
+		feedDirs["payload dir of feed "+name] = feedConfigs[i].PayloadDir
+	}
+	// Feeds sharing or nesting dirs would remove or misread each other's data
+	err := packager.ValidateDirs(feedDirs)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	for i, name := range config.Feeds {
+		feedPackager, err := newPackager(feedConfigs[i])
+		if err != nil {
+			log.Fatalf("Feed %s: %s", name, err.Error())
+		}
+		supervisor.Add(name, feedPackager)
+	}
+
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		log.Println("Stopping once the current runs finish")
+		close(stop)
+	}()
+	err = supervisor.Run(stop)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+}
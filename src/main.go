@@ -3,6 +3,9 @@ package main
 import (
 	"fmt"
 	"log"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/donovansolms/ut4-update-packager/src/packager"
 	"github.com/kelseyhightower/envconfig"
@@ -19,6 +22,142 @@ type Config struct {
 	DatabaseName     string `split_words:"true"`
 	DatabaseHost     string `split_words:"true"`
 	DatabasePort     uint   `split_words:"true"`
+	// DatabaseDialect is mysql (default) or sqlite3, which uses
+	// DatabaseName as the database file
+	DatabaseDialect string `split_words:"true"`
+	// PackageNameTemplate and PackageURLTemplate support the variables
+	// {from}, {to}, {version}, {platform} and {hash}
+	PackageNameTemplate string `split_words:"true"`
+	PackageURLTemplate  string `split_words:"true"`
+	// CoverageStrategy is either fanout or chain
+	CoverageStrategy string `split_words:"true"`
+	PublishLatest    bool   `split_words:"true"`
+	PackageRetries   int    `split_words:"true"`
+	// MaxResumeAttempts limits how often interrupted packaging is resumed
+	MaxResumeAttempts int `split_words:"true"`
+	// CleanWorkingDirOnStart removes stale artifacts of crashed runs
+	CleanWorkingDirOnStart bool `split_words:"true"`
+	ChunkFiles             bool `split_words:"true"`
+	// SigningKeyPath enables package signing when set
+	SigningKeyPath   string `split_words:"true"`
+	ExtractDepth     int    `split_words:"true"`
+	MaxExtractBytes  int64  `split_words:"true"`
+	Reprocess        bool   `split_words:"true"`
+	StoreFileHashes  bool   `split_words:"true"`
+	RequireValidDate bool   `split_words:"true"`
+	// IgnorePatterns is a comma separated list of paths to ignore
+	IgnorePatterns []string `split_words:"true"`
+	// MirrorURLs is a comma separated list of download mirror base URLs
+	MirrorURLs []string `envconfig:"MIRROR_URLS"`
+	// Channel is stable by default, BetaKeywords is a comma separated list
+	Channel      string   `split_words:"true"`
+	BetaKeywords []string `split_words:"true"`
+	// VersionMismatch is either warn or fail
+	VersionMismatch string `split_words:"true"`
+	HardlinkFiles   bool   `split_words:"true"`
+	// WatchDir and WatchInterval are used by the watch command
+	WatchDir      string        `split_words:"true"`
+	WatchInterval time.Duration `split_words:"true" default:"1m"`
+	// ResumePackaging skips files staged by a failed packaging attempt
+	ResumePackaging bool `split_words:"true"`
+	// KeepBlogPosts prunes the processed blog post history after a run
+	// when set
+	KeepBlogPosts int `split_words:"true"`
+	// KeepPackagesPerVersion prunes the packages from each version to the
+	// newest ones after a run when set
+	KeepPackagesPerVersion int `split_words:"true"`
+	// ReleasePublicKey enables minisign verification of release downloads
+	ReleasePublicKey       string `split_words:"true"`
+	ReleaseSignatureSuffix string `split_words:"true"`
+	// OperationsPlacement is either payload, first or sidecar
+	OperationsPlacement string `split_words:"true"`
+	// StorageMode is either archive or files
+	StorageMode string `split_words:"true"`
+	// CaseCollisions is either warn or fail
+	CaseCollisions string `split_words:"true"`
+	// Release bounds are optional sanity checks on the extracted release
+	MinReleaseFiles int   `split_words:"true"`
+	MaxReleaseFiles int   `split_words:"true"`
+	MinReleaseBytes int64 `split_words:"true"`
+	MaxReleaseBytes int64 `split_words:"true"`
+	HashDirectories bool  `split_words:"true"`
+	// RecordEmptyDeltas stops retrying version pairs without changes
+	RecordEmptyDeltas bool `split_words:"true"`
+	// AcceptedContentTypes is a comma separated list of content types the
+	// release download may be served as
+	AcceptedContentTypes []string `split_words:"true"`
+	VersionManifests     bool     `split_words:"true"`
+	DBBatchSize          int      `envconfig:"DB_BATCH_SIZE"`
+	ResumeExtraction     bool     `split_words:"true"`
+	ResumeExtractionCRC  bool     `envconfig:"RESUME_EXTRACTION_CRC"`
+	// FeedCacheMaxAge enables falling back to the last fetched feed
+	FeedCacheMaxAge time.Duration `split_words:"true"`
+	// PayloadDir holds the release download and extraction when set
+	PayloadDir string `split_words:"true"`
+	// FanOutMaxVersions and FanOutMaxAge limit which versions get packages
+	FanOutMaxVersions int           `split_words:"true"`
+	FanOutMaxAge      time.Duration `split_words:"true"`
+	// SmallPackages is either flag or skip for packages below
+	// MinPackageBytes
+	MinPackageBytes int64  `split_words:"true"`
+	SmallPackages   string `split_words:"true"`
+	// Normalizations is a comma separated list of
+	// <pattern>:<offset>+<length>[;<offset>+<length>] rules
+	Normalizations []string `split_words:"true"`
+	// NormalizationMode is either hash or demote
+	NormalizationMode string `split_words:"true"`
+	// DownloadLinkElement is a namespaced feed element, e.g. ut:download,
+	// holding the download link
+	DownloadLinkElement string `split_words:"true"`
+	// ShareDeltas lets version pairs with identical deltas share a package
+	ShareDeltas bool `split_words:"true"`
+	// HashMemoryCacheSize keeps the hashes of this many versions in memory
+	HashMemoryCacheSize int `split_words:"true"`
+	// ReleaseGracePeriod retries new posts whose download isn't live yet
+	ReleaseGracePeriod time.Duration `split_words:"true"`
+	// Permissions is either off, report or fix, ExecutablePatterns is a
+	// comma separated list of paths that must be executable
+	Permissions        string   `split_words:"true"`
+	ExecutablePatterns []string `split_words:"true"`
+	CompressHashCache  bool     `split_words:"true"`
+	// HashCacheIndex keeps all hash caches in a single index file
+	HashCacheIndex bool `split_words:"true"`
+	// HTTP* tune the connection reuse of the HTTP client
+	HTTPIdleConnsPerHost int           `split_words:"true"`
+	HTTPIdleConnTimeout  time.Duration `split_words:"true"`
+	HTTPKeepAlive        time.Duration `split_words:"true"`
+	DisableHTTP2         bool          `split_words:"true"`
+	// PostPackageCommand is a space separated command run per package,
+	// PostPackageHookFailure is either warn or fail
+	PostPackageCommand     string `split_words:"true"`
+	PostPackageWebhook     string `split_words:"true"`
+	PostPackageHookFailure string `split_words:"true"`
+	// CompressionStats logs and records the compression ratio of packages
+	CompressionStats bool `split_words:"true"`
+	// PostMetadata is a comma separated list of link, categories and
+	// description
+	PostMetadata []string `split_words:"true"`
+	// ProtectedPaths is a comma separated list of paths deltas may not
+	// remove
+	ProtectedPaths         []string `split_words:"true"`
+	AllowProtectedRemovals bool     `split_words:"true"`
+	PipelineDeltas         bool     `split_words:"true"`
+	// DownloadArtifact is the build taken from posts, ArtifactPatterns is a
+	// comma separated list of artifact:pattern link classifications
+	DownloadArtifact string   `split_words:"true"`
+	ArtifactPatterns []string `split_words:"true"`
+	// CompressOperations gzips operations.json in the package
+	CompressOperations bool `split_words:"true"`
+	// ContentRoots is a comma separated list of dirs packages are limited to
+	ContentRoots []string `split_words:"true"`
+	// Feeds is a comma separated list of feed names for the supervise
+	// command, each configured by PACKAGER_<NAME>_* variables
+	Feeds             []string      `split_words:"true"`
+	MaxConcurrentRuns int           `split_words:"true" default:"1"`
+	RunInterval       time.Duration `split_words:"true" default:"10m"`
+	RestartDelay      time.Duration `split_words:"true" default:"1m"`
+	// ListenAddress is where the serve command answers upgrade queries
+	ListenAddress string `split_words:"true" default:":8080"`
 }
 
 func main() {
@@ -28,6 +167,79 @@ func main() {
 		log.Fatal(err.Error())
 	}
 
+	command := "run"
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+	// Supervised feeds have their own configuration
+	if command == "supervise" {
+		superviseCommand(config)
+		return
+	}
+
+	packager, err := newPackager(config)
+	if err != nil {
+		panic(err)
+	}
+
+	switch command {
+	case "run":
+		runCommand(packager, config.KeepBlogPosts, config.KeepPackagesPerVersion)
+	case "list-posts":
+		listPostsCommand(packager)
+	case "watch":
+		watchCommand(packager, config.WatchInterval)
+	case "show-delta":
+		if len(os.Args) < 3 {
+			log.Fatal("Usage: show-delta <from version>")
+		}
+		showDeltaCommand(packager, os.Args[2])
+	case "reupload-missing":
+		reuploadMissingCommand(packager)
+	case "audit":
+		if len(os.Args) < 3 {
+			log.Fatal("Usage: audit <version>")
+		}
+		auditCommand(packager, os.Args[2])
+	case "audit-chains":
+		auditChainsCommand(packager)
+	case "full-package":
+		if len(os.Args) < 3 {
+			log.Fatal("Usage: full-package <version>")
+		}
+		fullPackageCommand(packager, os.Args[2])
+	case "generate-pairs":
+		if len(os.Args) == 4 && os.Args[2] == "--file" {
+			generatePairsCommand(packager, nil, os.Args[3])
+		} else if len(os.Args) > 2 {
+			generatePairsCommand(packager, os.Args[2:], "")
+		} else {
+			log.Fatal("Usage: generate-pairs <from:to>... | --file <path>")
+		}
+	case "serve":
+		serveCommand(packager, config.ListenAddress)
+	case "compact-hash-cache":
+		compactHashCacheCommand(packager)
+	case "doctor":
+		doctorCommand(packager, len(os.Args) > 2 && os.Args[2] == "--download")
+	default:
+		log.Fatalf("Unknown command '%s', expected run, list-posts, watch, "+
+			"show-delta, reupload-missing, audit, audit-chains, full-package, "+
+			"generate-pairs, supervise, compact-hash-cache or doctor", command)
+	}
+}
+
+// newPackager creates the Packager described by config
+func newPackager(config Config) (*packager.Packager, error) {
+	normalizations, err := packager.ParseNormalizationRules(config.Normalizations)
+	if err != nil {
+		return nil, err
+	}
+	artifactPatterns, err := packager.ParseArtifactPatterns(config.ArtifactPatterns)
+	if err != nil {
+		return nil, err
+	}
+
 	connectionString := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?%s",
 		config.DatabaseUser,
 		config.DatabasePassword,
@@ -35,20 +247,87 @@ func main() {
 		config.DatabasePort,
 		config.DatabaseName,
 		"charset=utf8&parseTime=True")
-	packager, err := packager.New(
+	if config.DatabaseDialect == packager.DialectSQLite {
+		connectionString = config.DatabaseName
+	}
+	return packager.New(
 		config.ReleaseFeedURL,
 		connectionString,
 		config.WorkingDir,
 		config.ReleaseDir,
 		config.PackageDir,
+		packager.Options{
+			PackageNameTemplate:    config.PackageNameTemplate,
+			PackageURLTemplate:     config.PackageURLTemplate,
+			DatabaseDialect:        config.DatabaseDialect,
+			CoverageStrategy:       config.CoverageStrategy,
+			PublishLatest:          config.PublishLatest,
+			PackageRetries:         config.PackageRetries,
+			MaxResumeAttempts:      config.MaxResumeAttempts,
+			CleanWorkingDirOnStart: config.CleanWorkingDirOnStart,
+			ChunkFiles:             config.ChunkFiles,
+			SigningKeyPath:         config.SigningKeyPath,
+			ExtractDepth:           config.ExtractDepth,
+			MaxExtractBytes:        config.MaxExtractBytes,
+			Reprocess:              config.Reprocess,
+			StoreFileHashes:        config.StoreFileHashes,
+			RequireValidDate:       config.RequireValidDate,
+			IgnorePatterns:         config.IgnorePatterns,
+			MirrorURLs:             config.MirrorURLs,
+			Channel:                config.Channel,
+			BetaKeywords:           config.BetaKeywords,
+			VersionMismatch:        config.VersionMismatch,
+			HardlinkFiles:          config.HardlinkFiles,
+			WatchDir:               config.WatchDir,
+			ResumePackaging:        config.ResumePackaging,
+			ReleasePublicKey:       config.ReleasePublicKey,
+			ReleaseSignatureSuffix: config.ReleaseSignatureSuffix,
+			OperationsPlacement:    config.OperationsPlacement,
+			StorageMode:            config.StorageMode,
+			CaseCollisions:         config.CaseCollisions,
+			MinReleaseFiles:        config.MinReleaseFiles,
+			MaxReleaseFiles:        config.MaxReleaseFiles,
+			MinReleaseBytes:        config.MinReleaseBytes,
+			MaxReleaseBytes:        config.MaxReleaseBytes,
+			HashDirectories:        config.HashDirectories,
+			RecordEmptyDeltas:      config.RecordEmptyDeltas,
+			AcceptedContentTypes:   config.AcceptedContentTypes,
+			VersionManifests:       config.VersionManifests,
+			DBBatchSize:            config.DBBatchSize,
+			ResumeExtraction:       config.ResumeExtraction,
+			ResumeExtractionCRC:    config.ResumeExtractionCRC,
+			FeedCacheMaxAge:        config.FeedCacheMaxAge,
+			PayloadDir:             config.PayloadDir,
+			FanOutMaxVersions:      config.FanOutMaxVersions,
+			FanOutMaxAge:           config.FanOutMaxAge,
+			MinPackageBytes:        config.MinPackageBytes,
+			SmallPackages:          config.SmallPackages,
+			Normalizations:         normalizations,
+			NormalizationMode:      config.NormalizationMode,
+			DownloadLinkElement:    config.DownloadLinkElement,
+			ShareDeltas:            config.ShareDeltas,
+			HashMemoryCacheSize:    config.HashMemoryCacheSize,
+			ReleaseGracePeriod:     config.ReleaseGracePeriod,
+			Permissions:            config.Permissions,
+			ExecutablePatterns:     config.ExecutablePatterns,
+			CompressHashCache:      config.CompressHashCache,
+			PostPackageCommand:     strings.Fields(config.PostPackageCommand),
+			PostPackageWebhook:     config.PostPackageWebhook,
+			PostPackageHookFailure: config.PostPackageHookFailure,
+			CompressionStats:       config.CompressionStats,
+			PostMetadata:           config.PostMetadata,
+			ProtectedPaths:         config.ProtectedPaths,
+			AllowProtectedRemovals: config.AllowProtectedRemovals,
+			PipelineDeltas:         config.PipelineDeltas,
+			DownloadArtifact:       config.DownloadArtifact,
+			ArtifactPatterns:       artifactPatterns,
+			CompressOperations:     config.CompressOperations,
+			ContentRoots:           config.ContentRoots,
+			HashCacheIndex:         config.HashCacheIndex,
+			HTTPIdleConnsPerHost:   config.HTTPIdleConnsPerHost,
+			HTTPIdleConnTimeout:    config.HTTPIdleConnTimeout,
+			HTTPKeepAlive:          config.HTTPKeepAlive,
+			DisableHTTP2:           config.DisableHTTP2,
+		},
 	)
-	if err != nil {
-		panic(err)
-	}
-
-	// TODO: Remove later
-	err = packager.Run()
-	if err != nil {
-		panic(err)
-	}
 }
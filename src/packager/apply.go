@@ -0,0 +1,252 @@
+package packager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ApplyPackage applies the upgrade package at packagePath to the install
+// at installPath. The package is extracted next to the install first and
+// every file it replaces or removes is kept in a backup, so when any step
+// fails the install is rolled back to the version it was before
+func ApplyPackage(packagePath string, installPath string) error {
+	operations, err := ReadPackageOperations(packagePath)
+	if err != nil {
+		return err
+	}
+	return applyOperations(packagePath, installPath, operations)
+}
+
+// applyOperations applies operations with the content of the package at
+// packagePath to the install at installPath, rolling back on failure
+func applyOperations(
+	packagePath string,
+	installPath string,
+	operations map[string]DeltaOperation) error {
+	// The staging dir is next to the install so files are renamed into
+	// place instead of copied
+	stageDir, err := ioutil.TempDir(filepath.Dir(filepath.Clean(installPath)), ".apply-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(stageDir)
+	payloadDir := filepath.Join(stageDir, "payload")
+	err = extractPayload(packagePath, payloadDir)
+	if err != nil {
+		return err
+	}
+
+	transaction := &applyTransaction{
+		installPath: installPath,
+		backupDir:   filepath.Join(stageDir, "backup"),
+	}
+	err = transaction.apply(payloadDir, operations)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"package": packagePath,
+			"install": installPath,
+		}).Warning("Apply failed, rolling back: " + err.Error())
+		rollbackErr := transaction.rollback()
+		if rollbackErr != nil {
+			return fmt.Errorf("Apply failed: %s, and rolling back failed: %s",
+				err, rollbackErr)
+		}
+		return err
+	}
+	log.WithFields(log.Fields{
+		"package":    packagePath,
+		"install":    installPath,
+		"operations": len(operations),
+	}).Info("Package applied")
+	return nil
+}
+
+// extractPayload extracts the files of the tar.gz package at packagePath
+// to payloadDir. Packages listing chunks or stored files don't hold the
+// file content and can't be applied
+func extractPayload(packagePath string, payloadDir string) error {
+	// Applying has no extraction limit, the zero Packager has none
+	err := (&Packager{}).extractTar(payloadDir, packagePath)
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{chunksFilename, filesFilename} {
+		if _, err := os.Stat(filepath.Join(payloadDir, name)); err == nil {
+			return fmt.Errorf("Packages with a %s can't be applied", name)
+		}
+	}
+	return nil
+}
+
+// applyTransaction applies operations to an install and remembers how to
+// undo each change
+type applyTransaction struct {
+	installPath string
+	// backupDir holds the replaced and removed files
+	backupDir string
+	// undo reverts the applied changes, in reverse order
+	undo []func() error
+}
+
+// apply applies the moves first, while their sources still exist, then
+// the added, modified and removed files and finally the directories
+func (transaction *applyTransaction) apply(
+	payloadDir string,
+	operations map[string]DeltaOperation) error {
+	paths := make([]string, 0, len(operations))
+	for path := range operations {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		if operations[path].Operation != deltaOperationMoved {
+			continue
+		}
+		err := transaction.replace(
+			path,
+			filepath.Join(transaction.installPath, operations[path].Source),
+			true)
+		if err != nil {
+			return err
+		}
+	}
+	for _, path := range paths {
+		if isDirectoryEntry(path) {
+			continue
+		}
+		var err error
+		switch operations[path].Operation {
+		case deltaOperationAdded, deltaOperationModified:
+			stagedPath := filepath.Join(payloadDir, path)
+			if _, statErr := os.Stat(stagedPath); statErr != nil {
+				return fmt.Errorf("Package has no content for '%s'", path)
+			}
+			err = transaction.replace(path, stagedPath, false)
+		case deltaOperationRemoved:
+			// Removed files are only moved to the backup
+			err = transaction.backup(path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for _, path := range paths {
+		if isDirectoryEntry(path) && operations[path].Operation == deltaOperationAdded {
+			err := transaction.mkdirAll(filepath.Join(transaction.installPath, path))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	// Children before their parents, directories that aren't empty on the
+	// client are kept
+	for i := len(paths) - 1; i >= 0; i-- {
+		path := paths[i]
+		if isDirectoryEntry(path) && operations[path].Operation == deltaOperationRemoved {
+			transaction.removeDir(path)
+		}
+	}
+	return nil
+}
+
+// replace puts the file at sourcePath in place of path in the install,
+// backing up the file it replaces. moved tells whether sourcePath is in
+// the install itself
+func (transaction *applyTransaction) replace(
+	path string,
+	sourcePath string,
+	moved bool) error {
+	targetPath := filepath.Join(transaction.installPath, path)
+	err := transaction.backup(path)
+	if err != nil {
+		return err
+	}
+	err = transaction.mkdirAll(filepath.Dir(targetPath))
+	if err != nil {
+		return err
+	}
+	err = os.Rename(sourcePath, targetPath)
+	if err != nil {
+		return err
+	}
+	transaction.undo = append(transaction.undo, func() error {
+		if moved {
+			return os.Rename(targetPath, sourcePath)
+		}
+		return os.Remove(targetPath)
+	})
+	return nil
+}
+
+// backup moves path in the install to the backup dir if it exists
+func (transaction *applyTransaction) backup(path string) error {
+	targetPath := filepath.Join(transaction.installPath, path)
+	if _, err := os.Lstat(targetPath); os.IsNotExist(err) {
+		return nil
+	}
+	backupPath := filepath.Join(transaction.backupDir, path)
+	err := os.MkdirAll(filepath.Dir(backupPath), 0755)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(targetPath, backupPath)
+	if err != nil {
+		return err
+	}
+	transaction.undo = append(transaction.undo, func() error {
+		return os.Rename(backupPath, targetPath)
+	})
+	return nil
+}
+
+// mkdirAll creates dir and its missing parents, they are removed again
+// on rollback
+func (transaction *applyTransaction) mkdirAll(dir string) error {
+	var missing []string
+	for parent := dir; ; parent = filepath.Dir(parent) {
+		if _, err := os.Stat(parent); err == nil || parent == filepath.Dir(parent) {
+			break
+		}
+		missing = append(missing, parent)
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		createdDir := missing[i]
+		err := os.Mkdir(createdDir, 0755)
+		if err != nil {
+			return err
+		}
+		transaction.undo = append(transaction.undo, func() error {
+			return os.Remove(createdDir)
+		})
+	}
+	return nil
+}
+
+// removeDir removes the directory at path in the install when it is empty
+func (transaction *applyTransaction) removeDir(path string) {
+	dir := filepath.Join(transaction.installPath, path)
+	if os.Remove(dir) != nil {
+		return
+	}
+	transaction.undo = append(transaction.undo, func() error {
+		return os.Mkdir(dir, 0755)
+	})
+}
+
+// rollback undoes the applied changes in reverse order
+func (transaction *applyTransaction) rollback() error {
+	for i := len(transaction.undo) - 1; i >= 0; i-- {
+		err := transaction.undo[i]()
+		if err != nil {
+			return err
+		}
+	}
+	transaction.undo = nil
+	return nil
+}
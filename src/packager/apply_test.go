@@ -0,0 +1,113 @@
+package packager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// readTree returns the content of the regular files in dir by slash
+// separated relative path
+func readTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.Walk(dir, func(path string, fileInfo os.FileInfo, err error) error {
+		if err != nil || fileInfo.IsDir() {
+			return err
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		relativePath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(relativePath)] = string(content)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// copyTree copies the regular files of source to destination
+func copyTree(t *testing.T, source string, destination string) {
+	t.Helper()
+	writeTree(t, destination, readTree(t, source))
+}
+
+// applyFixture builds the package from 3395761 to 3525360 and returns the
+// packager with the package path
+func applyFixture(t *testing.T) (*Packager, string) {
+	t.Helper()
+	packager := newTestPackager(t, Options{})
+	installTestVersion(t, packager, 3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini":  "setting=1",
+		"UnrealTournament/Content/Old.pak":     "same pak",
+		"UnrealTournament/Content/Removed.txt": "removed",
+		"UnrealTournament/Content/Kept.txt":    "kept",
+	})
+	installTestVersion(t, packager, 3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini":      "setting=2",
+		"UnrealTournament/Content/Paks/New.pak":    "same pak",
+		"UnrealTournament/Content/Kept.txt":        "kept",
+		"UnrealTournament/Content/Maps/Added.umap": "added",
+	})
+	_, err := packager.GeneratePackage("3395761", "3525360")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return packager, filepath.Join(packager.packageDir, "3395761-3525360.tar.gz")
+}
+
+func TestApplyPackage(t *testing.T) {
+	packager, packagePath := applyFixture(t)
+	installPath := filepath.Join(tempDir(t), "install")
+	copyTree(t, filepath.Join(packager.releaseDir, "3395761"), installPath)
+
+	err := ApplyPackage(packagePath, installPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	installed := readTree(t, installPath)
+	expected := readTree(t, filepath.Join(packager.releaseDir, "3525360"))
+	if !reflect.DeepEqual(installed, expected) {
+		t.Errorf("Applied install is %v, expected %v", installed, expected)
+	}
+	// Nothing is left of the staging next to the install
+	entries, err := ioutil.ReadDir(filepath.Dir(installPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("%d entries next to the install, expected 1", len(entries))
+	}
+}
+
+func TestApplyPackageRollsBackOnFailure(t *testing.T) {
+	packager, packagePath := applyFixture(t)
+	installPath := filepath.Join(tempDir(t), "install")
+	copyTree(t, filepath.Join(packager.releaseDir, "3395761"), installPath)
+	// A file where the package adds a directory makes the apply fail after
+	// the config was already replaced
+	writeTree(t, installPath, map[string]string{
+		"UnrealTournament/Content/Maps": "not a directory",
+	})
+	before := readTree(t, installPath)
+
+	err := ApplyPackage(packagePath, installPath)
+	if err == nil {
+		t.Fatal("Apply didn't fail")
+	}
+	after := readTree(t, installPath)
+	if !reflect.DeepEqual(after, before) {
+		t.Errorf("Install after the failed apply is %v, expected %v", after, before)
+	}
+	if _, err := os.Stat(filepath.Join(installPath, "UnrealTournament/Content/Paks")); !os.IsNotExist(err) {
+		t.Error("Directory created by the failed apply wasn't removed")
+	}
+}
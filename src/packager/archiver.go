@@ -0,0 +1,86 @@
+package packager
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+
+	"github.com/jhoonb/archivex"
+)
+
+// Archiver writes the compressed package file. The default is a tar.gz
+// archive, set Options.NewArchiver to use a different implementation
+type Archiver interface {
+	// Create starts a new archive at path
+	Create(path string) error
+	// AddFile adds the file at sourcePath as name
+	AddFile(name string, sourcePath string) error
+	// AddDir adds the contents of dir with names relative to dir
+	AddDir(dir string) error
+	// Close finishes the archive
+	Close() error
+}
+
+// StreamArchiver is an Archiver that can also write the archive to a
+// writer instead of a file, which streaming uploads require
+type StreamArchiver interface {
+	Archiver
+	// CreateWriter starts a new archive named name written to writer
+	CreateWriter(name string, writer io.Writer) error
+}
+
+// tarGzArchiver is the default archivex based Archiver
+type tarGzArchiver struct {
+	tar *archivex.TarFile
+}
+
+// newTarGzArchiver creates the default Archiver
+func newTarGzArchiver() Archiver {
+	return &tarGzArchiver{tar: new(archivex.TarFile)}
+}
+
+// Create starts a new tar.gz archive at path, the .tar.gz extension
+// enables compression
+func (archiver *tarGzArchiver) Create(path string) error {
+	return archiver.tar.Create(path)
+}
+
+// CreateWriter starts a new tar.gz archive written to writer, the .tar.gz
+// extension of name enables compression
+func (archiver *tarGzArchiver) CreateWriter(name string, writer io.Writer) error {
+	return archiver.tar.CreateWriter(name, writer)
+}
+
+// AddFile adds the file at sourcePath as name
+func (archiver *tarGzArchiver) AddFile(name string, sourcePath string) error {
+	file, err := os.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	err = archiver.tar.Writer.WriteHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(archiver.tar.Writer, file)
+	return err
+}
+
+// AddDir adds the contents of dir with names relative to dir
+func (archiver *tarGzArchiver) AddDir(dir string) error {
+	return archiver.tar.AddAll(dir, false)
+}
+
+// Close finishes the archive
+func (archiver *tarGzArchiver) Close() error {
+	return archiver.tar.Close()
+}
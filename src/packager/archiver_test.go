@@ -0,0 +1,83 @@
+package packager
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// memoryArchiver is an Archiver that records the entries added to it
+type memoryArchiver struct {
+	path    string
+	entries []string
+	closed  bool
+}
+
+func (archiver *memoryArchiver) Create(path string) error {
+	archiver.path = path
+	return nil
+}
+
+func (archiver *memoryArchiver) AddFile(name string, sourcePath string) error {
+	archiver.entries = append(archiver.entries, name)
+	return nil
+}
+
+func (archiver *memoryArchiver) AddDir(dir string) error {
+	return filepath.Walk(dir, func(path string, fileInfo os.FileInfo, err error) error {
+		if err != nil || fileInfo.IsDir() {
+			return err
+		}
+		relativePath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		archiver.entries = append(archiver.entries, filepath.ToSlash(relativePath))
+		return nil
+	})
+}
+
+func (archiver *memoryArchiver) Close() error {
+	archiver.closed = true
+	return nil
+}
+
+func TestInjectedArchiverReceivesEntries(t *testing.T) {
+	archiver := &memoryArchiver{}
+	packager := newTestPackager(t, Options{
+		OperationsPlacement: OperationsFirst,
+		NewArchiver: func() Archiver {
+			return archiver
+		},
+	})
+	installTestVersion(t, packager, 3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+		"UnrealTournament/Content/Kept.txt":   "kept",
+	})
+	installTestVersion(t, packager, 3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+		"UnrealTournament/Content/Kept.txt":   "kept",
+		"UnrealTournament/Content/Added.txt":  "added",
+	})
+
+	staged, _, err := packager.generateUpgradePath("3395761", "3525360")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if archiver.path != staged.path {
+		t.Errorf("Archive created at %s, expected %s", archiver.path, staged.path)
+	}
+	if !archiver.closed {
+		t.Error("Archive wasn't closed")
+	}
+	expected := []string{
+		operationsFilename,
+		modulesBinaryDir + "/" + modulesFilename,
+		"UnrealTournament/Config/Default.ini",
+		"UnrealTournament/Content/Added.txt",
+	}
+	if !reflect.DeepEqual(archiver.entries, expected) {
+		t.Errorf("Archive entries are %v, expected %v", archiver.entries, expected)
+	}
+}
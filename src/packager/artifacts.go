@@ -0,0 +1,73 @@
+package packager
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// ArtifactClient is the game client build, the default artifact
+	ArtifactClient = "client"
+	// ArtifactServer is the dedicated server build
+	ArtifactServer = "server"
+	// ArtifactEditor is the editor build
+	ArtifactEditor = "editor"
+	// ArtifactSymbols are the debug symbols of a build
+	ArtifactSymbols = "symbols"
+)
+
+// ArtifactPattern classifies links containing Pattern, case-insensitive,
+// as Artifact
+type ArtifactPattern struct {
+	Artifact string
+	Pattern  string
+}
+
+// defaultArtifactPatterns are checked in order, so symbols and editor
+// links mentioning the client are not taken for the client
+var defaultArtifactPatterns = []ArtifactPattern{
+	{Artifact: ArtifactSymbols, Pattern: "symbols"},
+	{Artifact: ArtifactEditor, Pattern: "editor"},
+	{Artifact: ArtifactServer, Pattern: "server-xan"},
+	{Artifact: ArtifactClient, Pattern: "client-xan"},
+}
+
+// ParseArtifactPatterns parses specs of the form artifact:pattern, kept in
+// the given order
+func ParseArtifactPatterns(specs []string) ([]ArtifactPattern, error) {
+	var patterns []ArtifactPattern
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf(
+				"Invalid artifact pattern '%s', expected artifact:pattern", spec)
+		}
+		patterns = append(patterns, ArtifactPattern{
+			Artifact: parts[0],
+			Pattern:  strings.ToLower(parts[1]),
+		})
+	}
+	return patterns, nil
+}
+
+// validateArtifact checks that some pattern classifies links as artifact
+func validateArtifact(artifact string, patterns []ArtifactPattern) error {
+	for _, pattern := range patterns {
+		if pattern.Artifact == artifact {
+			return nil
+		}
+	}
+	return fmt.Errorf("No link pattern for the download artifact '%s'", artifact)
+}
+
+// classifyLink returns the artifact of the first pattern link matches, or
+// an empty string when none does
+func (packager *Packager) classifyLink(link string) string {
+	link = strings.ToLower(link)
+	for _, pattern := range packager.options.ArtifactPatterns {
+		if strings.Contains(link, strings.ToLower(pattern.Pattern)) {
+			return pattern.Artifact
+		}
+	}
+	return ""
+}
@@ -0,0 +1,65 @@
+package packager
+
+import (
+	"strings"
+	"testing"
+)
+
+const artifactPost = `<title>UT Release 3525360</title>` +
+	`<description><![CDATA[` +
+	`<a href="https://cdn.example.com/UnrealTournament-Client-XAN-3525360-Linux.zip">Client</a>` +
+	`<a href="https://cdn.example.com/UnrealTournament-Client-XAN-3525360-Linux-Symbols.zip">Client symbols</a>` +
+	`<a href="https://cdn.example.com/UnrealTournament-Server-XAN-3525360-Linux.zip">Server</a>` +
+	`<a href="https://cdn.example.com/UnrealTournament-Editor-XAN-3525360-Linux.zip">Editor</a>` +
+	`<a href="https://cdn.example.com/UnrealTournament-Client-XAN-3525360-Win64.zip">Windows client</a>` +
+	`]]></description>`
+
+func TestDownloadLinkOfArtifact(t *testing.T) {
+	item := parseTestItem(t, artifactPost)
+	for artifact, expected := range map[string]string{
+		"":              "https://cdn.example.com/UnrealTournament-Client-XAN-3525360-Linux.zip",
+		ArtifactClient:  "https://cdn.example.com/UnrealTournament-Client-XAN-3525360-Linux.zip",
+		ArtifactServer:  "https://cdn.example.com/UnrealTournament-Server-XAN-3525360-Linux.zip",
+		ArtifactEditor:  "https://cdn.example.com/UnrealTournament-Editor-XAN-3525360-Linux.zip",
+		ArtifactSymbols: "https://cdn.example.com/UnrealTournament-Client-XAN-3525360-Linux-Symbols.zip",
+	} {
+		packager := newTestPackager(t, Options{DownloadArtifact: artifact})
+		link, err := packager.extractUpdateDownloadLinkFromPost(item)
+		if err != nil {
+			t.Errorf("%s: %s", artifact, err)
+			continue
+		}
+		if link != expected {
+			t.Errorf("%s: download link is %s, expected %s", artifact, link, expected)
+		}
+	}
+}
+
+func TestDownloadLinkMissingArtifact(t *testing.T) {
+	patterns, err := ParseArtifactPatterns([]string{
+		"client:client-xan",
+		"installer:installer-xan",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	packager := newTestPackager(t, Options{
+		DownloadArtifact: "installer",
+		ArtifactPatterns: patterns,
+	})
+	_, err = packager.extractUpdateDownloadLinkFromPost(parseTestItem(t, artifactPost))
+	if err == nil {
+		t.Fatal("Link of an absent artifact was found")
+	}
+	if !strings.Contains(err.Error(), "installer") {
+		t.Errorf("Error %q doesn't name the artifact", err)
+	}
+}
+
+func TestNewRejectsUnclassifiedArtifact(t *testing.T) {
+	_, err := New("http://localhost/feed", "", tempDir(t), tempDir(t), tempDir(t),
+		Options{DownloadArtifact: "installer"})
+	if err == nil || !strings.Contains(err.Error(), "installer") {
+		t.Errorf("Artifact without a link pattern wasn't rejected, got %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package packager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// AssembleVersion builds a working copy of the version the package at
+// packagePath upgrades to in targetPath, from the installed fromVersion
+// plus the package. Unchanged files are hardlinked from the from-version
+// tree when HardlinkFiles is set
+func (packager *Packager) AssembleVersion(
+	fromVersion string,
+	packagePath string,
+	targetPath string) error {
+	return ApplyPackageOverlay(
+		filepath.Join(packager.releaseDir, fromVersion),
+		packagePath,
+		targetPath,
+		packager.options.HardlinkFiles)
+}
+
+// ApplyPackageOverlay applies the package at packagePath to the install at
+// basePath without changing it. The complete upgraded tree is written to
+// targetPath, which must not exist, with the unchanged files hardlinked
+// from the base when hardlink is set and copied otherwise. Files the
+// package changes are renamed away rather than written to, so the base is
+// never modified through a shared link and can be read-only
+func ApplyPackageOverlay(
+	basePath string,
+	packagePath string,
+	targetPath string,
+	hardlink bool) error {
+	operations, err := ReadPackageOperations(packagePath)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(targetPath); err == nil {
+		return fmt.Errorf("Target '%s' already exists", targetPath)
+	}
+	err = linkTree(basePath, targetPath, hardlink)
+	if err != nil {
+		os.RemoveAll(targetPath)
+		return err
+	}
+	err = applyOperations(packagePath, targetPath, operations)
+	if err != nil {
+		os.RemoveAll(targetPath)
+		return err
+	}
+	log.WithFields(log.Fields{
+		"base":    basePath,
+		"package": packagePath,
+		"target":  targetPath,
+	}).Info("Package applied to overlay")
+	return nil
+}
+
+// linkTree recreates the tree at sourcePath in targetPath, hardlinking
+// the files when hardlink is set and copying them otherwise
+func linkTree(sourcePath string, targetPath string, hardlink bool) error {
+	return filepath.Walk(sourcePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relativePath, err := filepath.Rel(sourcePath, path)
+		if err != nil {
+			return err
+		}
+		destinationPath := filepath.Join(targetPath, relativePath)
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(destinationPath, info.Mode().Perm()|0700)
+		case info.Mode()&os.ModeSymlink != 0:
+			linkTarget, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(linkTarget, destinationPath)
+		default:
+			return linkOrCopyFile(path, destinationPath, hardlink)
+		}
+	})
+}
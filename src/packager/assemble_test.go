@@ -0,0 +1,148 @@
+package packager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAssembleVersionHardlinksUnchangedFiles(t *testing.T) {
+	packager, packagePath := applyFixture(t)
+	packager.options.HardlinkFiles = true
+	fromPath := filepath.Join(packager.releaseDir, "3395761")
+	fromFiles := readTree(t, fromPath)
+	targetPath := filepath.Join(tempDir(t), "3525360")
+
+	err := packager.AssembleVersion("3395761", packagePath, targetPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assembled := readTree(t, targetPath)
+	expected := readTree(t, filepath.Join(packager.releaseDir, "3525360"))
+	if !reflect.DeepEqual(assembled, expected) {
+		t.Errorf("Assembled version is %v, expected %v", assembled, expected)
+	}
+
+	keptPath := "UnrealTournament/Content/Kept.txt"
+	fromInfo, err := os.Stat(filepath.Join(fromPath, keptPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assembledInfo, err := os.Stat(filepath.Join(targetPath, keptPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(fromInfo, assembledInfo) {
+		t.Error("Unchanged file wasn't hardlinked")
+	}
+	// Replacing the linked files must leave the from-version alone
+	if files := readTree(t, fromPath); !reflect.DeepEqual(files, fromFiles) {
+		t.Errorf("From-version changed to %v, expected %v", files, fromFiles)
+	}
+}
+
+func TestAssembleVersionCopiesWithoutHardlinks(t *testing.T) {
+	packager, packagePath := applyFixture(t)
+	targetPath := filepath.Join(tempDir(t), "3525360")
+
+	err := packager.AssembleVersion("3395761", packagePath, targetPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keptPath := "UnrealTournament/Content/Kept.txt"
+	fromInfo, err := os.Stat(filepath.Join(packager.releaseDir, "3395761", keptPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assembledInfo, err := os.Stat(filepath.Join(targetPath, keptPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if os.SameFile(fromInfo, assembledInfo) {
+		t.Error("File was hardlinked with HardlinkFiles off")
+	}
+}
+
+func TestStageFileReplacesExistingLink(t *testing.T) {
+	dir := tempDir(t)
+	sourcePath := filepath.Join(dir, "release.txt")
+	destinationPath := filepath.Join(dir, "staged.txt")
+	err := ioutil.WriteFile(sourcePath, []byte("release"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packager := &Packager{options: Options{HardlinkFiles: true}}
+	for i := 0; i < 2; i++ {
+		// The second run finds the link kept from the first
+		err = packager.stageFile(sourcePath, destinationPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	content, err := ioutil.ReadFile(sourcePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "release" {
+		t.Errorf("Release file is %q after restaging", content)
+	}
+
+	// Without hardlinks a copy doesn't write through the kept link either
+	packager.options.HardlinkFiles = false
+	err = packager.stageFile(sourcePath, destinationPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err = ioutil.ReadFile(sourcePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "release" {
+		t.Errorf("Release file is %q after copying", content)
+	}
+}
+
+func TestApplyPackageOverlayOverReadOnlyBase(t *testing.T) {
+	packager, packagePath := applyFixture(t)
+	basePath := filepath.Join(tempDir(t), "base")
+	copyTree(t, filepath.Join(packager.releaseDir, "3395761"), basePath)
+	baseFiles := readTree(t, basePath)
+	setTreeMode := func(fileMode os.FileMode, dirMode os.FileMode) {
+		err := filepath.Walk(basePath, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return os.Chmod(path, dirMode)
+			}
+			return os.Chmod(path, fileMode)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	setTreeMode(0444, 0555)
+	defer setTreeMode(0644, 0755)
+	targetPath := filepath.Join(tempDir(t), "3525360")
+
+	err := ApplyPackageOverlay(basePath, packagePath, targetPath, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assembled := readTree(t, targetPath)
+	expected := readTree(t, filepath.Join(packager.releaseDir, "3525360"))
+	if !reflect.DeepEqual(assembled, expected) {
+		t.Errorf("Overlay is %v, expected %v", assembled, expected)
+	}
+	if files := readTree(t, basePath); !reflect.DeepEqual(files, baseFiles) {
+		t.Errorf("Base changed to %v, expected %v", files, baseFiles)
+	}
+
+	// The target must not exist yet
+	err = ApplyPackageOverlay(basePath, packagePath, targetPath, true)
+	if err == nil {
+		t.Error("Applying over an existing target didn't fail")
+	}
+}
@@ -0,0 +1,111 @@
+package packager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/donovansolms/ut4-update-packager/src/packager/models"
+)
+
+// DriftReport lists the differences between the recorded hashes of a
+// version and its files on disk
+type DriftReport struct {
+	Version string
+	// Source is where the recorded hashes came from, database or cache
+	Source string
+	// Modified files have a different hash on disk
+	Modified []string
+	// Missing files are recorded but no longer on disk
+	Missing []string
+	// Extra files are on disk but not recorded
+	Extra []string
+}
+
+// HasDrift checks if the report found any differences
+func (report DriftReport) HasDrift() bool {
+	return len(report.Modified) > 0 || len(report.Missing) > 0 ||
+		len(report.Extra) > 0
+}
+
+// AuditVersion compares the recorded hashes of version with freshly
+// computed hashes of its files. The hashes stored in the database are
+// used when available, otherwise the hash cache
+func (packager *Packager) AuditVersion(version string) (DriftReport, error) {
+	report := DriftReport{Version: version}
+	recorded, source, err := packager.recordedHashes(version)
+	if err != nil {
+		return report, err
+	}
+	report.Source = source
+	current, err := packager.generateHashes(
+		filepath.Join(packager.releaseDir, version))
+	if err != nil {
+		return report, err
+	}
+	for path, hash := range recorded {
+		currentHash, ok := current[path]
+		if !ok {
+			report.Missing = append(report.Missing, path)
+		} else if currentHash != hash {
+			report.Modified = append(report.Modified, path)
+		}
+	}
+	for path := range current {
+		if _, ok := recorded[path]; !ok {
+			report.Extra = append(report.Extra, path)
+		}
+	}
+	sort.Strings(report.Modified)
+	sort.Strings(report.Missing)
+	sort.Strings(report.Extra)
+	return report, nil
+}
+
+// recordedHashes returns the hashes stored for version in the database,
+// falling back to the hash cache
+func (packager *Packager) recordedHashes(
+	version string) (map[string]string, string, error) {
+	hashes, source, err := packager.findRecordedHashes(version)
+	if err != nil {
+		return nil, "", err
+	}
+	if hashes == nil {
+		return nil, "", fmt.Errorf("No recorded hashes for version %s", version)
+	}
+	return hashes, source, nil
+}
+
+// findRecordedHashes is recordedHashes returning nil hashes when nothing
+// was recorded for version
+func (packager *Packager) findRecordedHashes(
+	version string) (map[string]string, string, error) {
+	hashes := make(map[string]string)
+	if packager.options.StoreFileHashes {
+		db, err := packager.openDB()
+		if err != nil {
+			return nil, "", err
+		}
+		defer db.Close()
+		var fileHashes []models.Ut4FileHashes
+		query := db.Where("version = ?", version).Find(&fileHashes)
+		if query.Error != nil {
+			return nil, "", query.Error
+		}
+		for _, fileHash := range fileHashes {
+			hashes[fileHash.Path] = fileHash.Hash
+		}
+		if len(hashes) > 0 {
+			return hashes, "database", nil
+		}
+	}
+	hashes, err := packager.readHashCache(version)
+	if os.IsNotExist(err) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return hashes, "cache", nil
+}
@@ -0,0 +1,77 @@
+package packager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAuditVersionReportsDrift(t *testing.T) {
+	for _, storeFileHashes := range []bool{false, true} {
+		fixture := newFixture(t)
+		fixture.installVersion(3525360, map[string]string{
+			"UnrealTournament/Config/Default.ini":  "setting=1",
+			"UnrealTournament/Content/Removed.txt": "removed",
+		})
+		packager := fixture.newPackager(Options{StoreFileHashes: storeFileHashes})
+		_, err := packager.getVersionHashes("3525360")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		report, err := packager.AuditVersion("3525360")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.HasDrift() {
+			t.Errorf("Untouched version has drift: %+v", report)
+		}
+
+		versionDir := filepath.Join(fixture.releaseDir, "3525360")
+		writeTree(t, versionDir, map[string]string{
+			"UnrealTournament/Config/Default.ini": "tampered",
+			"UnrealTournament/Content/Extra.txt":  "extra",
+		})
+		err = os.Remove(filepath.Join(versionDir, "UnrealTournament/Content/Removed.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		report, err = packager.AuditVersion("3525360")
+		if err != nil {
+			t.Fatal(err)
+		}
+		source := "cache"
+		if storeFileHashes {
+			source = "database"
+		}
+		expected := DriftReport{
+			Version:  "3525360",
+			Source:   source,
+			Modified: []string{"UnrealTournament/Config/Default.ini"},
+			Missing:  []string{"UnrealTournament/Content/Removed.txt"},
+			Extra:    []string{"UnrealTournament/Content/Extra.txt"},
+		}
+		if !reflect.DeepEqual(report, expected) {
+			t.Errorf("Report is %+v, expected %+v", report, expected)
+		}
+	}
+}
+
+func TestAuditVersionWithoutRecordedHashes(t *testing.T) {
+	packager := newTestPackager(t, Options{})
+	err := os.MkdirAll(filepath.Join(packager.releaseDir, "3525360"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(
+		filepath.Join(packager.releaseDir, "3525360", "file.txt"), []byte("x"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = packager.AuditVersion("3525360")
+	if err == nil {
+		t.Error("Auditing a version without recorded hashes didn't fail")
+	}
+}
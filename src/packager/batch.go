@@ -0,0 +1,59 @@
+package packager
+
+import (
+	"github.com/donovansolms/ut4-update-packager/src/packager/models"
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+)
+
+// packageBatch collects upgrade package rows and writes them in
+// transactions of size rows. A size of 0 saves every row immediately.
+// Rows that exist already are skipped
+type packageBatch struct {
+	db      *gorm.DB
+	size    int
+	pending []models.Ut4UpdatePackages
+}
+
+// newPackageBatch creates a batch writing to db in transactions of size
+func newPackageBatch(db *gorm.DB, size int) *packageBatch {
+	return &packageBatch{db: db, size: size}
+}
+
+// add queues updatePackage and writes the batch once it is full
+func (batch *packageBatch) add(updatePackage models.Ut4UpdatePackages) error {
+	if batch.size <= 0 {
+		return savePackageOnce(batch.db, updatePackage)
+	}
+	batch.pending = append(batch.pending, updatePackage)
+	if len(batch.pending) >= batch.size {
+		return batch.flush()
+	}
+	return nil
+}
+
+// flush writes the queued rows in a single transaction, none of them are
+// written when one fails
+func (batch *packageBatch) flush() error {
+	if len(batch.pending) == 0 {
+		return nil
+	}
+	tx := batch.db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	for _, updatePackage := range batch.pending {
+		err := savePackageOnce(tx, updatePackage)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	err := tx.Commit().Error
+	if err != nil {
+		return err
+	}
+	log.WithField("rows", len(batch.pending)).Debug("Upgrade packages written")
+	batch.pending = nil
+	return nil
+}
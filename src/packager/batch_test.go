@@ -0,0 +1,66 @@
+package packager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/donovansolms/ut4-update-packager/src/packager/models"
+)
+
+// batchPackage is an update package row from fromVersion to 3525360
+func batchPackage(fromVersion string) models.Ut4UpdatePackages {
+	return models.Ut4UpdatePackages{
+		FromVersion: fromVersion,
+		ToVersion:   "3525360",
+		Channel:     ChannelStable,
+		DateCreated: time.Now(),
+	}
+}
+
+func TestPackageBatchWritesInOneTransaction(t *testing.T) {
+	fixture := newFixture(t)
+	fixture.newPackager(Options{})
+	db := fixture.db()
+	countRows := func() int {
+		var count int
+		db.Table("ut4_update_packages").Count(&count)
+		return count
+	}
+
+	batch := newPackageBatch(db, 3)
+	for _, fromVersion := range []string{"3395761", "3420000"} {
+		err := batch.add(batchPackage(fromVersion))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if count := countRows(); count != 0 {
+		t.Fatalf("%d rows written before the batch was flushed", count)
+	}
+	err := batch.flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := countRows(); count != 2 {
+		t.Fatalf("%d rows written, expected 2", count)
+	}
+
+	// A failing row rolls back the rows before it in the batch
+	err = db.Exec("CREATE TRIGGER fail_insert BEFORE INSERT ON ut4_update_packages " +
+		"WHEN NEW.from_version = 'fail' BEGIN SELECT RAISE(ABORT, 'induced'); END").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch = newPackageBatch(db, 2)
+	err = batch.add(batchPackage("3450000"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = batch.add(batchPackage("fail"))
+	if err == nil {
+		t.Fatal("Batch with a failing row was written")
+	}
+	if count := countRows(); count != 2 {
+		t.Errorf("%d rows after the rollback, expected 2", count)
+	}
+}
@@ -0,0 +1,59 @@
+package packager
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// CaseCollisionWarn logs a warning for paths that only differ by case
+	CaseCollisionWarn = "warn"
+	// CaseCollisionFail fails hashing for paths that only differ by case
+	CaseCollisionFail = "fail"
+)
+
+// findCaseCollisions returns the groups of paths that differ only by case
+// and would collide on a case-insensitive filesystem
+func findCaseCollisions(paths []string) [][]string {
+	byLowerPath := make(map[string][]string)
+	for _, path := range paths {
+		lowerPath := strings.ToLower(path)
+		byLowerPath[lowerPath] = append(byLowerPath[lowerPath], path)
+	}
+	var collisions [][]string
+	for _, group := range byLowerPath {
+		if len(group) > 1 {
+			sort.Strings(group)
+			collisions = append(collisions, group)
+		}
+	}
+	sort.Slice(collisions, func(i, j int) bool {
+		return collisions[i][0] < collisions[j][0]
+	})
+	return collisions
+}
+
+// checkCaseCollisions logs or returns an error for the paths of
+// searchPath that differ only by case, depending on the configuration
+func (packager *Packager) checkCaseCollisions(
+	searchPath string,
+	paths []string) error {
+	collisions := findCaseCollisions(paths)
+	if len(collisions) == 0 {
+		return nil
+	}
+	for _, group := range collisions {
+		log.WithFields(log.Fields{
+			"path":  searchPath,
+			"files": strings.Join(group, ", "),
+		}).Warning("Files only differ by case")
+	}
+	if packager.options.CaseCollisions == CaseCollisionFail {
+		return fmt.Errorf(
+			"%d file(s) in %s only differ by case", len(collisions), searchPath)
+	}
+	return nil
+}
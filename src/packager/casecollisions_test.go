@@ -0,0 +1,46 @@
+package packager
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindCaseCollisions(t *testing.T) {
+	collisions := findCaseCollisions([]string{
+		"UnrealTournament/Config/Default.ini",
+		"UnrealTournament/Content/Map.umap",
+		"UnrealTournament/Content/map.umap",
+		"UnrealTournament/Content/Other.umap",
+	})
+	expected := [][]string{
+		{"UnrealTournament/Content/Map.umap", "UnrealTournament/Content/map.umap"},
+	}
+	if !reflect.DeepEqual(collisions, expected) {
+		t.Errorf("Collisions are %v, expected %v", collisions, expected)
+	}
+}
+
+func TestGenerateHashesDetectsCaseCollisions(t *testing.T) {
+	files := map[string]string{
+		"UnrealTournament/Content/Map.umap": "upper",
+		"UnrealTournament/Content/map.umap": "lower",
+	}
+	dir := tempDir(t)
+	writeTree(t, dir, files)
+
+	// Warnings still hash every file
+	packager := newTestPackager(t, Options{})
+	hashes, err := packager.generateHashes(dir)
+	if err != nil {
+		t.Fatalf("Case collisions failed with warn: %s", err)
+	}
+	if len(hashes) != 2 {
+		t.Errorf("Hashed %d files, expected 2", len(hashes))
+	}
+
+	packager = newTestPackager(t, Options{CaseCollisions: CaseCollisionFail})
+	_, err = packager.generateHashes(dir)
+	if err == nil {
+		t.Error("Case collisions passed with fail")
+	}
+}
@@ -0,0 +1,141 @@
+package packager
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/donovansolms/ut4-update-packager/src/packager/models"
+)
+
+// ChainAudit is the upgrade chain of an installed version to the latest
+// version with the problems found in its packages
+type ChainAudit struct {
+	UpgradePath
+	// Problems is empty when every package of the chain is usable
+	Problems []string
+}
+
+// Broken checks if the chain can't take a client to the latest version
+func (audit ChainAudit) Broken() bool {
+	return audit.Error != "" || len(audit.Problems) > 0
+}
+
+// AuditChains resolves the upgrade chain of every installed version to the
+// latest version of the configured channel and scope and checks that each
+// package of the chain exists in the package dir, has the recorded size
+// and matches its hash
+func (packager *Packager) AuditChains() ([]ChainAudit, error) {
+	versions, err := packager.GetVersionList()
+	if err != nil {
+		return nil, err
+	}
+	paths, err := packager.ResolveUpgradePaths(versions, packager.options.Channel)
+	if err != nil {
+		return nil, err
+	}
+	// Chains share packages, check each one once
+	checked := make(map[uint32]string)
+	audits := make([]ChainAudit, 0, len(paths))
+	for _, upgradePath := range paths {
+		audit := ChainAudit{UpgradePath: upgradePath}
+		for _, updatePackage := range upgradePath.Packages {
+			problem, ok := checked[updatePackage.ID]
+			if !ok {
+				problem = packager.packageProblem(updatePackage)
+				checked[updatePackage.ID] = problem
+			}
+			if problem != "" {
+				audit.Problems = append(audit.Problems, fmt.Sprintf("%s to %s: %s",
+					templateFromVersion(updatePackage.FromVersion),
+					updatePackage.ToVersion,
+					problem))
+			}
+		}
+		audits = append(audits, audit)
+	}
+	return audits, nil
+}
+
+// packageProblem describes what is wrong with the local file of
+// updatePackage, or returns an empty string when it is usable
+func (packager *Packager) packageProblem(updatePackage models.Ut4UpdatePackages) string {
+	packagePath, err := packager.findLocalPackage(
+		updatePackage.FromVersion,
+		updatePackage.ToVersion)
+	namedAfterPair := err == nil
+	if err != nil && updatePackage.DeltaHash != "" {
+		// Shared packages are named after the pair they were built for,
+		// the URL still ends in their name
+		packagePath, err = packager.packagePathFromURL(updatePackage.UpdateURL)
+	}
+	if err != nil {
+		return err.Error()
+	}
+	fileInfo, err := os.Stat(packagePath)
+	if err != nil {
+		return err.Error()
+	}
+	if updatePackage.Size > 0 && fileInfo.Size() != updatePackage.Size {
+		return fmt.Sprintf("size is %d bytes, %d recorded",
+			fileInfo.Size(), updatePackage.Size)
+	}
+	packageHash, err := hashFile(packagePath)
+	if err != nil {
+		return err.Error()
+	}
+	// The hash is known from the package name or the signed manifest
+	if namedAfterPair &&
+		strings.Contains(packager.options.PackageNameTemplate, "{hash}") {
+		expectedName := RenderTemplate(
+			packager.options.PackageNameTemplate,
+			TemplateValues{
+				FromVersion: templateFromVersion(updatePackage.FromVersion),
+				ToVersion:   updatePackage.ToVersion,
+				Platform:    packagePlatform,
+				Hash:        packageHash,
+			})
+		if filepath.Base(expectedName) != filepath.Base(packagePath) {
+			return "hash doesn't match the package name"
+		}
+	}
+	if packager.signingKey != nil {
+		err = VerifySignature(
+			packagePath,
+			packager.signingKey.Public().(ed25519.PublicKey))
+		if err != nil {
+			return err.Error()
+		}
+	} else if signedBytes, err := ioutil.ReadFile(packagePath + signatureSuffix); err == nil {
+		var signed SignedManifest
+		var manifest PackageManifest
+		if json.Unmarshal(signedBytes, &signed) != nil ||
+			json.Unmarshal(signed.Manifest, &manifest) != nil {
+			return "signed manifest is corrupt"
+		}
+		if manifest.PackageHash != packageHash {
+			return "package doesn't match the signed manifest"
+		}
+	}
+	return ""
+}
+
+// packagePathFromURL returns the file in the package dir named like the
+// last element of updateURL
+func (packager *Packager) packagePathFromURL(updateURL string) (string, error) {
+	parsedURL, err := url.Parse(updateURL)
+	if err != nil {
+		return "", err
+	}
+	name := path.Base(parsedURL.Path)
+	if name == "." || name == "/" {
+		return "", fmt.Errorf("No package name in URL '%s'", updateURL)
+	}
+	return filepath.Join(packager.packageDir, name), nil
+}
@@ -0,0 +1,57 @@
+package packager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAuditChainsReportsMissingPackage(t *testing.T) {
+	packager := newTestPackager(t, Options{})
+	for i, changelist := range []int{3395761, 3450000, 3525360} {
+		installTestVersion(t, packager, changelist, map[string]string{
+			"UnrealTournament/Config/Default.ini": fmt.Sprintf("setting=%d", i),
+		})
+	}
+	for _, pair := range []VersionPair{
+		{FromVersion: "3395761", ToVersion: "3450000"},
+		{FromVersion: "3450000", ToVersion: "3525360"},
+	} {
+		_, err := packager.GeneratePackage(pair.FromVersion, pair.ToVersion)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	audits, err := packager.AuditChains()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, audit := range audits {
+		if audit.Broken() {
+			t.Errorf("Chain from %s is broken: %v %v",
+				audit.FromVersion, audit.Error, audit.Problems)
+		}
+	}
+
+	// The intermediate package goes missing
+	err = os.Remove(filepath.Join(packager.packageDir, "3395761-3450000.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	audits, err = packager.AuditChains()
+	if err != nil {
+		t.Fatal(err)
+	}
+	broken := make(map[string]bool)
+	for _, audit := range audits {
+		broken[audit.FromVersion] = audit.Broken()
+	}
+	if !broken["3395761"] {
+		t.Error("Chain through the missing package wasn't reported")
+	}
+	if broken["3450000"] {
+		t.Error("Chain without the missing package was reported")
+	}
+}
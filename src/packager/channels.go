@@ -0,0 +1,44 @@
+package packager
+
+import (
+	"strings"
+
+	"github.com/donovansolms/ut4-update-packager/src/packager/models"
+)
+
+// releaseChannel returns the channel for the release being processed.
+// Posts whose title contains a beta keyword go to ChannelBeta, everything
+// else goes to the configured channel
+func (packager *Packager) releaseChannel() string {
+	if packager.releasePost != nil {
+		title := strings.ToLower(packager.releasePost.Title)
+		for _, keyword := range packager.options.BetaKeywords {
+			if keyword != "" && strings.Contains(title, strings.ToLower(keyword)) {
+				return ChannelBeta
+			}
+		}
+	}
+	return packager.options.Channel
+}
+
+// FindUpgradePackages returns the upgrade packages from fromVersion that
+// are available in channel
+func (packager *Packager) FindUpgradePackages(
+	fromVersion string,
+	channel string) ([]models.Ut4UpdatePackages, error) {
+	db, err := packager.openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var updatePackages []models.Ut4UpdatePackages
+	query := db.Where("from_version = ? AND channel = ? AND is_deleted = 0",
+		fromVersion,
+		channel,
+	).Find(&updatePackages)
+	if query.Error != nil {
+		return nil, query.Error
+	}
+	return updatePackages, nil
+}
@@ -0,0 +1,68 @@
+package packager
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBetaPackageIsNotReturnedToStableClients(t *testing.T) {
+	fixture := newFixture(t)
+	fixture.installVersion(3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+	})
+	downloadURL := fixture.serveRelease(3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+	})
+	fixture.addPost("UT Release 3525360 Beta", "post-3525360", downloadURL, time.Now())
+	packager := fixture.newPackager(Options{BetaKeywords: []string{"beta"}})
+	result, err := packager.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Packages) != 1 {
+		t.Fatalf("Run packaged %v", result.Packages)
+	}
+
+	stablePackages, err := packager.FindUpgradePackages("3395761", ChannelStable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stablePackages) != 0 {
+		t.Errorf("Beta package returned to a stable client: %+v", stablePackages)
+	}
+	betaPackages, err := packager.FindUpgradePackages("3395761", ChannelBeta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(betaPackages) != 1 || betaPackages[0].ToVersion != "3525360" {
+		t.Errorf("Beta packages are %+v", betaPackages)
+	}
+}
+
+func TestRunResetsReleasePost(t *testing.T) {
+	fixture := newFixture(t)
+	fixture.installVersion(3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+	})
+	downloadURL := fixture.serveRelease(3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+	})
+	fixture.addPost("UT Release 3525360 Beta", "post-3525360", downloadURL, time.Now())
+	packager := fixture.newPackager(Options{BetaKeywords: []string{"beta"}})
+	_, err := packager.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packager.releaseChannel() != ChannelBeta {
+		t.Fatalf("Channel of the beta run is %s", packager.releaseChannel())
+	}
+
+	// Nothing new, the beta post no longer applies
+	_, err = packager.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packager.releaseChannel() != ChannelStable {
+		t.Errorf("Channel after a run without a post is %s", packager.releaseChannel())
+	}
+}
@@ -0,0 +1,91 @@
+package packager
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// checkpointFilename records the files already staged in a package
+// staging dir. It is removed before the package is archived
+const checkpointFilename = ".checkpoint"
+
+// packageCheckpoint tracks which files have been staged for a package so
+// an interrupted packaging attempt can resume where it stopped
+type packageCheckpoint struct {
+	path   string
+	staged map[string]string
+	file   *os.File
+}
+
+// openPackageCheckpoint loads the checkpoint in stagingPath, creating it
+// when it doesn't exist
+func openPackageCheckpoint(stagingPath string) (*packageCheckpoint, error) {
+	checkpoint := &packageCheckpoint{
+		path:   filepath.Join(stagingPath, checkpointFilename),
+		staged: make(map[string]string),
+	}
+	existing, err := os.Open(checkpoint.path)
+	if err == nil {
+		scanner := bufio.NewScanner(existing)
+		for scanner.Scan() {
+			parts := strings.SplitN(scanner.Text(), "\t", 2)
+			if len(parts) == 2 {
+				checkpoint.staged[parts[1]] = parts[0]
+			}
+		}
+		existing.Close()
+		if scanner.Err() != nil {
+			return nil, scanner.Err()
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	checkpoint.file, err = os.OpenFile(
+		checkpoint.path,
+		os.O_APPEND|os.O_WRONLY|os.O_CREATE,
+		0644)
+	if err != nil {
+		return nil, err
+	}
+	return checkpoint, nil
+}
+
+// isStaged checks if filename was staged with the given hash
+func (checkpoint *packageCheckpoint) isStaged(filename string, hash string) bool {
+	stagedHash, ok := checkpoint.staged[filename]
+	return ok && stagedHash == hash
+}
+
+// markStaged records filename as staged with hash
+func (checkpoint *packageCheckpoint) markStaged(filename string, hash string) error {
+	checkpoint.staged[filename] = hash
+	_, err := fmt.Fprintf(checkpoint.file, "%s\t%s\n", hash, filename)
+	if err != nil {
+		return err
+	}
+	return checkpoint.file.Sync()
+}
+
+// finish closes and removes the checkpoint and deletes staged files that
+// are no longer part of the package
+func (checkpoint *packageCheckpoint) finish(
+	stagingPath string,
+	expected map[string]bool) error {
+	checkpoint.file.Close()
+	err := os.Remove(checkpoint.path)
+	if err != nil {
+		return err
+	}
+	for filename := range checkpoint.staged {
+		if !expected[filename] {
+			err = os.Remove(filepath.Join(stagingPath, filename))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
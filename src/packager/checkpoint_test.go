@@ -0,0 +1,97 @@
+package packager
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestResumedPackagingSkipsStagedFiles(t *testing.T) {
+	packager := newTestPackager(t, Options{ResumePackaging: true})
+	installTestVersion(t, packager, 3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+	})
+	installTestVersion(t, packager, 3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+		"UnrealTournament/Content/First.txt":  "first",
+		"UnrealTournament/Content/Second.txt": "second",
+	})
+	toHashes, err := packager.getVersionHashes("3525360")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An interrupted attempt staged and checkpointed the first file, left
+	// the second half written and staged a file that's no longer needed
+	stagingPath := filepath.Join(packager.workingDir, "3395761-3525360-package")
+	writeTree(t, stagingPath, map[string]string{
+		"UnrealTournament/Content/Second.txt": "sec",
+		"UnrealTournament/Content/Stale.txt":  "stale",
+	})
+	checkpoint, err := openPackageCheckpoint(stagingPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstPath := "UnrealTournament/Content/First.txt"
+	err = packager.stageFile(
+		filepath.Join(packager.releaseDir, "3525360", firstPath),
+		filepath.Join(stagingPath, firstPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = checkpoint.markStaged(firstPath, toHashes[firstPath])
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = checkpoint.markStaged("UnrealTournament/Content/Stale.txt", "stale")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkpoint.file.Close()
+	// A checkpointed file that is copied again gets a new modification time
+	staged := time.Now().Add(-time.Hour).Truncate(time.Second)
+	err = os.Chtimes(filepath.Join(stagingPath, firstPath), staged, staged)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stagedPackage, _, err := packager.stageUpgradePath("3395761", "3525360")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileInfo, err := os.Stat(filepath.Join(stagedPackage.dir, firstPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fileInfo.ModTime().Equal(staged) {
+		t.Error("Checkpointed file was staged again")
+	}
+	stagedFiles := readTree(t, stagedPackage.dir)
+	delete(stagedFiles, operationsFilename)
+	expected := releaseFiles(3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+		"UnrealTournament/Content/First.txt":  "first",
+		"UnrealTournament/Content/Second.txt": "second",
+	})
+	// The unchanged binary isn't part of the delta
+	delete(expected, modulesBinaryDir+"/libUE4-UnrealTournament.so")
+	if !reflect.DeepEqual(stagedFiles, expected) {
+		t.Errorf("Staged files are %v, expected %v", stagedFiles, expected)
+	}
+
+	// The resumed staging dir packages like a fresh one
+	_, err = packager.GeneratePackage("3395761", "3525360")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := readPackage(t, filepath.Join(packager.packageDir, "3395761-3525360.tar.gz"))
+	delete(files, operationsFilename)
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("Package holds %v, expected %v", files, expected)
+	}
+	if _, ok := stagedFiles[checkpointFilename]; ok {
+		t.Error("Checkpoint is in the staging dir")
+	}
+}
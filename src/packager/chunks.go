@@ -0,0 +1,357 @@
+package packager
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// chunksFilename is the package entry mapping files to their chunks
+	chunksFilename = "chunks.json"
+	// chunkDirName is the directory in the package dir holding all chunks
+	chunkDirName = "chunks"
+	// chunkRefsSuffix is appended to the package path for the sidecar
+	// listing the chunks of a package, retention keeps the chunks listed
+	// in the sidecars of the remaining packages
+	chunkRefsSuffix = ".chunks.json"
+	// chunkURLSuffix is appended to the chunk path for the file holding
+	// the URL the chunk was uploaded to
+	chunkURLSuffix = ".url"
+
+	// Chunk sizes are tuned for the large UT4 binaries and paks
+	chunkMinSize = 256 * 1024
+	chunkAvgSize = 1024 * 1024
+	chunkMaxSize = 4 * 1024 * 1024
+
+	// chunkMaskSmall is used before the average size is reached and makes a
+	// cut less likely, chunkMaskLarge after it and makes a cut more likely.
+	// The masks use the high bits of the gear hash since they depend on
+	// the most input bytes
+	chunkMaskSmall = uint64((1<<22)-1) << (64 - 22)
+	chunkMaskLarge = uint64((1<<18)-1) << (64 - 18)
+)
+
+// gearTable holds the per-byte values for the gear rolling hash. It is
+// generated from a fixed seed so chunk boundaries never change between runs
+var gearTable = func() [256]uint64 {
+	var table [256]uint64
+	// splitmix64
+	seed := uint64(0x5554342d6364632d)
+	for i := range table {
+		seed += 0x9e3779b97f4a7c15
+		value := seed
+		value = (value ^ (value >> 30)) * 0xbf58476d1ce4e5b9
+		value = (value ^ (value >> 27)) * 0x94d049bb133111eb
+		table[i] = value ^ (value >> 31)
+	}
+	return table
+}()
+
+// ChunkStore stores content-defined chunks by their SHA256 hash so
+// identical chunks across files and versions are only stored once
+type ChunkStore struct {
+	dir string
+}
+
+// NewChunkStore creates a chunk store in dir
+func NewChunkStore(dir string) (*ChunkStore, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &ChunkStore{dir: dir}, nil
+}
+
+// chunkPath returns the path for chunk ID
+func (store *ChunkStore) chunkPath(id string) string {
+	return filepath.Join(store.dir, id[:2], id)
+}
+
+// StoreFile splits the file at path into chunks, stores any chunks not yet
+// in the store and returns the chunk IDs in order along with the number
+// of chunks that were newly stored
+func (store *ChunkStore) StoreFile(path string) ([]string, int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	var ids []string
+	var stored int
+	reader := bufio.NewReaderSize(file, 1024*1024)
+	chunk := bytes.NewBuffer(make([]byte, 0, chunkMaxSize))
+	var hash uint64
+	for {
+		b, err := reader.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		chunk.WriteByte(b)
+		hash = (hash << 1) + gearTable[b]
+
+		size := chunk.Len()
+		if size < chunkMinSize {
+			continue
+		}
+		mask := chunkMaskLarge
+		if size < chunkAvgSize {
+			mask = chunkMaskSmall
+		}
+		if hash&mask == 0 || size >= chunkMaxSize {
+			id, isNew, err := store.storeChunk(chunk.Bytes())
+			if err != nil {
+				return nil, 0, err
+			}
+			if isNew {
+				stored++
+			}
+			ids = append(ids, id)
+			chunk.Reset()
+			hash = 0
+		}
+	}
+	if chunk.Len() > 0 {
+		id, isNew, err := store.storeChunk(chunk.Bytes())
+		if err != nil {
+			return nil, 0, err
+		}
+		if isNew {
+			stored++
+		}
+		ids = append(ids, id)
+	}
+	return ids, stored, nil
+}
+
+// storeChunk writes data to the store unless a chunk with the same hash
+// exists already. It returns the chunk ID and whether it was newly stored
+func (store *ChunkStore) storeChunk(data []byte) (string, bool, error) {
+	id := fmt.Sprintf("%x", sha256.Sum256(data))
+	chunkPath := store.chunkPath(id)
+	if _, err := os.Stat(chunkPath); err == nil {
+		return id, false, nil
+	}
+	err := os.MkdirAll(filepath.Dir(chunkPath), 0755)
+	if err != nil {
+		return id, false, err
+	}
+	err = ioutil.WriteFile(chunkPath+".tmp", data, 0644)
+	if err != nil {
+		return id, false, err
+	}
+	err = os.Rename(chunkPath+".tmp", chunkPath)
+	if err != nil {
+		return id, false, err
+	}
+	return id, true, nil
+}
+
+// ReassembleFile writes the chunks to destination in order, verifying
+// each chunk's hash along the way
+func (store *ChunkStore) ReassembleFile(ids []string, destination string) error {
+	err := os.MkdirAll(filepath.Dir(destination), 0755)
+	if err != nil {
+		return err
+	}
+	output, err := os.Create(destination)
+	if err != nil {
+		return err
+	}
+	defer output.Close()
+	for _, id := range ids {
+		data, err := ioutil.ReadFile(store.chunkPath(id))
+		if err != nil {
+			return err
+		}
+		if fmt.Sprintf("%x", sha256.Sum256(data)) != id {
+			return fmt.Errorf("Chunk %s is corrupt", id)
+		}
+		_, err = output.Write(data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReassembleFiles rebuilds every file listed in a package's chunks.json
+// into outputDir
+func (store *ChunkStore) ReassembleFiles(
+	chunksManifestPath string,
+	outputDir string) error {
+	manifest, err := readChunkManifest(chunksManifestPath)
+	if err != nil {
+		return err
+	}
+	for filename, ids := range manifest {
+		err = store.ReassembleFile(ids, filepath.Join(outputDir, filename))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readChunkManifest reads a chunks.json mapping files to their chunks
+func readChunkManifest(manifestPath string) (map[string][]string, error) {
+	content, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	var manifest map[string][]string
+	err = json.Unmarshal(content, &manifest)
+	return manifest, err
+}
+
+// publishChunks writes the chunk sidecar of the package at packagePath
+// from its chunks.json at manifestPath and uploads the chunks that weren't
+// uploaded yet. The default uploader serves chunks from the package dir
+// so nothing is uploaded with it
+func (packager *Packager) publishChunks(
+	manifestPath string,
+	packagePath string) error {
+	manifest, err := readChunkManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+	manifestBytes, err := json.Marshal(&manifest)
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomic(packagePath+chunkRefsSuffix, manifestBytes)
+	if err != nil {
+		return err
+	}
+	if _, ok := packager.options.Uploader.(*templateUploader); ok {
+		return nil
+	}
+
+	store := &ChunkStore{dir: filepath.Join(packager.packageDir, chunkDirName)}
+	ids := make(map[string]bool)
+	for _, fileIDs := range manifest {
+		for _, id := range fileIDs {
+			ids[id] = true
+		}
+	}
+	uploaded := 0
+	for id := range ids {
+		urlPath := store.chunkPath(id) + chunkURLSuffix
+		if _, err := os.Stat(urlPath); err == nil {
+			continue
+		}
+		chunkURL, err := packager.uploadFile(
+			store.chunkPath(id),
+			TemplateValues{Platform: packagePlatform, Hash: id})
+		if err != nil {
+			return err
+		}
+		err = writeFileAtomic(urlPath, []byte(chunkURL))
+		if err != nil {
+			return err
+		}
+		uploaded++
+	}
+	log.WithFields(log.Fields{
+		"chunks":   len(ids),
+		"uploaded": uploaded,
+	}).Info("Chunks published")
+	return nil
+}
+
+// pruneChunks removes the chunks that no package in the package dir lists
+// in its chunk sidecar anymore, from storage as well when the Uploader is
+// a PackageRemover. Returns the number of removed chunks
+func (packager *Packager) pruneChunks() (int, error) {
+	chunkDir := filepath.Join(packager.packageDir, chunkDirName)
+	if _, err := os.Stat(chunkDir); os.IsNotExist(err) {
+		return 0, nil
+	}
+	referenced := make(map[string]bool)
+	err := filepath.Walk(packager.packageDir, func(
+		path string,
+		fileInfo os.FileInfo,
+		err error) error {
+		if err != nil {
+			return err
+		}
+		if fileInfo.IsDir() && path == chunkDir {
+			return filepath.SkipDir
+		}
+		if fileInfo.IsDir() || !strings.HasSuffix(path, chunkRefsSuffix) {
+			return nil
+		}
+		manifest, err := readChunkManifest(path)
+		if err != nil {
+			return err
+		}
+		for _, ids := range manifest {
+			for _, id := range ids {
+				referenced[id] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var unreferenced []string
+	err = filepath.Walk(chunkDir, func(
+		path string,
+		fileInfo os.FileInfo,
+		err error) error {
+		if err != nil {
+			return err
+		}
+		// Chunk files are named by their hash, the others are URL and
+		// temporary files
+		if fileInfo.IsDir() || strings.Contains(fileInfo.Name(), ".") {
+			return nil
+		}
+		if !referenced[fileInfo.Name()] {
+			unreferenced = append(unreferenced, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	sort.Strings(unreferenced)
+
+	remover, canRemove := packager.options.Uploader.(PackageRemover)
+	for i, chunkPath := range unreferenced {
+		chunkURL, err := ioutil.ReadFile(chunkPath + chunkURLSuffix)
+		if err == nil && canRemove {
+			err = remover.Remove(string(chunkURL))
+			if err != nil {
+				return i, err
+			}
+		}
+		for _, path := range []string{chunkPath + chunkURLSuffix, chunkPath} {
+			err = os.Remove(path)
+			if err != nil && !os.IsNotExist(err) {
+				return i, err
+			}
+		}
+	}
+	log.WithFields(log.Fields{
+		"referenced": len(referenced),
+		"pruned":     len(unreferenced),
+	}).Info("Pruned chunks")
+	return len(unreferenced), nil
+}
@@ -0,0 +1,139 @@
+package packager
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChunkStoreStoresSharedChunksOnce(t *testing.T) {
+	dir := tempDir(t)
+	store, err := NewChunkStore(filepath.Join(dir, chunkDirName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 6*chunkAvgSize)
+	rand.New(rand.NewSource(1)).Read(data)
+	// The second file has the content of the first with a new tail
+	extended := append(append([]byte{}, data...), []byte("new tail")...)
+	err = ioutil.WriteFile(filepath.Join(dir, "first.pak"), data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "second.pak"), extended, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	firstIDs, firstStored, err := store.StoreFile(filepath.Join(dir, "first.pak"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(firstIDs) < 2 || firstStored != len(firstIDs) {
+		t.Fatalf("First file has %d chunks, %d stored", len(firstIDs), firstStored)
+	}
+	secondIDs, secondStored, err := store.StoreFile(filepath.Join(dir, "second.pak"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secondStored != 1 {
+		t.Errorf("Second file stored %d new chunks, expected 1", secondStored)
+	}
+	for i := 0; i < len(firstIDs)-1; i++ {
+		if firstIDs[i] != secondIDs[i] {
+			t.Errorf("Chunk %d isn't shared", i)
+		}
+	}
+
+	output := filepath.Join(dir, "output", "second.pak")
+	err = store.ReassembleFile(secondIDs, output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reassembled, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(reassembled, extended) {
+		t.Error("Reassembled file differs")
+	}
+}
+
+// storageUploader uploads to storage it keeps in memory
+type storageUploader struct {
+	stored map[string]bool
+}
+
+func (uploader *storageUploader) Upload(
+	packagePath string,
+	values TemplateValues) (string, error) {
+	url := "http://storage/" + filepath.Base(packagePath)
+	uploader.stored[url] = true
+	return url, nil
+}
+
+func (uploader *storageUploader) Remove(updateURL string) error {
+	delete(uploader.stored, updateURL)
+	return nil
+}
+
+func TestChunksAreUploadedAndPruned(t *testing.T) {
+	uploader := &storageUploader{stored: make(map[string]bool)}
+	packager := newTestPackager(t, Options{
+		ChunkFiles: true,
+		Uploader:   uploader,
+	})
+	for changelist, content := range map[int]string{
+		3395761: "one",
+		3450000: "two",
+		3525360: "three",
+	} {
+		installTestVersion(t, packager, changelist, map[string]string{
+			"UnrealTournament/Content/a.txt": content,
+		})
+	}
+	chunkURL := func(content string) string {
+		return fmt.Sprintf("http://storage/%x", sha256.Sum256([]byte(content)))
+	}
+
+	for _, toVersion := range []string{"3450000", "3525360"} {
+		_, err := packager.GeneratePackage("3395761", toVersion)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, content := range []string{"two", "three"} {
+		if !uploader.stored[chunkURL(content)] {
+			t.Errorf("Chunk of %q wasn't uploaded", content)
+		}
+	}
+
+	// Only the package to the newest version is kept
+	pruned, err := packager.PrunePackages(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned != 1 {
+		t.Fatalf("%d packages pruned, expected 1", pruned)
+	}
+	if uploader.stored[chunkURL("two")] {
+		t.Error("Chunk only the pruned package used is still stored")
+	}
+	if !uploader.stored[chunkURL("three")] {
+		t.Error("Chunk of the kept package was removed")
+	}
+	store := &ChunkStore{dir: filepath.Join(packager.packageDir, chunkDirName)}
+	id := fmt.Sprintf("%x", sha256.Sum256([]byte("two")))
+	if _, err := os.Stat(store.chunkPath(id)); !os.IsNotExist(err) {
+		t.Error("Chunk only the pruned package used is still in the package dir")
+	}
+	id = fmt.Sprintf("%x", sha256.Sum256([]byte("three")))
+	if _, err := os.Stat(store.chunkPath(id)); err != nil {
+		t.Error("Chunk of the kept package was removed from the package dir")
+	}
+}
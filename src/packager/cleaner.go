@@ -0,0 +1,81 @@
+package packager
+
+import (
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// staleArtifactPatterns match the files a run leaves in the working dir
+var staleArtifactPatterns = []string{
+	"newrelease.zip",
+	"newrelease.zip" + defaultReleaseSignatureSuffix,
+	"newrelease",
+	stagingDirPattern,
+	"*.tar.gz",
+	"*.tar.gz" + operationsSidecarSuffix,
+}
+
+// stagingDirPattern matches the package staging dirs in the working dir
+const stagingDirPattern = "*-package"
+
+// CleanStaleArtifacts removes the files a previous, possibly crashed,
+// run left in workingDir. It is the default WorkingDirCleaner
+func CleanStaleArtifacts(workingDir string) error {
+	return cleanArtifacts(workingDir, false)
+}
+
+// CleanStaleArtifactsKeepStaging removes the same files as
+// CleanStaleArtifacts except the package staging dirs. It is the default
+// WorkingDirCleaner with ResumePackaging so failed packages can resume
+func CleanStaleArtifactsKeepStaging(workingDir string) error {
+	return cleanArtifacts(workingDir, true)
+}
+
+// cleanArtifacts removes the stale artifacts in workingDir, keeping the
+// staging dirs when keepStaging is set
+func cleanArtifacts(workingDir string, keepStaging bool) error {
+	for _, pattern := range staleArtifactPatterns {
+		if keepStaging && pattern == stagingDirPattern {
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(workingDir, pattern))
+		if err != nil {
+			return err
+		}
+		for _, match := range matches {
+			log.WithField("path", match).Debug("Removing stale artifact")
+			err = os.RemoveAll(match)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// CleanAll removes everything in workingDir
+func CleanAll(workingDir string) error {
+	return os.RemoveAll(workingDir)
+}
+
+// cleanWorkingDirs removes the working dir and the release artifacts in a
+// separate payload dir once a release is processed. With ResumePackaging
+// the staging dirs of failed packages are kept for the next run
+func (packager *Packager) cleanWorkingDirs() {
+	if packager.options.ResumePackaging {
+		err := CleanStaleArtifactsKeepStaging(packager.workingDir)
+		if err != nil {
+			log.WithField("err", "clean_working_dir").Warning(err.Error())
+		}
+	} else {
+		os.RemoveAll(packager.workingDir)
+	}
+	if packager.payloadDir != packager.workingDir {
+		err := CleanStaleArtifacts(packager.payloadDir)
+		if err != nil {
+			log.WithField("err", "clean_payload_dir").Warning(err.Error())
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package packager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// staleWorkingDir writes the artifacts of a crashed run and a file that
+// isn't one to the working dir of fixture
+func staleWorkingDir(t *testing.T, fixture *fixture) {
+	t.Helper()
+	files := map[string]string{
+		"newrelease.zip": "zip",
+		"newrelease/UnrealTournament/Default.ini": "ini",
+		"3395761-3525360-package/Default.ini":     "ini",
+		"3395761-3525360.tar.gz":                  "package",
+		"keep.txt":                                "keep",
+	}
+	files["3395761-3525360.tar.gz"+operationsSidecarSuffix] = "{}"
+	writeTree(t, fixture.workingDir, files)
+}
+
+func assertExists(t *testing.T, path string, exists bool) {
+	t.Helper()
+	_, err := os.Stat(path)
+	if exists && err != nil {
+		t.Errorf("%s was removed", filepath.Base(path))
+	}
+	if !exists && !os.IsNotExist(err) {
+		t.Errorf("%s wasn't removed", filepath.Base(path))
+	}
+}
+
+func TestCleanWorkingDirOnStart(t *testing.T) {
+	fixture := newFixture(t)
+	staleWorkingDir(t, fixture)
+	fixture.newPackager(Options{CleanWorkingDirOnStart: true})
+
+	for _, name := range []string{
+		"newrelease.zip",
+		"newrelease",
+		"3395761-3525360-package",
+		"3395761-3525360.tar.gz",
+		"3395761-3525360.tar.gz" + operationsSidecarSuffix,
+	} {
+		assertExists(t, filepath.Join(fixture.workingDir, name), false)
+	}
+	assertExists(t, filepath.Join(fixture.workingDir, "keep.txt"), true)
+}
+
+func TestCleanWorkingDirOnStartKeepsStagingWhenResuming(t *testing.T) {
+	fixture := newFixture(t)
+	staleWorkingDir(t, fixture)
+	fixture.newPackager(Options{
+		CleanWorkingDirOnStart: true,
+		ResumePackaging:        true,
+	})
+
+	assertExists(t, filepath.Join(fixture.workingDir, "3395761-3525360-package"), true)
+	assertExists(t, filepath.Join(fixture.workingDir, "newrelease.zip"), false)
+	assertExists(t, filepath.Join(fixture.workingDir, "3395761-3525360.tar.gz"), false)
+}
+
+func TestCleanAll(t *testing.T) {
+	fixture := newFixture(t)
+	staleWorkingDir(t, fixture)
+	fixture.newPackager(Options{
+		CleanWorkingDirOnStart: true,
+		WorkingDirCleaner:      CleanAll,
+	})
+	assertExists(t, filepath.Join(fixture.workingDir, "keep.txt"), false)
+}
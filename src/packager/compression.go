@@ -0,0 +1,98 @@
+package packager
+
+import (
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// PackageCompression is the size of a single package before and after
+// compression
+type PackageCompression struct {
+	VersionPair
+	UncompressedSize int64
+	CompressedSize   int64
+	// Ratio is CompressedSize divided by UncompressedSize, lower is better
+	Ratio float64
+}
+
+// compressionRatio returns compressed divided by uncompressed, or 0 when
+// the uncompressed size is unknown
+func compressionRatio(compressed int64, uncompressed int64) float64 {
+	if uncompressed <= 0 {
+		return 0
+	}
+	return float64(compressed) / float64(uncompressed)
+}
+
+// CompressionRatio returns the ratio over all packages of the run that
+// have an uncompressed size
+func (result RunResult) CompressionRatio() float64 {
+	var compressed int64
+	var uncompressed int64
+	for _, compression := range result.Compression {
+		if compression.UncompressedSize <= 0 {
+			continue
+		}
+		compressed += compression.CompressedSize
+		uncompressed += compression.UncompressedSize
+	}
+	return compressionRatio(compressed, uncompressed)
+}
+
+// stagedSize returns the number of bytes of the staged files and
+// operations of staged, which is what the archive compresses
+func stagedSize(staged stagedPackage) (int64, error) {
+	var size int64
+	err := filepath.Walk(staged.dir, func(path string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fileInfo.Mode().IsRegular() && path != staged.operationsPath {
+			size += fileInfo.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	operationsInfo, err := os.Stat(staged.operationsPath)
+	if err != nil {
+		return 0, err
+	}
+	return size + operationsInfo.Size(), nil
+}
+
+// measureStaged sets the uncompressed size of staged when compression
+// stats are enabled
+func (packager *Packager) measureStaged(staged *stagedPackage) error {
+	if !packager.options.CompressionStats {
+		return nil
+	}
+	size, err := stagedSize(*staged)
+	if err != nil {
+		return err
+	}
+	staged.size = size
+	return nil
+}
+
+// logCompression logs the sizes and ratio of the package from fromVersion
+// to toVersion when its uncompressed size is known
+func logCompression(
+	fromVersion string,
+	toVersion string,
+	uncompressed int64,
+	compressed int64) {
+	if uncompressed <= 0 {
+		return
+	}
+	log.WithFields(log.Fields{
+		"fromVersion":  fromVersion,
+		"toVersion":    toVersion,
+		"uncompressed": uncompressed,
+		"compressed":   compressed,
+		"ratio":        compressionRatio(compressed, uncompressed),
+	}).Info("Package compression")
+}
@@ -0,0 +1,71 @@
+package packager
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunReportsCompression(t *testing.T) {
+	fixture := newFixture(t)
+	fixture.installVersion(3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+	})
+	downloadURL := fixture.serveRelease(3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+		"UnrealTournament/Content/Added.txt":  strings.Repeat("compressible ", 1000),
+	})
+	fixture.addPost("UT Release 3525360", "post-3525360", downloadURL, time.Now())
+	packager := fixture.newPackager(Options{CompressionStats: true})
+
+	result, err := packager.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Compression) != 1 {
+		t.Fatalf("Compression of %d packages reported, expected 1", len(result.Compression))
+	}
+	compression := result.Compression[0]
+
+	// The uncompressed size is every file the archive holds
+	packagePath := filepath.Join(fixture.packageDir, "3395761-3525360.tar.gz")
+	var uncompressed int64
+	for _, content := range readPackage(t, packagePath) {
+		uncompressed += int64(len(content))
+	}
+	packageInfo, err := os.Stat(packagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compression.UncompressedSize != uncompressed ||
+		compression.CompressedSize != packageInfo.Size() {
+		t.Errorf("Sizes are %d and %d, expected %d and %d",
+			compression.UncompressedSize, compression.CompressedSize,
+			uncompressed, packageInfo.Size())
+	}
+	expectedRatio := float64(packageInfo.Size()) / float64(uncompressed)
+	if compression.Ratio != expectedRatio || result.CompressionRatio() != expectedRatio {
+		t.Errorf("Ratio is %f, run ratio %f, expected %f",
+			compression.Ratio, result.CompressionRatio(), expectedRatio)
+	}
+	if compression.Ratio >= 1 {
+		t.Errorf("Compressible package has ratio %f", compression.Ratio)
+	}
+}
+
+func TestRunResultCompressionRatio(t *testing.T) {
+	result := RunResult{Compression: []PackageCompression{
+		{UncompressedSize: 1000, CompressedSize: 250},
+		{UncompressedSize: 3000, CompressedSize: 750},
+		// Unknown uncompressed sizes are left out
+		{UncompressedSize: 0, CompressedSize: 500},
+	}}
+	if ratio := result.CompressionRatio(); ratio != 0.25 {
+		t.Errorf("Ratio is %f, expected 0.25", ratio)
+	}
+	if ratio := (RunResult{}).CompressionRatio(); ratio != 0 {
+		t.Errorf("Ratio without packages is %f, expected 0", ratio)
+	}
+}
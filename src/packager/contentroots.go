@@ -0,0 +1,49 @@
+package packager
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ScopeContent marks packages limited to the configured content roots.
+// Packages of the whole install have an empty scope
+const ScopeContent = "content"
+
+// normalizeContentRoots cleans roots into slash separated paths relative
+// to the install, rejecting roots that leave it
+func normalizeContentRoots(roots []string) ([]string, error) {
+	var normalized []string
+	for _, root := range roots {
+		cleaned := path.Clean(strings.Replace(strings.TrimSpace(root), "\\", "/", -1))
+		if cleaned == "." || path.IsAbs(cleaned) ||
+			cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+			return nil, fmt.Errorf("Invalid content root '%s'", root)
+		}
+		normalized = append(normalized, cleaned)
+	}
+	return normalized, nil
+}
+
+// inContentRoots checks if file is inside any of roots, everything is
+// when there are no roots
+func inContentRoots(roots []string, file string) bool {
+	if len(roots) == 0 {
+		return true
+	}
+	for _, root := range roots {
+		if file == root || strings.HasPrefix(file, root+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// packageScope returns the scope recorded with the packages this
+// Packager builds
+func (packager *Packager) packageScope() string {
+	if len(packager.options.ContentRoots) > 0 {
+		return ScopeContent
+	}
+	return ""
+}
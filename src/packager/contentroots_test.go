@@ -0,0 +1,108 @@
+package packager
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/donovansolms/ut4-update-packager/src/packager/models"
+)
+
+func TestContentRootsLimitPackage(t *testing.T) {
+	const root = "UnrealTournament/Content/Maps"
+	packager := newTestPackager(t, Options{ContentRoots: []string{root + "/"}})
+	installTestVersion(t, packager, 3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini":    "setting=1",
+		"UnrealTournament/Content/Maps/Map.umap": "map=1",
+		"UnrealTournament/Content/Movies/a.mp4":  "movie",
+	})
+	installTestVersion(t, packager, 3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini":    "setting=2",
+		"UnrealTournament/Content/Maps/Map.umap": "map=2",
+		"UnrealTournament/Content/Maps/New.umap": "new",
+	})
+
+	updatePackage, err := packager.GeneratePackage("3395761", "3525360")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updatePackage.Scope != ScopeContent {
+		t.Errorf("Package scope is %q, expected %q", updatePackage.Scope, ScopeContent)
+	}
+	packagePath := filepath.Join(packager.packageDir, "3395761-3525360.tar.gz")
+	files := readPackage(t, packagePath)
+	delete(files, operationsFilename)
+	expected := map[string]string{
+		root + "/Map.umap": "map=2",
+		root + "/New.umap": "new",
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("Package holds %v, expected %v", files, expected)
+	}
+	operations, err := ReadPackageOperations(packagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for file := range operations {
+		if !strings.HasPrefix(file, root+"/") {
+			t.Errorf("Operation on %s outside the content roots", file)
+		}
+	}
+}
+
+func TestNormalizeContentRootsRejectsOutsideInstall(t *testing.T) {
+	for _, root := range []string{"", ".", "/UnrealTournament", "..", "../Engine"} {
+		_, err := normalizeContentRoots([]string{root})
+		if err == nil {
+			t.Errorf("Content root %q was accepted", root)
+		}
+	}
+}
+
+func TestResolveUpgradePathsOnlyUsesOwnScope(t *testing.T) {
+	fixture := newFixture(t)
+	fixture.newPackager(Options{})
+	addUpdatePackages(t, fixture, []VersionPair{
+		{FromVersion: "3395761", ToVersion: "3450000"},
+		{FromVersion: "3450000", ToVersion: "3525360"},
+	})
+	// A direct content package must not shortcut whole install chains
+	err := fixture.db().Create(&models.Ut4UpdatePackages{
+		FromVersion: "3395761",
+		ToVersion:   "3525360",
+		UpdateURL:   "http://update.donovansolms.com/content/3395761-3525360.tar.gz",
+		Channel:     ChannelStable,
+		Scope:       ScopeContent,
+		DateCreated: time.Now(),
+	}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		options Options
+		steps   []string
+	}{
+		{Options{}, []string{"3395761-3450000", "3450000-3525360"}},
+		{Options{ContentRoots: []string{"UnrealTournament/Content"}},
+			[]string{"3395761-3525360"}},
+	} {
+		packager := fixture.newPackager(test.options)
+		paths, err := packager.ResolveUpgradePaths([]string{"3395761"}, ChannelStable)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var steps []string
+		for _, updatePackage := range paths[0].Packages {
+			steps = append(steps, fmt.Sprintf("%s-%s",
+				updatePackage.FromVersion, updatePackage.ToVersion))
+		}
+		if !reflect.DeepEqual(steps, test.steps) {
+			t.Errorf("Scope %q: path is %v, expected %v",
+				packager.packageScope(), steps, test.steps)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package packager
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// PlanCoverage returns the upgrade packages needed so that every installed
+// version can be upgraded to the newest installed version using the
+// configured coverage strategy
+func (packager *Packager) PlanCoverage() ([]VersionPair, error) {
+	versions, err := packager.GetVersionList()
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, errors.New("No versions are installed")
+	}
+	packager.sortVersions(versions)
+	return packager.planCoverage(versions, versions[len(versions)-1]), nil
+}
+
+// planCoverage returns the upgrade pairs from versions to targetVersion.
+// Versions newer or equal to targetVersion are skipped
+func (packager *Packager) planCoverage(
+	versions []string,
+	targetVersion string) []VersionPair {
+
+	var olderVersions []string
+	for _, version := range versions {
+		if packager.compareVersions(version, targetVersion) >= 0 {
+			log.WithFields(log.Fields{
+				"fromVersion": version,
+				"toVersion":   targetVersion}).Debug("Skipping older or equal version")
+			continue
+		}
+		olderVersions = append(olderVersions, version)
+	}
+	packager.sortVersions(olderVersions)
+	olderVersions = packager.fanOutWindow(olderVersions)
+
+	var pairs []VersionPair
+	for i, version := range olderVersions {
+		toVersion := targetVersion
+		if packager.options.CoverageStrategy == CoverageChain &&
+			i < len(olderVersions)-1 {
+			// Chain links between older versions are usually built already
+			// and will be skipped when they exist in the database
+			toVersion = olderVersions[i+1]
+		}
+		pairs = append(pairs, VersionPair{
+			FromVersion: version,
+			ToVersion:   toVersion,
+		})
+	}
+	return pairs
+}
+
+// fanOutWindow drops the versions, sorted oldest first, that are outside
+// the configured FanOutMaxVersions and FanOutMaxAge. Clients on those
+// versions use the full install instead
+func (packager *Packager) fanOutWindow(versions []string) []string {
+	maxVersions := packager.options.FanOutMaxVersions
+	if maxVersions > 0 && len(versions) > maxVersions {
+		log.WithField("versions", versions[:len(versions)-maxVersions]).
+			Debug("Skipping versions outside the fan-out window")
+		versions = versions[len(versions)-maxVersions:]
+	}
+	if packager.options.FanOutMaxAge <= 0 {
+		return versions
+	}
+	cutoff := time.Now().Add(-packager.options.FanOutMaxAge)
+	var inWindow []string
+	for _, version := range versions {
+		fileInfo, err := os.Stat(filepath.Join(packager.releaseDir, version))
+		if err == nil && fileInfo.ModTime().Before(cutoff) {
+			log.WithField("version", version).
+				Debug("Skipping version older than the fan-out window")
+			continue
+		}
+		inWindow = append(inWindow, version)
+	}
+	return inWindow
+}
+
+// compareVersions compares two versions with the configured
+// VersionComparator
+func (packager *Packager) compareVersions(a string, b string) int {
+	return packager.options.VersionComparator(a, b)
+}
+
+// sortVersions sorts versions from oldest to newest
+func (packager *Packager) sortVersions(versions []string) {
+	sort.Slice(versions, func(i, j int) bool {
+		return packager.compareVersions(versions[i], versions[j]) < 0
+	})
+}
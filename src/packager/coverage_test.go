@@ -0,0 +1,128 @@
+package packager
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// reachesTarget checks that pairs upgrade every version to target
+func reachesTarget(pairs []VersionPair, versions []string, target string) bool {
+	next := make(map[string]string)
+	for _, pair := range pairs {
+		next[pair.FromVersion] = pair.ToVersion
+	}
+	for _, version := range versions {
+		for steps := 0; version != target; steps++ {
+			toVersion, ok := next[version]
+			if !ok || steps > len(versions) {
+				return false
+			}
+			version = toVersion
+		}
+	}
+	return true
+}
+
+func TestPlanCoverageChainNeedsFewerPackages(t *testing.T) {
+	versions := []string{"1000001", "1000002", "1000003", "1000004", "1000005"}
+	built := map[string]map[VersionPair]bool{
+		CoverageFanOut: make(map[VersionPair]bool),
+		CoverageChain:  make(map[VersionPair]bool),
+	}
+	for strategy, packages := range built {
+		packager := newTestPackager(t, Options{CoverageStrategy: strategy})
+		// Releases arrive one at a time, each run plans the packages to
+		// the new release and keeps the earlier ones
+		for i := 1; i < len(versions); i++ {
+			pairs := packager.planCoverage(versions[:i+1], versions[i])
+			for _, pair := range pairs {
+				packages[pair] = true
+			}
+			var all []VersionPair
+			for pair := range packages {
+				all = append(all, pair)
+			}
+			if !reachesTarget(all, versions[:i], versions[i]) {
+				t.Errorf("%s doesn't upgrade every version to %s: %v",
+					strategy, versions[i], all)
+			}
+		}
+	}
+	if len(built[CoverageChain]) != len(versions)-1 {
+		t.Errorf("Chain built %d packages, expected %d",
+			len(built[CoverageChain]), len(versions)-1)
+	}
+	if len(built[CoverageChain]) >= len(built[CoverageFanOut]) {
+		t.Errorf("Chain built %d packages, fan-out %d",
+			len(built[CoverageChain]), len(built[CoverageFanOut]))
+	}
+}
+
+func TestPlanCoverage(t *testing.T) {
+	packager := newTestPackager(t, Options{CoverageStrategy: CoverageChain})
+	for _, version := range []int{1000003, 1000001, 1000002} {
+		installTestVersion(t, packager, version, nil)
+	}
+	pairs, err := packager.PlanCoverage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []VersionPair{
+		{FromVersion: "1000001", ToVersion: "1000002"},
+		{FromVersion: "1000002", ToVersion: "1000003"},
+	}
+	if !reflect.DeepEqual(pairs, expected) {
+		t.Errorf("Plan is %v, expected %v", pairs, expected)
+	}
+}
+
+func TestPlanCoverageWithoutVersions(t *testing.T) {
+	packager := newTestPackager(t, Options{})
+	_, err := packager.PlanCoverage()
+	if err == nil {
+		t.Error("Planning without versions should fail")
+	}
+}
+
+func TestPlanCoverageSkipsNewerVersions(t *testing.T) {
+	packager := newTestPackager(t, Options{})
+	pairs := packager.planCoverage([]string{"1000001", "1000002", "1000003"}, "1000002")
+	expected := []VersionPair{{FromVersion: "1000001", ToVersion: "1000002"}}
+	if !reflect.DeepEqual(pairs, expected) {
+		t.Errorf("Plan is %v, expected %v", pairs, expected)
+	}
+}
+
+func TestPlanCoverageFanOutWindow(t *testing.T) {
+	versions := []string{"1000001", "1000002", "1000003", "1000004"}
+	packager := newTestPackager(t, Options{FanOutMaxVersions: 2})
+	pairs := packager.planCoverage(versions, "1000004")
+	expected := []VersionPair{
+		{FromVersion: "1000002", ToVersion: "1000004"},
+		{FromVersion: "1000003", ToVersion: "1000004"},
+	}
+	if !reflect.DeepEqual(pairs, expected) {
+		t.Errorf("Plan with a version count window is %v, expected %v", pairs, expected)
+	}
+
+	packager = newTestPackager(t, Options{FanOutMaxAge: 24 * time.Hour})
+	for _, version := range []int{1000001, 1000002, 1000003, 1000004} {
+		installTestVersion(t, packager, version, nil)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	err := os.Chtimes(filepath.Join(packager.releaseDir, "1000001"), old, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pairs = packager.planCoverage(versions, "1000004")
+	expected = []VersionPair{
+		{FromVersion: "1000002", ToVersion: "1000004"},
+		{FromVersion: "1000003", ToVersion: "1000004"},
+	}
+	if !reflect.DeepEqual(pairs, expected) {
+		t.Errorf("Plan with an age window is %v, expected %v", pairs, expected)
+	}
+}
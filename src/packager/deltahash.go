@@ -0,0 +1,116 @@
+package packager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/donovansolms/ut4-update-packager/src/packager/models"
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+)
+
+// deltaHash identifies the content of a delta by its operations and the
+// hashes of the files it adds or modifies. Pairs with the same delta hash
+// produce the same package
+func deltaHash(
+	deltaOperations map[string]DeltaOperation,
+	toVersionHashes map[string]string) string {
+	paths := make([]string, 0, len(deltaOperations))
+	for path := range deltaOperations {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	hash := sha256.New()
+	for _, path := range paths {
+		operation := deltaOperations[path]
+		var fileHash string
+		if operation.Operation == deltaOperationAdded ||
+			operation.Operation == deltaOperationModified {
+			fileHash = toVersionHashes[path]
+		}
+		fmt.Fprintf(hash, "%s\x00%s\x00%s\x00%s\n",
+			path, operation.Operation, operation.Source, fileHash)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// findSharedPackage returns the delta hash of the pair and the package
+// already built for the same delta, if any. The package is looked up in
+// the packages built during this run first, then in the database
+func (packager *Packager) findSharedPackage(
+	fromVersion string,
+	toVersion string) (string, OperationCounts, *models.Ut4UpdatePackages, error) {
+	fromVersionHashes, err := packager.getVersionHashes(fromVersion)
+	if err != nil {
+		return "", OperationCounts{}, nil, err
+	}
+	toVersionHashes, err := packager.getVersionHashes(toVersion)
+	if err != nil {
+		return "", OperationCounts{}, nil, err
+	}
+	deltaOperations := packager.calculateHashDeltaOperations(
+		fromVersionHashes,
+		toVersionHashes)
+	err = packager.postProcessDelta(
+		fromVersion,
+		toVersion,
+		deltaOperations,
+		fromVersionHashes,
+		toVersionHashes)
+	if err != nil {
+		return "", OperationCounts{}, nil, err
+	}
+	_, err = packager.demoteNormalizedModified(deltaOperations, fromVersion, toVersion)
+	if err != nil {
+		return "", OperationCounts{}, nil, err
+	}
+	if len(deltaOperations) == 0 {
+		// Left to generateUpgradePath to report
+		return "", OperationCounts{}, nil, nil
+	}
+	hash := deltaHash(deltaOperations, toVersionHashes)
+	counts := countOperations(deltaOperations)
+
+	existing, ok := packager.sharedDeltas[hash]
+	if !ok {
+		db, err := packager.openDB()
+		if err != nil {
+			return hash, counts, nil, err
+		}
+		defer db.Close()
+		query := db.Where(
+			"delta_hash = ? AND channel = ? AND scope = ? AND is_deleted = 0",
+			hash,
+			packager.releaseChannel(),
+			packager.packageScope(),
+		).First(&existing)
+		if query.Error == gorm.ErrRecordNotFound {
+			return hash, counts, nil, nil
+		}
+		if query.Error != nil {
+			return hash, counts, nil, query.Error
+		}
+	}
+	log.WithFields(log.Fields{
+		"fromVersion": fromVersion,
+		"toVersion":   toVersion,
+		"sharedFrom":  existing.FromVersion,
+		"sharedTo":    existing.ToVersion,
+		"deltaHash":   hash,
+	}).Info("Identical delta already packaged, sharing the package")
+	return hash, counts, &models.Ut4UpdatePackages{
+		FromVersion:      fromVersion,
+		ToVersion:        toVersion,
+		UpdateURL:        existing.UpdateURL,
+		SignatureURL:     existing.SignatureURL,
+		Channel:          packager.releaseChannel(),
+		Size:             existing.Size,
+		DeltaHash:        hash,
+		Scope:            existing.Scope,
+		DateCreated:      time.Now(),
+		UncompressedSize: existing.UncompressedSize,
+	}, nil
+}
@@ -0,0 +1,54 @@
+package packager
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/donovansolms/ut4-update-packager/src/packager/models"
+)
+
+func TestIdenticalDeltasShareAPackage(t *testing.T) {
+	fixture := newFixture(t)
+	// Both versions only differ from the new release in the same files
+	files := map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+	}
+	fixture.installVersion(3395761, files)
+	fixture.installVersion(3450000, files)
+	downloadURL := fixture.serveRelease(3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+	})
+	fixture.addPost("UT Release 3525360", "post-3525360", downloadURL, time.Now())
+	packager := fixture.newPackager(Options{ShareDeltas: true})
+
+	result, err := packager.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Packages) != 2 {
+		t.Fatalf("Created %d packages, expected 2", len(result.Packages))
+	}
+	packages, err := filepath.Glob(filepath.Join(fixture.packageDir, "*.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packages) != 1 {
+		t.Errorf("Archived %d package files, expected 1 shared: %v",
+			len(packages), packages)
+	}
+
+	var rows []models.Ut4UpdatePackages
+	fixture.db().Where("to_version = ?", "3525360").Find(&rows)
+	if len(rows) != 2 {
+		t.Fatalf("Stored %d package rows, expected 2", len(rows))
+	}
+	if rows[0].DeltaHash == "" || rows[0].DeltaHash != rows[1].DeltaHash {
+		t.Errorf("Rows have delta hashes '%s' and '%s'",
+			rows[0].DeltaHash, rows[1].DeltaHash)
+	}
+	if rows[0].UpdateURL != rows[1].UpdateURL {
+		t.Errorf("Rows reference different packages %s and %s",
+			rows[0].UpdateURL, rows[1].UpdateURL)
+	}
+}
@@ -0,0 +1,71 @@
+package packager
+
+// DeltaContext is the delta between two versions handed to a
+// DeltaPostProcessor
+type DeltaContext struct {
+	FromVersion string
+	ToVersion   string
+	// Operations can be changed in place, operations of files that aren't
+	// in the to version can't be packaged. The result is validated with
+	// ValidateOperations before it is packaged
+	Operations map[string]DeltaOperation
+	// FromHashes are the hashes of all files of the from version,
+	// ToHashes at least those of the added and modified files
+	FromHashes map[string]string
+	ToHashes   map[string]string
+}
+
+// DeltaPostProcessor transforms the delta operations of a version pair
+// before they are packaged, e.g. to drop or add operations
+type DeltaPostProcessor interface {
+	ProcessDelta(delta DeltaContext) error
+}
+
+// moveDetector is the bundled DeltaPostProcessor pairing up added and
+// removed files with the same content as moves
+type moveDetector struct{}
+
+// NewMoveDetector creates the DeltaPostProcessor detecting moved files.
+// It is the default processor, include it when configuring processors
+// to keep detecting moves
+func NewMoveDetector() DeltaPostProcessor {
+	return moveDetector{}
+}
+
+// ProcessDelta replaces added and removed pairs by moves
+func (detector moveDetector) ProcessDelta(delta DeltaContext) error {
+	detectMovedFiles(delta.Operations, delta.FromHashes, delta.ToHashes)
+	return nil
+}
+
+// RegisterDeltaPostProcessor adds processor to the end of the processors
+// applied to every delta
+func (packager *Packager) RegisterDeltaPostProcessor(processor DeltaPostProcessor) {
+	packager.options.DeltaPostProcessors = append(
+		packager.options.DeltaPostProcessors,
+		processor)
+}
+
+// postProcessDelta applies the delta post processors in order to the
+// operations from fromVersion to toVersion
+func (packager *Packager) postProcessDelta(
+	fromVersion string,
+	toVersion string,
+	operations map[string]DeltaOperation,
+	fromHashes map[string]string,
+	toHashes map[string]string) error {
+	delta := DeltaContext{
+		FromVersion: fromVersion,
+		ToVersion:   toVersion,
+		Operations:  operations,
+		FromHashes:  fromHashes,
+		ToHashes:    toHashes,
+	}
+	for _, processor := range packager.options.DeltaPostProcessors {
+		err := processor.ProcessDelta(delta)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
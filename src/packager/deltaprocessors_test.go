@@ -0,0 +1,101 @@
+package packager
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// pathStripper is a DeltaPostProcessor dropping the operations under prefix
+type pathStripper struct {
+	prefix string
+}
+
+func (stripper pathStripper) ProcessDelta(delta DeltaContext) error {
+	for file := range delta.Operations {
+		if strings.HasPrefix(file, stripper.prefix) {
+			delete(delta.Operations, file)
+		}
+	}
+	return nil
+}
+
+// failingProcessor is a DeltaPostProcessor that always fails
+type failingProcessor struct{}
+
+func (processor failingProcessor) ProcessDelta(delta DeltaContext) error {
+	return errors.New("Processor failed")
+}
+
+// installProcessorVersions installs two versions where a file moved, a
+// config changed and a log was added
+func installProcessorVersions(t *testing.T, packager *Packager) {
+	t.Helper()
+	installTestVersion(t, packager, 3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+		"UnrealTournament/Content/Old.txt":    "moved",
+	})
+	installTestVersion(t, packager, 3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+		"UnrealTournament/Content/New.txt":    "moved",
+		"UnrealTournament/Saved/Logs/ut.log":  "log",
+	})
+}
+
+func TestDeltaPostProcessorStripsPath(t *testing.T) {
+	packager := newTestPackager(t, Options{})
+	packager.RegisterDeltaPostProcessor(pathStripper{prefix: "UnrealTournament/Saved/"})
+	installProcessorVersions(t, packager)
+
+	_, err := packager.GeneratePackage("3395761", "3525360")
+	if err != nil {
+		t.Fatal(err)
+	}
+	packagePath := filepath.Join(packager.packageDir, "3395761-3525360.tar.gz")
+	if _, ok := readPackage(t, packagePath)["UnrealTournament/Saved/Logs/ut.log"]; ok {
+		t.Error("Stripped file is in the package")
+	}
+	operations, err := ReadPackageOperations(packagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := operations["UnrealTournament/Saved/Logs/ut.log"]; ok {
+		t.Error("Stripped file has an operation")
+	}
+	// The default move detection still runs before the registered processor
+	moved := operations["UnrealTournament/Content/New.txt"]
+	if moved.Operation != deltaOperationMoved {
+		t.Errorf("Moved file has operation %q", moved.Operation)
+	}
+}
+
+func TestNoDeltaPostProcessorsDisablesMoveDetection(t *testing.T) {
+	packager := newTestPackager(t, Options{DeltaPostProcessors: []DeltaPostProcessor{}})
+	installProcessorVersions(t, packager)
+
+	_, err := packager.GeneratePackage("3395761", "3525360")
+	if err != nil {
+		t.Fatal(err)
+	}
+	operations, err := ReadPackageOperations(
+		filepath.Join(packager.packageDir, "3395761-3525360.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if operations["UnrealTournament/Content/New.txt"].Operation != deltaOperationAdded ||
+		operations["UnrealTournament/Content/Old.txt"].Operation != deltaOperationRemoved {
+		t.Errorf("Moves were detected without processors: %v", operations)
+	}
+}
+
+func TestFailingDeltaPostProcessorFailsPackage(t *testing.T) {
+	packager := newTestPackager(t, Options{})
+	packager.RegisterDeltaPostProcessor(failingProcessor{})
+	installProcessorVersions(t, packager)
+
+	_, err := packager.GeneratePackage("3395761", "3525360")
+	if err == nil {
+		t.Error("Package was built although a processor failed")
+	}
+}
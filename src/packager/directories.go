@@ -0,0 +1,24 @@
+package packager
+
+import (
+	"strings"
+)
+
+// directoryHash is the hash map value marking a directory entry. Directory
+// entries are keyed by their path with a trailing slash
+const directoryHash = "directory"
+
+// isDirectoryEntry checks if a hash map key is a directory entry
+func isDirectoryEntry(path string) bool {
+	return strings.HasSuffix(path, "/")
+}
+
+// hashCacheFilename returns the filename of the hash cache of version.
+// Caches with directory entries are kept apart so changing
+// HashDirectories doesn't mix them up
+func (packager *Packager) hashCacheFilename(version string) string {
+	if packager.options.HashDirectories {
+		return version + ".dirs.hashes"
+	}
+	return version + ".hashes"
+}
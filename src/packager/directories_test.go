@@ -0,0 +1,49 @@
+package packager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEmptyDirectoriesAreInTheDelta(t *testing.T) {
+	packager := newTestPackager(t, Options{HashDirectories: true})
+	installTestVersion(t, packager, 3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+	})
+	installTestVersion(t, packager, 3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+	})
+	for _, dir := range []string{
+		filepath.Join(packager.releaseDir, "3395761", "UnrealTournament/Saved/Old"),
+		filepath.Join(packager.releaseDir, "3525360", "UnrealTournament/Saved/Logs"),
+	} {
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := packager.GeneratePackage("3395761", "3525360")
+	if err != nil {
+		t.Fatal(err)
+	}
+	operations, err := ReadPackageOperations(
+		filepath.Join(packager.packageDir, "3395761-3525360.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"UnrealTournament/Saved/Logs/": deltaOperationAdded,
+		"UnrealTournament/Saved/Old/":  deltaOperationRemoved,
+	}
+	for path, operation := range expected {
+		if operations[path].Operation != operation {
+			t.Errorf("%s is %q, expected %q", path, operations[path].Operation, operation)
+		}
+	}
+	// Directories in both versions aren't operations
+	if _, ok := operations["UnrealTournament/Saved/"]; ok {
+		t.Error("Unchanged directory is in the delta")
+	}
+}
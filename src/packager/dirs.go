@@ -0,0 +1,59 @@
+package packager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ValidateDirs checks that the named dirs are distinct and not nested in
+// each other once made absolute. Empty dirs are left out, supervised feeds
+// use it to keep their dirs apart
+func ValidateDirs(dirs map[string]string) error {
+	setDirs := make(map[string]string)
+	for name, dir := range dirs {
+		if dir != "" {
+			setDirs[name] = dir
+		}
+	}
+	return validateDirs(setDirs)
+}
+
+// validateDirs checks that the working, release and package dirs are
+// distinct and not nested in each other. The working dir is removed after
+// every run and every dir in the release dir is taken to be a version, so
+// any overlap between them would destroy or corrupt data
+func validateDirs(dirs map[string]string) error {
+	var names []string
+	absoluteDirs := make(map[string]string)
+	for name, dir := range dirs {
+		names = append(names, name)
+		absoluteDir, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		absoluteDirs[name] = absoluteDir
+	}
+	// Sorted so the same misconfiguration always reports the same error
+	sort.Strings(names)
+	for _, name := range names {
+		dir := absoluteDirs[name]
+		for _, otherName := range names {
+			otherDir := absoluteDirs[otherName]
+			if name == otherName {
+				continue
+			}
+			if dir == otherDir {
+				return fmt.Errorf("The %s and %s can't be the same path: %s",
+					name, otherName, dir)
+			}
+			if strings.HasPrefix(dir, otherDir+string(os.PathSeparator)) {
+				return fmt.Errorf("The %s can't be inside the %s: %s is in %s",
+					name, otherName, dir, otherDir)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package packager
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewRejectsOverlappingDirs(t *testing.T) {
+	dir := tempDir(t)
+	working := filepath.Join(dir, "working")
+	releases := filepath.Join(dir, "releases")
+	packages := filepath.Join(dir, "packages")
+	tests := []struct {
+		workingDir string
+		releaseDir string
+		packageDir string
+		err        string
+	}{
+		{working, releases, releases, "can't be the same path"},
+		{working, working, packages, "can't be the same path"},
+		{working, releases, releases + "/../releases", "can't be the same path"},
+		{working, releases, filepath.Join(releases, "packages"), "can't be inside"},
+		{filepath.Join(packages, "working"), releases, packages, "can't be inside"},
+	}
+	for _, test := range tests {
+		_, err := New("http://localhost/feed.xml", "", test.workingDir,
+			test.releaseDir, test.packageDir, Options{})
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("New(%s, %s, %s) returned %v, expected %q",
+				test.workingDir, test.releaseDir, test.packageDir, err, test.err)
+		}
+	}
+
+	_, err := New("http://localhost/feed.xml", "", working, releases, packages,
+		Options{})
+	if err != nil {
+		t.Errorf("Distinct dirs were rejected: %s", err)
+	}
+}
+
+func TestValidateDirsAcrossFeeds(t *testing.T) {
+	dir := tempDir(t)
+	feedDirs := func(feed string) map[string]string {
+		return map[string]string{
+			"working dir of " + feed: filepath.Join(dir, feed, "working"),
+			"release dir of " + feed: filepath.Join(dir, feed, "releases"),
+			"package dir of " + feed: filepath.Join(dir, feed, "packages"),
+			"payload dir of " + feed: "",
+		}
+	}
+	tests := []struct {
+		name string
+		dir  string
+		err  string
+	}{
+		{"payload dir of b", filepath.Join(dir, "a", "working"), "can't be the same path"},
+		{"package dir of b", filepath.Join(dir, "a", "packages") + "/", "can't be the same path"},
+		{"release dir of b", dir + "/a/../a/releases", "can't be the same path"},
+		{"working dir of b", filepath.Join(dir, "a", "packages", "b"), "can't be inside"},
+	}
+	for _, test := range tests {
+		dirs := feedDirs("a")
+		for name, feedDir := range feedDirs("b") {
+			dirs[name] = feedDir
+		}
+		dirs[test.name] = test.dir
+		err := ValidateDirs(dirs)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s at %s returned %v, expected %q",
+				test.name, test.dir, err, test.err)
+		}
+	}
+
+	dirs := feedDirs("a")
+	for name, feedDir := range feedDirs("b") {
+		dirs[name] = feedDir
+	}
+	err := ValidateDirs(dirs)
+	if err != nil {
+		t.Errorf("Distinct feed dirs were rejected: %s", err)
+	}
+}
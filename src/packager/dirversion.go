@@ -0,0 +1,42 @@
+package packager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// versionFromTopDirs returns the changelist embedded in the names of the
+// top level directories of installPath, which some release zips use
+// instead of a .modules file. Directories naming different changelists
+// are ambiguous and return an error
+func versionFromTopDirs(installPath string) (string, error) {
+	entries, err := ioutil.ReadDir(installPath)
+	if err != nil {
+		return "", err
+	}
+	found := make(map[string]bool)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if version := urlVersionPattern.FindString(entry.Name()); version != "" {
+			found[version] = true
+		}
+	}
+	var versions []string
+	for version := range found {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	switch len(versions) {
+	case 0:
+		return "", fmt.Errorf("No version in the top level directory names of %s",
+			installPath)
+	case 1:
+		return versions[0], nil
+	}
+	return "", fmt.Errorf("Top level directories name several versions: %s",
+		strings.Join(versions, ", "))
+}
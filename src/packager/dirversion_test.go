@@ -0,0 +1,63 @@
+package packager
+
+import (
+	"path"
+	"testing"
+)
+
+func TestGetReleaseNumberFromTopDir(t *testing.T) {
+	packager := newTestPackager(t, Options{})
+	tests := []struct {
+		files   []string
+		version string
+	}{
+		{[]string{"LinuxNoEditor-3525360/UnrealTournament/Config/Default.ini"}, "3525360"},
+		{[]string{
+			"UT4-3525360/UnrealTournament/Config/Default.ini",
+			"Docs/readme.txt",
+		}, "3525360"},
+		// Files aren't directories
+		{[]string{"Release-3525360.txt"}, ""},
+		{[]string{"LinuxNoEditor/UnrealTournament/Config/Default.ini"}, ""},
+		{[]string{
+			"UT4-3450000/Default.ini",
+			"UT4-3525360/Default.ini",
+		}, ""},
+	}
+	for _, test := range tests {
+		dir := tempDir(t)
+		files := make(map[string]string)
+		for _, file := range test.files {
+			files[file] = "content"
+		}
+		writeTree(t, dir, files)
+		version, err := packager.getReleaseNumber(dir)
+		if test.version == "" {
+			if err == nil {
+				t.Errorf("Tree %v gave version %q, expected an error",
+					test.files, version)
+			}
+			continue
+		}
+		if err != nil || version != test.version {
+			t.Errorf("Tree %v gave version %q (%v), expected %q",
+				test.files, version, err, test.version)
+		}
+	}
+}
+
+func TestGetReleaseNumberPrefersModules(t *testing.T) {
+	packager := newTestPackager(t, Options{})
+	dir := tempDir(t)
+	writeTree(t, dir, map[string]string{
+		path.Join(modulesBinaryDir, modulesFilename): `{"Changelist": 3525360}`,
+		"Backup-3450000/Default.ini":                 "setting=1",
+	})
+	version, err := packager.getReleaseNumber(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != "3525360" {
+		t.Errorf("Version is %s, expected the one of the modules file", version)
+	}
+}
@@ -0,0 +1,75 @@
+package packager
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// DiskUsageReport summarises the storage used by the packager
+type DiskUsageReport struct {
+	// ReleaseBytes is the size of the release dir, including hash caches
+	ReleaseBytes int64
+	// VersionBytes is the size of each installed version
+	VersionBytes map[string]int64
+	// PackageBytes is the size of the package dir
+	PackageBytes int64
+	// PackageCount is the number of files in the package dir
+	PackageCount int
+	// WorkingBytes is the size of the working dir
+	WorkingBytes int64
+	// WorkingFileCount is the number of files in the working dir
+	WorkingFileCount int
+}
+
+// DiskUsage returns the bytes used by the release, package and working dirs
+func (packager *Packager) DiskUsage() (DiskUsageReport, error) {
+	report := DiskUsageReport{
+		VersionBytes: make(map[string]int64),
+	}
+	var err error
+	report.ReleaseBytes, _, err = dirUsage(packager.releaseDir)
+	if err != nil {
+		return report, err
+	}
+	versions, err := packager.GetVersionList()
+	if err != nil {
+		return report, err
+	}
+	for _, version := range versions {
+		report.VersionBytes[version], _, err = dirUsage(
+			filepath.Join(packager.releaseDir, version))
+		if err != nil {
+			return report, err
+		}
+	}
+	report.PackageBytes, report.PackageCount, err = dirUsage(packager.packageDir)
+	if err != nil {
+		return report, err
+	}
+	report.WorkingBytes, report.WorkingFileCount, err = dirUsage(packager.workingDir)
+	if err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// dirUsage returns the total size and number of files in dir. A missing
+// dir is reported as empty
+func dirUsage(dir string) (int64, int, error) {
+	var size int64
+	var count int
+	err := filepath.Walk(dir, func(path string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !fileInfo.IsDir() {
+			size += fileInfo.Size()
+			count++
+		}
+		return nil
+	})
+	return size, count, err
+}
@@ -0,0 +1,60 @@
+package packager
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// treeSize returns the total size of the files in dir
+func treeSize(t *testing.T, dir string) int64 {
+	t.Helper()
+	var size int64
+	for _, content := range readTree(t, dir) {
+		size += int64(len(content))
+	}
+	return size
+}
+
+func TestDiskUsage(t *testing.T) {
+	packager := newTestPackager(t, Options{})
+	installTestVersion(t, packager, 3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+	})
+	installTestVersion(t, packager, 3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=22",
+	})
+	writeTree(t, packager.packageDir, map[string]string{
+		"3395761-3525360.tar.gz":     "12345678",
+		"3395761-3525360.tar.gz.sig": "1234",
+	})
+	writeTree(t, packager.workingDir, map[string]string{
+		"newrelease.zip": "123",
+	})
+
+	report, err := packager.DiskUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, version := range []string{"3395761", "3525360"} {
+		expected := treeSize(t, filepath.Join(packager.releaseDir, version))
+		if report.VersionBytes[version] != expected {
+			t.Errorf("Version %s uses %d bytes, expected %d",
+				version, report.VersionBytes[version], expected)
+		}
+	}
+	if report.VersionBytes["3525360"] != report.VersionBytes["3395761"]+1 {
+		t.Errorf("Version sizes are %v", report.VersionBytes)
+	}
+	if report.ReleaseBytes != treeSize(t, packager.releaseDir) {
+		t.Errorf("Release dir uses %d bytes, expected %d",
+			report.ReleaseBytes, treeSize(t, packager.releaseDir))
+	}
+	if report.PackageBytes != 12 || report.PackageCount != 2 {
+		t.Errorf("Package dir uses %d bytes in %d files, expected 12 in 2",
+			report.PackageBytes, report.PackageCount)
+	}
+	if report.WorkingBytes != 3 || report.WorkingFileCount != 1 {
+		t.Errorf("Working dir uses %d bytes in %d files, expected 3 in 1",
+			report.WorkingBytes, report.WorkingFileCount)
+	}
+}
@@ -0,0 +1,68 @@
+package packager
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Downloader downloads the release at uri to dest. Downloaders are
+// selected by the scheme of the download URI, HTTP and HTTPS use the
+// built-in HTTP downloader unless overridden
+type Downloader interface {
+	Download(ctx context.Context, uri string, dest string) error
+}
+
+// httpDownloader is the default Downloader for http and https URIs
+type httpDownloader struct {
+	packager *Packager
+}
+
+// Download downloads uri to dest over HTTP
+func (downloader *httpDownloader) Download(
+	ctx context.Context,
+	uri string,
+	dest string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return downloader.packager.downloadFile(dest, uri)
+}
+
+// isHTTPScheme checks if scheme is handled by the HTTP downloader
+func isHTTPScheme(scheme string) bool {
+	scheme = strings.ToLower(scheme)
+	return scheme == "http" || scheme == "https"
+}
+
+// isHTTPURL checks if uri is an http or https URL
+func isHTTPURL(uri string) bool {
+	parsedURL, err := url.Parse(uri)
+	return err == nil && isHTTPScheme(parsedURL.Scheme)
+}
+
+// downloaderFor returns the Downloader registered for the scheme of uri
+func (packager *Packager) downloaderFor(uri string) (Downloader, error) {
+	parsedURL, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	scheme := strings.ToLower(parsedURL.Scheme)
+	if downloader, ok := packager.options.Downloaders[scheme]; ok {
+		return downloader, nil
+	}
+	if isHTTPScheme(scheme) {
+		return &httpDownloader{packager: packager}, nil
+	}
+	return nil, fmt.Errorf("No downloader for '%s' URIs", scheme)
+}
+
+// download downloads uri to outputPath with the Downloader for its scheme
+func (packager *Packager) download(outputPath string, uri string) error {
+	downloader, err := packager.downloaderFor(uri)
+	if err != nil {
+		return err
+	}
+	return downloader.Download(context.Background(), uri, outputPath)
+}
@@ -0,0 +1,55 @@
+package packager
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// fakeDownloader serves a fixed release for any URI and records the URIs
+type fakeDownloader struct {
+	content []byte
+	uris    []string
+}
+
+func (downloader *fakeDownloader) Download(
+	ctx context.Context,
+	uri string,
+	dest string) error {
+	downloader.uris = append(downloader.uris, uri)
+	return ioutil.WriteFile(dest, downloader.content, 0644)
+}
+
+func TestDownloadAndExtractDispatchesByScheme(t *testing.T) {
+	downloader := &fakeDownloader{
+		content: zipFiles(t, releaseFiles(3525360, map[string]string{
+			"UnrealTournament/Config/Default.ini": "setting=2",
+		})),
+	}
+	packager := newTestPackager(t, Options{
+		Downloaders: map[string]Downloader{"magnet": downloader},
+	})
+
+	uri := "magnet:?xt=urn:btih:0123456789abcdef&dn=UnrealTournament-Linux.zip"
+	extractPath, err := packager.DownloadAndExtract(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(downloader.uris) != 1 || downloader.uris[0] != uri {
+		t.Errorf("Fake downloader got %v", downloader.uris)
+	}
+	content, err := ioutil.ReadFile(
+		filepath.Join(extractPath, "UnrealTournament/Config/Default.ini"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "setting=2" {
+		t.Errorf("Extracted file is %q", content)
+	}
+
+	_, err = packager.DownloadAndExtract("ipfs://QmRelease")
+	if err == nil {
+		t.Error("URI without a registered downloader was downloaded")
+	}
+}
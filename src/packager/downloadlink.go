@@ -0,0 +1,54 @@
+package packager
+
+import (
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+	log "github.com/sirupsen/logrus"
+)
+
+// structuredDownloadLink returns the download link from the configured feed
+// element or a Linux enclosure of the post that isn't another artifact. An
+// empty string is returned when the post doesn't have one, the link is
+// then scraped from the content
+func (packager *Packager) structuredDownloadLink(releasePost *gofeed.Item) string {
+	if link := extensionValue(releasePost, packager.options.DownloadLinkElement); link != "" {
+		log.WithField("element", packager.options.DownloadLinkElement).
+			Debug("Using the download link from the feed element")
+		return link
+	}
+	// gofeed maps RSS enclosures and Atom rel="enclosure" links to
+	// Enclosures
+	for _, enclosure := range releasePost.Enclosures {
+		if enclosure == nil || enclosure.URL == "" {
+			continue
+		}
+		artifact := packager.classifyLink(enclosure.URL)
+		if artifact != "" && artifact != packager.options.DownloadArtifact {
+			continue
+		}
+		if strings.Contains(strings.ToLower(enclosure.URL), "linux") {
+			log.Debug("Using the download link from the enclosure")
+			return strings.TrimSpace(enclosure.URL)
+		}
+	}
+	return ""
+}
+
+// extensionValue returns the value of the namespaced element, given as
+// prefix:name, of the post
+func extensionValue(releasePost *gofeed.Item, element string) string {
+	parts := strings.SplitN(element, ":", 2)
+	if len(parts) != 2 {
+		return ""
+	}
+	namespace, ok := releasePost.Extensions[parts[0]]
+	if !ok {
+		return ""
+	}
+	values := namespace[parts[1]]
+	if len(values) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(values[0].Value)
+}
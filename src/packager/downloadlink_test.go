@@ -0,0 +1,74 @@
+package packager
+
+import (
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// parseTestItem parses an RSS feed with a single item and returns it
+func parseTestItem(t *testing.T, item string) *gofeed.Item {
+	t.Helper()
+	feed, err := gofeed.NewParser().ParseString(
+		`<?xml version="1.0" encoding="UTF-8"?>` +
+			`<rss version="2.0" xmlns:ut="http://unrealtournament.com/ns">` +
+			`<channel><title>Unreal Tournament</title><item>` + item +
+			`</item></channel></rss>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feed.Items) != 1 {
+		t.Fatalf("Parsed %d items, expected 1", len(feed.Items))
+	}
+	return feed.Items[0]
+}
+
+func TestDownloadLinkPrefersEnclosure(t *testing.T) {
+	const enclosure = "https://cdn.example.com/UnrealTournament-Client-XAN-3525360-Linux.zip"
+	item := parseTestItem(t, `<title>UT Release 3525360</title>`+
+		`<enclosure url="https://cdn.example.com/UnrealTournament-Server-XAN-3525360-Linux.zip"`+
+		` length="1" type="application/zip"/>`+
+		`<enclosure url="`+enclosure+`" length="1" type="application/zip"/>`+
+		`<description><![CDATA[<a href="https://scraped.example.com/`+
+		`UnrealTournament-Client-XAN-3525360-Linux.zip">Linux client</a>]]></description>`)
+	packager := newTestPackager(t, Options{})
+
+	link, err := packager.extractUpdateDownloadLinkFromPost(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link != enclosure {
+		t.Errorf("Download link is %s, expected the enclosure %s", link, enclosure)
+	}
+}
+
+func TestDownloadLinkFromElement(t *testing.T) {
+	const element = "https://cdn.example.com/UnrealTournament-Client-XAN-3525360-Linux.zip"
+	item := parseTestItem(t, `<title>UT Release 3525360</title>`+
+		`<ut:download>`+element+`</ut:download>`+
+		`<description>No links</description>`)
+	packager := newTestPackager(t, Options{DownloadLinkElement: "ut:download"})
+
+	link, err := packager.extractUpdateDownloadLinkFromPost(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link != element {
+		t.Errorf("Download link is %s, expected the element %s", link, element)
+	}
+}
+
+func TestDownloadLinkFallsBackToScraping(t *testing.T) {
+	const scraped = "https://scraped.example.com/UnrealTournament-Client-XAN-3525360-Linux.zip"
+	item := parseTestItem(t, `<title>UT Release 3525360</title>`+
+		`<description><![CDATA[<a href="`+scraped+`">Linux client</a>]]></description>`)
+	packager := newTestPackager(t, Options{})
+
+	link, err := packager.extractUpdateDownloadLinkFromPost(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link != scraped {
+		t.Errorf("Download link is %s, expected the scraped %s", link, scraped)
+	}
+}
@@ -0,0 +1,49 @@
+package packager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRunWithoutContentLength(t *testing.T) {
+	fixture := newFixture(t)
+	fixture.installVersion(3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+	})
+	fixture.serveRelease(3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+	})
+	content := fixture.downloads["UnrealTournament-Client-XAN-3525360-Linux.zip"]
+	// Chunked responses don't have a Content-Length
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/zip")
+			w.WriteHeader(http.StatusOK)
+			if r.Method == http.MethodHead {
+				return
+			}
+			w.(http.Flusher).Flush()
+			w.Write(content)
+		}))
+	defer server.Close()
+	chunkedURL := server.URL + "/UnrealTournament-Client-XAN-3525360-Linux.zip"
+	fixture.addPost("UT Release 3525360", "post-3525360", chunkedURL, time.Now())
+	packager := fixture.newPackager(Options{})
+
+	size, err := packager.getDownloadSize(chunkedURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != UnknownDownloadSize {
+		t.Errorf("Download size is %f, expected unknown", size)
+	}
+	result, err := packager.Run()
+	if err != nil {
+		t.Fatalf("Run without a Content-Length failed: %s", err)
+	}
+	if len(result.Packages) != 1 {
+		t.Errorf("Created %d packages, expected 1", len(result.Packages))
+	}
+}
@@ -0,0 +1,48 @@
+package packager
+
+import (
+	"errors"
+	"time"
+
+	"github.com/donovansolms/ut4-update-packager/src/packager/models"
+	"github.com/jinzhu/gorm"
+)
+
+// ErrEmptyDelta is returned when there are no changes between two versions
+// and no package is created
+var ErrEmptyDelta = errors.New("Nothing changed between the versions")
+
+// isEmptyDelta checks if pair was recorded as having no changes
+func (packager *Packager) isEmptyDelta(
+	db *gorm.DB,
+	pair VersionPair) (bool, error) {
+	var emptyDelta models.Ut4EmptyDeltas
+	query := db.Where(
+		"from_version = ? AND to_version = ? AND channel = ? AND scope = ? "+
+			"AND is_deleted = 0",
+		pair.FromVersion,
+		pair.ToVersion,
+		packager.releaseChannel(),
+		packager.packageScope(),
+	).First(&emptyDelta)
+	if query.Error == gorm.ErrRecordNotFound {
+		return false, nil
+	}
+	if query.Error != nil {
+		return false, query.Error
+	}
+	return true, nil
+}
+
+// recordEmptyDelta records that pair has no changes
+func (packager *Packager) recordEmptyDelta(
+	db *gorm.DB,
+	pair VersionPair) error {
+	return db.Save(&models.Ut4EmptyDeltas{
+		FromVersion: pair.FromVersion,
+		ToVersion:   pair.ToVersion,
+		Channel:     packager.releaseChannel(),
+		Scope:       packager.packageScope(),
+		DateCreated: time.Now(),
+	}).Error
+}
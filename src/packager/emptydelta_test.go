@@ -0,0 +1,65 @@
+package packager
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestIdenticalVersionsCreateNoPackage(t *testing.T) {
+	fixture := newFixture(t)
+	packager := fixture.newPackager(Options{RecordEmptyDeltas: true})
+	// The trees are identical down to the modules file
+	files := releaseFiles(3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+	})
+	writeTree(t, filepath.Join(fixture.releaseDir, "3395761"), files)
+	writeTree(t, filepath.Join(fixture.releaseDir, "3525360"), files)
+
+	_, err := packager.GeneratePackage("3395761", "3525360")
+	if err != ErrEmptyDelta {
+		t.Fatalf("Generating the package returned %v, expected %v", err, ErrEmptyDelta)
+	}
+
+	db, err := packager.openDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	result, err := packager.packageRelease(db, RunResult{Version: "3525360"}, "", 0, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []VersionPair{{FromVersion: "3395761", ToVersion: "3525360"}}
+	if !reflect.DeepEqual(result.Unchanged, expected) {
+		t.Errorf("Unchanged pairs are %v, expected %v", result.Unchanged, expected)
+	}
+	if len(result.Packages) != 0 {
+		t.Errorf("Packages were built: %v", result.Packages)
+	}
+	entries, err := ioutil.ReadDir(fixture.packageDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			t.Errorf("Package file %s was created", entry.Name())
+		}
+	}
+	var count int
+	fixture.db().Table("ut4_update_packages").Count(&count)
+	if count != 0 {
+		t.Errorf("%d package rows were created", count)
+	}
+
+	// The recorded pair isn't compared again
+	result, err = packager.packageRelease(db, RunResult{Version: "3525360"}, "", 0, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Unchanged) != 0 {
+		t.Errorf("Recorded empty delta was compared again: %v", result.Unchanged)
+	}
+}
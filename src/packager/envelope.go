@@ -0,0 +1,39 @@
+package packager
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// checkReleaseEnvelope verifies the file count and total size of the
+// extracted release at releasePath fall within the configured bounds.
+// Bounds that are 0 are not checked
+func (packager *Packager) checkReleaseEnvelope(releasePath string) error {
+	size, count, err := dirUsage(releasePath)
+	if err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{
+		"files": count,
+		"size":  fmt.Sprintf("%.2fMB", float64(size)/1024.00/1024.00),
+	}).Debug("Release size")
+	options := packager.options
+	if options.MinReleaseFiles > 0 && count < options.MinReleaseFiles {
+		return fmt.Errorf("Release has %d files, expected at least %d",
+			count, options.MinReleaseFiles)
+	}
+	if options.MaxReleaseFiles > 0 && count > options.MaxReleaseFiles {
+		return fmt.Errorf("Release has %d files, expected at most %d",
+			count, options.MaxReleaseFiles)
+	}
+	if options.MinReleaseBytes > 0 && size < options.MinReleaseBytes {
+		return fmt.Errorf("Release is %d bytes, expected at least %d",
+			size, options.MinReleaseBytes)
+	}
+	if options.MaxReleaseBytes > 0 && size > options.MaxReleaseBytes {
+		return fmt.Errorf("Release is %d bytes, expected at most %d",
+			size, options.MaxReleaseBytes)
+	}
+	return nil
+}
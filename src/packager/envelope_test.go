@@ -0,0 +1,59 @@
+package packager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckReleaseEnvelope(t *testing.T) {
+	dir := tempDir(t)
+	// 3 files of 10 bytes
+	writeTree(t, dir, map[string]string{
+		"a": "0123456789",
+		"b": "0123456789",
+		"c": "0123456789",
+	})
+	tests := []struct {
+		options Options
+		valid   bool
+	}{
+		{Options{}, true},
+		{Options{MinReleaseFiles: 3, MaxReleaseFiles: 3, MinReleaseBytes: 30, MaxReleaseBytes: 30}, true},
+		{Options{MinReleaseFiles: 4}, false},
+		{Options{MaxReleaseFiles: 2}, false},
+		{Options{MinReleaseBytes: 31}, false},
+		{Options{MaxReleaseBytes: 29}, false},
+	}
+	for _, test := range tests {
+		packager := &Packager{options: test.options}
+		err := packager.checkReleaseEnvelope(dir)
+		if test.valid && err != nil {
+			t.Errorf("Options %+v: %s", test.options, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("Options %+v: release within the bounds", test.options)
+		}
+	}
+}
+
+func TestRunRejectsTinyRelease(t *testing.T) {
+	fixture := newFixture(t)
+	fixture.installVersion(3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+	})
+	downloadURL := fixture.serveRelease(3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+	})
+	fixture.addPost("UT Release 3525360", "post-3525360", downloadURL, time.Now())
+	packager := fixture.newPackager(Options{MinReleaseBytes: 1024 * 1024})
+
+	_, err := packager.Run()
+	if err == nil {
+		t.Fatal("Tiny release passed the lower bound")
+	}
+	if _, err := os.Stat(filepath.Join(fixture.releaseDir, "3525360")); !os.IsNotExist(err) {
+		t.Error("Tiny release was installed")
+	}
+}
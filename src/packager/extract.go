@@ -0,0 +1,281 @@
+package packager
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// extract extracts the ZIP file to extractPath. Archives inside the release
+// are extracted as well up to the configured depth
+func (packager *Packager) extract(extractPath string, zipPath string) error {
+	err := packager.extractZip(extractPath, zipPath)
+	if err != nil {
+		return err
+	}
+	return packager.extractNested(extractPath, packager.options.ExtractDepth-1)
+}
+
+// extractNested extracts the known archive types found in dir into a
+// directory named after the archive, removing the archive afterwards.
+// This repeats for depth levels
+func (packager *Packager) extractNested(dir string, depth int) error {
+	if depth <= 0 {
+		return nil
+	}
+	var archives []string
+	err := filepath.Walk(dir, func(path string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fileInfo.IsDir() && nestedArchiveName(path) != "" {
+			archives = append(archives, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, archivePath := range archives {
+		outputPath := filepath.Join(
+			filepath.Dir(archivePath),
+			nestedArchiveName(archivePath))
+		log.WithField("archive", archivePath).Debug("Extracting nested archive")
+		if strings.HasSuffix(strings.ToLower(archivePath), ".zip") {
+			err = packager.extractZip(outputPath, archivePath)
+		} else {
+			err = packager.extractTar(outputPath, archivePath)
+		}
+		if err != nil {
+			return err
+		}
+		err = os.Remove(archivePath)
+		if err != nil {
+			return err
+		}
+		err = packager.extractNested(outputPath, depth-1)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nestedArchiveName returns the name of the directory a nested archive is
+// extracted to, or an empty string if path is not a known archive type
+func nestedArchiveName(path string) string {
+	name := filepath.Base(path)
+	lowerName := strings.ToLower(name)
+	for _, extension := range []string{".tar.gz", ".tgz", ".tar", ".zip"} {
+		if strings.HasSuffix(lowerName, extension) {
+			return name[:len(name)-len(extension)]
+		}
+	}
+	return ""
+}
+
+// extractZip extracts the ZIP file to extractPath
+func (packager *Packager) extractZip(extractPath string, zipPath string) error {
+	err := os.MkdirAll(extractPath, 0744)
+	if err != nil {
+		return err
+	}
+	zipReader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return err
+	}
+	defer zipReader.Close()
+
+	limit := newExtractLimit(packager.options.MaxExtractBytes)
+	for _, zipFile := range zipReader.File {
+		outputPath, err := safeExtractPath(extractPath, zipFile.Name)
+		if err != nil {
+			return err
+		}
+		if zipFile.FileInfo().IsDir() {
+			os.MkdirAll(outputPath, zipFile.Mode())
+			continue
+		}
+		// Create the directory when no separate directory entry exists
+		os.MkdirAll(filepath.Dir(outputPath), zipFile.Mode())
+		if packager.options.ResumeExtraction &&
+			packager.isExtracted(outputPath, zipFile) {
+			err = limit.skip(outputPath, int64(zipFile.UncompressedSize64))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		zipFileReader, err := zipFile.Open()
+		if err != nil {
+			return err
+		}
+		// The zip reader skips the check for entries with a zero CRC in
+		// the central directory, so check every entry here
+		checksum := crc32.NewIEEE()
+		err = limit.writeFile(
+			outputPath,
+			io.TeeReader(zipFileReader, checksum),
+			zipFile.Mode())
+		zipFileReader.Close()
+		if err == zip.ErrChecksum ||
+			(err == nil && checksum.Sum32() != zipFile.CRC32) {
+			return fmt.Errorf("Zip entry '%s' has CRC-32 %08x, expected %08x",
+				zipFile.Name, checksum.Sum32(), zipFile.CRC32)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractTar extracts a tar or gzipped tar file to extractPath
+func (packager *Packager) extractTar(extractPath string, tarPath string) error {
+	err := os.MkdirAll(extractPath, 0744)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(tarPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if !strings.HasSuffix(strings.ToLower(tarPath), ".tar") {
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	}
+
+	limit := newExtractLimit(packager.options.MaxExtractBytes)
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		outputPath, err := safeExtractPath(extractPath, header.Name)
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			os.MkdirAll(outputPath, os.FileMode(header.Mode))
+		case tar.TypeReg:
+			os.MkdirAll(filepath.Dir(outputPath), 0755)
+			err = limit.writeFile(outputPath, tarReader, os.FileMode(header.Mode))
+			if err != nil {
+				return err
+			}
+		default:
+			log.WithField("entry", header.Name).Debug("Skipping unsupported tar entry")
+		}
+	}
+}
+
+// isExtracted checks if the file at outputPath is a complete extraction of
+// zipFile by comparing the size and, when configured, the CRC-32
+func (packager *Packager) isExtracted(outputPath string, zipFile *zip.File) bool {
+	fileInfo, err := os.Stat(outputPath)
+	if err != nil || fileInfo.IsDir() ||
+		fileInfo.Size() != int64(zipFile.UncompressedSize64) {
+		return false
+	}
+	if packager.options.ResumeExtractionCRC {
+		file, err := os.Open(outputPath)
+		if err != nil {
+			return false
+		}
+		defer file.Close()
+		checksum := crc32.NewIEEE()
+		_, err = io.Copy(checksum, file)
+		if err != nil || checksum.Sum32() != zipFile.CRC32 {
+			return false
+		}
+	}
+	log.WithField("path", outputPath).Debug("Already extracted, skipping")
+	return true
+}
+
+// safeExtractPath joins name to extractPath and rejects entries that would
+// end up outside extractPath (Zip Slip)
+func safeExtractPath(extractPath string, name string) (string, error) {
+	outputPath := filepath.Join(extractPath, name)
+	cleanExtractPath := filepath.Clean(extractPath) + string(os.PathSeparator)
+	if !strings.HasPrefix(outputPath+string(os.PathSeparator), cleanExtractPath) {
+		return "", fmt.Errorf("Archive entry '%s' is outside the extract path", name)
+	}
+	return outputPath, nil
+}
+
+// extractLimit caps the number of bytes extracted from a single archive,
+// a limit of 0 means no limit
+type extractLimit struct {
+	remaining int64
+	limited   bool
+}
+
+// newExtractLimit creates a limit of maxBytes
+func newExtractLimit(maxBytes int64) *extractLimit {
+	return &extractLimit{
+		remaining: maxBytes,
+		limited:   maxBytes > 0,
+	}
+}
+
+// skip counts size bytes of an already extracted file towards the limit
+func (limit *extractLimit) skip(outputPath string, size int64) error {
+	if !limit.limited {
+		return nil
+	}
+	limit.remaining -= size
+	if limit.remaining < 0 {
+		return fmt.Errorf("Archive exceeds the maximum extract size at '%s'", outputPath)
+	}
+	return nil
+}
+
+// writeFile copies reader to outputPath, counting towards the limit
+func (limit *extractLimit) writeFile(
+	outputPath string,
+	reader io.Reader,
+	mode os.FileMode) error {
+	outputFile, err := os.OpenFile(
+		outputPath,
+		os.O_WRONLY|os.O_CREATE|os.O_TRUNC,
+		mode)
+	if err != nil {
+		return err
+	}
+	defer outputFile.Close()
+	if !limit.limited {
+		_, err = io.Copy(outputFile, reader)
+		return err
+	}
+	// Copy one byte more than allowed to detect going over the limit
+	written, err := io.CopyN(outputFile, reader, limit.remaining+1)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	limit.remaining -= written
+	if limit.remaining < 0 {
+		return fmt.Errorf("Archive exceeds the maximum extract size at '%s'", outputPath)
+	}
+	return nil
+}
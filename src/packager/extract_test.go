@@ -0,0 +1,216 @@
+package packager
+
+import (
+	"archive/zip"
+	"bytes"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeNestedZip writes a release zip holding the zip of innerFiles as
+// Content.zip and returns its path
+func writeNestedZip(t *testing.T, dir string, innerFiles map[string]string) string {
+	t.Helper()
+	zipPath := filepath.Join(dir, "release.zip")
+	content := zipFiles(t, map[string]string{
+		"UnrealTournament/Default.ini": "setting=1",
+		"UnrealTournament/Content.zip": string(zipFiles(t, innerFiles)),
+	})
+	err := ioutil.WriteFile(zipPath, content, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zipPath
+}
+
+func TestExtractNestedZip(t *testing.T) {
+	dir := tempDir(t)
+	zipPath := writeNestedZip(t, dir, map[string]string{
+		"Paks/game.pak": "pak",
+	})
+	packager := newTestPackager(t, Options{ExtractDepth: 2})
+	extractPath := filepath.Join(dir, "extracted")
+	err := packager.extract(extractPath, zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(
+		filepath.Join(extractPath, "UnrealTournament", "Content", "Paks", "game.pak"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "pak" {
+		t.Errorf("Nested file is %q", content)
+	}
+	_, err = os.Stat(filepath.Join(extractPath, "UnrealTournament", "Content.zip"))
+	if !os.IsNotExist(err) {
+		t.Error("Nested archive wasn't removed")
+	}
+}
+
+func TestExtractDefaultDepthKeepsNestedZip(t *testing.T) {
+	dir := tempDir(t)
+	zipPath := writeNestedZip(t, dir, map[string]string{
+		"Paks/game.pak": "pak",
+	})
+	packager := newTestPackager(t, Options{})
+	extractPath := filepath.Join(dir, "extracted")
+	err := packager.extract(extractPath, zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = os.Stat(filepath.Join(extractPath, "UnrealTournament", "Content.zip"))
+	if err != nil {
+		t.Errorf("Nested archive was touched: %s", err)
+	}
+}
+
+func TestExtractNestedZipSlip(t *testing.T) {
+	dir := tempDir(t)
+	zipPath := writeNestedZip(t, dir, map[string]string{
+		"../../../evil.txt": "evil",
+	})
+	packager := newTestPackager(t, Options{ExtractDepth: 2})
+	err := packager.extract(filepath.Join(dir, "extracted"), zipPath)
+	if err == nil {
+		t.Fatal("Nested entry outside the extract path didn't fail")
+	}
+	_, err = os.Stat(filepath.Join(dir, "evil.txt"))
+	if !os.IsNotExist(err) {
+		t.Error("Nested entry was written outside the extract path")
+	}
+}
+
+func TestExtractNestedZipSizeCap(t *testing.T) {
+	dir := tempDir(t)
+	zipPath := writeNestedZip(t, dir, map[string]string{
+		"Paks/game.pak": strings.Repeat("a", 64*1024),
+	})
+	packager := newTestPackager(t, Options{
+		ExtractDepth:    2,
+		MaxExtractBytes: 16 * 1024,
+	})
+	err := packager.extract(filepath.Join(dir, "extracted"), zipPath)
+	if err == nil {
+		t.Error("Nested archive over the size cap didn't fail")
+	}
+}
+
+func TestResumeExtraction(t *testing.T) {
+	dir := tempDir(t)
+	files := map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+		"UnrealTournament/Content/Map.umap":   "complete map",
+		"UnrealTournament/Content/Game.pak":   "complete pak",
+		"UnrealTournament/Content/Same.txt":   "same size",
+	}
+	zipPath := filepath.Join(dir, "release.zip")
+	err := ioutil.WriteFile(zipPath, zipFiles(t, files), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fullPath := filepath.Join(dir, "full")
+	err = newTestPackager(t, Options{}).extract(fullPath, zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The interrupted run extracted the config, stopped halfway through the
+	// pak and left a file of the right size with the wrong content
+	resumedPath := filepath.Join(dir, "resumed")
+	writeTree(t, resumedPath, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+		"UnrealTournament/Content/Game.pak":   "compl",
+		"UnrealTournament/Content/Same.txt":   "SAME SIZE",
+	})
+	configPath := filepath.Join(resumedPath, "UnrealTournament/Config/Default.ini")
+	extracted := time.Now().Add(-time.Hour).Truncate(time.Second)
+	err = os.Chtimes(configPath, extracted, extracted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packager := newTestPackager(t, Options{
+		ResumeExtraction:    true,
+		ResumeExtractionCRC: true,
+	})
+	err = packager.extract(resumedPath, zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resumed := readTree(t, resumedPath)
+	full := readTree(t, fullPath)
+	if !reflect.DeepEqual(resumed, full) {
+		t.Errorf("Resumed extraction is %v, expected %v", resumed, full)
+	}
+	fileInfo, err := os.Stat(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fileInfo.ModTime().Equal(extracted) {
+		t.Error("Extracted file was extracted again")
+	}
+}
+
+// writeBadCRCZip writes a zip holding a single stored entry with content and
+// the CRC-32 crc in its headers and returns its path
+func writeBadCRCZip(t *testing.T, dir string, name string, content string, crc uint32) string {
+	t.Helper()
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	entry, err := writer.CreateRaw(&zip.FileHeader{
+		Name:               name,
+		Method:             zip.Store,
+		CRC32:              crc,
+		CompressedSize64:   uint64(len(content)),
+		UncompressedSize64: uint64(len(content)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = entry.Write([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	zipPath := filepath.Join(dir, "corrupt.zip")
+	err = ioutil.WriteFile(zipPath, buffer.Bytes(), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zipPath
+}
+
+func TestExtractRejectsWrongCRC(t *testing.T) {
+	const name = "UnrealTournament/Default.ini"
+	const content = "setting=1"
+	for _, test := range []struct {
+		description string
+		crc         uint32
+	}{
+		{"wrong CRC", crc32.ChecksumIEEE([]byte(content)) ^ 1},
+		// The zip reader doesn't check entries with a zero CRC itself
+		{"zero CRC", 0},
+	} {
+		dir := tempDir(t)
+		zipPath := writeBadCRCZip(t, dir, name, content, test.crc)
+		packager := newTestPackager(t, Options{})
+		err := packager.extract(filepath.Join(dir, "extracted"), zipPath)
+		if err == nil {
+			t.Errorf("%s: corrupt entry was extracted", test.description)
+			continue
+		}
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("%s: error %q doesn't name the entry", test.description, err)
+		}
+	}
+}
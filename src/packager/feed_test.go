@@ -0,0 +1,124 @@
+package packager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+const (
+	testClientLink = "https://s3.amazonaws.com/unrealtournament/" +
+		"UnrealTournament-Client-XAN-3525360-Linux.zip"
+	testServerLink = "https://s3.amazonaws.com/unrealtournament/" +
+		"UnrealTournament-Server-XAN-3525360-Linux.zip"
+)
+
+// testPostHTML links the Linux client and server builds
+const testPostHTML = `<p>Get the <a href="` + testServerLink + `">server</a>
+and the <a href="` + testClientLink + `">client</a></p>`
+
+const atomFeed = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>Unreal Tournament</title>
+  <entry>
+    <title>UT Release 3525360</title>
+    <id>tag:epicgames.com,2017:3525360</id>
+    <updated>2017-07-03T12:00:00Z</updated>
+    <content type="html"><![CDATA[` + testPostHTML + `]]></content>
+  </entry>
+</feed>`
+
+const rssFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:content="http://purl.org/rss/1.0/modules/content/">
+  <channel>
+    <title>Unreal Tournament</title>
+    <item>
+      <title>UT Release 3525360</title>
+      <guid>post-3525360</guid>
+      <description>Release notes</description>
+      <content:encoded><![CDATA[` + testPostHTML + `]]></content:encoded>
+    </item>
+  </channel>
+</rss>`
+
+func TestDownloadLinkFromFeedTypes(t *testing.T) {
+	packager := newTestPackager(t, Options{})
+	for name, feedContent := range map[string]string{
+		"atom": atomFeed,
+		"rss":  rssFeed,
+	} {
+		feed, err := gofeed.NewParser().ParseString(feedContent)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if len(feed.Items) != 1 {
+			t.Fatalf("%s: %d items parsed", name, len(feed.Items))
+		}
+		link, err := packager.extractUpdateDownloadLinkFromPost(feed.Items[0])
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if link != testClientLink {
+			t.Errorf("%s: download link is %q", name, link)
+		}
+	}
+}
+
+func TestDownloadLinkFromJSONFeedItem(t *testing.T) {
+	packager := newTestPackager(t, Options{})
+	// JSON Feed content_html is normalised into Content, content_text into
+	// Description
+	for _, item := range []*gofeed.Item{
+		{Title: "UT Release 3525360", Content: testPostHTML},
+		{Title: "UT Release 3525360", Description: testPostHTML},
+	} {
+		link, err := packager.extractUpdateDownloadLinkFromPost(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if link != testClientLink {
+			t.Errorf("Download link is %q", link)
+		}
+	}
+}
+
+func TestDownloadLinkFromEmptyPost(t *testing.T) {
+	packager := newTestPackager(t, Options{})
+	_, err := packager.extractUpdateDownloadLinkFromPost(&gofeed.Item{
+		Title: "UT Release 3525360",
+	})
+	if err == nil {
+		t.Error("Empty post didn't fail")
+	}
+}
+
+func TestRunWithPostWithoutDate(t *testing.T) {
+	fixture := newFixture(t)
+	fixture.installVersion(3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+	})
+	downloadURL := fixture.serveRelease(3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+	})
+	fixture.addPost("UT Release 3525360", "post-3525360", downloadURL, time.Time{})
+
+	// Posts without a date are skipped when a valid date is required
+	packager := fixture.newPackager(Options{RequireValidDate: true})
+	result, err := packager.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Version != "" {
+		t.Errorf("Post without a date was processed: %+v", result)
+	}
+
+	packager = fixture.newPackager(Options{})
+	result, err = packager.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Version != "3525360" || len(result.Packages) != 1 {
+		t.Errorf("Post without a date wasn't processed: %+v", result)
+	}
+}
@@ -0,0 +1,60 @@
+package packager
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	log "github.com/sirupsen/logrus"
+)
+
+// feedCacheFilename stores the last successfully fetched feed
+const feedCacheFilename = ".feed-cache.json"
+
+// cachedFeed is the content of the feed cache
+type cachedFeed struct {
+	Fetched time.Time    `json:"fetched"`
+	Feed    *gofeed.Feed `json:"feed"`
+}
+
+// writeFeedCache stores feed as the last successfully fetched feed
+func (packager *Packager) writeFeedCache(feed *gofeed.Feed) error {
+	cacheBytes, err := json.Marshal(&cachedFeed{
+		Fetched: time.Now(),
+		Feed:    feed,
+	})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(
+		filepath.Join(packager.releaseDir, feedCacheFilename),
+		cacheBytes)
+}
+
+// readFeedCache returns the cached feed when it is not older than the
+// configured max age. fetchErr is returned when there is no usable cache
+func (packager *Packager) readFeedCache(fetchErr error) (*gofeed.Feed, error) {
+	cacheBytes, err := ioutil.ReadFile(
+		filepath.Join(packager.releaseDir, feedCacheFilename))
+	if err != nil {
+		return nil, fetchErr
+	}
+	var cache cachedFeed
+	err = json.Unmarshal(cacheBytes, &cache)
+	if err != nil || cache.Feed == nil {
+		log.WithField("err", "read_feed_cache").Warning("Feed cache is corrupt")
+		return nil, fetchErr
+	}
+	age := time.Since(cache.Fetched)
+	if age > packager.options.FeedCacheMaxAge {
+		log.WithField("age", age.String()).Warning("Feed cache is too old to use")
+		return nil, fetchErr
+	}
+	log.WithFields(log.Fields{
+		"err": fetchErr.Error(),
+		"age": age.String(),
+	}).Warning("Feed fetch failed, using the cached feed")
+	return cache.Feed, nil
+}
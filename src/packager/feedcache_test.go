@@ -0,0 +1,41 @@
+package packager
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFetchFeedFallsBackToCache(t *testing.T) {
+	fixture := newFixture(t)
+	fixture.addPost("UT Release 3525360", "post-3525360",
+		fixture.server.URL+"/UnrealTournament-Client-XAN-3525360-Linux.zip", time.Now())
+	packager := fixture.newPackager(Options{FeedCacheMaxAge: time.Hour})
+	_, err := packager.fetchFeed()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The feed is unavailable now
+	fixture.server.Close()
+	feed, err := packager.fetchFeed()
+	if err != nil {
+		t.Fatalf("Cached feed wasn't used: %s", err)
+	}
+	if len(feed.Items) != 1 || feed.Items[0].GUID != "post-3525360" {
+		t.Errorf("Cached feed has items %+v", feed.Items)
+	}
+
+	// Stale caches aren't used
+	packager.options.FeedCacheMaxAge = time.Nanosecond
+	_, err = packager.fetchFeed()
+	if err == nil {
+		t.Error("Stale cached feed was used")
+	}
+
+	// Without a max age there is no fallback
+	packager = fixture.newPackager(Options{})
+	_, err = packager.fetchFeed()
+	if err == nil {
+		t.Error("Cached feed was used with caching disabled")
+	}
+}
@@ -0,0 +1,87 @@
+package packager
+
+import (
+	"github.com/donovansolms/ut4-update-packager/src/packager/models"
+)
+
+// storeFileHashes replaces the per-file hash rows for version
+func (packager *Packager) storeFileHashes(
+	version string,
+	hashes map[string]string) error {
+	db, err := packager.openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx := db.Begin()
+	query := tx.Where("version = ?", version).Delete(models.Ut4FileHashes{})
+	if query.Error != nil {
+		tx.Rollback()
+		return query.Error
+	}
+	for path, hash := range hashes {
+		query = tx.Create(&models.Ut4FileHashes{
+			Version: version,
+			Path:    path,
+			Hash:    hash,
+		})
+		if query.Error != nil {
+			tx.Rollback()
+			return query.Error
+		}
+	}
+	return tx.Commit().Error
+}
+
+// FindVersionsWithFile returns the versions that contain the file at path
+// with the given hash. Requires StoreFileHashes to be enabled
+func (packager *Packager) FindVersionsWithFile(
+	path string,
+	hash string) ([]string, error) {
+	db, err := packager.openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var versions []string
+	query := db.Model(&models.Ut4FileHashes{}).
+		Where("path = ? AND hash = ?", path, hash).
+		Pluck("version", &versions)
+	if query.Error != nil {
+		return nil, query.Error
+	}
+	packager.sortVersions(versions)
+	return versions, nil
+}
+
+// ensureFileHashes stores the per-file hash rows of version from its
+// cached hashes unless it has rows already
+func (packager *Packager) ensureFileHashes(
+	version string,
+	hashes map[string]string) error {
+	if packager.fileHashVersions[version] {
+		return nil
+	}
+	db, err := packager.openDB()
+	if err != nil {
+		return err
+	}
+	var count int
+	query := db.Model(&models.Ut4FileHashes{}).
+		Where("version = ?", version).
+		Count(&count)
+	db.Close()
+	if query.Error != nil {
+		return query.Error
+	}
+	if count == 0 {
+		err = packager.storeFileHashes(version, hashes)
+		if err != nil {
+			return err
+		}
+	}
+	packager.fileHashVersions[version] = true
+	return nil
+}
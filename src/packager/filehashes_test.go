@@ -0,0 +1,81 @@
+package packager
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func contentHash(content string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+}
+
+func TestFindVersionsWithFile(t *testing.T) {
+	fixture := newFixture(t)
+	packager := fixture.newPackager(Options{StoreFileHashes: true})
+	for changelist, content := range map[int]string{
+		3395761: "setting=1",
+		3450000: "setting=2",
+		3525360: "setting=1",
+	} {
+		installTestVersion(t, packager, changelist, map[string]string{
+			"UnrealTournament/Config/Default.ini": content,
+		})
+		_, err := packager.getVersionHashes(fmt.Sprint(changelist))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	versions, err := packager.FindVersionsWithFile(
+		"UnrealTournament/Config/Default.ini",
+		contentHash("setting=1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"3395761", "3525360"}
+	if !reflect.DeepEqual(versions, expected) {
+		t.Errorf("Versions with the file are %v, expected %v", versions, expected)
+	}
+	versions, err = packager.FindVersionsWithFile(
+		"UnrealTournament/Config/Default.ini",
+		contentHash("setting=3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 0 {
+		t.Errorf("Versions with an unknown hash are %v", versions)
+	}
+}
+
+func TestFileHashesStoredFromHashCache(t *testing.T) {
+	fixture := newFixture(t)
+	packager := fixture.newPackager(Options{})
+	installTestVersion(t, packager, 3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+	})
+	// Hashed and cached before the option is enabled
+	_, err := packager.getVersionHashes("3395761")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packager = fixture.newPackager(Options{StoreFileHashes: true})
+	_, err = packager.getVersionHashes("3395761")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packager.HashCacheStats().Hits != 1 {
+		t.Fatalf("Hash cache wasn't used: %+v", packager.HashCacheStats())
+	}
+	versions, err := packager.FindVersionsWithFile(
+		"UnrealTournament/Config/Default.ini",
+		contentHash("setting=1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(versions, []string{"3395761"}) {
+		t.Errorf("Versions with the file are %v", versions)
+	}
+}
@@ -0,0 +1,99 @@
+package packager
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// StorageArchive stores the added and modified files in the package
+	StorageArchive = "archive"
+	// StorageFiles stores each added and modified file compressed in the
+	// files dir of the package dir. Packages then contain a files.json
+	// listing the stored files
+	StorageFiles = "files"
+)
+
+// fileStoreDirName is the dir in the package dir for individually stored
+// files, one subdir per version
+const fileStoreDirName = "files"
+
+// filesFilename is the package entry listing the individually stored files
+const filesFilename = "files.json"
+
+// StoredFile is a single file stored by StorageFiles
+type StoredFile struct {
+	// Path is relative to the files dir, <version>/<filename>.gz
+	Path           string `json:"path"`
+	Hash           string `json:"hash"`
+	Size           int64  `json:"size"`
+	CompressedSize int64  `json:"compressedSize"`
+}
+
+// storeCompressedFile stores filename of version gzip compressed in the
+// files dir. Files already stored for version by another package are
+// reused
+func (packager *Packager) storeCompressedFile(
+	version string,
+	filename string,
+	hash string) (StoredFile, error) {
+	storedFile := StoredFile{
+		Path: filepath.ToSlash(filepath.Join(version, filename)) + ".gz",
+		Hash: hash,
+	}
+	sourcePath := filepath.Join(packager.releaseDir, version, filename)
+	sourceInfo, err := os.Stat(sourcePath)
+	if err != nil {
+		return storedFile, err
+	}
+	storedFile.Size = sourceInfo.Size()
+
+	destinationPath := filepath.Join(
+		packager.packageDir,
+		fileStoreDirName,
+		filepath.FromSlash(storedFile.Path))
+	destinationInfo, err := os.Stat(destinationPath)
+	if err == nil {
+		storedFile.CompressedSize = destinationInfo.Size()
+		return storedFile, nil
+	}
+	err = os.MkdirAll(filepath.Dir(destinationPath), 0755)
+	if err != nil {
+		return storedFile, err
+	}
+
+	source, err := os.Open(sourcePath)
+	if err != nil {
+		return storedFile, err
+	}
+	defer source.Close()
+	tempPath := destinationPath + ".tmp"
+	destination, err := os.Create(tempPath)
+	if err != nil {
+		return storedFile, err
+	}
+	gzipWriter := gzip.NewWriter(destination)
+	_, err = io.Copy(gzipWriter, source)
+	if err == nil {
+		err = gzipWriter.Close()
+	}
+	if closeErr := destination.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return storedFile, err
+	}
+	err = os.Rename(tempPath, destinationPath)
+	if err != nil {
+		return storedFile, err
+	}
+	destinationInfo, err = os.Stat(destinationPath)
+	if err != nil {
+		return storedFile, err
+	}
+	storedFile.CompressedSize = destinationInfo.Size()
+	return storedFile, nil
+}
@@ -0,0 +1,83 @@
+package packager
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestFilesStorageStoresChangedFiles(t *testing.T) {
+	packager := newTestPackager(t, Options{StorageMode: StorageFiles})
+	installTestVersion(t, packager, 3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+		"UnrealTournament/Content/Kept.txt":   "kept",
+	})
+	installTestVersion(t, packager, 3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+		"UnrealTournament/Content/Kept.txt":   "kept",
+		"UnrealTournament/Content/Added.txt":  "added",
+	})
+	_, err := packager.GeneratePackage("3395761", "3525360")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := readPackage(t, filepath.Join(packager.packageDir, "3395761-3525360.tar.gz"))
+	if _, ok := files["UnrealTournament/Content/Added.txt"]; ok {
+		t.Error("Stored file is in the package as well")
+	}
+	var manifest map[string]StoredFile
+	err = json.Unmarshal([]byte(files[filesFilename]), &manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var listed []string
+	for filename := range manifest {
+		listed = append(listed, filename)
+	}
+	sort.Strings(listed)
+	expected := []string{
+		modulesBinaryDir + "/" + modulesFilename,
+		"UnrealTournament/Config/Default.ini",
+		"UnrealTournament/Content/Added.txt",
+	}
+	if !reflect.DeepEqual(listed, expected) {
+		t.Fatalf("Manifest lists %v, expected %v", listed, expected)
+	}
+
+	release := releaseFiles(3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+		"UnrealTournament/Content/Added.txt":  "added",
+	})
+	for _, filename := range listed {
+		storedFile := manifest[filename]
+		if storedFile.Path != "3525360/"+filename+".gz" {
+			t.Errorf("%s is stored at %s", filename, storedFile.Path)
+		}
+		file, err := os.Open(filepath.Join(
+			packager.packageDir, fileStoreDirName, filepath.FromSlash(storedFile.Path)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadAll(gzipReader)
+		file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != release[filename] {
+			t.Errorf("Stored %s holds %q, expected %q", filename, content, release[filename])
+		}
+		if storedFile.Size != int64(len(release[filename])) {
+			t.Errorf("Stored %s size is %d", filename, storedFile.Size)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package packager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// checkFromTree refuses versions whose directory lost files since their
+// hashes were recorded. Diffing against a truncated tree would put the
+// lost files in the package as added. Versions without recorded hashes
+// can't be checked and are accepted
+func (packager *Packager) checkFromTree(version string) error {
+	if version == "" {
+		return nil
+	}
+	recorded, source, err := packager.findRecordedHashes(version)
+	if err != nil {
+		return err
+	}
+	if recorded == nil {
+		log.WithField("version", version).Debug(
+			"No recorded hashes, can't check the version is complete")
+		return nil
+	}
+	versionPath := filepath.Join(packager.releaseDir, version)
+	var missing []string
+	for path := range recorded {
+		_, err := os.Lstat(filepath.Join(versionPath, path))
+		if os.IsNotExist(err) {
+			missing = append(missing, path)
+		} else if err != nil {
+			return err
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	for _, path := range missing {
+		log.WithFields(log.Fields{
+			"version": version,
+			"path":    path,
+		}).Debug("Recorded file missing")
+	}
+	return fmt.Errorf("Version %s is incomplete, %d files recorded in the %s "+
+		"are missing, e.g. '%s'", version, len(missing), source, missing[0])
+}
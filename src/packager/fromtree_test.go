@@ -0,0 +1,39 @@
+package packager
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPackagingRefusesIncompleteFromVersion(t *testing.T) {
+	packager := newTestPackager(t, Options{})
+	installTestVersion(t, packager, 3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini":  "setting=1",
+		"UnrealTournament/Content/Paks/UT.pak": "content",
+	})
+	installTestVersion(t, packager, 3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini":  "setting=2",
+		"UnrealTournament/Content/Paks/UT.pak": "content",
+	})
+	// The hashes are recorded before part of the version is deleted
+	_, err := packager.getVersionHashes("3395761")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Remove(filepath.Join(packager.releaseDir, "3395761",
+		"UnrealTournament/Content/Paks/UT.pak"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = packager.GeneratePackage("3395761", "3525360")
+	if err == nil || !strings.Contains(err.Error(), "incomplete") {
+		t.Fatalf("Packaging an incomplete version returned %v", err)
+	}
+	_, err = os.Stat(filepath.Join(packager.packageDir, "3395761-3525360.tar.gz"))
+	if !os.IsNotExist(err) {
+		t.Errorf("Package from an incomplete version was written: %v", err)
+	}
+}
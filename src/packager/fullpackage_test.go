@@ -0,0 +1,59 @@
+package packager
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/donovansolms/ut4-update-packager/src/packager/models"
+)
+
+func TestGenerateFullPackageAppliesToEmptyDir(t *testing.T) {
+	packager := newTestPackager(t, Options{})
+	installTestVersion(t, packager, 3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini":  "setting=1",
+		"UnrealTournament/Content/Paks/UT.pak": "content",
+	})
+
+	url, err := packager.GenerateFullPackage("3525360")
+	if err != nil {
+		t.Fatal(err)
+	}
+	packagePath := filepath.Join(packager.packageDir, "full-3525360.tar.gz")
+	operations, err := ReadPackageOperations(packagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, operation := range operations {
+		if operation.Operation != deltaOperationAdded {
+			t.Errorf("%s is %s in a full package", path, operation.Operation)
+		}
+	}
+
+	installPath := filepath.Join(tempDir(t), "install")
+	err = ApplyPackage(packagePath, installPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	installed := readTree(t, installPath)
+	expected := readTree(t, filepath.Join(packager.releaseDir, "3525360"))
+	if !reflect.DeepEqual(installed, expected) {
+		t.Errorf("Installed %v, expected %v", installed, expected)
+	}
+
+	// Generating it again replaces the row
+	_, err = packager.GenerateFullPackage("3525360")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := packager.openDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var rows []models.Ut4UpdatePackages
+	db.Where("from_version = '' AND to_version = ?", "3525360").Find(&rows)
+	if len(rows) != 1 || rows[0].UpdateURL != url {
+		t.Errorf("Full package rows are %+v, expected one for %s", rows, url)
+	}
+}
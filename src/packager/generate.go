@@ -0,0 +1,175 @@
+package packager
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/donovansolms/ut4-update-packager/src/packager/models"
+	"github.com/jinzhu/gorm"
+)
+
+// GeneratePackage builds the upgrade package between any two versions on
+// disk, independent of the release feed, and records it in the database.
+// An existing package for the same versions is replaced
+func (packager *Packager) GeneratePackage(
+	fromVersion string,
+	toVersion string) (models.Ut4UpdatePackages, error) {
+	err := packager.validateVersionPair(fromVersion, toVersion)
+	if err != nil {
+		return models.Ut4UpdatePackages{}, err
+	}
+
+	db, err := packager.openDB()
+	if err != nil {
+		return models.Ut4UpdatePackages{}, err
+	}
+	defer db.Close()
+
+	updatePackage, _, err := packager.buildPackage(fromVersion, toVersion)
+	if err != nil {
+		return updatePackage, err
+	}
+
+	var existing models.Ut4UpdatePackages
+	query := db.Where(
+		"from_version = ? AND to_version = ? AND channel = ? AND scope = ?",
+		fromVersion,
+		toVersion,
+		updatePackage.Channel,
+		updatePackage.Scope,
+	).First(&existing)
+	if query.Error != nil && query.Error != gorm.ErrRecordNotFound {
+		return updatePackage, query.Error
+	}
+	// Saving with the existing ID updates the row instead of adding a
+	// duplicate upgrade path, a pruned row is restored
+	updatePackage.ID = existing.ID
+	query = db.Save(&updatePackage)
+	if query.Error != nil {
+		return updatePackage, query.Error
+	}
+	return updatePackage, nil
+}
+
+// fullPackageFrom stands in for the empty from version of full install
+// packages in package names and URLs
+const fullPackageFrom = "full"
+
+// GenerateFullPackage builds the package holding the complete install of
+// version, for clients without a previous version, and records it with an
+// empty from version. Every file is an added operation. An existing full
+// package of version is replaced. It returns the package URL
+func (packager *Packager) GenerateFullPackage(version string) (string, error) {
+	fileInfo, err := os.Stat(filepath.Join(packager.releaseDir, version))
+	if err != nil || !fileInfo.IsDir() {
+		return "", fmt.Errorf("Version %s is not installed", version)
+	}
+
+	db, err := packager.openDB()
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	updatePackage, _, err := packager.buildPackage("", version)
+	if err != nil {
+		return "", err
+	}
+
+	var existing models.Ut4UpdatePackages
+	query := db.Where(
+		"from_version = '' AND to_version = ? AND channel = ? AND scope = ?",
+		version,
+		updatePackage.Channel,
+		updatePackage.Scope,
+	).First(&existing)
+	if query.Error != nil && query.Error != gorm.ErrRecordNotFound {
+		return "", query.Error
+	}
+	updatePackage.ID = existing.ID
+	query = db.Save(&updatePackage)
+	if query.Error != nil {
+		return "", query.Error
+	}
+	return updatePackage.UpdateURL, nil
+}
+
+// templateFromVersion returns the from version used in package names and
+// URLs
+func templateFromVersion(fromVersion string) string {
+	if fromVersion == "" {
+		return fullPackageFrom
+	}
+	return fromVersion
+}
+
+// validateVersionPair checks that both versions are installed and differ
+func (packager *Packager) validateVersionPair(
+	fromVersion string,
+	toVersion string) error {
+	if fromVersion == toVersion {
+		return errors.New("fromVersion and toVersion can't be the same")
+	}
+	for _, version := range []string{fromVersion, toVersion} {
+		fileInfo, err := os.Stat(filepath.Join(packager.releaseDir, version))
+		if err != nil || !fileInfo.IsDir() {
+			return fmt.Errorf("Version %s is not installed", version)
+		}
+	}
+	return nil
+}
+
+// ParseVersionPairs parses specs of the form from:to. Blank specs and
+// specs starting with # are skipped so the lines of a file can be passed
+func ParseVersionPairs(specs []string) ([]VersionPair, error) {
+	var pairs []VersionPair
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" || strings.HasPrefix(spec, "#") {
+			continue
+		}
+		parts := strings.Split(spec, ":")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("Invalid version pair '%s', expected from:to", spec)
+		}
+		pairs = append(pairs, VersionPair{
+			FromVersion: parts[0],
+			ToVersion:   parts[1],
+		})
+	}
+	return pairs, nil
+}
+
+// GeneratePackages builds the package of every pair with GeneratePackage.
+// All pairs are validated before the first is built. Pairs that fail to
+// build are returned as failures, the others are still built
+func (packager *Packager) GeneratePackages(
+	pairs []VersionPair) ([]models.Ut4UpdatePackages, []PackageFailure, error) {
+	for _, pair := range pairs {
+		err := packager.validateVersionPair(pair.FromVersion, pair.ToVersion)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s:%s: %s",
+				pair.FromVersion, pair.ToVersion, err.Error())
+		}
+	}
+	var updatePackages []models.Ut4UpdatePackages
+	var failures []PackageFailure
+	for _, pair := range pairs {
+		updatePackage, err := packager.GeneratePackage(
+			pair.FromVersion,
+			pair.ToVersion)
+		if err != nil {
+			failures = append(failures, PackageFailure{
+				VersionPair: pair,
+				Attempts:    1,
+				Error:       err.Error(),
+			})
+			continue
+		}
+		updatePackages = append(updatePackages, updatePackage)
+	}
+	return updatePackages, failures, nil
+}
@@ -0,0 +1,67 @@
+package packager
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestGeneratePackageBetweenOlderVersions(t *testing.T) {
+	packager := newTestPackager(t, Options{})
+	installTestVersion(t, packager, 3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+	})
+	installTestVersion(t, packager, 3450000, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+	})
+	installTestVersion(t, packager, 3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=3",
+	})
+
+	updatePackage, err := packager.GeneratePackage("3395761", "3450000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updatePackage.FromVersion != "3395761" || updatePackage.ToVersion != "3450000" {
+		t.Errorf("Generated package is %+v", updatePackage)
+	}
+	files := readPackage(t, filepath.Join(packager.packageDir, "3395761-3450000.tar.gz"))
+	if files["UnrealTournament/Config/Default.ini"] != "setting=2" {
+		t.Errorf("Modified file in package is %q",
+			files["UnrealTournament/Config/Default.ini"])
+	}
+
+	// Rebuilding the path updates the recorded package
+	_, err = packager.GeneratePackage("3395761", "3450000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := packager.openDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var count int
+	db.Table("ut4_update_packages").
+		Where("from_version = ? AND to_version = ?", "3395761", "3450000").
+		Count(&count)
+	if count != 1 {
+		t.Errorf("%d packages recorded, expected 1", count)
+	}
+}
+
+func TestGeneratePackageValidatesVersions(t *testing.T) {
+	packager := newTestPackager(t, Options{})
+	installTestVersion(t, packager, 3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+	})
+	for _, pair := range []VersionPair{
+		{FromVersion: "3395761", ToVersion: "3395761"},
+		{FromVersion: "3395761", ToVersion: "3525360"},
+		{FromVersion: "3350000", ToVersion: "3395761"},
+	} {
+		_, err := packager.GeneratePackage(pair.FromVersion, pair.ToVersion)
+		if err == nil {
+			t.Errorf("Generating %s to %s didn't fail", pair.FromVersion, pair.ToVersion)
+		}
+	}
+}
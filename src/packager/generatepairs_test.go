@@ -0,0 +1,107 @@
+package packager
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/donovansolms/ut4-update-packager/src/packager/models"
+)
+
+func TestParseVersionPairs(t *testing.T) {
+	pairs, err := ParseVersionPairs([]string{
+		"# backfill",
+		"3395761:3450000",
+		"",
+		" 3420000:3525360 ",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []VersionPair{
+		{FromVersion: "3395761", ToVersion: "3450000"},
+		{FromVersion: "3420000", ToVersion: "3525360"},
+	}
+	if !reflect.DeepEqual(pairs, expected) {
+		t.Errorf("Parsed %v, expected %v", pairs, expected)
+	}
+	for _, spec := range []string{"3395761", "3395761:", ":3450000", "1:2:3"} {
+		_, err = ParseVersionPairs([]string{spec})
+		if err == nil {
+			t.Errorf("Invalid pair %q was accepted", spec)
+		}
+	}
+}
+
+func TestGeneratePackagesBuildsExactlyThePairs(t *testing.T) {
+	fixture := newFixture(t)
+	packager := fixture.newPackager(Options{})
+	for _, changelist := range []int{3395761, 3420000, 3450000, 3525360} {
+		installTestVersion(t, packager, changelist, map[string]string{
+			"UnrealTournament/Content/a.txt": fmt.Sprint(changelist),
+		})
+	}
+	pairs := []VersionPair{
+		{FromVersion: "3395761", ToVersion: "3450000"},
+		{FromVersion: "3420000", ToVersion: "3525360"},
+	}
+
+	updatePackages, failures, err := packager.GeneratePackages(pairs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) != 0 {
+		t.Fatalf("Unexpected failures %v", failures)
+	}
+	if len(updatePackages) != len(pairs) {
+		t.Errorf("Built %d packages, expected %d", len(updatePackages), len(pairs))
+	}
+	var rows []models.Ut4UpdatePackages
+	err = fixture.db().
+		Where("is_deleted = 0").
+		Order("from_version").
+		Find(&rows).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	var built []VersionPair
+	for _, row := range rows {
+		built = append(built, VersionPair{
+			FromVersion: row.FromVersion,
+			ToVersion:   row.ToVersion,
+		})
+	}
+	if !reflect.DeepEqual(built, pairs) {
+		t.Errorf("Recorded packages %v, expected %v", built, pairs)
+	}
+}
+
+func TestGeneratePackagesValidatesAllPairsFirst(t *testing.T) {
+	fixture := newFixture(t)
+	packager := fixture.newPackager(Options{})
+	for _, changelist := range []int{3395761, 3450000} {
+		installTestVersion(t, packager, changelist, map[string]string{
+			"UnrealTournament/Content/a.txt": fmt.Sprint(changelist),
+		})
+	}
+	for _, invalid := range []VersionPair{
+		{FromVersion: "3450000", ToVersion: "3450000"},
+		{FromVersion: "3395761", ToVersion: "3999999"},
+	} {
+		_, _, err := packager.GeneratePackages([]VersionPair{
+			{FromVersion: "3395761", ToVersion: "3450000"},
+			invalid,
+		})
+		if err == nil {
+			t.Errorf("Invalid pair %v was accepted", invalid)
+		}
+	}
+	var count int
+	err := fixture.db().Model(&models.Ut4UpdatePackages{}).Count(&count).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("%d packages were built before validation failed", count)
+	}
+}
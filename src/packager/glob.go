@@ -0,0 +1,62 @@
+package packager
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// matchPath reports whether the slash separated relative path matches
+// pattern. Patterns use filepath.Match syntax per path segment, and a
+// "**" segment matches any number of segments
+func matchPath(pattern string, relativePath string) bool {
+	return matchSegments(
+		strings.Split(pattern, "/"),
+		strings.Split(filepath.ToSlash(relativePath), "/"))
+}
+
+// matchSegments matches the pattern segments against the path segments
+func matchSegments(patternSegments []string, pathSegments []string) bool {
+	if len(patternSegments) == 0 {
+		return len(pathSegments) == 0
+	}
+	if patternSegments[0] == "**" {
+		for i := 0; i <= len(pathSegments); i++ {
+			if matchSegments(patternSegments[1:], pathSegments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(pathSegments) == 0 {
+		return false
+	}
+	matched, err := path.Match(patternSegments[0], pathSegments[0])
+	if err != nil || !matched {
+		return false
+	}
+	return matchSegments(patternSegments[1:], pathSegments[1:])
+}
+
+// matchAnyPath reports whether relativePath matches any of the patterns
+func matchAnyPath(patterns []string, relativePath string) bool {
+	for _, pattern := range patterns {
+		if matchPath(pattern, relativePath) {
+			return true
+		}
+	}
+	return false
+}
+
+// validatePathPatterns checks that all patterns are valid
+func validatePathPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		for _, segment := range strings.Split(pattern, "/") {
+			_, err := path.Match(segment, "")
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
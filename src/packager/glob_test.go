@@ -0,0 +1,69 @@
+package packager
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		matches bool
+	}{
+		{"UnrealTournament/Saved/**", "UnrealTournament/Saved/Logs/UT.log", true},
+		{"UnrealTournament/Saved/**", "UnrealTournament/Saved", true},
+		{"UnrealTournament/Saved/**", "UnrealTournament/Content/Saved.txt", false},
+		{"**/*.log", "UnrealTournament/Saved/Logs/UT.log", true},
+		{"**/*.log", "UT.log", true},
+		{"**/*.log", "UnrealTournament/UT.log.txt", false},
+		{"*/DerivedDataCache/*", "UnrealTournament/DerivedDataCache/a.ddp", true},
+		{"*/DerivedDataCache/*", "UnrealTournament/DerivedDataCache/sub/a.ddp", false},
+	}
+	for _, test := range tests {
+		if matchPath(test.pattern, test.path) != test.matches {
+			t.Errorf("matchPath(%q, %q) isn't %v", test.pattern, test.path, test.matches)
+		}
+	}
+}
+
+func TestIgnoredPathsAreNotInDelta(t *testing.T) {
+	packager := newTestPackager(t, Options{
+		IgnorePatterns: []string{"UnrealTournament/Saved/**", "**/*.log"},
+	})
+	installTestVersion(t, packager, 3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini":    "setting=1",
+		"UnrealTournament/Saved/Cache/cache.bin": "cache 1",
+		"UnrealTournament/Saved/Removed.bin":     "removed",
+		"UnrealTournament/Binaries/Linux/UT.log": "log 1",
+	})
+	installTestVersion(t, packager, 3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini":    "setting=2",
+		"UnrealTournament/Saved/Cache/cache.bin": "cache 2",
+		"UnrealTournament/Saved/Added.bin":       "added",
+		"UnrealTournament/Binaries/Linux/UT.log": "log 2",
+	})
+	_, err := packager.GeneratePackage("3395761", "3525360")
+	if err != nil {
+		t.Fatal(err)
+	}
+	packagePath := filepath.Join(packager.packageDir, "3395761-3525360.tar.gz")
+	operations, err := ReadPackageOperations(packagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := operations["UnrealTournament/Config/Default.ini"]; !ok {
+		t.Error("Changed file isn't in the delta")
+	}
+	for path := range operations {
+		if strings.Contains(path, "Saved") || strings.HasSuffix(path, ".log") {
+			t.Errorf("Ignored path %s is in the delta", path)
+		}
+	}
+	for path := range readPackage(t, packagePath) {
+		if strings.Contains(path, "Saved") || strings.HasSuffix(path, ".log") {
+			t.Errorf("Ignored path %s is in the package", path)
+		}
+	}
+}
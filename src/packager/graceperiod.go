@@ -0,0 +1,108 @@
+package packager
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	log "github.com/sirupsen/logrus"
+)
+
+// pendingReleasesFilename stores when release posts whose download wasn't
+// available yet were first seen
+const pendingReleasesFilename = ".pending-releases.json"
+
+// ErrReleasePending is returned by CheckForNewRelease when the download of
+// a new release post isn't available yet but is still within the grace
+// period
+var ErrReleasePending = errors.New("New release download is not available yet")
+
+// withinGracePeriod is called when the download of releasePost failed with
+// err. While the post was first seen less than the grace period ago
+// ErrReleasePending is returned so it is retried on the next run, after
+// that err is returned
+func (packager *Packager) withinGracePeriod(
+	releasePost *gofeed.Item,
+	err error) error {
+	if packager.options.ReleaseGracePeriod <= 0 {
+		return err
+	}
+	pending := packager.readPendingReleases()
+	key := postKey(releasePost)
+	firstSeen, ok := pending[key]
+	if !ok {
+		firstSeen = time.Now()
+		pending[key] = firstSeen
+		writeErr := packager.writePendingReleases(pending)
+		if writeErr != nil {
+			log.WithField("err", "pending_releases").Warning(writeErr.Error())
+		}
+	}
+	waited := time.Since(firstSeen)
+	if waited > packager.options.ReleaseGracePeriod {
+		return err
+	}
+	log.WithFields(log.Fields{
+		"title":  releasePost.Title,
+		"waited": waited.String(),
+		"reason": err.Error(),
+	}).Warning("Release download not available yet, retrying on the next run")
+	return ErrReleasePending
+}
+
+// clearPendingRelease forgets the first seen time of releasePost once its
+// download is available
+func (packager *Packager) clearPendingRelease(releasePost *gofeed.Item) {
+	if packager.options.ReleaseGracePeriod <= 0 {
+		return
+	}
+	pending := packager.readPendingReleases()
+	key := postKey(releasePost)
+	if _, ok := pending[key]; !ok {
+		return
+	}
+	delete(pending, key)
+	err := packager.writePendingReleases(pending)
+	if err != nil {
+		log.WithField("err", "pending_releases").Warning(err.Error())
+	}
+}
+
+// readPendingReleases returns the first seen times by post key, an
+// unreadable file is treated as empty
+func (packager *Packager) readPendingReleases() map[string]time.Time {
+	pending := make(map[string]time.Time)
+	pendingBytes, err := ioutil.ReadFile(
+		filepath.Join(packager.releaseDir, pendingReleasesFilename))
+	if err != nil {
+		return pending
+	}
+	err = json.Unmarshal(pendingBytes, &pending)
+	if err != nil {
+		log.WithField("err", "pending_releases").Warning("Pending releases file is corrupt")
+		return make(map[string]time.Time)
+	}
+	return pending
+}
+
+// writePendingReleases stores the first seen times, removing the file
+// when there are none
+func (packager *Packager) writePendingReleases(pending map[string]time.Time) error {
+	pendingPath := filepath.Join(packager.releaseDir, pendingReleasesFilename)
+	if len(pending) == 0 {
+		err := os.Remove(pendingPath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	pendingBytes, err := json.Marshal(&pending)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(pendingPath, pendingBytes)
+}
@@ -0,0 +1,70 @@
+package packager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRunRetriesReleaseWithinGracePeriod(t *testing.T) {
+	fixture := newFixture(t)
+	fixture.installVersion(3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+	})
+	// The post is published before its download is live
+	fixture.addPost("UT Release 3525360", "post-3525360",
+		fixture.server.URL+"/UnrealTournament-Client-XAN-3525360-Linux.zip",
+		time.Now())
+	packager := fixture.newPackager(Options{ReleaseGracePeriod: time.Hour})
+
+	result, err := packager.Run()
+	if err != nil {
+		t.Fatalf("Unavailable download within the grace period failed: %s", err)
+	}
+	if result.Version != "" {
+		t.Errorf("Run packaged %s without a download", result.Version)
+	}
+	var count int
+	fixture.db().Table("ut4_blog_posts").Count(&count)
+	if count != 0 {
+		t.Error("Pending release post was marked processed")
+	}
+
+	fixture.serveRelease(3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+	})
+	result, err = packager.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Version != "3525360" || len(result.Packages) != 1 {
+		t.Errorf("Later poll packaged %s %v", result.Version, result.Packages)
+	}
+	_, err = os.Stat(filepath.Join(fixture.releaseDir, pendingReleasesFilename))
+	if !os.IsNotExist(err) {
+		t.Errorf("Pending release wasn't cleared: %v", err)
+	}
+}
+
+func TestRunFailsAfterGracePeriod(t *testing.T) {
+	fixture := newFixture(t)
+	fixture.installVersion(3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+	})
+	fixture.addPost("UT Release 3525360", "post-3525360",
+		fixture.server.URL+"/UnrealTournament-Client-XAN-3525360-Linux.zip",
+		time.Now())
+	packager := fixture.newPackager(Options{ReleaseGracePeriod: time.Hour})
+	err := packager.writePendingReleases(map[string]time.Time{
+		"post-3525360": time.Now().Add(-2 * time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = packager.Run()
+	if err == nil || err == ErrReleasePending {
+		t.Errorf("Unavailable download after the grace period returned %v", err)
+	}
+}
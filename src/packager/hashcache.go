@@ -0,0 +1,73 @@
+package packager
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// HashCacheStats counts how often getVersionHashes used the .hashes cache
+// and how long regenerating the hashes took
+type HashCacheStats struct {
+	Hits             int
+	Misses           int
+	RegenerationTime time.Duration
+	// Versions holds the same counts per version
+	Versions map[string]VersionHashCacheStats
+}
+
+// VersionHashCacheStats are the hash cache counts of a single version
+type VersionHashCacheStats struct {
+	Hits             int
+	Misses           int
+	RegenerationTime time.Duration
+}
+
+// HashCacheStats returns the hash cache counts since the Packager was
+// created
+func (packager *Packager) HashCacheStats() HashCacheStats {
+	packager.hashCacheLock.Lock()
+	defer packager.hashCacheLock.Unlock()
+	stats := packager.hashCacheStats
+	stats.Versions = make(map[string]VersionHashCacheStats)
+	for version, versionStats := range packager.hashCacheStats.Versions {
+		stats.Versions[version] = versionStats
+	}
+	return stats
+}
+
+// recordHashCacheHit counts a cache hit for version
+func (packager *Packager) recordHashCacheHit(version string) {
+	packager.hashCacheLock.Lock()
+	defer packager.hashCacheLock.Unlock()
+	if packager.hashCacheStats.Versions == nil {
+		packager.hashCacheStats.Versions = make(map[string]VersionHashCacheStats)
+	}
+	versionStats := packager.hashCacheStats.Versions[version]
+	versionStats.Hits++
+	packager.hashCacheStats.Versions[version] = versionStats
+	packager.hashCacheStats.Hits++
+	log.WithField("version", version).Debug("Hash cache hit")
+}
+
+// recordHashCacheMiss counts a cache miss for version that took duration
+// to regenerate
+func (packager *Packager) recordHashCacheMiss(
+	version string,
+	duration time.Duration) {
+	packager.hashCacheLock.Lock()
+	defer packager.hashCacheLock.Unlock()
+	if packager.hashCacheStats.Versions == nil {
+		packager.hashCacheStats.Versions = make(map[string]VersionHashCacheStats)
+	}
+	versionStats := packager.hashCacheStats.Versions[version]
+	versionStats.Misses++
+	versionStats.RegenerationTime += duration
+	packager.hashCacheStats.Versions[version] = versionStats
+	packager.hashCacheStats.Misses++
+	packager.hashCacheStats.RegenerationTime += duration
+	log.WithFields(log.Fields{
+		"version":  version,
+		"duration": duration.String(),
+	}).Info("Hash cache miss, hashes regenerated")
+}
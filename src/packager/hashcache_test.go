@@ -0,0 +1,32 @@
+package packager
+
+import "testing"
+
+func TestSecondHashLookupIsCacheHit(t *testing.T) {
+	packager := newTestPackager(t, Options{})
+	installTestVersion(t, packager, 3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+	})
+
+	_, err := packager.getVersionHashes("3395761")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := packager.HashCacheStats()
+	if stats.Hits != 0 || stats.Misses != 1 {
+		t.Fatalf("First lookup counted %d hits and %d misses", stats.Hits, stats.Misses)
+	}
+
+	_, err = packager.getVersionHashes("3395761")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats = packager.HashCacheStats()
+	if stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("Second lookup counted %d hits and %d misses", stats.Hits, stats.Misses)
+	}
+	versionStats := stats.Versions["3395761"]
+	if versionStats.Hits != 1 || versionStats.Misses != 1 {
+		t.Errorf("Version stats are %+v", versionStats)
+	}
+}
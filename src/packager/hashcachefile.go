@@ -0,0 +1,172 @@
+package packager
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressedHashCacheSuffix is appended to the hash cache filename when
+// the cache is zstd compressed
+const compressedHashCacheSuffix = ".zst"
+
+// zstdMagic starts every zstd frame
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// hashCachePath returns the path of the plain hash cache of version
+func (packager *Packager) hashCachePath(version string) string {
+	return filepath.Join(packager.releaseDir, packager.hashCacheFilename(version))
+}
+
+// readHashCache reads the hash cache of version. With the hash cache index
+// enabled the index is read first and the per version files are the
+// fallback for versions that weren't compacted yet
+func (packager *Packager) readHashCache(version string) (map[string]string, error) {
+	if packager.options.HashCacheIndex {
+		hashes, ok, err := packager.indexedHashes(version)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return hashes, nil
+		}
+	}
+	return packager.readHashCacheFile(version)
+}
+
+// readHashCacheFile reads the hash cache file of version, compressed or
+// plain. The compressed cache is preferred and compression is detected by
+// its magic so a renamed file still reads
+func (packager *Packager) readHashCacheFile(version string) (map[string]string, error) {
+	cachePath := packager.hashCachePath(version)
+	cacheBytes, err := ioutil.ReadFile(cachePath + compressedHashCacheSuffix)
+	if os.IsNotExist(err) {
+		cacheBytes, err = ioutil.ReadFile(cachePath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	hashes := make(map[string]string)
+	err = decodeHashCache(cacheBytes, &hashes)
+	if err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
+
+// decodeHashCache unmarshals the JSON in cacheBytes into value,
+// decompressing it first when it is zstd compressed
+func decodeHashCache(cacheBytes []byte, value interface{}) error {
+	if bytes.HasPrefix(cacheBytes, zstdMagic) {
+		decoder, err := zstd.NewReader(nil)
+		if err != nil {
+			return err
+		}
+		defer decoder.Close()
+		cacheBytes, err = decoder.DecodeAll(cacheBytes, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(cacheBytes, value)
+}
+
+// encodeHashCache marshals value as JSON, zstd compressed when configured
+func (packager *Packager) encodeHashCache(value interface{}) ([]byte, error) {
+	cacheBytes, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	if !packager.options.CompressHashCache {
+		return cacheBytes, nil
+	}
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		return nil, err
+	}
+	cacheBytes = encoder.EncodeAll(cacheBytes, nil)
+	err = encoder.Close()
+	if err != nil {
+		return nil, err
+	}
+	return cacheBytes, nil
+}
+
+// writeHashCache stores hashes as the hash cache of version, in the index
+// when it is enabled and otherwise zstd compressed when configured. The
+// cache in the other formats is removed so it can't go stale
+func (packager *Packager) writeHashCache(
+	version string,
+	hashes map[string]string) error {
+	if packager.options.HashCacheIndex {
+		err := packager.indexHashes(map[string]map[string]string{version: hashes})
+		if err != nil {
+			return err
+		}
+		return packager.removeHashCacheFiles(version)
+	}
+	cacheBytes, err := packager.encodeHashCache(&hashes)
+	if err != nil {
+		return err
+	}
+	cachePath := packager.hashCachePath(version)
+	stalePath := cachePath + compressedHashCacheSuffix
+	if packager.options.CompressHashCache {
+		stalePath = cachePath
+		cachePath += compressedHashCacheSuffix
+	}
+	err = ioutil.WriteFile(cachePath, cacheBytes, 0644)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(stalePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// hasHashCache checks if hashes of version are cached on disk
+func (packager *Packager) hasHashCache(version string) (bool, error) {
+	if packager.options.HashCacheIndex {
+		_, ok, err := packager.indexedHashes(version)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	cachePath := packager.hashCachePath(version)
+	for _, path := range []string{cachePath, cachePath + compressedHashCacheSuffix} {
+		if _, err := os.Stat(path); err == nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// removeHashCache removes the hash cache of version in all formats
+func (packager *Packager) removeHashCache(version string) error {
+	if packager.options.HashCacheIndex {
+		err := packager.unindexHashes(version)
+		if err != nil {
+			return err
+		}
+	}
+	return packager.removeHashCacheFiles(version)
+}
+
+// removeHashCacheFiles removes the hash cache files of version in both
+// formats
+func (packager *Packager) removeHashCacheFiles(version string) error {
+	cachePath := packager.hashCachePath(version)
+	for _, path := range []string{cachePath, cachePath + compressedHashCacheSuffix} {
+		err := os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package packager
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestCompressedHashCacheRoundTrip(t *testing.T) {
+	hashes := map[string]string{
+		"UnrealTournament/Config/Default.ini":  "6b86b273ff34fce19d6b804eff5a3f57",
+		"UnrealTournament/Content/Paks/UT.pak": "d4735e3a265e16eee03f59718b9b5d03",
+	}
+	packager := newTestPackager(t, Options{CompressHashCache: true})
+	err := packager.writeHashCache("3525360", hashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cachePath := packager.hashCachePath("3525360")
+	cacheBytes, err := ioutil.ReadFile(cachePath + compressedHashCacheSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(cacheBytes, zstdMagic) {
+		t.Error("Hash cache isn't zstd compressed")
+	}
+	if _, err = os.Stat(cachePath); !os.IsNotExist(err) {
+		t.Errorf("Plain hash cache exists next to the compressed one: %v", err)
+	}
+
+	read, err := packager.readHashCache("3525360")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, hashes) {
+		t.Errorf("Read %v, expected %v", read, hashes)
+	}
+
+	// Plain caches are still read, and replace the compressed one
+	packager.options.CompressHashCache = false
+	err = packager.writeHashCache("3525360", hashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(cachePath + compressedHashCacheSuffix); !os.IsNotExist(err) {
+		t.Errorf("Stale compressed hash cache wasn't removed: %v", err)
+	}
+	read, err = packager.readHashCache("3525360")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, hashes) {
+		t.Errorf("Read %v from the plain cache, expected %v", read, hashes)
+	}
+}
@@ -0,0 +1,135 @@
+package packager
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// hashCacheWriter writes the hash cache of a version while its hashes
+// arrive one at a time, so a pipelined delta caches the hashes without
+// keeping them all in memory. The index can only be written as a whole,
+// with HashCacheIndex the hashes are collected and indexed on finish
+type hashCacheWriter struct {
+	packager *Packager
+	version  string
+	// hashes collects the hashes when the index is used
+	hashes map[string]string
+	file   *os.File
+	// buffered writes to file, encoder compresses when it is set
+	buffered *bufio.Writer
+	encoder  *zstd.Encoder
+	writer   io.Writer
+	written  int
+}
+
+// newHashCacheWriter starts writing the hash cache of version
+func (packager *Packager) newHashCacheWriter(version string) (*hashCacheWriter, error) {
+	cacheWriter := &hashCacheWriter{packager: packager, version: version}
+	if packager.options.HashCacheIndex {
+		cacheWriter.hashes = make(map[string]string)
+		return cacheWriter, nil
+	}
+	file, err := ioutil.TempFile(packager.releaseDir, ".hashes-")
+	if err != nil {
+		return nil, err
+	}
+	cacheWriter.file = file
+	cacheWriter.buffered = bufio.NewWriter(file)
+	cacheWriter.writer = cacheWriter.buffered
+	if packager.options.CompressHashCache {
+		cacheWriter.encoder, err = zstd.NewWriter(cacheWriter.buffered)
+		if err != nil {
+			cacheWriter.abort()
+			return nil, err
+		}
+		cacheWriter.writer = cacheWriter.encoder
+	}
+	_, err = io.WriteString(cacheWriter.writer, "{")
+	if err != nil {
+		cacheWriter.abort()
+		return nil, err
+	}
+	return cacheWriter, nil
+}
+
+// add writes the hash of path
+func (cacheWriter *hashCacheWriter) add(path string, hash string) error {
+	if cacheWriter.hashes != nil {
+		cacheWriter.hashes[path] = hash
+		return nil
+	}
+	entry, err := json.Marshal(path)
+	if err != nil {
+		return err
+	}
+	hashBytes, err := json.Marshal(hash)
+	if err != nil {
+		return err
+	}
+	if cacheWriter.written > 0 {
+		entry = append([]byte(","), entry...)
+	}
+	entry = append(append(entry, ':'), hashBytes...)
+	_, err = cacheWriter.writer.Write(entry)
+	if err != nil {
+		return err
+	}
+	cacheWriter.written++
+	return nil
+}
+
+// finish completes the hash cache and moves it into place, removing the
+// cache in the other format so it can't go stale
+func (cacheWriter *hashCacheWriter) finish() error {
+	packager := cacheWriter.packager
+	if cacheWriter.hashes != nil {
+		return packager.writeHashCache(cacheWriter.version, cacheWriter.hashes)
+	}
+	_, err := io.WriteString(cacheWriter.writer, "}")
+	if err == nil && cacheWriter.encoder != nil {
+		err = cacheWriter.encoder.Close()
+	}
+	if err == nil {
+		err = cacheWriter.buffered.Flush()
+	}
+	if err == nil {
+		err = cacheWriter.file.Close()
+	}
+	if err != nil {
+		cacheWriter.abort()
+		return err
+	}
+	cachePath := packager.hashCachePath(cacheWriter.version)
+	stalePath := cachePath + compressedHashCacheSuffix
+	if packager.options.CompressHashCache {
+		stalePath = cachePath
+		cachePath += compressedHashCacheSuffix
+	}
+	err = os.Rename(cacheWriter.file.Name(), cachePath)
+	if err != nil {
+		os.Remove(cacheWriter.file.Name())
+		return err
+	}
+	err = os.Remove(stalePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// abort discards the partly written hash cache
+func (cacheWriter *hashCacheWriter) abort() {
+	if cacheWriter.file == nil {
+		return
+	}
+	if cacheWriter.encoder != nil {
+		cacheWriter.encoder.Close()
+	}
+	cacheWriter.file.Close()
+	os.Remove(cacheWriter.file.Name())
+}
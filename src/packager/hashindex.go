@@ -0,0 +1,403 @@
+package packager
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// hashIndexPath returns the path of the hash cache index. Indexes with
+// directory entries are kept apart like the per version caches
+func (packager *Packager) hashIndexPath() string {
+	if packager.options.HashDirectories {
+		return filepath.Join(packager.releaseDir, "hash-cache.dirs.index")
+	}
+	return filepath.Join(packager.releaseDir, "hash-cache.index")
+}
+
+// The hash cache index is a log of records, each a "<version> <length>\n"
+// header followed by the encoded hashes of the version. A later record of
+// a version replaces the earlier ones and a zero length removes it. New
+// hashes are appended, the index is only rewritten to drop replaced
+// records once they outnumber the live ones
+
+// minHashIndexCompaction is the number of records below which replaced
+// records are never compacted
+const minHashIndexCompaction = 16
+
+// hashIndexRecord locates the encoded hashes of a version in the index
+type hashIndexRecord struct {
+	offset int64
+	length int64
+}
+
+// hashIndexState is the layout of the index, read once per Packager
+type hashIndexState struct {
+	path    string
+	records map[string]hashIndexRecord
+	// count is the number of records in the file, replaced ones included
+	count int
+	// size is the end of the last complete record, an append torn by a
+	// crash after it is overwritten
+	size int64
+}
+
+// loadHashIndex reads the layout of the index unless it is loaded
+// already. Only the record headers are read. Requires hashIndexLock to be
+// held
+func (packager *Packager) loadHashIndex() (*hashIndexState, error) {
+	indexPath := packager.hashIndexPath()
+	if packager.hashIndex != nil && packager.hashIndex.path == indexPath {
+		return packager.hashIndex, nil
+	}
+	state := &hashIndexState{
+		path:    indexPath,
+		records: make(map[string]hashIndexRecord),
+	}
+	file, err := os.Open(indexPath)
+	if os.IsNotExist(err) {
+		packager.hashIndex = state
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	// Indexes holding all versions in a single map start like a hash cache
+	magic, _ := reader.Peek(len(zstdMagic))
+	if bytes.HasPrefix(magic, []byte("{")) || bytes.Equal(magic, zstdMagic) {
+		return packager.migrateHashIndex(state)
+	}
+	for {
+		header, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if err == io.EOF && header == "" {
+			break
+		}
+		version, length, ok := parseHashIndexHeader(header)
+		if ok {
+			var skipped int
+			skipped, err = reader.Discard(int(length))
+			if err != nil && err != io.EOF {
+				return nil, err
+			}
+			ok = int64(skipped) == length
+		}
+		if !ok {
+			log.WithFields(log.Fields{
+				"path":   indexPath,
+				"offset": state.size,
+			}).Warning("Ignoring the incomplete end of the hash cache index")
+			break
+		}
+		offset := state.size + int64(len(header))
+		if length == 0 {
+			delete(state.records, version)
+		} else {
+			state.records[version] = hashIndexRecord{offset: offset, length: length}
+		}
+		state.count++
+		state.size = offset + length
+	}
+	packager.hashIndex = state
+	return state, nil
+}
+
+// parseHashIndexHeader parses a "<version> <length>\n" record header
+func parseHashIndexHeader(header string) (string, int64, bool) {
+	if !strings.HasSuffix(header, "\n") {
+		return "", 0, false
+	}
+	fields := strings.Fields(header)
+	if len(fields) != 2 {
+		return "", 0, false
+	}
+	length, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || length < 0 {
+		return "", 0, false
+	}
+	return fields[0], length, true
+}
+
+// migrateHashIndex rewrites an index holding all versions in a single map,
+// as written before the index was a log, into records. Requires
+// hashIndexLock to be held
+func (packager *Packager) migrateHashIndex(
+	state *hashIndexState) (*hashIndexState, error) {
+	indexBytes, err := ioutil.ReadFile(state.path)
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[string]map[string]string)
+	err = decodeHashCache(indexBytes, &index)
+	if err != nil {
+		return nil, fmt.Errorf("Hash cache index %s is corrupt: %s",
+			state.path, err.Error())
+	}
+	encoded := make(map[string][]byte, len(index))
+	for version, hashes := range index {
+		encoded[version], err = packager.encodeHashCache(&hashes)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return packager.rewriteHashIndex(state.path, encoded)
+}
+
+// rewriteHashIndex replaces the index with a record for each of encoded
+// through a temporary file so a failed write can't truncate it. Requires
+// hashIndexLock to be held
+func (packager *Packager) rewriteHashIndex(
+	indexPath string,
+	encoded map[string][]byte) (*hashIndexState, error) {
+	state := &hashIndexState{
+		path:    indexPath,
+		records: make(map[string]hashIndexRecord),
+	}
+	versions := make([]string, 0, len(encoded))
+	for version := range encoded {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	var index bytes.Buffer
+	for _, version := range versions {
+		fmt.Fprintf(&index, "%s %d\n", version, len(encoded[version]))
+		state.records[version] = hashIndexRecord{
+			offset: int64(index.Len()),
+			length: int64(len(encoded[version])),
+		}
+		index.Write(encoded[version])
+		state.count++
+	}
+	state.size = int64(index.Len())
+	// The cached layout is dropped first, a failed rewrite reloads it
+	packager.hashIndex = nil
+	err := writeFileAtomic(indexPath, index.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	packager.hashIndex = state
+	return state, nil
+}
+
+// appendHashIndex appends the record of version holding encoded, or
+// removing the version when encoded is empty. Requires hashIndexLock to
+// be held
+func (packager *Packager) appendHashIndex(version string, encoded []byte) error {
+	state, err := packager.loadHashIndex()
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(state.path, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	header := fmt.Sprintf("%s %d\n", version, len(encoded))
+	// Drop a torn append of an earlier crash before appending
+	err = file.Truncate(state.size)
+	if err == nil {
+		_, err = file.WriteAt(append([]byte(header), encoded...), state.size)
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// The file may not match the layout anymore
+		packager.hashIndex = nil
+		return err
+	}
+	offset := state.size + int64(len(header))
+	if len(encoded) == 0 {
+		delete(state.records, version)
+	} else {
+		state.records[version] = hashIndexRecord{
+			offset: offset,
+			length: int64(len(encoded)),
+		}
+	}
+	state.count++
+	state.size = offset + int64(len(encoded))
+	if state.count >= minHashIndexCompaction && state.count > 2*len(state.records) {
+		return packager.compactHashIndex(state)
+	}
+	return nil
+}
+
+// compactHashIndex rewrites the index with only the live records.
+// Requires hashIndexLock to be held
+func (packager *Packager) compactHashIndex(state *hashIndexState) error {
+	encoded := make(map[string][]byte, len(state.records))
+	for version := range state.records {
+		recordBytes, err := packager.readHashIndexRecord(state, version)
+		if err != nil {
+			return err
+		}
+		encoded[version] = recordBytes
+	}
+	_, err := packager.rewriteHashIndex(state.path, encoded)
+	return err
+}
+
+// readHashIndexRecord reads the encoded hashes of version, which must be
+// indexed. Requires hashIndexLock to be held
+func (packager *Packager) readHashIndexRecord(
+	state *hashIndexState,
+	version string) ([]byte, error) {
+	record := state.records[version]
+	file, err := os.Open(state.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	recordBytes := make([]byte, record.length)
+	_, err = file.ReadAt(recordBytes, record.offset)
+	if err != nil {
+		return nil, err
+	}
+	return recordBytes, nil
+}
+
+// indexedHashes returns the hashes of version from the index, ok is false
+// when the version isn't indexed
+func (packager *Packager) indexedHashes(
+	version string) (hashes map[string]string, ok bool, err error) {
+	packager.hashIndexLock.Lock()
+	defer packager.hashIndexLock.Unlock()
+	state, err := packager.loadHashIndex()
+	if err != nil {
+		return nil, false, err
+	}
+	if _, ok = state.records[version]; !ok {
+		return nil, false, nil
+	}
+	recordBytes, err := packager.readHashIndexRecord(state, version)
+	if err != nil {
+		return nil, false, err
+	}
+	hashes = make(map[string]string)
+	err = decodeHashCache(recordBytes, &hashes)
+	if err != nil {
+		return nil, false, err
+	}
+	return hashes, true, nil
+}
+
+// indexHashes adds the hashes of versions to the index, replacing those
+// already indexed
+func (packager *Packager) indexHashes(versions map[string]map[string]string) error {
+	packager.hashIndexLock.Lock()
+	defer packager.hashIndexLock.Unlock()
+	for version, hashes := range versions {
+		encoded, err := packager.encodeHashCache(&hashes)
+		if err != nil {
+			return err
+		}
+		err = packager.appendHashIndex(version, encoded)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unindexHashes removes version from the index
+func (packager *Packager) unindexHashes(version string) error {
+	packager.hashIndexLock.Lock()
+	defer packager.hashIndexLock.Unlock()
+	state, err := packager.loadHashIndex()
+	if err != nil {
+		return err
+	}
+	if _, ok := state.records[version]; !ok {
+		return nil
+	}
+	return packager.appendHashIndex(version, nil)
+}
+
+// hashCacheFileVersions returns the versions with a hash cache file in the
+// release dir
+func (packager *Packager) hashCacheFileVersions() ([]string, error) {
+	entries, err := ioutil.ReadDir(packager.releaseDir)
+	if err != nil {
+		return nil, err
+	}
+	suffix := packager.hashCacheFilename("")
+	found := make(map[string]bool)
+	for _, entry := range entries {
+		if !entry.Mode().IsRegular() {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), compressedHashCacheSuffix)
+		if !strings.HasSuffix(name, suffix) {
+			continue
+		}
+		version := strings.TrimSuffix(name, suffix)
+		// Without directory entries <version>.dirs.hashes also ends in
+		// .hashes but belongs to the other cache
+		if version == "" ||
+			(!packager.options.HashDirectories && strings.HasSuffix(version, ".dirs")) {
+			continue
+		}
+		found[version] = true
+	}
+	versions := make([]string, 0, len(found))
+	for version := range found {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	return versions, nil
+}
+
+// CompactHashCache moves the per version hash cache files in the release
+// dir into the hash cache index and returns the versions it moved. The
+// files are only removed once the index is written
+func (packager *Packager) CompactHashCache() ([]string, error) {
+	if !packager.options.HashCacheIndex {
+		return nil, errors.New("The hash cache index is disabled")
+	}
+	versions, err := packager.hashCacheFileVersions()
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return versions, nil
+	}
+	compacted := make(map[string]map[string]string)
+	for _, version := range versions {
+		hashes, err := packager.readHashCacheFile(version)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"err":     "read_hash_cache",
+				"version": version,
+			}).Error(err.Error())
+			return nil, err
+		}
+		compacted[version] = hashes
+	}
+	err = packager.indexHashes(compacted)
+	if err != nil {
+		return nil, err
+	}
+	for _, version := range versions {
+		err = packager.removeHashCacheFiles(version)
+		if err != nil {
+			return nil, err
+		}
+	}
+	log.WithField("versions", len(versions)).Info("Hash cache compacted")
+	return versions, nil
+}
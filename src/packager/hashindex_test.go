@@ -0,0 +1,192 @@
+package packager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// testVersionHashes returns distinct hashes for version
+func testVersionHashes(version string) map[string]string {
+	return map[string]string{
+		"UnrealTournament/Config/Default.ini":  "config-" + version,
+		"UnrealTournament/Content/Paks/UT.pak": "pak-" + version,
+	}
+}
+
+// checkIndexedHashes checks that packager reads the hashes of versions
+// from the index
+func checkIndexedHashes(t *testing.T, packager *Packager, versions ...string) {
+	t.Helper()
+	for _, version := range versions {
+		hashes, ok, err := packager.indexedHashes(version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			t.Errorf("%s isn't indexed", version)
+			continue
+		}
+		if !reflect.DeepEqual(hashes, testVersionHashes(version)) {
+			t.Errorf("%s: read %v", version, hashes)
+		}
+	}
+}
+
+func TestCompactHashCache(t *testing.T) {
+	fixture := newFixture(t)
+	packager := fixture.newPackager(Options{})
+	versions := []string{"3395761", "3450000", "3525360"}
+	for _, version := range versions {
+		err := packager.writeHashCache(version, testVersionHashes(version))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	packager = fixture.newPackager(Options{HashCacheIndex: true})
+	compacted, err := packager.CompactHashCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(compacted, versions) {
+		t.Errorf("Compacted %v, expected %v", compacted, versions)
+	}
+	for _, version := range versions {
+		if _, err := os.Stat(packager.hashCachePath(version)); !os.IsNotExist(err) {
+			t.Errorf("Hash cache file of %s wasn't removed", version)
+		}
+	}
+	// A new Packager loads the index from disk
+	packager = fixture.newPackager(Options{HashCacheIndex: true})
+	checkIndexedHashes(t, packager, versions...)
+	for _, version := range versions {
+		hashes, err := packager.readHashCache(version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(hashes, testVersionHashes(version)) {
+			t.Errorf("%s: read %v from the cache", version, hashes)
+		}
+	}
+}
+
+func TestHashIndexAppendsVersions(t *testing.T) {
+	fixture := newFixture(t)
+	packager := fixture.newPackager(Options{HashCacheIndex: true})
+	err := packager.writeHashCache("3395761", testVersionHashes("3395761"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := ioutil.ReadFile(packager.hashIndexPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = packager.writeHashCache("3525360", testVersionHashes("3525360"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := ioutil.ReadFile(packager.hashIndexPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(after, before) {
+		t.Error("Indexing a version rewrote the index")
+	}
+
+	err = packager.removeHashCache("3395761")
+	if err != nil {
+		t.Fatal(err)
+	}
+	packager = fixture.newPackager(Options{HashCacheIndex: true})
+	checkIndexedHashes(t, packager, "3525360")
+	if _, ok, _ := packager.indexedHashes("3395761"); ok {
+		t.Error("Removed version is still indexed")
+	}
+}
+
+func TestHashIndexCompactsReplacedRecords(t *testing.T) {
+	fixture := newFixture(t)
+	packager := fixture.newPackager(Options{HashCacheIndex: true})
+	for i := 0; i < 10*minHashIndexCompaction; i++ {
+		err := packager.writeHashCache("3525360", testVersionHashes(fmt.Sprint(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := packager.writeHashCache("3525360", testVersionHashes("3525360"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packager.hashIndex.count >= minHashIndexCompaction {
+		t.Errorf("Index holds %d records of a single version", packager.hashIndex.count)
+	}
+	packager = fixture.newPackager(Options{HashCacheIndex: true})
+	checkIndexedHashes(t, packager, "3525360")
+}
+
+func TestHashIndexIgnoresTornAppend(t *testing.T) {
+	fixture := newFixture(t)
+	packager := fixture.newPackager(Options{HashCacheIndex: true})
+	err := packager.writeHashCache("3395761", testVersionHashes("3395761"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A crash while appending leaves a partial record
+	file, err := os.OpenFile(packager.hashIndexPath(), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = file.WriteString("3450000 4096\n{\"UnrealTour")
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packager = fixture.newPackager(Options{HashCacheIndex: true})
+	checkIndexedHashes(t, packager, "3395761")
+	err = packager.writeHashCache("3525360", testVersionHashes("3525360"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	packager = fixture.newPackager(Options{HashCacheIndex: true})
+	checkIndexedHashes(t, packager, "3395761", "3525360")
+	if _, ok, _ := packager.indexedHashes("3450000"); ok {
+		t.Error("Partial record was indexed")
+	}
+}
+
+func TestHashIndexMigratesSingleMap(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		fixture := newFixture(t)
+		options := Options{HashCacheIndex: true, CompressHashCache: compress}
+		packager := fixture.newPackager(options)
+		index := map[string]map[string]string{
+			"3395761": testVersionHashes("3395761"),
+			"3525360": testVersionHashes("3525360"),
+		}
+		indexBytes, err := packager.encodeHashCache(&index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(packager.hashIndexPath(), indexBytes, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checkIndexedHashes(t, packager, "3395761", "3525360")
+		migrated, err := ioutil.ReadFile(packager.hashIndexPath())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if json.Valid(migrated) || bytes.HasPrefix(migrated, zstdMagic) {
+			t.Errorf("Compressed %v: index wasn't migrated to records", compress)
+		}
+		packager = fixture.newPackager(options)
+		checkIndexedHashes(t, packager, "3395761", "3525360")
+	}
+}
@@ -0,0 +1,90 @@
+package packager
+
+import (
+	"container/list"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// versionHashLRU keeps the hashes of the most recently used versions in
+// memory so a run touching many pairs doesn't parse the same .hashes files
+// over and over. The maps it returns are shared and must not be modified
+type versionHashLRU struct {
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+	lock    sync.Mutex
+}
+
+// versionHashEntry is a single version in the LRU
+type versionHashEntry struct {
+	version string
+	hashes  map[string]string
+}
+
+// newVersionHashLRU creates an LRU holding up to size versions
+func newVersionHashLRU(size int) *versionHashLRU {
+	return &versionHashLRU{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// get returns the hashes of version if they are cached
+func (lru *versionHashLRU) get(version string) (map[string]string, bool) {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+	element, ok := lru.entries[version]
+	if !ok {
+		return nil, false
+	}
+	lru.order.MoveToFront(element)
+	return element.Value.(*versionHashEntry).hashes, true
+}
+
+// put caches the hashes of version, evicting the least recently used
+// version when full
+func (lru *versionHashLRU) put(version string, hashes map[string]string) {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+	if element, ok := lru.entries[version]; ok {
+		element.Value.(*versionHashEntry).hashes = hashes
+		lru.order.MoveToFront(element)
+		return
+	}
+	lru.entries[version] = lru.order.PushFront(&versionHashEntry{
+		version: version,
+		hashes:  hashes,
+	})
+	for lru.order.Len() > lru.size {
+		oldest := lru.order.Back()
+		lru.order.Remove(oldest)
+		delete(lru.entries, oldest.Value.(*versionHashEntry).version)
+	}
+}
+
+// remove drops version from the cache
+func (lru *versionHashLRU) remove(version string) {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+	if element, ok := lru.entries[version]; ok {
+		lru.order.Remove(element)
+		delete(lru.entries, version)
+	}
+}
+
+// RebuildHashes discards the cached hashes of version, in memory and on
+// disk, and generates them again from the release files
+func (packager *Packager) RebuildHashes(version string) (map[string]string, error) {
+	if packager.hashLRU != nil {
+		packager.hashLRU.remove(version)
+	}
+	err := packager.removeHashCache(version)
+	if err != nil {
+		return nil, err
+	}
+	log.WithField("version", version).Info("Rebuilding version hashes")
+	return packager.getVersionHashes(version)
+}
@@ -0,0 +1,75 @@
+package packager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVersionHashesAreCachedInMemory(t *testing.T) {
+	packager := newTestPackager(t, Options{HashMemoryCacheSize: 1})
+	installTestVersion(t, packager, 3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+	})
+	first, err := packager.getVersionHashes("3525360")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without the release and its hash cache only memory is left
+	versionDir := filepath.Join(packager.releaseDir, "3525360")
+	err = os.Rename(versionDir, versionDir+".moved")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Rename(packager.hashCachePath("3525360"),
+		packager.hashCachePath("3525360")+".moved")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := packager.getVersionHashes("3525360")
+	if err != nil {
+		t.Fatalf("Second lookup read from disk: %s", err)
+	}
+	if len(second) != len(first) {
+		t.Errorf("Second lookup returned %d hashes, expected %d", len(second), len(first))
+	}
+	err = os.Rename(versionDir+".moved", versionDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rebuilding invalidates the cached hashes
+	const config = "UnrealTournament/Config/Default.ini"
+	writeTree(t, versionDir, map[string]string{config: "setting=2"})
+	rebuilt, err := packager.RebuildHashes("3525360")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rebuilt[config] == first[config] {
+		t.Error("Rebuilt hashes are the cached hashes")
+	}
+	cached, err := packager.getVersionHashes("3525360")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached[config] != rebuilt[config] {
+		t.Error("Lookup after rebuilding returned the old hashes")
+	}
+}
+
+func TestVersionHashLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	lru := newVersionHashLRU(2)
+	lru.put("1", map[string]string{"a": "1"})
+	lru.put("2", map[string]string{"a": "2"})
+	lru.get("1")
+	lru.put("3", map[string]string{"a": "3"})
+	if _, ok := lru.get("2"); ok {
+		t.Error("Least recently used version wasn't evicted")
+	}
+	for _, version := range []string{"1", "3"} {
+		if _, ok := lru.get(version); !ok {
+			t.Errorf("Version %s was evicted", version)
+		}
+	}
+}
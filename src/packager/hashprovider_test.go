@@ -0,0 +1,85 @@
+package packager
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// memoryHashProvider supplies version hashes from memory
+type memoryHashProvider map[string]map[string]string
+
+func (provider memoryHashProvider) VersionHashes(version string) (map[string]string, error) {
+	hashes, ok := provider[version]
+	if !ok {
+		return nil, fmt.Errorf("No hashes for %s", version)
+	}
+	copied := make(map[string]string, len(hashes))
+	for path, hash := range hashes {
+		copied[path] = hash
+	}
+	return copied, nil
+}
+
+func TestDeltaFromInjectedHashes(t *testing.T) {
+	packager := newTestPackager(t, Options{
+		HashProvider: memoryHashProvider{
+			"3395761": {
+				"UnrealTournament/Config/Default.ini":    "hash-config-1",
+				"UnrealTournament/Content/Paks/game.pak": "hash-pak-1",
+				"UnrealTournament/Content/Removed.txt":   "hash-removed",
+				"UnrealTournament/Content/Kept.txt":      "hash-kept",
+			},
+			"3525360": {
+				"UnrealTournament/Config/Default.ini":    "hash-config-2",
+				"UnrealTournament/Content/Paks/game.pak": "hash-pak-2",
+				"UnrealTournament/Content/Added.txt":     "hash-added",
+				"UnrealTournament/Content/Kept.txt":      "hash-kept",
+			},
+		},
+	})
+	fromHashes, err := packager.getVersionHashes("3395761")
+	if err != nil {
+		t.Fatal(err)
+	}
+	toHashes, err := packager.getVersionHashes("3525360")
+	if err != nil {
+		t.Fatal(err)
+	}
+	operations := packager.calculateHashDeltaOperations(fromHashes, toHashes)
+	expected := map[string]DeltaOperation{
+		"UnrealTournament/Config/Default.ini":    {Operation: deltaOperationModified},
+		"UnrealTournament/Content/Paks/game.pak": {Operation: deltaOperationModified},
+		"UnrealTournament/Content/Added.txt":     {Operation: deltaOperationAdded},
+		"UnrealTournament/Content/Removed.txt":   {Operation: deltaOperationRemoved},
+	}
+	if !reflect.DeepEqual(operations, expected) {
+		t.Errorf("Operations are %v, expected %v", operations, expected)
+	}
+}
+
+func TestStagingFromInjectedHashesWithoutContent(t *testing.T) {
+	// Nothing in this delta needs file content, so nothing is on disk
+	packager := newTestPackager(t, Options{
+		HashProvider: memoryHashProvider{
+			"3395761": {
+				"UnrealTournament/Content/Paks/game.pak": "hash-pak",
+				"UnrealTournament/Content/Removed.txt":   "hash-removed",
+			},
+			"3525360": {
+				"UnrealTournament/Content/Paks/game.pak": "hash-pak",
+			},
+		},
+	})
+	staged, counts, err := packager.stageUpgradePath("3395761", "3525360")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts.Modified != 0 || counts.Removed != 1 {
+		t.Errorf("Operation counts are %+v", counts)
+	}
+	files := readTree(t, staged.dir)
+	if _, ok := files["UnrealTournament/Content/Paks/game.pak"]; ok {
+		t.Error("Unchanged pak was staged")
+	}
+}
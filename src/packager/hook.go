@@ -0,0 +1,113 @@
+package packager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// HookFailureWarn logs a failed post-package hook and continues
+	HookFailureWarn = "warn"
+	// HookFailureFail fails the package when its post-package hook fails
+	HookFailureFail = "fail"
+)
+
+// PackageHookPayload is the JSON body posted to the post-package webhook
+type PackageHookPayload struct {
+	FromVersion string `json:"from_version"`
+	ToVersion   string `json:"to_version"`
+	Platform    string `json:"platform"`
+	Hash        string `json:"hash"`
+	Path        string `json:"path"`
+	URL         string `json:"url"`
+}
+
+// runPackageHooks runs the post-package command and webhook for the
+// package at packagePath, published at updateURL. Failures are only
+// returned with HookFailureFail
+func (packager *Packager) runPackageHooks(
+	packagePath string,
+	updateURL string,
+	values TemplateValues) error {
+	err := packager.runPackageHookCommand(packagePath, updateURL, values)
+	if err == nil {
+		err = packager.postPackageWebhook(packagePath, updateURL, values)
+	}
+	if err == nil {
+		return nil
+	}
+	log.WithFields(log.Fields{
+		"fromVersion": values.FromVersion,
+		"toVersion":   values.ToVersion,
+		"err":         "post_package_hook",
+	}).Error(err.Error())
+	if packager.options.PostPackageHookFailure == HookFailureFail {
+		return err
+	}
+	return nil
+}
+
+// runPackageHookCommand runs the configured command with its arguments
+// rendered as package templates, which may also use {path} and {url}
+func (packager *Packager) runPackageHookCommand(
+	packagePath string,
+	updateURL string,
+	values TemplateValues) error {
+	if len(packager.options.PostPackageCommand) == 0 {
+		return nil
+	}
+	replacer := strings.NewReplacer("{path}", packagePath, "{url}", updateURL)
+	args := make([]string, len(packager.options.PostPackageCommand))
+	for i, arg := range packager.options.PostPackageCommand {
+		args[i] = RenderTemplate(replacer.Replace(arg), values)
+	}
+	output, err := exec.Command(args[0], args[1:]...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("Post-package command failed: %s: %s",
+			err, strings.TrimSpace(string(output)))
+	}
+	log.WithFields(log.Fields{
+		"command": args[0],
+		"output":  strings.TrimSpace(string(output)),
+	}).Debug("Post-package command finished")
+	return nil
+}
+
+// postPackageWebhook posts the package details to the configured webhook
+func (packager *Packager) postPackageWebhook(
+	packagePath string,
+	updateURL string,
+	values TemplateValues) error {
+	if packager.options.PostPackageWebhook == "" {
+		return nil
+	}
+	payload, err := json.Marshal(&PackageHookPayload{
+		FromVersion: values.FromVersion,
+		ToVersion:   values.ToVersion,
+		Platform:    values.Platform,
+		Hash:        values.Hash,
+		Path:        packagePath,
+		URL:         updateURL,
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := packager.httpClient.Post(
+		packager.options.PostPackageWebhook,
+		"application/json",
+		bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	drainAndClose(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Post-package webhook returned status code %d",
+			resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package packager
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// installHookVersions installs two versions to package with hooks
+func installHookVersions(t *testing.T, packager *Packager) {
+	t.Helper()
+	installTestVersion(t, packager, 3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+	})
+	installTestVersion(t, packager, 3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+	})
+}
+
+func TestPostPackageHooks(t *testing.T) {
+	var payload PackageHookPayload
+	webhook := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			err := json.NewDecoder(r.Body).Decode(&payload)
+			if err != nil {
+				t.Error(err)
+			}
+		}))
+	defer webhook.Close()
+	argsPath := filepath.Join(tempDir(t), "args")
+	packager := newTestPackager(t, Options{
+		PostPackageCommand: []string{
+			"sh", "-c", `echo "$@" > ` + argsPath, "hook",
+			"{from}", "{to}", "{path}", "{url}",
+		},
+		PostPackageWebhook: webhook.URL,
+	})
+	installHookVersions(t, packager)
+
+	updatePackage, err := packager.GeneratePackage("3395761", "3525360")
+	if err != nil {
+		t.Fatal(err)
+	}
+	packagePath := filepath.Join(packager.packageDir, "3395761-3525360.tar.gz")
+	args, err := ioutil.ReadFile(argsPath)
+	if err != nil {
+		t.Fatalf("Post-package command didn't run: %s", err)
+	}
+	expectedArgs := strings.Join([]string{
+		"3395761", "3525360", packagePath, updatePackage.UpdateURL,
+	}, " ")
+	if strings.TrimSpace(string(args)) != expectedArgs {
+		t.Errorf("Command arguments are '%s', expected '%s'", args, expectedArgs)
+	}
+	expectedPayload := PackageHookPayload{
+		FromVersion: "3395761",
+		ToVersion:   "3525360",
+		Platform:    packagePlatform,
+		Path:        packagePath,
+		URL:         updatePackage.UpdateURL,
+	}
+	payload.Hash = ""
+	if payload != expectedPayload {
+		t.Errorf("Webhook payload is %+v, expected %+v", payload, expectedPayload)
+	}
+}
+
+func TestPostPackageHookFailure(t *testing.T) {
+	for _, failure := range []string{HookFailureWarn, HookFailureFail} {
+		packager := newTestPackager(t, Options{
+			PostPackageCommand:     []string{"false"},
+			PostPackageHookFailure: failure,
+		})
+		installHookVersions(t, packager)
+		_, err := packager.GeneratePackage("3395761", "3525360")
+		if failure == HookFailureWarn && err != nil {
+			t.Errorf("Failed hook with warn failed the package: %s", err)
+		}
+		if failure == HookFailureFail && err == nil {
+			t.Error("Failed hook with fail didn't fail the package")
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package packager
+
+import (
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	// defaultHTTPIdleConnsPerHost keeps enough idle connections to reuse
+	// for concurrent mirror segments to the same host
+	defaultHTTPIdleConnsPerHost = 8
+	defaultHTTPIdleConnTimeout  = 90 * time.Second
+	defaultHTTPKeepAlive        = 30 * time.Second
+	// maxDrainBytes is how much of an unread response body is read before
+	// closing so the connection can be reused
+	maxDrainBytes = 64 * 1024
+)
+
+// newHTTPClient creates the client used for all requests of the Packager,
+// with the transport tuned by options. There is no overall timeout as
+// release downloads take long
+func newHTTPClient(options Options) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: options.HTTPKeepAlive,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.MaxIdleConnsPerHost = options.HTTPIdleConnsPerHost
+	if transport.MaxIdleConns < options.HTTPIdleConnsPerHost {
+		transport.MaxIdleConns = options.HTTPIdleConnsPerHost
+	}
+	transport.IdleConnTimeout = options.HTTPIdleConnTimeout
+	transport.ForceAttemptHTTP2 = !options.DisableHTTP2
+	if options.DisableHTTP2 {
+		// A non-nil empty map stops the transport from upgrading to HTTP/2
+		transport.TLSNextProto = make(
+			map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	return &http.Client{Transport: transport}
+}
+
+// drainAndClose reads what is left of a small response body and closes it,
+// an unread body keeps its connection from being reused
+func drainAndClose(body io.ReadCloser) {
+	io.Copy(ioutil.Discard, io.LimitReader(body, maxDrainBytes))
+	body.Close()
+}
@@ -0,0 +1,79 @@
+package packager
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHTTPClientReusesConnections(t *testing.T) {
+	var connections int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Length", "7")
+			io.WriteString(w, "release")
+		}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&connections, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+	packager := newTestPackager(t, Options{})
+
+	for i := 0; i < 5; i++ {
+		_, err := packager.getDownloadSize(server.URL + "/release.zip")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = packager.downloadFile(
+			filepath.Join(packager.workingDir, "release.zip"),
+			server.URL+"/release.zip")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if atomic.LoadInt32(&connections) != 1 {
+		t.Errorf("Sequential requests opened %d connections, expected 1", connections)
+	}
+}
+
+func TestHTTPClientNegotiatesHTTP2(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+	serverTLS := server.Client().Transport.(*http.Transport).TLSClientConfig
+
+	for _, test := range []struct {
+		disable bool
+		major   int
+	}{
+		{false, 2},
+		{true, 1},
+	} {
+		client := newHTTPClient(Options{
+			HTTPIdleConnsPerHost: defaultHTTPIdleConnsPerHost,
+			DisableHTTP2:         test.disable,
+		})
+		client.Transport.(*http.Transport).TLSClientConfig = &tls.Config{
+			RootCAs: serverTLS.RootCAs,
+		}
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.ProtoMajor != test.major {
+			t.Errorf("DisableHTTP2 %v: got HTTP/%d, expected HTTP/%d",
+				test.disable, resp.ProtoMajor, test.major)
+		}
+	}
+}
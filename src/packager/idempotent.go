@@ -0,0 +1,104 @@
+package packager
+
+import (
+	"strings"
+
+	"github.com/donovansolms/ut4-update-packager/src/packager/models"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+)
+
+// mysqlDuplicateEntry is the MySQL error number of a duplicate key
+const mysqlDuplicateEntry = 1062
+
+// saveBlogPostOnce inserts blogPost unless a post with the same GUID
+// exists. A concurrent or retried run inserting the same post isn't an
+// error
+func saveBlogPostOnce(db *gorm.DB, blogPost models.Ut4BlogPost) error {
+	var existing models.Ut4BlogPost
+	query := db.
+		Where("guid = ? AND is_deleted = 0", blogPost.GUID).
+		Attrs(blogPost).
+		FirstOrCreate(&existing)
+	if isDuplicateKeyError(query.Error) {
+		log.WithField("guid", blogPost.GUID).Debug("Blog post saved already")
+		return nil
+	}
+	return query.Error
+}
+
+// savePackageOnce inserts updatePackage unless a package for the same
+// versions and channel exists. A concurrent or retried run inserting the
+// same package isn't an error. A pruned package is restored, the unique
+// index doesn't allow a second row for it
+func savePackageOnce(db *gorm.DB, updatePackage models.Ut4UpdatePackages) error {
+	var existing models.Ut4UpdatePackages
+	query := db.
+		Where("from_version = ? AND to_version = ? AND channel = ? AND scope = ?",
+			updatePackage.FromVersion,
+			updatePackage.ToVersion,
+			updatePackage.Channel,
+			updatePackage.Scope,
+		).
+		Attrs(updatePackage).
+		FirstOrCreate(&existing)
+	if isDuplicateKeyError(query.Error) {
+		log.WithFields(log.Fields{
+			"fromVersion": updatePackage.FromVersion,
+			"toVersion":   updatePackage.ToVersion,
+		}).Debug("Upgrade package saved already")
+		return nil
+	}
+	if query.Error != nil || existing.IsDeleted == 0 {
+		return query.Error
+	}
+	updatePackage.ID = existing.ID
+	return db.Save(&updatePackage).Error
+}
+
+// addUniqueIndexes adds the unique indexes on the natural keys that make
+// concurrent inserts of the same post or package fail instead of adding a
+// duplicate. An index that can't be added, e.g. because earlier runs left
+// duplicates, is logged and the lookups before inserting still apply
+func addUniqueIndexes(db *gorm.DB) {
+	indexes := []struct {
+		model   interface{}
+		name    string
+		columns []string
+	}{
+		{
+			&models.Ut4BlogPost{},
+			"uix_ut4_blog_posts_guid",
+			[]string{"guid"},
+		},
+		{
+			&models.Ut4UpdatePackages{},
+			"uix_ut4_update_packages_path",
+			[]string{"from_version", "to_version", "channel", "scope"},
+		},
+	}
+	for _, index := range indexes {
+		query := db.Model(index.model).AddUniqueIndex(index.name, index.columns...)
+		if query.Error != nil {
+			log.WithFields(log.Fields{
+				"index": index.name,
+				"err":   "unique_index",
+			}).Warning(query.Error.Error())
+		}
+	}
+}
+
+// isDuplicateKeyError checks if err is a unique key violation, which
+// happens when another run inserted the same row between the lookup and
+// the insert
+func isDuplicateKeyError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok {
+		return mysqlErr.Number == mysqlDuplicateEntry
+	}
+	// Other dialects, e.g. sqlite
+	return strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
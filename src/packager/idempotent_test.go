@@ -0,0 +1,82 @@
+package packager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/donovansolms/ut4-update-packager/src/packager/models"
+)
+
+func TestSaveBlogPostOnce(t *testing.T) {
+	fixture := newFixture(t)
+	fixture.newPackager(Options{})
+	db := fixture.db()
+	blogPost := models.Ut4BlogPost{
+		Title:       "UT Release 3525360",
+		GUID:        "post-3525360",
+		DateCreated: time.Now(),
+	}
+	for attempt := 0; attempt < 2; attempt++ {
+		err := saveBlogPostOnce(db, blogPost)
+		if err != nil {
+			t.Fatalf("Attempt %d failed: %s", attempt, err)
+		}
+	}
+	var count int
+	db.Table("ut4_blog_posts").Where("guid = ?", "post-3525360").Count(&count)
+	if count != 1 {
+		t.Errorf("Saved %d posts, expected 1", count)
+	}
+
+	// The unique index catches inserts that skip the lookup
+	query := db.Create(&blogPost)
+	if !isDuplicateKeyError(query.Error) {
+		t.Errorf("Duplicate insert returned %v", query.Error)
+	}
+}
+
+func TestSavePackageOnce(t *testing.T) {
+	fixture := newFixture(t)
+	fixture.newPackager(Options{})
+	db := fixture.db()
+	updatePackage := models.Ut4UpdatePackages{
+		FromVersion: "3395761",
+		ToVersion:   "3525360",
+		UpdateURL:   "http://update.donovansolms.com/3395761-3525360.tar.gz",
+		Channel:     "stable",
+		DateCreated: time.Now(),
+	}
+	for attempt := 0; attempt < 2; attempt++ {
+		err := savePackageOnce(db, updatePackage)
+		if err != nil {
+			t.Fatalf("Attempt %d failed: %s", attempt, err)
+		}
+	}
+	var rows []models.Ut4UpdatePackages
+	db.Find(&rows)
+	if len(rows) != 1 {
+		t.Fatalf("Saved %d packages, expected 1", len(rows))
+	}
+	query := db.Create(&updatePackage)
+	if !isDuplicateKeyError(query.Error) {
+		t.Errorf("Duplicate insert returned %v", query.Error)
+	}
+
+	// A pruned package is restored rather than inserted again
+	query = db.Model(&rows[0]).Update("is_deleted", 1)
+	if query.Error != nil {
+		t.Fatal(query.Error)
+	}
+	updatePackage.ID = 0
+	updatePackage.UpdateURL = "http://update.donovansolms.com/rebuilt.tar.gz"
+	err := savePackageOnce(db, updatePackage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows = nil
+	db.Find(&rows)
+	if len(rows) != 1 || rows[0].IsDeleted != 0 ||
+		rows[0].UpdateURL != updatePackage.UpdateURL {
+		t.Errorf("Pruned package wasn't restored: %+v", rows)
+	}
+}
@@ -0,0 +1,113 @@
+package packager
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/donovansolms/ut4-update-packager/src/packager/models"
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+)
+
+// latestFilename is the name of the latest version pointer in the package dir
+const latestFilename = "latest.json"
+
+// LatestRelease is the content of latest.json, it lets clients discover
+// the newest version and the packages available to reach it
+type LatestRelease struct {
+	Version        string          `json:"version"`
+	FullInstallURL string          `json:"full_install_url,omitempty"`
+	Packages       []LatestPackage `json:"packages"`
+}
+
+// LatestPackage is a single upgrade package listed in latest.json.
+// SignatureURL is its signed manifest, only set for signed packages
+type LatestPackage struct {
+	FromVersion  string `json:"from_version"`
+	ToVersion    string `json:"to_version"`
+	URL          string `json:"url"`
+	SignatureURL string `json:"signature_url,omitempty"`
+	Channel      string `json:"channel"`
+}
+
+// publishLatest writes latest.json for version to the package dir and
+// uploads it. Only the packages to version on the current channel and
+// scope are listed. The file is written to a temporary name first and
+// renamed so that readers never see a partial file
+func (packager *Packager) publishLatest(
+	db *gorm.DB,
+	version string,
+	fullInstallURL string) error {
+
+	var updatePackages []models.Ut4UpdatePackages
+	query := db.Where(
+		"to_version = ? AND channel = ? AND scope = ? AND is_deleted = 0",
+		version,
+		packager.releaseChannel(),
+		packager.packageScope(),
+	).Order("from_version").Find(&updatePackages)
+	if query.Error != nil {
+		return query.Error
+	}
+
+	latestPath := filepath.Join(packager.packageDir, latestFilename)
+	if fullInstallURL == "" {
+		// Releases from the watch dir have no download URL, keep the one
+		// published for the same version earlier
+		fullInstallURL = publishedFullInstallURL(latestPath, version)
+	}
+	latest := LatestRelease{
+		Version:        version,
+		FullInstallURL: fullInstallURL,
+		Packages:       []LatestPackage{},
+	}
+	for _, updatePackage := range updatePackages {
+		latest.Packages = append(latest.Packages, LatestPackage{
+			FromVersion:  updatePackage.FromVersion,
+			ToVersion:    updatePackage.ToVersion,
+			URL:          updatePackage.UpdateURL,
+			SignatureURL: updatePackage.SignatureURL,
+			Channel:      updatePackage.Channel,
+		})
+	}
+	latestJSON, err := json.MarshalIndent(&latest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = writeFileAtomic(latestPath, latestJSON)
+	if err != nil {
+		return err
+	}
+	latestURL, err := packager.uploadFile(
+		latestPath,
+		TemplateValues{
+			ToVersion: version,
+			Platform:  packagePlatform,
+		})
+	if err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{
+		"version":  version,
+		"packages": len(latest.Packages),
+		"url":      latestURL,
+	}).Info("Published latest version")
+	return nil
+}
+
+// publishedFullInstallURL returns the full install URL in the latest.json
+// at latestPath when it is for version
+func publishedFullInstallURL(latestPath string, version string) string {
+	latestJSON, err := ioutil.ReadFile(latestPath)
+	if err != nil {
+		return ""
+	}
+	var latest LatestRelease
+	err = json.Unmarshal(latestJSON, &latest)
+	if err != nil || latest.Version != version {
+		return ""
+	}
+	return latest.FullInstallURL
+}
@@ -0,0 +1,111 @@
+package packager
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// recordingUploader is a template Uploader that remembers the paths it
+// uploaded
+type recordingUploader struct {
+	Uploader
+	uploaded []string
+}
+
+func (uploader *recordingUploader) Upload(
+	packagePath string,
+	values TemplateValues) (string, error) {
+	uploader.uploaded = append(uploader.uploaded, filepath.Base(packagePath))
+	return uploader.Uploader.Upload(packagePath, values)
+}
+
+func TestPublishLatest(t *testing.T) {
+	fixture := newFixture(t)
+	fixture.installVersion(3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+	})
+	fixture.installVersion(3450000, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+	})
+	downloadURL := fixture.serveRelease(3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=3",
+	})
+	fixture.addPost("UT Release 3525360", "post-3525360", downloadURL, time.Now())
+	uploader := &recordingUploader{
+		Uploader: NewTemplateUploader(
+			"http://update.donovansolms.com/{from}-{to}.tar.gz"),
+	}
+	packager := fixture.newPackager(Options{
+		PublishLatest: true,
+		Uploader:      uploader,
+	})
+
+	// A package to an older version must not be listed
+	db := fixture.db()
+	err := db.Exec("INSERT INTO ut4_update_packages " +
+		"(from_version, to_version, update_url, channel, scope, is_deleted) " +
+		"VALUES ('3395761', '3450000', 'http://old', 'stable', '', 0)").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = packager.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	latestJSON, err := ioutil.ReadFile(filepath.Join(fixture.packageDir, latestFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var latest LatestRelease
+	err = json.Unmarshal(latestJSON, &latest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := LatestRelease{
+		Version:        "3525360",
+		FullInstallURL: downloadURL,
+		Packages: []LatestPackage{
+			{
+				FromVersion: "3395761",
+				ToVersion:   "3525360",
+				URL:         "http://update.donovansolms.com/3395761-3525360.tar.gz",
+				Channel:     ChannelStable,
+			},
+			{
+				FromVersion: "3450000",
+				ToVersion:   "3525360",
+				URL:         "http://update.donovansolms.com/3450000-3525360.tar.gz",
+				Channel:     ChannelStable,
+			},
+		},
+	}
+	if !reflect.DeepEqual(latest, expected) {
+		t.Errorf("latest.json is %+v, expected %+v", latest, expected)
+	}
+	if uploader.uploaded[len(uploader.uploaded)-1] != latestFilename {
+		t.Errorf("latest.json wasn't uploaded, uploads were %v", uploader.uploaded)
+	}
+}
+
+func TestPublishedFullInstallURL(t *testing.T) {
+	latestPath := filepath.Join(tempDir(t), latestFilename)
+	if url := publishedFullInstallURL(latestPath, "3525360"); url != "" {
+		t.Errorf("Missing latest.json gave %q", url)
+	}
+	err := ioutil.WriteFile(latestPath,
+		[]byte(`{"version": "3525360", "full_install_url": "http://full"}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url := publishedFullInstallURL(latestPath, "3525360"); url != "http://full" {
+		t.Errorf("Same version gave %q", url)
+	}
+	if url := publishedFullInstallURL(latestPath, "3600000"); url != "" {
+		t.Errorf("Other version gave %q", url)
+	}
+}
@@ -0,0 +1,80 @@
+package packager
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// versionManifestSuffix is appended to the version for its hash manifest
+// in the package dir
+const versionManifestSuffix = ".manifest.json"
+
+// VersionManifest lists the hash of every file in a version so clients can
+// verify a full install
+type VersionManifest struct {
+	Version string            `json:"version"`
+	Files   map[string]string `json:"files"`
+}
+
+// writeVersionManifest writes the hash manifest of version to the package
+// dir and signs it when a signing key is configured. The signed copy is
+// the manifest path plus .sig
+func (packager *Packager) writeVersionManifest(version string) error {
+	hashes, err := packager.getVersionHashes(version)
+	if err != nil {
+		return err
+	}
+	manifestBytes, err := json.Marshal(&VersionManifest{
+		Version: version,
+		Files:   hashes,
+	})
+	if err != nil {
+		return err
+	}
+	manifestPath := filepath.Join(
+		packager.packageDir,
+		version+versionManifestSuffix)
+	err = writeFileAtomic(manifestPath, manifestBytes)
+	if err != nil {
+		return err
+	}
+	if packager.signingKey != nil {
+		signedBytes, err := json.Marshal(&SignedManifest{
+			Manifest:  manifestBytes,
+			Signature: ed25519.Sign(packager.signingKey, manifestBytes),
+		})
+		if err != nil {
+			return err
+		}
+		err = writeFileAtomic(manifestPath+signatureSuffix, signedBytes)
+		if err != nil {
+			return err
+		}
+	}
+	log.WithFields(log.Fields{
+		"version": version,
+		"files":   len(hashes),
+	}).Info("Version manifest written")
+	return nil
+}
+
+// writeFileAtomic writes content to a temporary file next to path and
+// renames it into place
+func writeFileAtomic(path string, content []byte) error {
+	tempPath := path + ".tmp"
+	err := ioutil.WriteFile(tempPath, content, 0644)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tempPath, path)
+	if err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package packager
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestVersionManifestMatchesHashes(t *testing.T) {
+	keyPath, publicKey := writeSigningKey(t, tempDir(t))
+	packager := newTestPackager(t, Options{
+		SigningKeyPath:   keyPath,
+		VersionManifests: true,
+	})
+	installTestVersion(t, packager, 3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+		"UnrealTournament/Content/Added.txt":  "added",
+	})
+
+	err := packager.writeVersionManifest("3525360")
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifestPath := filepath.Join(packager.packageDir, "3525360"+versionManifestSuffix)
+	manifestBytes, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest VersionManifest
+	err = json.Unmarshal(manifestBytes, &manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes, err := packager.getVersionHashes("3525360")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Version != "3525360" || !reflect.DeepEqual(manifest.Files, hashes) {
+		t.Errorf("Manifest is %+v, expected the hashes %v", manifest, hashes)
+	}
+
+	signedBytes, err := ioutil.ReadFile(manifestPath + signatureSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var signed SignedManifest
+	err = json.Unmarshal(signedBytes, &signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(signed.Manifest) != string(manifestBytes) {
+		t.Error("Signed manifest differs from the manifest")
+	}
+	if !ed25519.Verify(publicKey, signed.Manifest, signed.Signature) {
+		t.Error("Manifest signature doesn't verify")
+	}
+}
@@ -0,0 +1,72 @@
+package packager
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/donovansolms/ut4-update-packager/src/packager/models"
+	"github.com/jinzhu/gorm"
+	"github.com/mmcdole/gofeed"
+)
+
+const (
+	// MetadataLink captures the link of the post as the release notes URL
+	MetadataLink = "link"
+	// MetadataCategories captures the categories of the post
+	MetadataCategories = "categories"
+	// MetadataDescription captures the description of the post as the
+	// release notes
+	MetadataDescription = "description"
+)
+
+// defaultPostMetadata is captured when no metadata is configured
+var defaultPostMetadata = []string{MetadataLink, MetadataCategories}
+
+// validatePostMetadata checks that fields only holds known metadata
+func validatePostMetadata(fields []string) error {
+	for _, field := range fields {
+		if field != MetadataLink &&
+			field != MetadataCategories &&
+			field != MetadataDescription {
+			return fmt.Errorf("Unknown post metadata '%s'", field)
+		}
+	}
+	return nil
+}
+
+// setPostMetadata copies the configured metadata of releasePost to
+// blogPost
+func (packager *Packager) setPostMetadata(
+	blogPost *models.Ut4BlogPost,
+	releasePost *gofeed.Item) {
+	for _, field := range packager.options.PostMetadata {
+		switch field {
+		case MetadataLink:
+			blogPost.NotesURL = releasePost.Link
+		case MetadataCategories:
+			blogPost.Categories = strings.Join(releasePost.Categories, ",")
+		case MetadataDescription:
+			blogPost.Notes = releasePost.Description
+		}
+	}
+}
+
+// FindReleasePost returns the recorded post that announced version, with
+// the release metadata captured from it
+func (packager *Packager) FindReleasePost(
+	version string) (models.Ut4BlogPost, error) {
+	db, err := packager.openDB()
+	if err != nil {
+		return models.Ut4BlogPost{}, err
+	}
+	defer db.Close()
+
+	var blogPost models.Ut4BlogPost
+	query := db.Where("version = ? AND is_deleted = 0", version).
+		Order("date_published desc").
+		First(&blogPost)
+	if query.Error == gorm.ErrRecordNotFound {
+		return blogPost, fmt.Errorf("No release post for version %s", version)
+	}
+	return blogPost, query.Error
+}
@@ -0,0 +1,53 @@
+package packager
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRunStoresPostMetadata(t *testing.T) {
+	fixture := newFixture(t)
+	fixture.installVersion(3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+	})
+	downloadURL := fixture.serveRelease(3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+	})
+	fixture.addPost("UT Release 3525360", "post-3525360", downloadURL, time.Now())
+	fixture.posts[0].Link = "https://www.epicgames.com/unrealtournament/blog/release-notes"
+	fixture.posts[0].Categories = []string{"Releases", "Patch Notes"}
+	packager := fixture.newPackager(Options{
+		PostMetadata: []string{MetadataLink, MetadataCategories, MetadataDescription},
+	})
+
+	_, err := packager.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	blogPost, err := packager.FindReleasePost("3525360")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blogPost.Title != "UT Release 3525360" ||
+		blogPost.NotesURL != fixture.posts[0].Link ||
+		blogPost.Categories != "Releases,Patch Notes" ||
+		blogPost.Notes != fixture.posts[0].Content {
+		t.Errorf("Stored post is %+v", blogPost)
+	}
+
+	_, err = packager.FindReleasePost("3450000")
+	if err == nil {
+		t.Error("Found a post for a version without one")
+	}
+}
+
+func TestValidatePostMetadata(t *testing.T) {
+	err := validatePostMetadata([]string{MetadataLink, MetadataDescription})
+	if err != nil {
+		t.Error(err)
+	}
+	err = validatePostMetadata([]string{"author"})
+	if err == nil {
+		t.Error("Unknown metadata was accepted")
+	}
+}
@@ -0,0 +1,64 @@
+package packager
+
+import (
+	"time"
+
+	"github.com/donovansolms/ut4-update-packager/src/packager/models"
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+)
+
+// Migrate creates missing tables, columns and unique indexes for all
+// models. Existing columns and data are left untouched
+func (packager *Packager) Migrate() error {
+	db, err := packager.openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	query := db.AutoMigrate(
+		&models.Ut4BlogPost{},
+		&models.Ut4UpdatePackages{},
+		&models.Ut4RunStats{},
+		&models.Ut4FileHashes{},
+		&models.Ut4EmptyDeltas{},
+	)
+	if query.Error != nil {
+		return query.Error
+	}
+	addUniqueIndexes(db)
+	return nil
+}
+
+// saveRunStats records the statistics of a run
+func (packager *Packager) saveRunStats(
+	db *gorm.DB,
+	result RunResult,
+	downloadSize float64,
+	startTime time.Time) error {
+	if downloadSize == UnknownDownloadSize {
+		downloadSize = 0
+	}
+	stats := models.Ut4RunStats{
+		Version:          result.Version,
+		DownloadSize:     int64(downloadSize),
+		PackageCount:     len(result.Packages),
+		TotalDeltaSize:   result.TotalPackageSize,
+		CompressionRatio: result.CompressionRatio(),
+		DurationSeconds:  time.Since(startTime).Seconds(),
+		DateCreated:      time.Now(),
+	}
+	if stats.PackageCount > 0 {
+		stats.AverageDeltaSize = stats.TotalDeltaSize / int64(stats.PackageCount)
+	}
+	query := db.Save(&stats)
+	if query.Error != nil {
+		return query.Error
+	}
+	log.WithFields(log.Fields{
+		"version":  stats.Version,
+		"packages": stats.PackageCount,
+		"duration": stats.DurationSeconds,
+	}).Info("Run stats saved")
+	return nil
+}
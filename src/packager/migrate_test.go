@@ -0,0 +1,70 @@
+package packager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/donovansolms/ut4-update-packager/src/packager/models"
+)
+
+func TestSaveRunStats(t *testing.T) {
+	fixture := newFixture(t)
+	packager := fixture.newPackager(Options{})
+	db := fixture.db()
+	result := RunResult{
+		Version: "3525360",
+		Packages: []VersionPair{
+			{FromVersion: "3395761", ToVersion: "3525360"},
+			{FromVersion: "3450000", ToVersion: "3525360"},
+		},
+		TotalPackageSize: 3000,
+		Compression: []PackageCompression{
+			{CompressedSize: 1000, UncompressedSize: 4000},
+			{CompressedSize: 2000, UncompressedSize: 8000},
+		},
+	}
+	err := packager.saveRunStats(db, result, 1024*1024, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var runStats []models.Ut4RunStats
+	err = db.Find(&runStats).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runStats) != 1 {
+		t.Fatalf("%d run stats saved, expected 1", len(runStats))
+	}
+	stats := runStats[0]
+	if stats.Version != "3525360" ||
+		stats.DownloadSize != 1024*1024 ||
+		stats.PackageCount != 2 ||
+		stats.TotalDeltaSize != 3000 ||
+		stats.AverageDeltaSize != 1500 ||
+		stats.CompressionRatio != 0.25 {
+		t.Errorf("Run stats are %+v", stats)
+	}
+	if stats.DurationSeconds < 60 || stats.DurationSeconds > 120 {
+		t.Errorf("Run took %f seconds, expected about 60", stats.DurationSeconds)
+	}
+}
+
+func TestSaveRunStatsWithUnknownDownloadSize(t *testing.T) {
+	fixture := newFixture(t)
+	packager := fixture.newPackager(Options{})
+	db := fixture.db()
+	err := packager.saveRunStats(db, RunResult{Version: "3525360"},
+		UnknownDownloadSize, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stats models.Ut4RunStats
+	err = db.First(&stats).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.DownloadSize != 0 || stats.AverageDeltaSize != 0 {
+		t.Errorf("Run stats are %+v", stats)
+	}
+}
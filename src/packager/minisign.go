@@ -0,0 +1,126 @@
+package packager
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/blake2b"
+)
+
+// defaultReleaseSignatureSuffix is appended to the download URL to find
+// the detached minisign signature of a release
+const defaultReleaseSignatureSuffix = ".minisig"
+
+// minisignPublicKey is a parsed minisign public key
+type minisignPublicKey struct {
+	keyID [8]byte
+	key   ed25519.PublicKey
+}
+
+// parseMinisignPublicKey parses a base64 minisign public key, either the
+// key itself or the contents of a minisign.pub file
+func parseMinisignPublicKey(encoded string) (*minisignPublicKey, error) {
+	lines := strings.Split(strings.TrimSpace(encoded), "\n")
+	raw, err := base64.StdEncoding.DecodeString(
+		strings.TrimSpace(lines[len(lines)-1]))
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != 2+8+ed25519.PublicKeySize || string(raw[:2]) != "Ed" {
+		return nil, errors.New("Invalid minisign public key")
+	}
+	publicKey := &minisignPublicKey{key: ed25519.PublicKey(raw[10:])}
+	copy(publicKey.keyID[:], raw[2:10])
+	return publicKey, nil
+}
+
+// verifyMinisign verifies the file at filePath against the minisign
+// signature file at signaturePath. Both legacy and prehashed signatures
+// are supported
+func verifyMinisign(
+	publicKey *minisignPublicKey,
+	filePath string,
+	signaturePath string) error {
+	signatureFile, err := ioutil.ReadFile(signaturePath)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(strings.Replace(
+		string(signatureFile), "\r\n", "\n", -1), "\n")
+	if len(lines) < 4 ||
+		!strings.HasPrefix(lines[2], "trusted comment: ") {
+		return errors.New("Invalid minisign signature file")
+	}
+	signature, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil {
+		return err
+	}
+	if len(signature) != 2+8+ed25519.SignatureSize {
+		return errors.New("Invalid minisign signature")
+	}
+	if !bytes.Equal(signature[2:10], publicKey.keyID[:]) {
+		return errors.New("Release signature was made with a different key")
+	}
+	globalSignature, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var message []byte
+	switch string(signature[:2]) {
+	case "Ed":
+		message, err = ioutil.ReadAll(file)
+	case "ED":
+		digest, hashErr := blake2b.New512(nil)
+		if hashErr != nil {
+			return hashErr
+		}
+		_, err = io.Copy(digest, file)
+		message = digest.Sum(nil)
+	default:
+		return errors.New("Unsupported minisign signature algorithm")
+	}
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(publicKey.key, message, signature[10:]) {
+		return errors.New("Release signature verification failed")
+	}
+	trustedComment := strings.TrimPrefix(lines[2], "trusted comment: ")
+	if !ed25519.Verify(
+		publicKey.key,
+		append(append([]byte{}, signature[10:]...), trustedComment...),
+		globalSignature) {
+		return errors.New("Release trusted comment verification failed")
+	}
+	log.WithField("trusted_comment", trustedComment).
+		Info("Release signature verified")
+	return nil
+}
+
+// verifyRelease downloads the detached signature for downloadURL and
+// verifies the release at releasePath with it
+func (packager *Packager) verifyRelease(
+	releasePath string,
+	downloadURL string) error {
+	signaturePath := releasePath + packager.options.ReleaseSignatureSuffix
+	err := packager.downloadFileFromMirrors(
+		signaturePath,
+		downloadURL+packager.options.ReleaseSignatureSuffix)
+	if err != nil {
+		return err
+	}
+	return verifyMinisign(packager.releasePublicKey, releasePath, signaturePath)
+}
@@ -0,0 +1,144 @@
+package packager
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// minisignKeyID is the key id of the test minisign key
+var minisignKeyID = []byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+// minisignTestKey returns the private key and the minisign.pub contents
+// of the test minisign key with keyID
+func minisignTestKey(keyID []byte) (ed25519.PrivateKey, string) {
+	privateKey := ed25519.NewKeyFromSeed([]byte(strings.Repeat("k", ed25519.SeedSize)))
+	raw := append(append([]byte("Ed"), keyID...),
+		privateKey.Public().(ed25519.PublicKey)...)
+	return privateKey, "untrusted comment: minisign public key\n" +
+		base64.StdEncoding.EncodeToString(raw) + "\n"
+}
+
+// minisignSignature returns a minisign signature file for content, a
+// prehashed one when prehashed is set
+func minisignSignature(
+	privateKey ed25519.PrivateKey,
+	content []byte,
+	prehashed bool) string {
+	algorithm := "Ed"
+	if prehashed {
+		algorithm = "ED"
+		digest := blake2b.Sum512(content)
+		content = digest[:]
+	}
+	signature := ed25519.Sign(privateKey, content)
+	trustedComment := "timestamp:1500000000\tfile:release.zip"
+	globalSignature := ed25519.Sign(privateKey,
+		append(append([]byte{}, signature...), trustedComment...))
+	raw := append(append([]byte(algorithm), minisignKeyID...), signature...)
+	return "untrusted comment: signature from minisign secret key\n" +
+		base64.StdEncoding.EncodeToString(raw) + "\n" +
+		"trusted comment: " + trustedComment + "\n" +
+		base64.StdEncoding.EncodeToString(globalSignature) + "\n"
+}
+
+func TestVerifyMinisign(t *testing.T) {
+	privateKey, encodedPublicKey := minisignTestKey(minisignKeyID)
+	publicKey, err := parseMinisignPublicKey(encodedPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release := []byte("release zip")
+	dir := tempDir(t)
+	releasePath := filepath.Join(dir, "release.zip")
+	err = ioutil.WriteFile(releasePath, release, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The same key under another id, as a different key would be
+	_, otherPublicKey := minisignTestKey([]byte{8, 7, 6, 5, 4, 3, 2, 1})
+
+	tests := []struct {
+		name      string
+		signature string
+		publicKey string
+		valid     bool
+	}{
+		{"legacy", minisignSignature(privateKey, release, false), encodedPublicKey, true},
+		{"prehashed", minisignSignature(privateKey, release, true), encodedPublicKey, true},
+		{"other content", minisignSignature(privateKey, []byte("other zip"), true),
+			encodedPublicKey, false},
+		{"other key", minisignSignature(privateKey, release, true), otherPublicKey, false},
+		{"changed trusted comment", strings.Replace(
+			minisignSignature(privateKey, release, true),
+			"file:release.zip", "file:other.zip", 1), encodedPublicKey, false},
+		{"not a signature", "garbage\n", encodedPublicKey, false},
+	}
+	for _, test := range tests {
+		signaturePath := filepath.Join(dir, "release.zip.minisig")
+		err := ioutil.WriteFile(signaturePath, []byte(test.signature), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key := publicKey
+		if test.publicKey != encodedPublicKey {
+			key, err = parseMinisignPublicKey(test.publicKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err = verifyMinisign(key, releasePath, signaturePath)
+		if test.valid && err != nil {
+			t.Errorf("%s: valid signature failed: %s", test.name, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("%s: invalid signature passed", test.name)
+		}
+	}
+}
+
+func TestRunVerifiesReleaseSignature(t *testing.T) {
+	privateKey, publicKey := minisignTestKey(minisignKeyID)
+	for _, valid := range []bool{true, false} {
+		fixture := newFixture(t)
+		fixture.installVersion(3395761, map[string]string{
+			"UnrealTournament/Config/Default.ini": "setting=1",
+		})
+		downloadURL := fixture.serveRelease(3525360, map[string]string{
+			"UnrealTournament/Config/Default.ini": "setting=2",
+		})
+		name := filepath.Base(downloadURL)
+		signed := fixture.downloads[name]
+		if !valid {
+			signed = []byte("a different release")
+		}
+		fixture.downloads[name+defaultReleaseSignatureSuffix] =
+			[]byte(minisignSignature(privateKey, signed, true))
+		fixture.addPost("UT Release 3525360", "post-3525360", downloadURL, time.Now())
+		packager := fixture.newPackager(Options{ReleasePublicKey: publicKey})
+
+		result, err := packager.Run()
+		if valid {
+			if err != nil {
+				t.Fatalf("Run with a valid signature failed: %s", err)
+			}
+			if result.Version != "3525360" {
+				t.Errorf("Run with a valid signature packaged %q", result.Version)
+			}
+			continue
+		}
+		if err == nil {
+			t.Error("Run with an invalid signature succeeded")
+		}
+		if len(result.Packages) != 0 {
+			t.Errorf("Release with an invalid signature was packaged: %v",
+				result.Packages)
+		}
+	}
+}
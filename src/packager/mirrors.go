@@ -0,0 +1,89 @@
+package packager
+
+import (
+	"net/url"
+	"path"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// candidateURLs returns downloadURL followed by the same path on each of
+// the configured mirrors. Only HTTP download URLs are mirrored
+func (packager *Packager) candidateURLs(downloadURL string) ([]string, error) {
+	candidates := []string{downloadURL}
+	if len(packager.options.MirrorURLs) == 0 {
+		return candidates, nil
+	}
+	parsedURL, err := url.Parse(downloadURL)
+	if err != nil {
+		return nil, err
+	}
+	// Mirrors only serve the same paths over HTTP
+	if !isHTTPScheme(parsedURL.Scheme) {
+		return candidates, nil
+	}
+	for _, mirrorURL := range packager.options.MirrorURLs {
+		mirror, err := url.Parse(mirrorURL)
+		if err != nil {
+			return nil, err
+		}
+		mirror.Path = path.Join("/", mirror.Path, parsedURL.Path)
+		mirror.RawQuery = parsedURL.RawQuery
+		candidates = append(candidates, mirror.String())
+	}
+	return candidates, nil
+}
+
+// getDownloadSizeFromMirrors returns the first of the primary URL and its
+// mirrors that answers the HEAD request, along with the download size
+func (packager *Packager) getDownloadSizeFromMirrors(
+	downloadURL string) (string, float64, error) {
+	// The size is only known up front for HTTP downloads
+	if !isHTTPURL(downloadURL) {
+		return downloadURL, UnknownDownloadSize, nil
+	}
+	candidates, err := packager.candidateURLs(downloadURL)
+	if err != nil {
+		return downloadURL, 0, err
+	}
+	for i, candidate := range candidates {
+		var size float64
+		size, err = packager.getDownloadSize(candidate)
+		if err == nil {
+			if i > 0 {
+				log.WithField("mirror", candidate).Info("Using mirror for download")
+			}
+			return candidate, size, nil
+		}
+		log.WithFields(log.Fields{
+			"url": candidate,
+			"err": "download_size",
+		}).Warning(err.Error())
+	}
+	return downloadURL, 0, err
+}
+
+// downloadFileFromMirrors downloads from the primary URL and falls back to
+// each mirror in turn, using the Downloader for the URL's scheme
+func (packager *Packager) downloadFileFromMirrors(
+	outputPath string,
+	downloadURL string) error {
+	candidates, err := packager.candidateURLs(downloadURL)
+	if err != nil {
+		return err
+	}
+	for i, candidate := range candidates {
+		err = packager.download(outputPath, candidate)
+		if err == nil {
+			if i > 0 {
+				log.WithField("mirror", candidate).Info("Downloaded from mirror")
+			}
+			return nil
+		}
+		log.WithFields(log.Fields{
+			"url": candidate,
+			"err": "download",
+		}).Warning(err.Error())
+	}
+	return err
+}
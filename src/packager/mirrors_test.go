@@ -0,0 +1,53 @@
+package packager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCandidateURLs(t *testing.T) {
+	packager := newTestPackager(t, Options{
+		MirrorURLs: []string{"http://mirror-a", "https://mirror-b/ut"},
+	})
+	candidates, err := packager.candidateURLs("https://origin/builds/release.zip?sig=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"https://origin/builds/release.zip?sig=1",
+		"http://mirror-a/builds/release.zip?sig=1",
+		"https://mirror-b/ut/builds/release.zip?sig=1",
+	}
+	if !reflect.DeepEqual(candidates, expected) {
+		t.Errorf("Candidates are %v, expected %v", candidates, expected)
+	}
+}
+
+func TestRunDownloadsFromMirror(t *testing.T) {
+	fixture := newFixture(t)
+	fixture.installVersion(3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+	})
+	mirrorURL := fixture.serveRelease(3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+	})
+	primary := httptest.NewServer(http.NotFoundHandler())
+	defer primary.Close()
+	downloadURL := strings.Replace(mirrorURL, fixture.server.URL, primary.URL, 1)
+	fixture.addPost("UT Release 3525360", "post-3525360", downloadURL, time.Now())
+	packager := fixture.newPackager(Options{
+		MirrorURLs: []string{fixture.server.URL},
+	})
+
+	result, err := packager.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Version != "3525360" || len(result.Packages) != 1 {
+		t.Errorf("Release from the mirror wasn't packaged: %+v", result)
+	}
+}
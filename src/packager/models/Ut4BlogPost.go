@@ -9,6 +9,14 @@ type Ut4BlogPost struct {
 	Title         string
 	GUID          string
 	DatePublished time.Time
-	DateCreated   time.Time
-	IsDeleted     uint
+	// Version is the release the post announced, empty for posts recorded
+	// before it was stored
+	Version string `gorm:"index"`
+	// NotesURL, Categories and Notes are the release metadata captured
+	// from the post, Categories is comma separated
+	NotesURL    string
+	Categories  string
+	Notes       string `gorm:"type:text"`
+	DateCreated time.Time
+	IsDeleted   uint
 }
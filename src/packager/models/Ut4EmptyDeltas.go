@@ -0,0 +1,17 @@
+// Package models holds database models for data access
+package models
+
+import "time"
+
+// Ut4EmptyDeltas marks version pairs without any changes so they aren't
+// packaged again on every run
+type Ut4EmptyDeltas struct {
+	ID          uint32
+	FromVersion string
+	ToVersion   string
+	Channel     string `gorm:"default:'stable'"`
+	// Scope is the scope of the packages the pair would have had
+	Scope       string `gorm:"default:''"`
+	DateCreated time.Time
+	IsDeleted   uint
+}
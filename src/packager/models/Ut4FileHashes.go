@@ -0,0 +1,10 @@
+// Package models holds database models for data access
+package models
+
+// Ut4FileHashes holds the hash of every file in a version, one row per file
+type Ut4FileHashes struct {
+	ID      uint32
+	Version string `gorm:"index"`
+	Path    string `gorm:"index"`
+	Hash    string
+}
@@ -0,0 +1,20 @@
+// Package models holds database models for data access
+package models
+
+import "time"
+
+// Ut4RunStats holds statistics for each packaging run
+type Ut4RunStats struct {
+	ID               uint32
+	Version          string
+	DownloadSize     int64
+	PackageCount     int
+	TotalDeltaSize   int64
+	AverageDeltaSize int64
+	// CompressionRatio is the total compressed size divided by the total
+	// uncompressed size, 0 when unknown
+	CompressionRatio float64
+	DurationSeconds  float64
+	DateCreated      time.Time
+	IsDeleted        uint
+}
@@ -3,12 +3,27 @@ package models
 
 import "time"
 
-// Ut4UpdatePackages holds available upgrade paths available
+// Ut4UpdatePackages holds available upgrade paths available.
+// FromVersion, ToVersion, Channel and Scope are unique together, their
+// sizes keep the unique index within the MySQL key length
 type Ut4UpdatePackages struct {
 	ID          uint32
-	FromVersion string
-	ToVersion   string
+	FromVersion string `gorm:"size:64"`
+	ToVersion   string `gorm:"size:64"`
 	UpdateURL   string
-	DateCreated time.Time
-	IsDeleted   uint
+	Channel     string `gorm:"size:32;default:'stable'"`
+	Size        int64
+	// DeltaHash identifies the package content, pairs with the same delta
+	// share a package
+	DeltaHash string
+	// Scope is content for packages limited to the content roots, empty
+	// for packages of the whole install
+	Scope string `gorm:"size:32;default:''"`
+	// SignatureURL is where the signed manifest of the package is
+	// published, empty for unsigned packages
+	SignatureURL string
+	// UncompressedSize is the size of the package content, 0 when unknown
+	UncompressedSize int64
+	DateCreated      time.Time
+	IsDeleted        uint
 }
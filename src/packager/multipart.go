@@ -0,0 +1,190 @@
+package packager
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// multipartStateSuffix is appended to the package path to remember the
+// upload ID of an unfinished multipart upload
+const multipartStateSuffix = ".upload"
+
+// UploadPart is a single uploaded part with its SHA256 checksum
+type UploadPart struct {
+	Number   int
+	Checksum string
+}
+
+// MultipartBackend is storage that accepts uploads in parts, such as an
+// object store
+type MultipartBackend interface {
+	// CreateUpload starts a multipart upload of name
+	CreateUpload(name string) (string, error)
+	// UploadPart uploads a part, numbered from 1, with its checksum
+	UploadPart(uploadID string, number int, data []byte, checksum string) error
+	// ListParts returns the parts the backend has for an upload
+	ListParts(uploadID string) ([]UploadPart, error)
+	// CompleteUpload finishes the upload and returns its URL
+	CompleteUpload(uploadID string, parts []UploadPart) (string, error)
+}
+
+// multipartUploader is an Uploader that uploads large packages in parts
+// and resumes unfinished uploads
+type multipartUploader struct {
+	backend  MultipartBackend
+	partSize int64
+	retries  int
+	fallback Uploader
+}
+
+// NewMultipartUploader creates an Uploader that uploads packages of at
+// least partSize bytes to backend in parts of partSize, retrying each
+// part up to retries times. Smaller packages are uploaded by fallback
+func NewMultipartUploader(
+	backend MultipartBackend,
+	partSize int64,
+	retries int,
+	fallback Uploader) Uploader {
+	return &multipartUploader{
+		backend:  backend,
+		partSize: partSize,
+		retries:  retries,
+		fallback: fallback,
+	}
+}
+
+// Upload uploads the package in parts. Parts the backend already has from
+// an earlier attempt with a matching checksum are not uploaded again
+func (uploader *multipartUploader) Upload(
+	packagePath string,
+	values TemplateValues) (string, error) {
+	packageInfo, err := os.Stat(packagePath)
+	if err != nil {
+		return "", err
+	}
+	if uploader.partSize <= 0 || packageInfo.Size() < uploader.partSize {
+		return uploader.fallback.Upload(packagePath, values)
+	}
+
+	uploadID, uploaded, err := uploader.resumeOrCreate(packagePath)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.Open(packagePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	var parts []UploadPart
+	buffer := make([]byte, uploader.partSize)
+	for number := 1; ; number++ {
+		n, err := io.ReadFull(file, buffer)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return "", err
+		}
+		data := buffer[:n]
+		part := UploadPart{
+			Number:   number,
+			Checksum: fmt.Sprintf("%x", sha256.Sum256(data)),
+		}
+		parts = append(parts, part)
+		if uploaded[number] == part.Checksum {
+			log.WithField("part", number).Debug("Part already uploaded")
+			continue
+		}
+		err = uploader.uploadPart(uploadID, part, data)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// Only complete once the backend has every part with the right checksum
+	backendParts, err := uploader.backend.ListParts(uploadID)
+	if err != nil {
+		return "", err
+	}
+	uploaded = make(map[int]string)
+	for _, part := range backendParts {
+		uploaded[part.Number] = part.Checksum
+	}
+	for _, part := range parts {
+		if uploaded[part.Number] != part.Checksum {
+			return "", fmt.Errorf("Part %d of %s failed verification",
+				part.Number, filepath.Base(packagePath))
+		}
+	}
+	url, err := uploader.backend.CompleteUpload(uploadID, parts)
+	if err != nil {
+		return "", err
+	}
+	os.Remove(packagePath + multipartStateSuffix)
+	log.WithFields(log.Fields{
+		"path":  packagePath,
+		"parts": len(parts),
+	}).Info("Multipart upload complete")
+	return url, nil
+}
+
+// resumeOrCreate continues the unfinished upload of packagePath or starts
+// a new one. It returns the upload ID and the checksums of uploaded parts
+func (uploader *multipartUploader) resumeOrCreate(
+	packagePath string) (string, map[int]string, error) {
+	uploaded := make(map[int]string)
+	statePath := packagePath + multipartStateSuffix
+	state, err := ioutil.ReadFile(statePath)
+	if err == nil {
+		uploadID := strings.TrimSpace(string(state))
+		parts, err := uploader.backend.ListParts(uploadID)
+		if err == nil {
+			for _, part := range parts {
+				uploaded[part.Number] = part.Checksum
+			}
+			log.WithFields(log.Fields{
+				"path":  packagePath,
+				"parts": len(parts),
+			}).Info("Resuming multipart upload")
+			return uploadID, uploaded, nil
+		}
+		log.WithField("err", "resume_upload").Warning(err.Error())
+	}
+	uploadID, err := uploader.backend.CreateUpload(filepath.Base(packagePath))
+	if err != nil {
+		return "", nil, err
+	}
+	err = ioutil.WriteFile(statePath, []byte(uploadID), 0644)
+	if err != nil {
+		return "", nil, err
+	}
+	return uploadID, uploaded, nil
+}
+
+// uploadPart uploads a single part, retrying on failure
+func (uploader *multipartUploader) uploadPart(
+	uploadID string,
+	part UploadPart,
+	data []byte) error {
+	var err error
+	for attempt := 0; attempt <= uploader.retries; attempt++ {
+		err = uploader.backend.UploadPart(uploadID, part.Number, data, part.Checksum)
+		if err == nil {
+			return nil
+		}
+		log.WithFields(log.Fields{
+			"part":    part.Number,
+			"attempt": attempt + 1,
+			"err":     "upload_part",
+		}).Warning(err.Error())
+	}
+	return err
+}
@@ -0,0 +1,138 @@
+package packager
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// fakeMultipartBackend keeps uploaded parts in memory and fails uploads
+// of failPart while failures is above zero
+type fakeMultipartBackend struct {
+	parts     map[int][]byte
+	created   int
+	uploads   []int
+	failPart  int
+	failures  int
+	completed []byte
+}
+
+func (backend *fakeMultipartBackend) CreateUpload(name string) (string, error) {
+	backend.created++
+	backend.parts = make(map[int][]byte)
+	return fmt.Sprintf("upload-%d", backend.created), nil
+}
+
+func (backend *fakeMultipartBackend) UploadPart(
+	uploadID string,
+	number int,
+	data []byte,
+	checksum string) error {
+	backend.uploads = append(backend.uploads, number)
+	if number == backend.failPart && backend.failures > 0 {
+		backend.failures--
+		return errors.New("Connection reset")
+	}
+	if fmt.Sprintf("%x", sha256.Sum256(data)) != checksum {
+		return errors.New("Checksum mismatch")
+	}
+	backend.parts[number] = append([]byte(nil), data...)
+	return nil
+}
+
+func (backend *fakeMultipartBackend) ListParts(uploadID string) ([]UploadPart, error) {
+	var parts []UploadPart
+	for number, data := range backend.parts {
+		parts = append(parts, UploadPart{
+			Number:   number,
+			Checksum: fmt.Sprintf("%x", sha256.Sum256(data)),
+		})
+	}
+	return parts, nil
+}
+
+func (backend *fakeMultipartBackend) CompleteUpload(
+	uploadID string,
+	parts []UploadPart) (string, error) {
+	var buffer bytes.Buffer
+	for _, part := range parts {
+		buffer.Write(backend.parts[part.Number])
+	}
+	backend.completed = buffer.Bytes()
+	return "http://objects.example.com/" + uploadID, nil
+}
+
+func TestMultipartUploadResumes(t *testing.T) {
+	dir := tempDir(t)
+	packagePath := filepath.Join(dir, "3395761-3525360.tar.gz")
+	content := []byte("0123456789abcdefghij")
+	err := ioutil.WriteFile(packagePath, content, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := &fakeMultipartBackend{failPart: 2, failures: 2}
+	uploader := NewMultipartUploader(backend, 8, 1, NewTemplateUploader(""))
+
+	// The second part fails every retry, the upload is left unfinished
+	_, err = uploader.Upload(packagePath, TemplateValues{})
+	if err == nil {
+		t.Fatal("Upload with a failing part didn't fail")
+	}
+	if backend.completed != nil {
+		t.Fatal("Upload with a failing part was completed")
+	}
+	if _, err = os.Stat(packagePath + multipartStateSuffix); err != nil {
+		t.Fatalf("Unfinished upload state wasn't kept: %s", err)
+	}
+
+	backend.uploads = nil
+	url, err := uploader.Upload(packagePath, TemplateValues{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "http://objects.example.com/upload-1" || backend.created != 1 {
+		t.Errorf("Upload wasn't resumed, created %d uploads, URL %s",
+			backend.created, url)
+	}
+	// The first part was already uploaded
+	if !reflect.DeepEqual(backend.uploads, []int{2, 3}) {
+		t.Errorf("Resumed upload uploaded parts %v, expected [2 3]", backend.uploads)
+	}
+	if !bytes.Equal(backend.completed, content) {
+		t.Errorf("Completed upload is '%s', expected '%s'", backend.completed, content)
+	}
+	if _, err = os.Stat(packagePath + multipartStateSuffix); !os.IsNotExist(err) {
+		t.Errorf("Upload state wasn't removed: %v", err)
+	}
+}
+
+func TestMultipartUploadFallsBackForSmallPackages(t *testing.T) {
+	dir := tempDir(t)
+	packagePath := filepath.Join(dir, "3395761-3525360.tar.gz")
+	err := ioutil.WriteFile(packagePath, []byte("small"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := &fakeMultipartBackend{}
+	uploader := NewMultipartUploader(backend, 8, 1,
+		NewTemplateUploader("http://update.example.com/{from}-{to}.tar.gz"))
+	url, err := uploader.Upload(packagePath, TemplateValues{
+		FromVersion: "3395761",
+		ToVersion:   "3525360",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backend.created != 0 {
+		t.Error("Small package was uploaded in parts")
+	}
+	if url != "http://update.example.com/3395761-3525360.tar.gz" {
+		t.Errorf("Fallback URL is %s", url)
+	}
+}
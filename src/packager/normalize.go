@@ -0,0 +1,175 @@
+package packager
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// NormalizeHashes zeroes the ranges before hashing, so normalized
+	// files never show up as modified
+	NormalizeHashes = "hash"
+	// NormalizeDemote keeps the real hashes and drops modified files from
+	// the delta when they are identical after normalization
+	NormalizeDemote = "demote"
+)
+
+// NormalizationRule zeroes byte ranges of the files matching Pattern
+// before they are hashed, so files that only differ in e.g. an embedded
+// build timestamp hash the same
+type NormalizationRule struct {
+	Pattern string
+	Ranges  []ByteRange
+}
+
+// ByteRange is Length bytes starting at Offset
+type ByteRange struct {
+	Offset int64
+	Length int64
+}
+
+// ParseNormalizationRules parses rules in the form
+// <pattern>:<offset>+<length>[;<offset>+<length>...], e.g.
+// Engine/Binaries/Linux/*.so:128+8;512+4
+func ParseNormalizationRules(specs []string) ([]NormalizationRule, error) {
+	var rules []NormalizationRule
+	for _, spec := range specs {
+		separator := strings.LastIndex(spec, ":")
+		if separator <= 0 {
+			return nil, fmt.Errorf("Normalization rule '%s' has no ranges", spec)
+		}
+		rule := NormalizationRule{Pattern: spec[:separator]}
+		for _, rangeSpec := range strings.Split(spec[separator+1:], ";") {
+			parts := strings.SplitN(rangeSpec, "+", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf(
+					"Normalization range '%s' must be <offset>+<length>", rangeSpec)
+			}
+			offset, err := strconv.ParseInt(parts[0], 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			length, err := strconv.ParseInt(parts[1], 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			if offset < 0 || length <= 0 {
+				return nil, fmt.Errorf("Normalization range '%s' is invalid", rangeSpec)
+			}
+			rule.Ranges = append(rule.Ranges, ByteRange{Offset: offset, Length: length})
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// normalizationFor returns the first rule matching relativePath or nil
+func (packager *Packager) normalizationFor(relativePath string) *NormalizationRule {
+	for i, rule := range packager.options.Normalizations {
+		if matchPath(rule.Pattern, relativePath) {
+			return &packager.options.Normalizations[i]
+		}
+	}
+	return nil
+}
+
+// zeroRangesReader reads from reader with the bytes in ranges set to zero
+type zeroRangesReader struct {
+	reader   io.Reader
+	ranges   []ByteRange
+	position int64
+}
+
+// Read reads from the underlying reader and zeroes the configured ranges
+func (zeroReader *zeroRangesReader) Read(buffer []byte) (int, error) {
+	n, err := zeroReader.reader.Read(buffer)
+	start := zeroReader.position
+	end := start + int64(n)
+	for _, byteRange := range zeroReader.ranges {
+		from := byteRange.Offset
+		to := byteRange.Offset + byteRange.Length
+		if to <= start || from >= end {
+			continue
+		}
+		if from < start {
+			from = start
+		}
+		if to > end {
+			to = end
+		}
+		for i := from; i < to; i++ {
+			buffer[i-start] = 0
+		}
+	}
+	zeroReader.position = end
+	return n, err
+}
+
+// demoteNormalizedModified removes the modified files from delta that are
+// identical to their fromVersion copy after normalization and returns how
+// many were removed. It only applies with NormalizeDemote
+func (packager *Packager) demoteNormalizedModified(
+	delta map[string]DeltaOperation,
+	fromVersion string,
+	toVersion string) (int, error) {
+	if packager.options.NormalizationMode != NormalizeDemote ||
+		len(packager.options.Normalizations) == 0 {
+		return 0, nil
+	}
+	demoted := 0
+	for filename, operation := range delta {
+		if operation.Operation != deltaOperationModified {
+			continue
+		}
+		rule := packager.normalizationFor(filename)
+		if rule == nil {
+			continue
+		}
+		fromHash, err := normalizedHash(
+			filepath.Join(packager.releaseDir, fromVersion, filename),
+			rule.Ranges)
+		if err != nil {
+			return demoted, err
+		}
+		toHash, err := normalizedHash(
+			filepath.Join(packager.releaseDir, toVersion, filename),
+			rule.Ranges)
+		if err != nil {
+			return demoted, err
+		}
+		if fromHash == toHash {
+			delete(delta, filename)
+			demoted++
+		}
+	}
+	if demoted > 0 {
+		log.WithFields(log.Fields{
+			"fromVersion": fromVersion,
+			"toVersion":   toVersion,
+			"demoted":     demoted,
+		}).Info("Modified files identical after normalization left out")
+	}
+	return demoted, nil
+}
+
+// normalizedHash hashes the file at path with ranges zeroed
+func normalizedHash(path string, ranges []ByteRange) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hasher := sha256.New()
+	_, err = io.Copy(hasher, &zeroRangesReader{reader: file, ranges: ranges})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
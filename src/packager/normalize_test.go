@@ -0,0 +1,120 @@
+package packager
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizedFilesHashEqual(t *testing.T) {
+	const binary = "Engine/Binaries/Linux/libUE4.so"
+	rules, err := ParseNormalizationRules([]string{"Engine/Binaries/Linux/*.so:4+4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	packager := newTestPackager(t, Options{Normalizations: rules})
+
+	// Only the bytes at 4-7 differ
+	first := tempDir(t)
+	writeTree(t, first, map[string]string{
+		binary:     "ELF\x00STMPcode",
+		"Other.so": "ELF\x00STMPcode",
+	})
+	second := tempDir(t)
+	writeTree(t, second, map[string]string{
+		binary:     "ELF\x00TIMEcode",
+		"Other.so": "ELF\x00TIMEcode",
+	})
+	firstHashes, err := packager.generateHashes(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondHashes, err := packager.generateHashes(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if firstHashes[binary] != secondHashes[binary] {
+		t.Error("Files differing only in a normalized range hash differently")
+	}
+	if firstHashes["Other.so"] == secondHashes["Other.so"] {
+		t.Error("Files outside the normalization pattern hash equal")
+	}
+
+	// Differences outside the ranges still change the hash
+	writeTree(t, second, map[string]string{binary: "ELF\x00TIMEdata"})
+	secondHashes, err = packager.generateHashes(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if firstHashes[binary] == secondHashes[binary] {
+		t.Error("Files differing outside the normalized range hash equal")
+	}
+}
+
+func TestParseNormalizationRules(t *testing.T) {
+	rules, err := ParseNormalizationRules([]string{"*.so:128+8;512+4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []NormalizationRule{{
+		Pattern: "*.so",
+		Ranges:  []ByteRange{{Offset: 128, Length: 8}, {Offset: 512, Length: 4}},
+	}}
+	if !reflect.DeepEqual(rules, expected) {
+		t.Errorf("Rules are %+v, expected %+v", rules, expected)
+	}
+	for _, spec := range []string{"*.so", "*.so:128", "*.so:-1+8", "*.so:0+0"} {
+		_, err = ParseNormalizationRules([]string{spec})
+		if err == nil {
+			t.Errorf("Invalid rule '%s' parsed", spec)
+		}
+	}
+}
+
+func TestDemoteNormalizedModifiedFiles(t *testing.T) {
+	const binary = "Engine/Binaries/Linux/libUE4.so"
+	rules, err := ParseNormalizationRules([]string{"Engine/Binaries/Linux/*.so:4+4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	packager := newTestPackager(t, Options{
+		Normalizations:    rules,
+		NormalizationMode: NormalizeDemote,
+	})
+	installTestVersion(t, packager, 3395761, map[string]string{
+		binary:                                "ELF\x00STMPcode",
+		"UnrealTournament/Config/Default.ini": "setting=1",
+	})
+	installTestVersion(t, packager, 3525360, map[string]string{
+		binary:                                "ELF\x00TIMEcode",
+		"UnrealTournament/Config/Default.ini": "setting=2",
+	})
+	// The real hashes are kept
+	fromHashes, err := packager.getVersionHashes("3395761")
+	if err != nil {
+		t.Fatal(err)
+	}
+	toHashes, err := packager.getVersionHashes("3525360")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fromHashes[binary] == toHashes[binary] {
+		t.Error("Hashes were normalized in demote mode")
+	}
+
+	_, err = packager.GeneratePackage("3395761", "3525360")
+	if err != nil {
+		t.Fatal(err)
+	}
+	operations, err := ReadPackageOperations(
+		filepath.Join(packager.packageDir, "3395761-3525360.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := operations[binary]; ok {
+		t.Error("Demoted file is in the package")
+	}
+	if operations["UnrealTournament/Config/Default.ini"].Operation != deltaOperationModified {
+		t.Errorf("Modified file isn't in the package: %v", operations)
+	}
+}
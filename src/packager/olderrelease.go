@@ -0,0 +1,49 @@
+package packager
+
+import (
+	log "github.com/sirupsen/logrus"
+)
+
+// isOlderThanLatest checks if version is older than the newest version in
+// the release dir and returns that newest version
+func (packager *Packager) isOlderThanLatest(version string) (bool, string, error) {
+	versions, err := packager.GetVersionList()
+	if err != nil {
+		return false, "", err
+	}
+	if len(versions) == 0 {
+		return false, "", nil
+	}
+	packager.sortVersions(versions)
+	latestVersion := versions[len(versions)-1]
+	return packager.compareVersions(version, latestVersion) < 0, latestVersion, nil
+}
+
+// skipOlderRelease checks if version is older than the latest installed
+// version. When it is, the release post is marked processed so it isn't
+// downloaded again and true is returned
+func (packager *Packager) skipOlderRelease(version string) (bool, error) {
+	if packager.options.Reprocess {
+		return false, nil
+	}
+	older, latestVersion, err := packager.isOlderThanLatest(version)
+	if err != nil || !older {
+		return false, err
+	}
+	log.WithFields(log.Fields{
+		"version":        version,
+		"latest_version": latestVersion,
+	}).Warning("Skipping release older than the latest installed version")
+	if packager.releasePost != nil {
+		db, err := packager.openDB()
+		if err != nil {
+			return true, err
+		}
+		defer db.Close()
+		err = packager.markReleaseProcessed(db, packager.releasePost, version)
+		if err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,55 @@
+package packager
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRunReportsOperationCounts(t *testing.T) {
+	fixture := newFixture(t)
+	fixture.installVersion(3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini":  "setting=1",
+		"UnrealTournament/Content/Removed.txt": "removed",
+		"UnrealTournament/Content/Old.pak":     "moved content",
+	})
+	downloadURL := fixture.serveRelease(3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+		"UnrealTournament/Content/Added.txt":  "added",
+		"UnrealTournament/Content/New.pak":    "moved content",
+	})
+	fixture.addPost("UT Release 3525360", "post-3525360", downloadURL, time.Now())
+	packager := fixture.newPackager(Options{})
+
+	result, err := packager.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The modules version marker is modified along with Default.ini
+	expected := []PackageOperations{{
+		VersionPair: VersionPair{FromVersion: "3395761", ToVersion: "3525360"},
+		OperationCounts: OperationCounts{
+			Added:    1,
+			Modified: 2,
+			Removed:  1,
+			Moved:    1,
+		},
+	}}
+	if !reflect.DeepEqual(result.Operations, expected) {
+		t.Errorf("Operations are %+v, expected %+v", result.Operations, expected)
+	}
+}
+
+func TestCountOperations(t *testing.T) {
+	counts := countOperations(map[string]DeltaOperation{
+		"a": {Operation: deltaOperationAdded},
+		"b": {Operation: deltaOperationAdded},
+		"c": {Operation: deltaOperationModified},
+		"d": {Operation: deltaOperationRemoved},
+		"e": {Operation: deltaOperationMoved, Source: "f"},
+	})
+	expected := OperationCounts{Added: 2, Modified: 1, Removed: 1, Moved: 1}
+	if counts != expected {
+		t.Errorf("Counts are %+v, expected %+v", counts, expected)
+	}
+}
@@ -0,0 +1,213 @@
+package packager
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// operationsFilename is the package entry holding the delta operations
+const operationsFilename = "operations.json"
+
+// compressedOperationsFilename is the package entry holding the gzipped
+// delta operations when they are compressed
+const compressedOperationsFilename = operationsFilename + ".gz"
+
+// operationsSidecarSuffix is appended to the package name for the
+// operations file when it is placed next to the package
+const operationsSidecarSuffix = ".operations.json"
+
+const (
+	// OperationsInPayload stores operations.json among the package files
+	OperationsInPayload = "payload"
+	// OperationsFirst stores operations.json as the first package entry
+	OperationsFirst = "first"
+	// OperationsSidecar stores operations.json next to the package as
+	// <package>.operations.json
+	OperationsSidecar = "sidecar"
+)
+
+// ReadPackageOperations reads only the delta operations of the package at
+// packagePath without extracting the rest of the package. A sidecar
+// operations file is preferred when one exists. The operations are
+// validated with ValidateOperations
+func ReadPackageOperations(packagePath string) (map[string]DeltaOperation, error) {
+	sidecar, err := os.Open(packagePath + operationsSidecarSuffix)
+	if err == nil {
+		defer sidecar.Close()
+		return decodeOperations(sidecar)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	file, err := os.Open(packagePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("No %s found in %s", operationsFilename, packagePath)
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := path.Clean(header.Name)
+		if name != operationsFilename && name != compressedOperationsFilename {
+			continue
+		}
+		return decodeOperations(tarReader)
+	}
+}
+
+// encodeOperations encodes operations as JSON, gzipped when compress is
+// set, and returns them with the package entry name they belong in
+func encodeOperations(
+	operations map[string]DeltaOperation,
+	compress bool) ([]byte, string, error) {
+	operationsBytes, err := json.Marshal(&operations)
+	if err != nil {
+		return nil, "", err
+	}
+	if !compress {
+		return operationsBytes, operationsFilename, nil
+	}
+	var compressed bytes.Buffer
+	gzipWriter := gzip.NewWriter(&compressed)
+	_, err = gzipWriter.Write(operationsBytes)
+	if err != nil {
+		return nil, "", err
+	}
+	err = gzipWriter.Close()
+	if err != nil {
+		return nil, "", err
+	}
+	return compressed.Bytes(), compressedOperationsFilename, nil
+}
+
+// decodeOperations decodes and validates the operations read from reader,
+// which are gunzipped first when they are compressed
+func decodeOperations(reader io.Reader) (map[string]DeltaOperation, error) {
+	bufferedReader := bufio.NewReader(reader)
+	reader = bufferedReader
+	magic, _ := bufferedReader.Peek(2)
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gzipReader, err := gzip.NewReader(bufferedReader)
+		if err != nil {
+			return nil, err
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	}
+	var operations map[string]DeltaOperation
+	err := json.NewDecoder(reader).Decode(&operations)
+	if err != nil {
+		return nil, fmt.Errorf("Malformed %s: %s", operationsFilename, err)
+	}
+	err = ValidateOperations(operations)
+	if err != nil {
+		return nil, err
+	}
+	return operations, nil
+}
+
+// ValidateOperations checks that every operation is a known kind on a
+// relative path inside the install, and that only moves have a source
+func ValidateOperations(operations map[string]DeltaOperation) error {
+	if operations == nil {
+		return fmt.Errorf("Invalid %s: no operations", operationsFilename)
+	}
+	paths := make([]string, 0, len(operations))
+	for filePath := range operations {
+		paths = append(paths, filePath)
+	}
+	sort.Strings(paths)
+	for _, filePath := range paths {
+		operation := operations[filePath]
+		if problem := operationPathProblem(filePath); problem != "" {
+			return fmt.Errorf("Invalid %s entry '%s': %s",
+				operationsFilename, filePath, problem)
+		}
+		switch operation.Operation {
+		case deltaOperationAdded, deltaOperationModified, deltaOperationRemoved:
+			if operation.Source != "" {
+				return fmt.Errorf("Invalid %s entry '%s': %s operation can't have a source",
+					operationsFilename, filePath, operation.Operation)
+			}
+		case deltaOperationMoved:
+			if operation.Source == "" {
+				return fmt.Errorf("Invalid %s entry '%s': moved operation without a source",
+					operationsFilename, filePath)
+			}
+			if problem := operationPathProblem(operation.Source); problem != "" {
+				return fmt.Errorf("Invalid %s entry '%s': source %s",
+					operationsFilename, filePath, problem)
+			}
+		default:
+			return fmt.Errorf("Invalid %s entry '%s': unknown operation '%s'",
+				operationsFilename, filePath, operation.Operation)
+		}
+	}
+	return nil
+}
+
+// operationPathProblem describes why filePath isn't a clean relative path
+// inside the install, or returns an empty string when it is. Directory
+// entries keep their trailing slash
+func operationPathProblem(filePath string) string {
+	if filePath == "" {
+		return "empty path"
+	}
+	if strings.ContainsRune(filePath, 0) {
+		return "path contains a NUL byte"
+	}
+	if path.IsAbs(filePath) || strings.Contains(filePath, "\\") {
+		return "path must be relative with forward slashes"
+	}
+	trimmed := strings.TrimSuffix(filePath, "/")
+	if path.Clean(trimmed) != trimmed {
+		return "path is not clean"
+	}
+	if trimmed == "." || trimmed == "" {
+		return "path is the install root"
+	}
+	if trimmed == ".." || strings.HasPrefix(trimmed, "../") {
+		return "path leaves the install"
+	}
+	return ""
+}
+
+// countOperations counts the operations of each kind in delta
+func countOperations(delta map[string]DeltaOperation) OperationCounts {
+	var counts OperationCounts
+	for _, operation := range delta {
+		switch operation.Operation {
+		case deltaOperationAdded:
+			counts.Added++
+		case deltaOperationModified:
+			counts.Modified++
+		case deltaOperationRemoved:
+			counts.Removed++
+		case deltaOperationMoved:
+			counts.Moved++
+		}
+	}
+	return counts
+}
@@ -0,0 +1,239 @@
+package packager
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadPackageOperations(t *testing.T) {
+	expected := map[string]DeltaOperation{
+		modulesBinaryDir + "/" + modulesFilename: {Operation: deltaOperationModified},
+		"UnrealTournament/Config/Default.ini":    {Operation: deltaOperationModified},
+		"UnrealTournament/Content/Added.txt":     {Operation: deltaOperationAdded},
+		"UnrealTournament/Content/Removed.txt":   {Operation: deltaOperationRemoved},
+	}
+	for _, options := range []Options{
+		{},
+		{OperationsPlacement: OperationsFirst},
+		{OperationsPlacement: OperationsSidecar},
+		{CompressOperations: true},
+	} {
+		packager := newTestPackager(t, options)
+		installTestVersion(t, packager, 3395761, map[string]string{
+			"UnrealTournament/Config/Default.ini":  "setting=1",
+			"UnrealTournament/Content/Removed.txt": "removed",
+		})
+		installTestVersion(t, packager, 3525360, map[string]string{
+			"UnrealTournament/Config/Default.ini": "setting=2",
+			"UnrealTournament/Content/Added.txt":  "added",
+		})
+		_, err := packager.GeneratePackage("3395761", "3525360")
+		if err != nil {
+			t.Fatal(err)
+		}
+		before, err := ioutil.ReadDir(packager.packageDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		operations, err := ReadPackageOperations(
+			filepath.Join(packager.packageDir, "3395761-3525360.tar.gz"))
+		if err != nil {
+			t.Fatalf("Options %+v: %s", options, err)
+		}
+		if !reflect.DeepEqual(operations, expected) {
+			t.Errorf("Options %+v: operations are %v, expected %v",
+				options, operations, expected)
+		}
+		// Nothing is extracted to read them
+		after, err := ioutil.ReadDir(packager.packageDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(after) != len(before) {
+			t.Errorf("Reading the operations wrote %d files", len(after)-len(before))
+		}
+	}
+}
+
+func TestReadPackageOperationsFromInvalidPackage(t *testing.T) {
+	dir := tempDir(t)
+	packagePath := filepath.Join(dir, "empty.tar.gz")
+	err := ioutil.WriteFile(packagePath, []byte("not a package"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ReadPackageOperations(packagePath)
+	if err == nil {
+		t.Error("Reading operations from an invalid package didn't fail")
+	}
+}
+
+func TestOperationsPlacement(t *testing.T) {
+	for _, placement := range []string{OperationsFirst, OperationsSidecar} {
+		packager := newTestPackager(t, Options{OperationsPlacement: placement})
+		installTestVersion(t, packager, 3395761, map[string]string{
+			"UnrealTournament/Config/Default.ini": "setting=1",
+		})
+		installTestVersion(t, packager, 3525360, map[string]string{
+			"UnrealTournament/Config/Default.ini": "setting=2",
+			"UnrealTournament/Content/Added.txt":  "added",
+		})
+		_, err := packager.GeneratePackage("3395761", "3525360")
+		if err != nil {
+			t.Fatal(err)
+		}
+		packagePath := filepath.Join(packager.packageDir, "3395761-3525360.tar.gz")
+
+		file, err := os.Open(packagePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		header, err := tar.NewReader(gzipReader).Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, sidecarErr := os.Stat(packagePath + operationsSidecarSuffix)
+		_, inPackage := readPackage(t, packagePath)[operationsFilename]
+		switch placement {
+		case OperationsFirst:
+			if header.Name != operationsFilename {
+				t.Errorf("First entry is %s, expected %s", header.Name, operationsFilename)
+			}
+			if sidecarErr == nil {
+				t.Error("Operations placed first have a sidecar")
+			}
+		case OperationsSidecar:
+			if sidecarErr != nil {
+				t.Errorf("Sidecar operations missing: %s", sidecarErr)
+			}
+			if inPackage {
+				t.Error("Sidecar operations are in the package as well")
+			}
+		}
+	}
+}
+
+func TestReadPackageOperationsRejectsMalformedOperations(t *testing.T) {
+	tests := []struct {
+		operations string
+		expected   string
+	}{
+		{`{"a.txt": "added"`, "Malformed operations.json"},
+		{`null`, "no operations"},
+		{`{"a.txt": "patched"}`, "unknown operation 'patched'"},
+		{`{"a.txt": {"operation": "added", "source": "b.txt"}}`, "can't have a source"},
+		{`{"a.txt": "moved"}`, "moved operation without a source"},
+		{`{"a.txt": {"operation": "moved", "source": "../b.txt"}}`, "source path leaves the install"},
+		{`{"/etc/passwd": "added"}`, "path must be relative"},
+		{`{"a/../../b.txt": "added"}`, "path is not clean"},
+		{`{"../b.txt": "added"}`, "path leaves the install"},
+		{`{"": "added"}`, "empty path"},
+	}
+	dir := tempDir(t)
+	packagePath := filepath.Join(dir, "3395761-3525360.tar.gz")
+	for _, test := range tests {
+		err := ioutil.WriteFile(packagePath+operationsSidecarSuffix,
+			[]byte(test.operations), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = ReadPackageOperations(packagePath)
+		if err == nil {
+			t.Errorf("Operations %s were accepted", test.operations)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("Operations %s were rejected with '%s', expected '%s'",
+				test.operations, err, test.expected)
+		}
+	}
+}
+
+func TestCompressedOperationsRoundTrip(t *testing.T) {
+	operations := make(map[string]DeltaOperation)
+	kinds := []string{
+		deltaOperationAdded,
+		deltaOperationModified,
+		deltaOperationRemoved,
+		deltaOperationMoved,
+	}
+	for i := 0; i < 20000; i++ {
+		operation := DeltaOperation{Operation: kinds[i%len(kinds)]}
+		if operation.Operation == deltaOperationMoved {
+			operation.Source = fmt.Sprintf("UnrealTournament/Content/Old/%05d.pak", i)
+		}
+		operations[fmt.Sprintf("UnrealTournament/Content/Paks/%05d.pak", i)] = operation
+	}
+
+	plain, plainName, err := encodeOperations(operations, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed, compressedName, err := encodeOperations(operations, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plainName != operationsFilename || compressedName != compressedOperationsFilename {
+		t.Errorf("Entries are %s and %s", plainName, compressedName)
+	}
+	if len(compressed) >= len(plain) {
+		t.Errorf("Compressed operations are %d bytes, plain %d", len(compressed), len(plain))
+	}
+	for name, encoded := range map[string][]byte{
+		plainName:      plain,
+		compressedName: compressed,
+	} {
+		decoded, err := decodeOperations(bytes.NewReader(encoded))
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if !reflect.DeepEqual(decoded, operations) {
+			t.Errorf("%s: %d operations decoded differ from the %d encoded",
+				name, len(decoded), len(operations))
+		}
+	}
+}
+
+func TestCompressedOperationsEntry(t *testing.T) {
+	packager := newTestPackager(t, Options{CompressOperations: true})
+	installTestVersion(t, packager, 3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+	})
+	installTestVersion(t, packager, 3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+	})
+	_, err := packager.GeneratePackage("3395761", "3525360")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := readPackage(t, filepath.Join(packager.packageDir, "3395761-3525360.tar.gz"))
+	if _, ok := files[compressedOperationsFilename]; !ok {
+		t.Errorf("Package has no %s", compressedOperationsFilename)
+	}
+	if _, ok := files[operationsFilename]; ok {
+		t.Errorf("Package with compressed operations has %s", operationsFilename)
+	}
+
+	_, err = New("http://localhost/feed", "", tempDir(t), tempDir(t), tempDir(t),
+		Options{
+			CompressOperations:  true,
+			OperationsPlacement: OperationsSidecar,
+		})
+	if err == nil {
+		t.Error("Compressed sidecar operations were accepted")
+	}
+}
@@ -1,7 +1,7 @@
 package packager
 
 import (
-	"archive/zip"
+	"crypto/ed25519"
 	"crypto/sha256"
 	"encoding/json"
 	"errors"
@@ -11,12 +11,13 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/donovansolms/ut4-update-packager/src/packager/models"
-	"github.com/jhoonb/archivex"
 	"github.com/jinzhu/gorm"
 	"github.com/mmcdole/gofeed"
 	"github.com/mvdan/xurls"
@@ -24,6 +25,7 @@ import (
 
 	// This is how SQL drivers are imported
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/mattn/go-sqlite3"
 )
 
 // Packager creates new update packages for releases
@@ -32,27 +34,311 @@ type Packager struct {
 	releaseFeedURL string
 	// connectionString is the MySQL-compatible DB connection string
 	connectionString string
-	// workingDir is the path for download and extract
+	// workingDir is the path for packaging scratch files
 	workingDir string
+	// payloadDir is where the release is downloaded and extracted, it is
+	// the working dir unless configured separately
+	payloadDir string
 	// releaseDir is where the releases are stored with their version numbers
 	releaseDir string
 	// packageDir is where compressed upgrade packages are stored
 	packageDir string
+	// options holds the optional behaviour settings
+	options Options
+	// signingKey signs package manifests when set
+	signingKey ed25519.PrivateKey
+	// releasePost is the post found by the last CheckForNewRelease
+	releasePost *gofeed.Item
+	// releasePublicKey verifies release downloads when set
+	releasePublicKey *minisignPublicKey
+	// hashCacheStats counts .hashes cache use, guarded by hashCacheLock
+	hashCacheStats HashCacheStats
+	hashCacheLock  sync.Mutex
+	// hashIndex is the layout of the hash cache index once loaded,
+	// hashIndexLock guards it with reading and writing the index
+	hashIndex     *hashIndexState
+	hashIndexLock sync.Mutex
+	// fileHashVersions holds the versions known to have per-file hash rows
+	fileHashVersions map[string]bool
+	// watchSizes holds the size of each unprocessed zip in the watch dir
+	// on the previous poll
+	watchSizes map[string]int64
+	// sharedDeltas holds the packages built during this run by delta hash
+	sharedDeltas map[string]models.Ut4UpdatePackages
+	// hashLRU keeps recently used version hashes in memory when enabled
+	hashLRU *versionHashLRU
+	// progress merges the progress of the downloads and hashing of a run
+	progress *ProgressAggregator
+	// httpClient makes all requests so connections are reused
+	httpClient *http.Client
 }
 
+// ErrNoNewRelease is returned by CheckForNewRelease when no unprocessed
+// release post is available
+var ErrNoNewRelease = errors.New("No new release available")
+
 // New creates a new instance of Packager
 func New(releaseFeedURL string,
 	connectionString string,
 	workingDir string,
 	releaseDir string,
-	packageDir string) (*Packager, error) {
+	packageDir string,
+	options Options) (*Packager, error) {
 	log.SetOutput(os.Stdout)
 	log.SetLevel(log.DebugLevel)
 	log.SetFormatter(&log.TextFormatter{
 		FullTimestamp:   true,
 		TimestampFormat: "Jan 02 15:04:05",
 	})
-	err := os.MkdirAll(workingDir, 0755)
+	if options.PackageNameTemplate == "" {
+		options.PackageNameTemplate = defaultPackageNameTemplate
+	}
+	if options.PackageURLTemplate == "" {
+		options.PackageURLTemplate = defaultPackageURLTemplate
+	}
+	if options.DatabaseDialect == "" {
+		options.DatabaseDialect = defaultDatabaseDialect
+	}
+	if options.VersionMismatch == "" {
+		options.VersionMismatch = VersionMismatchWarn
+	}
+	if options.VersionMismatch != VersionMismatchWarn &&
+		options.VersionMismatch != VersionMismatchFail {
+		return &Packager{}, fmt.Errorf(
+			"Unknown version mismatch behaviour '%s'", options.VersionMismatch)
+	}
+	if options.CaseCollisions == "" {
+		options.CaseCollisions = CaseCollisionWarn
+	}
+	if options.CaseCollisions != CaseCollisionWarn &&
+		options.CaseCollisions != CaseCollisionFail {
+		return &Packager{}, fmt.Errorf(
+			"Unknown case collision behaviour '%s'", options.CaseCollisions)
+	}
+	if options.Channel == "" {
+		options.Channel = ChannelStable
+	}
+	if options.ExtractDepth <= 0 {
+		options.ExtractDepth = 1
+	}
+	if options.Uploader == nil {
+		options.Uploader = NewTemplateUploader(options.PackageURLTemplate)
+	}
+	if options.NewArchiver == nil {
+		options.NewArchiver = newTarGzArchiver
+	}
+	if len(options.AcceptedContentTypes) == 0 {
+		options.AcceptedContentTypes = defaultAcceptedContentTypes
+	}
+	if options.VersionComparator == nil {
+		options.VersionComparator = CompareChangelists
+	}
+	if options.VersionValidator == nil {
+		options.VersionValidator = IsChangelistVersion
+	}
+	if options.StorageMode == "" {
+		options.StorageMode = StorageArchive
+	}
+	if options.StorageMode != StorageArchive &&
+		options.StorageMode != StorageFiles {
+		return &Packager{}, fmt.Errorf(
+			"Unknown storage mode '%s'", options.StorageMode)
+	}
+	if options.StorageMode == StorageFiles && options.ChunkFiles {
+		return &Packager{}, errors.New(
+			"Chunked files can't be combined with the files storage mode")
+	}
+	if options.MaxResumeAttempts <= 0 {
+		options.MaxResumeAttempts = 3
+	}
+	if options.SmallPackages == "" {
+		options.SmallPackages = SmallPackagesFlag
+	}
+	if options.SmallPackages != SmallPackagesFlag &&
+		options.SmallPackages != SmallPackagesSkip {
+		return &Packager{}, fmt.Errorf(
+			"Unknown small package behaviour '%s'", options.SmallPackages)
+	}
+	if options.NormalizationMode == "" {
+		options.NormalizationMode = NormalizeHashes
+	}
+	if options.NormalizationMode != NormalizeHashes &&
+		options.NormalizationMode != NormalizeDemote {
+		return &Packager{}, fmt.Errorf(
+			"Unknown normalization mode '%s'", options.NormalizationMode)
+	}
+	if options.PostPackageHookFailure == "" {
+		options.PostPackageHookFailure = HookFailureWarn
+	}
+	if options.PostPackageHookFailure != HookFailureWarn &&
+		options.PostPackageHookFailure != HookFailureFail {
+		return &Packager{}, fmt.Errorf(
+			"Unknown post-package hook failure behaviour '%s'",
+			options.PostPackageHookFailure)
+	}
+	if options.DeltaPostProcessors == nil {
+		options.DeltaPostProcessors = []DeltaPostProcessor{NewMoveDetector()}
+	}
+	if options.HTTPIdleConnsPerHost <= 0 {
+		options.HTTPIdleConnsPerHost = defaultHTTPIdleConnsPerHost
+	}
+	if options.HTTPIdleConnTimeout <= 0 {
+		options.HTTPIdleConnTimeout = defaultHTTPIdleConnTimeout
+	}
+	if options.HTTPKeepAlive <= 0 {
+		options.HTTPKeepAlive = defaultHTTPKeepAlive
+	}
+	if len(options.PostMetadata) == 0 {
+		options.PostMetadata = defaultPostMetadata
+	}
+	if options.DownloadArtifact == "" {
+		options.DownloadArtifact = ArtifactClient
+	}
+	if len(options.ArtifactPatterns) == 0 {
+		options.ArtifactPatterns = defaultArtifactPatterns
+	}
+	if options.CompressOperations &&
+		options.OperationsPlacement == OperationsSidecar {
+		return &Packager{}, errors.New(
+			"Compressed operations are only supported inside the package")
+	}
+	if options.StreamUploads {
+		err := validateStreamUploads(options)
+		if err != nil {
+			return &Packager{}, err
+		}
+	}
+	if options.Permissions == "" {
+		options.Permissions = PermissionsOff
+	}
+	if options.Permissions != PermissionsOff &&
+		options.Permissions != PermissionsReport &&
+		options.Permissions != PermissionsFix {
+		return &Packager{}, fmt.Errorf(
+			"Unknown permissions behaviour '%s'", options.Permissions)
+	}
+	if len(options.ExecutablePatterns) == 0 {
+		options.ExecutablePatterns = defaultExecutablePatterns
+	}
+	if options.DownloadLinkElement != "" &&
+		!strings.Contains(options.DownloadLinkElement, ":") {
+		return &Packager{}, fmt.Errorf(
+			"Download link element '%s' must be prefix:name",
+			options.DownloadLinkElement)
+	}
+	if options.OperationsPlacement == "" {
+		options.OperationsPlacement = OperationsInPayload
+	}
+	if options.OperationsPlacement != OperationsInPayload &&
+		options.OperationsPlacement != OperationsFirst &&
+		options.OperationsPlacement != OperationsSidecar {
+		return &Packager{}, fmt.Errorf(
+			"Unknown operations placement '%s'", options.OperationsPlacement)
+	}
+	if options.ReleaseSignatureSuffix == "" {
+		options.ReleaseSignatureSuffix = defaultReleaseSignatureSuffix
+	}
+	if options.CoverageStrategy == "" {
+		options.CoverageStrategy = CoverageFanOut
+	}
+	if options.CoverageStrategy != CoverageFanOut &&
+		options.CoverageStrategy != CoverageChain {
+		return &Packager{}, fmt.Errorf(
+			"Unknown coverage strategy '%s'", options.CoverageStrategy)
+	}
+	dirs := map[string]string{
+		"working dir": workingDir,
+		"release dir": releaseDir,
+		"package dir": packageDir,
+	}
+	payloadDir := workingDir
+	if options.PayloadDir != "" {
+		payloadDir = options.PayloadDir
+		dirs["payload dir"] = payloadDir
+	}
+	err := validateDirs(dirs)
+	if err != nil {
+		return &Packager{}, err
+	}
+	err = validatePathPatterns(options.IgnorePatterns)
+	if err != nil {
+		return &Packager{}, err
+	}
+	err = validatePathPatterns(options.ExecutablePatterns)
+	if err != nil {
+		return &Packager{}, err
+	}
+	err = validatePathPatterns(options.ProtectedPaths)
+	if err != nil {
+		return &Packager{}, err
+	}
+	options.ContentRoots, err = normalizeContentRoots(options.ContentRoots)
+	if err != nil {
+		return &Packager{}, err
+	}
+	err = validatePostMetadata(options.PostMetadata)
+	if err != nil {
+		return &Packager{}, err
+	}
+	err = validateArtifact(options.DownloadArtifact, options.ArtifactPatterns)
+	if err != nil {
+		return &Packager{}, err
+	}
+	for _, rule := range options.Normalizations {
+		err = validatePathPatterns([]string{rule.Pattern})
+		if err != nil {
+			return &Packager{}, err
+		}
+	}
+	err = validatePackageNameTemplate(options.PackageNameTemplate)
+	if err != nil {
+		return &Packager{}, err
+	}
+	err = ValidateTemplate(options.PackageURLTemplate)
+	if err != nil {
+		return &Packager{}, err
+	}
+	if options.CleanWorkingDirOnStart {
+		if options.WorkingDirCleaner == nil {
+			options.WorkingDirCleaner = CleanStaleArtifacts
+			if options.ResumePackaging {
+				options.WorkingDirCleaner = CleanStaleArtifactsKeepStaging
+			}
+		}
+		err = options.WorkingDirCleaner(workingDir)
+		if err != nil {
+			return &Packager{}, err
+		}
+		if payloadDir != workingDir {
+			err = options.WorkingDirCleaner(payloadDir)
+			if err != nil {
+				return &Packager{}, err
+			}
+		}
+	}
+	var signingKey ed25519.PrivateKey
+	if options.SigningKeyPath != "" {
+		signingKey, err = loadSigningKey(options.SigningKeyPath)
+		if err != nil {
+			return &Packager{}, err
+		}
+	}
+	var hashLRU *versionHashLRU
+	if options.HashMemoryCacheSize > 0 {
+		hashLRU = newVersionHashLRU(options.HashMemoryCacheSize)
+	}
+	var releasePublicKey *minisignPublicKey
+	if options.ReleasePublicKey != "" {
+		releasePublicKey, err = parseMinisignPublicKey(options.ReleasePublicKey)
+		if err != nil {
+			return &Packager{}, err
+		}
+	}
+	err = os.MkdirAll(workingDir, 0755)
+	if err != nil {
+		return &Packager{}, err
+	}
+	err = os.MkdirAll(payloadDir, 0755)
 	if err != nil {
 		return &Packager{}, err
 	}
@@ -68,8 +354,18 @@ func New(releaseFeedURL string,
 		releaseFeedURL:   releaseFeedURL,
 		connectionString: connectionString,
 		workingDir:       workingDir,
+		payloadDir:       payloadDir,
 		releaseDir:       releaseDir,
 		packageDir:       packageDir,
+		options:          options,
+		signingKey:       signingKey,
+		releasePublicKey: releasePublicKey,
+		fileHashVersions: make(map[string]bool),
+		watchSizes:       make(map[string]int64),
+		sharedDeltas:     make(map[string]models.Ut4UpdatePackages),
+		hashLRU:          hashLRU,
+		progress:         NewProgressAggregator(options.Progress),
+		httpClient:       newHTTPClient(options),
 	}, nil
 }
 
@@ -89,43 +385,46 @@ func (packager *Packager) CheckForNewRelease() (string, float64, error) {
 		return downloadURL, downloadSize, err
 	}
 
-	db, err := gorm.Open("mysql", packager.connectionString)
+	db, err := packager.openDB()
 	if err != nil {
 		return downloadURL, downloadSize, err
 	}
 	defer db.Close()
+	newPosts, err := packager.unprocessedPosts(db, releasePosts)
+	if err != nil {
+		return downloadURL, downloadSize, err
+	}
 	var newReleasePost *gofeed.Item
-	for _, releasePost := range releasePosts {
-		var model models.Ut4BlogPost
-		query := db.
-			Where("guid = ? AND is_deleted = 0", releasePost.GUID).
-			First(&model)
-		if query.Error != nil {
-			if query.Error == gorm.ErrRecordNotFound {
-				// New blog post found
-				newReleasePost = releasePost
-			} else {
-				return downloadURL, downloadSize, query.Error
-			}
-		}
+	if len(newPosts) > 0 {
+		newReleasePost = newPosts[len(newPosts)-1]
 	}
+	if newReleasePost == nil {
+		return downloadURL, downloadSize, ErrNoNewRelease
+	}
+	packager.releasePost = newReleasePost
 
+	date := "unknown"
+	if postDate(newReleasePost) != nil {
+		date = postDate(newReleasePost).Format("2006-01-02 15:04:05")
+	}
 	log.WithFields(log.Fields{
 		"title": newReleasePost.Title,
-		"guid":  newReleasePost.GUID,
-		"date":  newReleasePost.PublishedParsed.Format("2006-01-02 15:04:03"),
+		"guid":  postKey(newReleasePost),
+		"date":  date,
 	}).Info("New release post is available")
 
 	// TODO: Send email
 
+	// The download may not be live yet right after the post is published
 	downloadURL, err = packager.extractUpdateDownloadLinkFromPost(newReleasePost)
 	if err != nil {
-		return downloadURL, downloadSize, err
+		return downloadURL, downloadSize, packager.withinGracePeriod(newReleasePost, err)
 	}
-	downloadSize, err = packager.getDownloadSize(downloadURL)
+	downloadURL, downloadSize, err = packager.getDownloadSizeFromMirrors(downloadURL)
 	if err != nil {
-		return downloadURL, downloadSize, err
+		return downloadURL, downloadSize, packager.withinGracePeriod(newReleasePost, err)
 	}
+	packager.clearPendingRelease(newReleasePost)
 
 	return downloadURL, downloadSize, nil
 }
@@ -134,17 +433,28 @@ func (packager *Packager) CheckForNewRelease() (string, float64, error) {
 // and returns the extracted path
 func (packager *Packager) DownloadAndExtract(downloadURL string) (string, error) {
 	// Download the new release
-	downloadFilePath := filepath.Join(packager.workingDir, "newrelease.zip")
-	err := packager.downloadFile(downloadFilePath, downloadURL)
+	// The payload dir is removed after every processed release
+	err := os.MkdirAll(packager.payloadDir, 0755)
+	if err != nil {
+		return "", err
+	}
+	downloadFilePath := filepath.Join(packager.payloadDir, "newrelease.zip")
+	err = packager.downloadFileFromMirrors(downloadFilePath, downloadURL)
 	if err != nil {
 		return "", err
 	}
 	log.WithFields(log.Fields{
 		"output": downloadFilePath,
 	}).Info("Downloaded")
+	if packager.releasePublicKey != nil {
+		err = packager.verifyRelease(downloadFilePath, downloadURL)
+		if err != nil {
+			return "", err
+		}
+	}
 
 	// Extract the files to be able to determine the version
-	extractPath := filepath.Join(packager.workingDir, "newrelease")
+	extractPath := filepath.Join(packager.payloadDir, "newrelease")
 	err = packager.extract(extractPath, downloadFilePath)
 	if err != nil {
 		return "", err
@@ -169,49 +479,191 @@ func (packager *Packager) GetVersionList() ([]string, error) {
 
 	var versions []string
 	for _, file := range files {
-		if file.IsDir() {
-			versions = append(versions, file.Name())
+		if !file.IsDir() {
+			continue
+		}
+		// Stray dirs such as lost+found or .git aren't versions
+		if !packager.options.VersionValidator(file.Name()) {
+			log.WithField("dir", file.Name()).Debug("Skipping non-version dir")
+			continue
 		}
+		versions = append(versions, file.Name())
 	}
 	return versions, nil
 }
 
 // Run executes a continuous loop that checks for updates and packages
 // new updates as they become available
-func (packager *Packager) Run() error {
+func (packager *Packager) Run() (RunResult, error) {
+	var result RunResult
+	startTime := time.Now()
+	packager.progress.Reset()
+	// The post of an earlier run must not decide the channel of this one
+	packager.releasePost = nil
+	// Finish packaging a release an earlier run moved into place but didn't
+	// complete before looking for a new one
+	resumed, result, err := packager.resumePackaging(startTime)
+	if err != nil || resumed {
+		return result, err
+	}
 	// Is a new release available from the blog?
 	downloadURL, downloadSize, err := packager.CheckForNewRelease()
+	if err == ErrNoNewRelease {
+		log.Info("No new release available")
+		return result, nil
+	}
+	if err == ErrReleasePending {
+		return result, nil
+	}
 	if err != nil {
 		log.WithField("err", "check_for_release").Error(err.Error())
-		return err
+		return result, err
 	}
 	log.WithFields(log.Fields{
 		"link": downloadURL,
-		"size": fmt.Sprintf("%.2fMB", (downloadSize / 1024.00 / 1024.00)),
+		"size": formatDownloadSize(downloadSize),
 	}).Info("New release is available")
 
+	// Make sure the download will actually work before committing to it
+	err = packager.preflightDownload(downloadURL)
+	if err != nil {
+		log.WithField("err", "download_preflight").Error(err.Error())
+		return result, err
+	}
+
+	// Don't download a release the link already shows is older than what
+	// we have
+	if urlVersion := versionFromURL(downloadURL); urlVersion != "" {
+		skipped, err := packager.skipOlderRelease(urlVersion)
+		if err != nil {
+			log.WithField("err", "older_release_check").Error(err.Error())
+			return result, err
+		}
+		if skipped {
+			return result, nil
+		}
+	}
+
 	// Get the new release
 	newReleaseTempPath, err := packager.DownloadAndExtract(downloadURL)
 	if err != nil {
 		log.WithField("err", "download_extract").Error(err.Error())
-		return err
+		return result, err
 	}
 	log.WithFields(log.Fields{
 		"output": newReleaseTempPath,
 	}).Info("Release downloaded and extracted")
 
+	return packager.processRelease(
+		newReleaseTempPath,
+		downloadURL,
+		downloadSize,
+		startTime)
+}
+
+// processRelease moves an extracted release into the release dir and
+// builds its upgrade packages. downloadURL is empty for releases that
+// didn't come from the feed
+func (packager *Packager) processRelease(
+	newReleaseTempPath string,
+	downloadURL string,
+	downloadSize float64,
+	startTime time.Time) (RunResult, error) {
+	var result RunResult
+
 	// Determine version
 	newVersion, err := packager.getReleaseNumber(newReleaseTempPath)
 	if err != nil {
 		// TODO: Possibly check the download file name for the version number
 		// TODO: Send email with missing release number
 		log.WithField("err", "missing_release_version").Error(err.Error())
-		return err
+		return result, err
+	}
+	if !packager.options.VersionValidator(newVersion) {
+		err = fmt.Errorf("Release version '%s' is not a valid version", newVersion)
+		log.WithField("err", "invalid_release_version").Error(err.Error())
+		return result, err
 	}
 	log.WithField("version", newVersion).Info("Version info found")
+	result.Version = newVersion
+
+	err = verifyModuleBinaries(newReleaseTempPath)
+	if err != nil {
+		log.WithField("err", "missing_module_binaries").Error(err.Error())
+		return result, err
+	}
+
+	err = packager.checkReleaseEnvelope(newReleaseTempPath)
+	if err != nil {
+		log.WithField("err", "release_envelope").Error(err.Error())
+		return result, err
+	}
+
+	result.PermissionMismatches, err = packager.checkPermissions(newReleaseTempPath)
+	if err != nil {
+		log.WithField("err", "check_permissions").Error(err.Error())
+		return result, err
+	}
+
+	err = packager.checkDownloadVersion(downloadURL, newVersion)
+	if err != nil {
+		log.WithField("err", "version_mismatch").Error(err.Error())
+		return result, err
+	}
+
+	skipped, err := packager.skipOlderRelease(newVersion)
+	if err != nil {
+		log.WithField("err", "older_release_check").Error(err.Error())
+		return result, err
+	}
+	if skipped {
+		packager.cleanWorkingDirs()
+		return result, nil
+	}
+
+	db, err := packager.openDB()
+	if err != nil {
+		return result, err
+	}
+	defer db.Close()
+
+	// A reprocessed post for a version we already have doesn't need any
+	// work unless reprocessing was asked for
+	if !packager.options.Reprocess {
+		upToDate, err := packager.isUpToDate(db, newVersion)
+		if err != nil {
+			log.WithField("err", "up_to_date_check").Error(err.Error())
+			return result, err
+		}
+		if upToDate {
+			log.WithField("version", newVersion).Info("Release is up to date")
+			if packager.releasePost != nil {
+				err = packager.markReleaseProcessed(db, packager.releasePost, newVersion)
+				if err != nil {
+					return result, err
+				}
+			}
+			packager.cleanWorkingDirs()
+			return result, nil
+		}
+	}
+
+	// Snapshot the release to check nothing got lost when moving it, the
+	// move may cross filesystems
+	snapshot, err := snapshotRelease(newReleaseTempPath)
+	if err != nil {
+		log.WithField("err", "snapshot_release").Error(err.Error())
+		return result, err
+	}
 
 	// Now that we have the new release's version, we can move the files
-	// there
+	// there. The packaging marker lets the next run finish the packages
+	// when this one is interrupted after the move
+	err = packager.writePackagingMarker(newVersion, downloadURL)
+	if err != nil {
+		log.WithField("err", "packaging_marker").Error(err.Error())
+		return result, err
+	}
 	newReleasePath := filepath.Join(packager.releaseDir, newVersion)
 	os.RemoveAll(newReleasePath)
 	err = os.Rename(
@@ -220,188 +672,734 @@ func (packager *Packager) Run() error {
 	if err != nil {
 		// TODO: Send email
 		log.WithField("err", "move_temp_to_release").Error(err.Error())
-		return err
+		return result, err
+	}
+	err = packager.verifyMovedRelease(snapshot, newReleasePath, newVersion)
+	if err != nil {
+		log.WithField("err", "verify_moved_release").Error(err.Error())
+		return result, err
+	}
+	return packager.packageRelease(
+		db,
+		result,
+		downloadURL,
+		downloadSize,
+		startTime)
+}
+
+// packageRelease builds the upgrade packages to result.Version, which is
+// in the release dir already, and records the run
+func (packager *Packager) packageRelease(
+	db *gorm.DB,
+	result RunResult,
+	downloadURL string,
+	downloadSize float64,
+	startTime time.Time) (RunResult, error) {
+	newVersion := result.Version
+	var err error
+	if packager.options.VersionManifests {
+		err = packager.writeVersionManifest(newVersion)
+		if err != nil {
+			log.WithField("err", "version_manifest").Error(err.Error())
+			return result, err
+		}
 	}
 
 	versions, err := packager.GetVersionList()
 	if err != nil {
 		log.WithField("err", "version_list").Error(err.Error())
-		return err
+		return result, err
 	}
 	log.WithField("versions", versions).Info("Currently available versions")
 
-	db, err := gorm.Open("mysql", packager.connectionString)
-	if err != nil {
-		return err
-	}
-	defer db.Close()
 	// Now we build an upgrade path for each version to the new version
 	// We do this so that you can upgrade from any verion we have listed
 	// to the new one. If we don't have a version listed, you'll download
-	// the full latest version
-	for _, version := range versions {
-		if version >= newVersion {
-			log.WithFields(log.Fields{
-				"fromVersion": version,
-				"toVersion":   newVersion}).Debug("Skipping older or equal version")
-			continue
-		}
+	// the full latest version. Which pairs are built depends on the
+	// coverage strategy
+	batch := newPackageBatch(db, packager.options.DBBatchSize)
+	for _, pair := range packager.planCoverage(versions, newVersion) {
+		version := pair.FromVersion
+		toVersion := pair.ToVersion
 
 		// First check if this upgrade path has been added to the database already
-		var updateCheck models.Ut4UpdatePackages
-		query := db.Where("from_version = ? AND to_version = ? ANd is_deleted = 0",
-			version,
-			newVersion,
-		).First(&updateCheck)
-		if query.Error != nil {
-			if query.Error == gorm.ErrRecordNotFound {
-				// continue
-			} else {
-				return query.Error
-			}
+		exists, err := packager.packageExists(db, pair)
+		if err != nil {
+			return result, err
 		}
-		if updateCheck.FromVersion != "" && updateCheck.ToVersion != "" {
+		if exists {
 			// We have this version already
 			log.WithFields(log.Fields{
 				"fromVersion": version,
-				"toVersion":   newVersion,
+				"toVersion":   toVersion,
 			}).Warning("Upgrade already processed")
 			continue
 		}
 
-		packagePath, err := packager.generateUpgradePath(version, newVersion)
+		updatePackage, counts, err := packager.buildPackageWithRetries(pair)
+		if err == ErrEmptyDelta {
+			log.WithFields(log.Fields{
+				"fromVersion": pair.FromVersion,
+				"toVersion":   pair.ToVersion,
+			}).Info("Nothing changed, no upgrade package needed")
+			result.Unchanged = append(result.Unchanged, pair)
+			if packager.options.RecordEmptyDeltas {
+				err = packager.recordEmptyDelta(db, pair)
+				if err != nil {
+					return result, err
+				}
+			}
+			continue
+		}
+		if err == ErrPackageTooSmall {
+			result.Small = append(result.Small, pair)
+			continue
+		}
+		if err != nil {
+			result.Failures = append(result.Failures, PackageFailure{
+				VersionPair: pair,
+				Attempts:    packager.options.PackageRetries + 1,
+				Error:       err.Error(),
+			})
+			continue
+		}
+		err = batch.add(updatePackage)
+		if err != nil {
+			log.WithField("err", "save_packages").Error(err.Error())
+			return result, err
+		}
+		result.Packages = append(result.Packages, pair)
+		result.TotalPackageSize += updatePackage.Size
+		result.Operations = append(result.Operations, PackageOperations{
+			VersionPair:     pair,
+			OperationCounts: counts,
+		})
+		if updatePackage.UncompressedSize > 0 {
+			result.Compression = append(result.Compression, PackageCompression{
+				VersionPair:      pair,
+				UncompressedSize: updatePackage.UncompressedSize,
+				CompressedSize:   updatePackage.Size,
+				Ratio: compressionRatio(
+					updatePackage.Size,
+					updatePackage.UncompressedSize),
+			})
+		}
+		if updatePackage.Size < packager.options.MinPackageBytes {
+			result.Small = append(result.Small, pair)
+		}
+	}
+	err = batch.flush()
+	if err != nil {
+		log.WithField("err", "save_packages").Error(err.Error())
+		return result, err
+	}
+	result.HashCache = packager.HashCacheStats()
+	log.WithFields(log.Fields{
+		"hits":              result.HashCache.Hits,
+		"misses":            result.HashCache.Misses,
+		"regeneration_time": result.HashCache.RegenerationTime.String(),
+	}).Info("Hash cache usage")
+	for _, failure := range result.Failures {
+		log.WithFields(log.Fields{
+			"fromVersion": failure.FromVersion,
+			"toVersion":   failure.ToVersion,
+			"attempts":    failure.Attempts,
+		}).Error("Upgrade package failed: " + failure.Error)
+	}
+
+	// Only mark the post processed and clear the packaging marker once all
+	// packages were created so a failed run is picked up again
+	if len(result.Failures) == 0 {
+		if packager.releasePost != nil {
+			err = packager.markReleaseProcessed(db, packager.releasePost, newVersion)
+			if err != nil {
+				log.WithField("err", "mark_release_processed").Error(err.Error())
+				return result, err
+			}
+		}
+		err = packager.clearPackagingMarker(newVersion)
+		if err != nil {
+			log.WithField("err", "packaging_marker").Error(err.Error())
+			return result, err
+		}
+	}
+
+	err = packager.saveRunStats(db, result, downloadSize, startTime)
+	if err != nil {
+		log.WithField("err", "save_run_stats").Error(err.Error())
+		return result, err
+	}
+
+	// A partly packaged version isn't published, clients would be pointed
+	// at packages that don't exist
+	if packager.options.PublishLatest && len(result.Failures) == 0 {
+		err = packager.publishLatest(db, newVersion, downloadURL)
+		if err != nil {
+			log.WithField("err", "publish_latest").Error(err.Error())
+			return result, err
+		}
+	}
+	// Clear out the working dir, it will be recreated on startup
+	packager.cleanWorkingDirs()
+	return result, nil
+}
+
+// packageExists checks if the upgrade package for pair is in the database
+func (packager *Packager) packageExists(
+	db *gorm.DB,
+	pair VersionPair) (bool, error) {
+	var updateCheck models.Ut4UpdatePackages
+	query := db.Where(
+		"from_version = ? AND to_version = ? AND channel = ? AND scope = ? "+
+			"AND is_deleted = 0",
+		pair.FromVersion,
+		pair.ToVersion,
+		packager.releaseChannel(),
+		packager.packageScope(),
+	).First(&updateCheck)
+	if query.Error == gorm.ErrRecordNotFound {
+		if packager.options.RecordEmptyDeltas {
+			return packager.isEmptyDelta(db, pair)
+		}
+		return false, nil
+	}
+	if query.Error != nil {
+		return false, query.Error
+	}
+	return true, nil
+}
+
+// isUpToDate checks if version is installed already and all of its
+// upgrade packages exist
+func (packager *Packager) isUpToDate(db *gorm.DB, version string) (bool, error) {
+	fileInfo, err := os.Stat(filepath.Join(packager.releaseDir, version))
+	if err != nil || !fileInfo.IsDir() {
+		return false, nil
+	}
+	versions, err := packager.GetVersionList()
+	if err != nil {
+		return false, err
+	}
+	for _, pair := range packager.planCoverage(versions, version) {
+		exists, err := packager.packageExists(db, pair)
+		if err != nil {
+			return false, err
+		}
+		if !exists {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// buildPackageWithRetries builds the package for pair, retrying up to the
+// configured number of times before giving up
+func (packager *Packager) buildPackageWithRetries(
+	pair VersionPair) (models.Ut4UpdatePackages, OperationCounts, error) {
+	var err error
+	var updatePackage models.Ut4UpdatePackages
+	var counts OperationCounts
+	for attempt := 0; attempt <= packager.options.PackageRetries; attempt++ {
+		updatePackage, counts, err = packager.buildPackage(
+			pair.FromVersion,
+			pair.ToVersion)
+		if err == nil || err == ErrEmptyDelta || err == ErrPackageTooSmall {
+			return updatePackage, counts, err
+		}
+		log.WithFields(log.Fields{
+			"fromVersion": pair.FromVersion,
+			"toVersion":   pair.ToVersion,
+			"attempt":     attempt + 1,
+			"err":         "generating_upgrade_path",
+		}).Error(err.Error())
+	}
+	return updatePackage, counts, err
+}
+
+// buildPackage generates the upgrade package from fromVersion to toVersion,
+// moves it into the package dir and returns the database row describing it
+// with the operation counts of the package
+func (packager *Packager) buildPackage(
+	fromVersion string,
+	toVersion string) (models.Ut4UpdatePackages, OperationCounts, error) {
+	var deltaHash string
+	if packager.options.ShareDeltas {
+		var counts OperationCounts
+		var shared *models.Ut4UpdatePackages
+		var err error
+		deltaHash, counts, shared, err = packager.findSharedPackage(
+			fromVersion,
+			toVersion)
+		if err != nil {
+			return models.Ut4UpdatePackages{}, counts, err
+		}
+		if shared != nil {
+			return *shared, counts, nil
+		}
+	}
+	if packager.options.StreamUploads {
+		return packager.buildStreamedPackage(fromVersion, toVersion, deltaHash)
+	}
+	staged, counts, err := packager.generateUpgradePath(fromVersion, toVersion)
+	if err != nil {
+		return models.Ut4UpdatePackages{}, counts, err
+	}
+	packagePath := staged.path
+	err = packager.checkPackageSize(packagePath)
+	if err != nil {
+		return models.Ut4UpdatePackages{}, counts, err
+	}
+	log.WithFields(log.Fields{
+		"fromVersion": fromVersion,
+		"toVersion":   toVersion,
+		"path":        packagePath,
+		"added":       counts.Added,
+		"modified":    counts.Modified,
+		"removed":     counts.Removed,
+		"moved":       counts.Moved,
+	}).Info("Upgrade package created")
+
+	packageHash, err := hashFile(packagePath)
+	if err != nil {
+		return models.Ut4UpdatePackages{}, counts, err
+	}
+	templateValues := TemplateValues{
+		FromVersion: templateFromVersion(fromVersion),
+		ToVersion:   toVersion,
+		Platform:    packagePlatform,
+		Hash:        packageHash,
+	}
+
+	packageName := RenderTemplate(
+		packager.options.PackageNameTemplate,
+		templateValues)
+	destinationPath := filepath.Join(packager.packageDir, packageName)
+	err = os.MkdirAll(filepath.Dir(destinationPath), 0755)
+	if err != nil {
+		return models.Ut4UpdatePackages{}, counts, err
+	}
+	err = os.Rename(packagePath, destinationPath)
+	if err != nil {
+		return models.Ut4UpdatePackages{}, counts, err
+	}
+	if packager.options.OperationsPlacement == OperationsSidecar {
+		err = os.Rename(
+			packagePath+operationsSidecarSuffix,
+			destinationPath+operationsSidecarSuffix)
+		if err != nil {
+			return models.Ut4UpdatePackages{}, counts, err
+		}
+	}
+	if packager.options.ChunkFiles {
+		err = packager.publishChunks(
+			filepath.Join(staged.dir, chunksFilename),
+			destinationPath)
+		if err != nil {
+			return models.Ut4UpdatePackages{}, counts, err
+		}
+	}
+	// The staging dir is only kept to resume a failed package
+	os.RemoveAll(staged.dir)
+	packageInfo, err := os.Stat(destinationPath)
+	if err != nil {
+		return models.Ut4UpdatePackages{}, counts, err
+	}
+	logCompression(fromVersion, toVersion, staged.size, packageInfo.Size())
+	var signatureURL string
+	if packager.signingKey != nil {
+		err = signPackage(packager.signingKey, destinationPath, PackageManifest{
+			FromVersion: fromVersion,
+			ToVersion:   toVersion,
+			PackageHash: packageHash,
+		})
 		if err != nil {
-			log.WithField("err", "generating_upgrade_path").Error(err.Error())
+			return models.Ut4UpdatePackages{}, counts, err
 		}
-		log.WithFields(log.Fields{
-			"fromVersion": version,
-			"toVersion":   newVersion,
-			"path":        packagePath,
-		}).Info("Upgrade package created")
-
-		// TODO: Package needs to be uploaded somewhere
-		err = os.Rename(
-			packagePath,
-			filepath.Join(packager.packageDir, filepath.Base(packagePath)))
+		// The signature goes up first so it's there once the package is,
+		// the suffix keeps uploaders from putting it at the package's URL
+		signatureValues := templateValues
+		signatureValues.Suffix = signatureSuffix
+		signatureURL, err = packager.uploadFile(
+			destinationPath+signatureSuffix,
+			signatureValues)
 		if err != nil {
-			return err
+			return models.Ut4UpdatePackages{}, counts, err
 		}
+	}
 
-		updatePackage := models.Ut4UpdatePackages{
-			FromVersion: version,
-			ToVersion:   newVersion,
-			// TODO: Implement the update
-			UpdateURL:   "http://update.donovansolms.com/3301923-3395761.tar.gz",
-			DateCreated: time.Now(),
-		}
-		query = db.Save(&updatePackage)
-		if query.Error != nil {
-			return err
-		}
+	updateURL, err := packager.options.Uploader.Upload(
+		destinationPath,
+		templateValues)
+	if err != nil {
+		return models.Ut4UpdatePackages{}, counts, err
+	}
+	if packager.signingKey != nil && signatureURL == "" {
+		// Served from the package dir next to the package
+		signatureURL = updateURL + signatureSuffix
+	}
+	err = packager.runPackageHooks(destinationPath, updateURL, templateValues)
+	if err != nil {
+		return models.Ut4UpdatePackages{}, counts, err
+	}
 
+	updatePackage := models.Ut4UpdatePackages{
+		FromVersion:      fromVersion,
+		ToVersion:        toVersion,
+		UpdateURL:        updateURL,
+		SignatureURL:     signatureURL,
+		Channel:          packager.releaseChannel(),
+		Size:             packageInfo.Size(),
+		Scope:            packager.packageScope(),
+		DeltaHash:        deltaHash,
+		DateCreated:      time.Now(),
+		UncompressedSize: staged.size,
 	}
-	// Clear out the working dir, it will be recreated on startup
-	os.RemoveAll(packager.workingDir)
-	return nil
+	if deltaHash != "" {
+		packager.sharedDeltas[deltaHash] = updatePackage
+	}
+	return updatePackage, counts, nil
+}
+
+// openDB opens a connection to the packager database using the
+// configured dialect
+func (packager *Packager) openDB() (*gorm.DB, error) {
+	return gorm.Open(packager.options.DatabaseDialect, packager.connectionString)
 }
 
 // generateUpgradePath generates and upgrade package from
-// fromVersion to toVersion and returns the path to the upgrade package
+// fromVersion to toVersion and returns the staged package, whose path is
+// the upgrade package, with the number of operations of each kind
 func (packager *Packager) generateUpgradePath(
 	fromVersion string,
-	toVersion string) (string, error) {
+	toVersion string) (stagedPackage, OperationCounts, error) {
+	staged, counts, err := packager.stageUpgradePath(fromVersion, toVersion)
+	if err != nil {
+		return staged, counts, err
+	}
+	err = packager.measureStaged(&staged)
+	if err != nil {
+		return staged, counts, err
+	}
+	// Create the compressed package file
+	archiver := packager.options.NewArchiver()
+	err = archiver.Create(staged.path)
+	if err != nil {
+		return staged, counts, err
+	}
+	err = packager.writePackageArchive(archiver, staged)
+	if err != nil {
+		return staged, counts, err
+	}
+	return staged, counts, nil
+}
+
+// stagedPackage is an upgrade package ready to be archived
+type stagedPackage struct {
+	// path is where the archive is written
+	path string
+	// dir holds the files of the package
+	dir string
+	// operationsPath is operations.json in dir, or next to path when it is
+	// placed first or as a sidecar
+	operationsPath string
+	// operationsName is the package entry of the operations, gzipped ones
+	// are operations.json.gz
+	operationsName string
+	// size is the uncompressed size of the package, 0 when not measured
+	size int64
+}
+
+// stageUpgradePath stages the files and operations of the upgrade package
+// from fromVersion to toVersion in the working dir
+func (packager *Packager) stageUpgradePath(
+	fromVersion string,
+	toVersion string) (stagedPackage, OperationCounts, error) {
 	log.WithFields(log.Fields{
 		"from": fromVersion,
 		"to":   toVersion,
 	}).Info("Generating upgrade path")
 	if fromVersion == toVersion {
-		return "", errors.New("fromVersion and toVersion can't be the same")
+		return stagedPackage{}, OperationCounts{},
+			errors.New("fromVersion and toVersion can't be the same")
+	}
+	err := packager.checkFromTree(fromVersion)
+	if err != nil {
+		return stagedPackage{}, OperationCounts{}, err
 	}
 
 	fromVersionHashes, err := packager.getVersionHashes(fromVersion)
 	if err != nil {
-		return "", err
+		return stagedPackage{}, OperationCounts{}, err
 	}
-	toVersionHashes, err := packager.getVersionHashes(toVersion)
-	if err != nil {
-		return "", err
+	// Only the hashes of added and modified files are used below, which
+	// is all a pipelined delta keeps
+	var deltaOperations map[string]DeltaOperation
+	var toVersionHashes map[string]string
+	if packager.canPipelineDelta(toVersion) {
+		deltaOperations, toVersionHashes, err = packager.pipelinedDelta(
+			fromVersionHashes,
+			toVersion)
+		if err != nil {
+			return stagedPackage{}, OperationCounts{}, err
+		}
+	} else {
+		toVersionHashes, err = packager.getVersionHashes(toVersion)
+		if err != nil {
+			return stagedPackage{}, OperationCounts{}, err
+		}
+		deltaOperations = packager.calculateHashDeltaOperations(
+			fromVersionHashes,
+			toVersionHashes)
 	}
-
-	deltaOperations := packager.calculateHashDeltaOperations(
+	err = packager.postProcessDelta(
+		fromVersion,
+		toVersion,
+		deltaOperations,
 		fromVersionHashes,
 		toVersionHashes)
+	if err != nil {
+		return stagedPackage{}, OperationCounts{}, err
+	}
+	_, err = packager.demoteNormalizedModified(deltaOperations, fromVersion, toVersion)
+	if err != nil {
+		return stagedPackage{}, OperationCounts{}, err
+	}
+	if len(deltaOperations) == 0 {
+		return stagedPackage{}, OperationCounts{}, ErrEmptyDelta
+	}
 
 	// For each file with the operation 'added' or 'modified' copy the file
 	// to the new path for packaging
 	// 'Removed' operations will be performed on the client using this delta file
 	workingPackagePath := filepath.Join(
 		packager.workingDir,
-		fmt.Sprintf("%s-package", toVersion))
+		fmt.Sprintf("%s-%s-package", fromVersion, toVersion))
+	// Start from an empty staging dir, a previous failed attempt may have
+	// left files behind. When resuming, the checkpoint tells us which of
+	// those files are complete
+	if !packager.options.ResumePackaging {
+		err = os.RemoveAll(workingPackagePath)
+		if err != nil {
+			return stagedPackage{}, OperationCounts{}, err
+		}
+	}
+	err = os.MkdirAll(workingPackagePath, 0755)
+	if err != nil {
+		return stagedPackage{}, OperationCounts{}, err
+	}
+	var checkpoint *packageCheckpoint
+	stagedFiles := make(map[string]bool)
+	if packager.options.ResumePackaging {
+		checkpoint, err = openPackageCheckpoint(workingPackagePath)
+		if err != nil {
+			return stagedPackage{}, OperationCounts{}, err
+		}
+	}
+	// When chunking, file content goes to the shared chunk store and the
+	// package only lists the chunks for each file
+	var chunkStore *ChunkStore
+	chunkManifest := make(map[string][]string)
+	var chunksStored int
+	// When storing files individually, the package only lists them
+	filesManifest := make(map[string]StoredFile)
+	storeFiles := packager.options.StorageMode == StorageFiles
+	if packager.options.ChunkFiles {
+		chunkStore, err = NewChunkStore(
+			filepath.Join(packager.packageDir, chunkDirName))
+		if err != nil {
+			return stagedPackage{}, OperationCounts{}, err
+		}
+	}
 	for filename, operation := range deltaOperations {
-		if operation == deltaOperationAdded || operation == deltaOperationModified {
-
-			// We need to check if this is a pak file, if it is, we need to diff
-			// and package it separately to not require a full pak download that
-			// consists of multiple GBs of data
-			if strings.ToLower(filepath.Ext(filename)) == "pak" &&
-				operation == deltaOperationModified {
-				log.WithField("pak", filename).Debug("Pak file modified")
+		if operation.Operation == deltaOperationAdded ||
+			operation.Operation == deltaOperationModified {
+
+			// Modified pak files are packaged in full until they can be
+			// diffed, clients can't apply a modified file without content
+			if isDirectoryEntry(filename) {
+				// Directories are only created, in the package as well so
+				// empty ones are part of it
+				if !storeFiles && chunkStore == nil {
+					err = os.MkdirAll(filepath.Join(workingPackagePath, filename), 0755)
+					if err != nil {
+						return stagedPackage{}, OperationCounts{}, err
+					}
+				}
 				continue
 			}
 			sourcePath := filepath.Join(packager.releaseDir, toVersion, filename)
+			if chunkStore != nil {
+				ids, stored, err := chunkStore.StoreFile(sourcePath)
+				if err != nil {
+					return stagedPackage{}, OperationCounts{}, err
+				}
+				chunkManifest[filename] = ids
+				chunksStored += stored
+				continue
+			}
+			if storeFiles {
+				storedFile, err := packager.storeCompressedFile(
+					toVersion,
+					filename,
+					toVersionHashes[filename])
+				if err != nil {
+					return stagedPackage{}, OperationCounts{}, err
+				}
+				filesManifest[filename] = storedFile
+				continue
+			}
+			stagedFiles[filename] = true
+			if checkpoint != nil &&
+				checkpoint.isStaged(filename, toVersionHashes[filename]) {
+				continue
+			}
 			destinationPath := filepath.Join(workingPackagePath, filename)
 			err = os.MkdirAll(filepath.Dir(destinationPath), 0755)
 			if err != nil {
-				return "", err
+				return stagedPackage{}, OperationCounts{}, err
 			}
-			err = CopyFile(sourcePath, destinationPath)
+			err = packager.stageFile(sourcePath, destinationPath)
 			if err != nil {
-				return "", err
+				return stagedPackage{}, OperationCounts{}, err
+			}
+			if checkpoint != nil {
+				err = checkpoint.markStaged(filename, toVersionHashes[filename])
+				if err != nil {
+					return stagedPackage{}, OperationCounts{}, err
+				}
 			}
 		}
 	}
-	// Write a copy of the delta operations to the package
-	deltaOperationsBytes, err := json.Marshal(&deltaOperations)
-	if err != nil {
+	if checkpoint != nil {
+		log.WithFields(log.Fields{
+			"files":   len(stagedFiles),
+			"resumed": len(checkpoint.staged),
+		}).Debug("Package staging complete")
+		err = checkpoint.finish(workingPackagePath, stagedFiles)
 		if err != nil {
-			return "", err
+			return stagedPackage{}, OperationCounts{}, err
 		}
 	}
-	err = ioutil.WriteFile(
-		filepath.Join(workingPackagePath, "operations.json"),
-		deltaOperationsBytes,
-		0644)
+	if chunkStore != nil {
+		chunkManifestBytes, err := json.Marshal(&chunkManifest)
+		if err != nil {
+			return stagedPackage{}, OperationCounts{}, err
+		}
+		err = ioutil.WriteFile(
+			filepath.Join(workingPackagePath, chunksFilename),
+			chunkManifestBytes,
+			0644)
+		if err != nil {
+			return stagedPackage{}, OperationCounts{}, err
+		}
+		log.WithFields(log.Fields{
+			"files":  len(chunkManifest),
+			"stored": chunksStored,
+		}).Info("Files chunked")
+	}
+	if storeFiles {
+		filesManifestBytes, err := json.Marshal(&filesManifest)
+		if err != nil {
+			return stagedPackage{}, OperationCounts{}, err
+		}
+		err = ioutil.WriteFile(
+			filepath.Join(workingPackagePath, filesFilename),
+			filesManifestBytes,
+			0644)
+		if err != nil {
+			return stagedPackage{}, OperationCounts{}, err
+		}
+		log.WithField("files", len(filesManifest)).Info("Files stored")
+	}
+	// Write a copy of the delta operations to the package, or next to it
+	// when it should be placed first or as a sidecar. Clients reject
+	// invalid operations so don't publish them
+	err = ValidateOperations(deltaOperations)
 	if err != nil {
-		return "", err
+		return stagedPackage{}, OperationCounts{}, err
+	}
+	err = packager.checkProtectedRemovals(deltaOperations, fromVersion, toVersion)
+	if err != nil {
+		return stagedPackage{}, OperationCounts{}, err
+	}
+	deltaOperationsBytes, operationsName, err := encodeOperations(
+		deltaOperations,
+		packager.options.CompressOperations)
+	if err != nil {
+		return stagedPackage{}, OperationCounts{}, err
 	}
-
-	// Create the compressed package file
-	// I'm using archivex since it already does recursive compression of a
-	// directory...because I'm lazy
 	compressedPath := filepath.Join(
 		packager.workingDir, fmt.Sprintf("%s-%s.tar.gz", fromVersion, toVersion))
-	tar := new(archivex.TarFile)
-	err = tar.Create(compressedPath)
-	if err != nil {
-		return "", err
+	operationsPath := filepath.Join(workingPackagePath, operationsName)
+	if packager.options.OperationsPlacement != OperationsInPayload {
+		operationsPath = compressedPath + operationsSidecarSuffix
+	} else {
+		// A resumed staging dir may hold the operations in the other form
+		for _, name := range []string{operationsFilename, compressedOperationsFilename} {
+			if name != operationsName {
+				os.Remove(filepath.Join(workingPackagePath, name))
+			}
+		}
 	}
-	err = tar.AddAll(workingPackagePath, false)
+	err = ioutil.WriteFile(operationsPath, deltaOperationsBytes, 0644)
 	if err != nil {
-		return "", err
+		return stagedPackage{}, OperationCounts{}, err
+	}
+
+	staged := stagedPackage{
+		path:           compressedPath,
+		dir:            workingPackagePath,
+		operationsPath: operationsPath,
+		operationsName: operationsName,
 	}
-	tar.Close()
+	return staged, countOperations(deltaOperations), nil
+}
 
-	return compressedPath, nil
+// writePackageArchive writes staged to archiver, which was created
+// already, and closes it
+func (packager *Packager) writePackageArchive(
+	archiver Archiver,
+	staged stagedPackage) error {
+	if packager.options.OperationsPlacement == OperationsFirst {
+		err := archiver.AddFile(staged.operationsName, staged.operationsPath)
+		if err != nil {
+			archiver.Close()
+			return err
+		}
+		err = os.Remove(staged.operationsPath)
+		if err != nil {
+			archiver.Close()
+			return err
+		}
+	}
+	err := archiver.AddDir(staged.dir)
+	if err != nil {
+		archiver.Close()
+		return err
+	}
+	return archiver.Close()
 }
 
-// fetchFeed fetches the content from the release feed
+// fetchFeed fetches the content from the release feed. When the feed cache
+// is enabled, a recent cached copy is used if the fetch fails
 func (packager *Packager) fetchFeed() (*gofeed.Feed, error) {
 	log.WithField("release_feed", packager.releaseFeedURL).Info("Fetching feed")
 	parser := gofeed.NewParser()
+	parser.Client = packager.httpClient
 	feed, err := parser.ParseURL(packager.releaseFeedURL)
 	if err != nil {
+		if packager.options.FeedCacheMaxAge > 0 {
+			return packager.readFeedCache(err)
+		}
 		return nil, err
 	}
+	if packager.options.FeedCacheMaxAge > 0 {
+		err = packager.writeFeedCache(feed)
+		if err != nil {
+			// The cache is only a fallback, the run can continue
+			log.WithField("err", "write_feed_cache").Warning(err.Error())
+		}
+	}
 	return feed, nil
 }
 
@@ -412,62 +1410,103 @@ func (packager *Packager) extractReleasePosts(
 	var items []*gofeed.Item
 	for _, item := range feed.Items {
 		// The release blog posts usually contain the word release in the title
-		if strings.Contains(strings.ToLower(item.Title), "release") {
-			items = append(items, item)
+		if !strings.Contains(strings.ToLower(item.Title), "release") {
+			continue
+		}
+		if packager.options.RequireValidDate && postDate(item) == nil {
+			log.WithFields(log.Fields{
+				"title": item.Title,
+				"guid":  postKey(item),
+			}).Warning("Skipping release post without a valid date")
+			continue
 		}
+		items = append(items, item)
 	}
 	return items, nil
 }
 
-// extractUpdateDownloadLinkFromPost extracts the Linux client download
-// link from the post content
+// extractUpdateDownloadLinkFromPost extracts the Linux download link of
+// the configured artifact, the client by default, from the post content
 func (packager *Packager) extractUpdateDownloadLinkFromPost(
 	releasePost *gofeed.Item) (string, error) {
+	if link := packager.structuredDownloadLink(releasePost); link != "" {
+		return link, nil
+	}
 	// First get the actual content
+	post := postContent(releasePost)
+	if post == "" {
+		return "", errors.New("Post content is empty")
+	}
 	var downloadLink string
-	if content, ok := releasePost.Extensions["content"]; ok {
-		if encoded, ok := content["encoded"]; ok {
-			if len(encoded) == 0 {
-				return "", errors.New("Encoded content is empty")
-			}
-			post := encoded[0].Value
-			links := xurls.Relaxed.FindAllString(post, -1)
-			// Then find the 'client-xan' links
-			for _, link := range links {
-				originalLink := link
-				link = strings.ToLower(link)
-				if strings.Contains(link, "client-xan") &&
-					strings.Contains(link, "linux") {
-					downloadLink = originalLink
-				}
-			}
+	links := xurls.Relaxed.FindAllString(post, -1)
+	// Then find the Linux links of the wanted artifact, posts also link
+	// the server, editor and symbols
+	for _, link := range links {
+		if strings.Contains(strings.ToLower(link), "linux") &&
+			packager.classifyLink(link) == packager.options.DownloadArtifact {
+			downloadLink = link
 		}
 	}
 	if downloadLink == "" {
-		return "", errors.New("No valid download link found")
+		return "", fmt.Errorf("No valid %s download link found",
+			packager.options.DownloadArtifact)
 	}
 	return downloadLink, nil
 }
 
-// getDownloadSize returns the size in bytes for the requested download URL
+// postContent returns the content of a post regardless of the feed type.
+// gofeed normalises RSS content:encoded and Atom content (and JSON Feed
+// content_html in newer versions) into Content. The raw content:encoded
+// extension and the description are used when Content is empty
+func postContent(releasePost *gofeed.Item) string {
+	if releasePost.Content != "" {
+		return releasePost.Content
+	}
+	if content, ok := releasePost.Extensions["content"]; ok {
+		if encoded, ok := content["encoded"]; ok && len(encoded) > 0 {
+			if encoded[0].Value != "" {
+				return encoded[0].Value
+			}
+		}
+	}
+	return releasePost.Description
+}
+
+// UnknownDownloadSize is the download size when the server doesn't report
+// it, the download is then only verified after downloading
+const UnknownDownloadSize float64 = -1
+
+// getDownloadSize returns the size in bytes for the requested download URL,
+// or UnknownDownloadSize when the server doesn't send a usable
+// Content-Length, e.g. with chunked transfers
 func (packager *Packager) getDownloadSize(url string) (float64, error) {
 	// HTTP head requests should return the content-length
-	resp, err := http.Head(url)
+	resp, err := packager.httpClient.Head(url)
 	if err != nil {
 		return 0, err
 	}
+	resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		// Possibly invalid URL, not found, doesn't support head
 		return 0, fmt.Errorf(
 			"Non-200 status code returned for download URL: %d", resp.StatusCode)
 	}
-	size, err := strconv.Atoi(resp.Header.Get("Content-Length"))
-	if err != nil {
-		return 0, err
+	size, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	if err != nil || size < 0 {
+		log.WithField("url", url).Warning("Download size is unknown")
+		return UnknownDownloadSize, nil
 	}
 	return float64(size), nil
 }
 
+// formatDownloadSize formats size in MB for logging
+func formatDownloadSize(size float64) string {
+	if size == UnknownDownloadSize {
+		return "unknown"
+	}
+	return fmt.Sprintf("%.2fMB", size/1024.00/1024.00)
+}
+
 // downloadFile downloads the file from downloadLink to outputPath
 func (packager *Packager) downloadFile(
 	outputPath string, downloadLink string) (err error) {
@@ -481,8 +1520,7 @@ func (packager *Packager) downloadFile(
 	}
 	defer output.Close()
 
-	resp, err := http.Get(downloadLink)
-	fmt.Println(downloadLink)
+	resp, err := packager.httpClient.Get(downloadLink)
 	if err != nil {
 		return err
 	}
@@ -492,105 +1530,174 @@ func (packager *Packager) downloadFile(
 			"DownloadURL returned %s",
 			resp.Status)
 	}
-	_, err = io.Copy(output, resp.Body)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-// extract extracts the ZIP file to extractPath
-func (packager *Packager) extract(extractPath string, zipPath string) error {
-	err := os.MkdirAll(extractPath, 0744)
-	if err != nil {
-		return err
-	}
-	zipReader, err := zip.OpenReader(zipPath)
+	worker := "download " + filepath.Base(outputPath)
+	packager.progress.Update(worker, 0, resp.ContentLength)
+	_, err = io.Copy(
+		io.MultiWriter(output, progressWriter{packager.progress, worker}),
+		resp.Body)
 	if err != nil {
 		return err
 	}
-	defer zipReader.Close()
-
-	for _, zipFile := range zipReader.File {
-		zipFileReader, err := zipFile.Open()
-		if err != nil {
-			return err
-		}
-		defer zipFileReader.Close()
-		outputPath := filepath.Join(extractPath, zipFile.Name)
-		if zipFile.FileInfo().IsDir() {
-			os.MkdirAll(outputPath, zipFile.Mode())
-			continue
-		}
-		// Create the directory when no separate directory entry exists
-		os.MkdirAll(filepath.Dir(outputPath), zipFile.Mode())
-		outputFile, err := os.OpenFile(
-			outputPath,
-			os.O_WRONLY|os.O_CREATE|os.O_TRUNC,
-			zipFile.Mode())
+	// A connection that is closed cleanly mid-transfer leaves a truncated
+	// file, compare what was written with what the server advertised
+	if resp.ContentLength >= 0 {
+		outputInfo, err := output.Stat()
 		if err != nil {
 			return err
 		}
-		defer outputFile.Close()
-		_, err = io.Copy(outputFile, zipFileReader)
-		if err != nil {
-			return err
+		if outputInfo.Size() != resp.ContentLength {
+			return fmt.Errorf(
+				"Downloaded %d bytes but expected %d bytes",
+				outputInfo.Size(),
+				resp.ContentLength)
 		}
 	}
 	return nil
 }
 
-// getReleaseNumber extracts the release version from an UT4 install path
+// getReleaseNumber extracts the release version from an UT4 install path.
+// The .modules file is used, when it is missing the version is taken from
+// the top level directory names as a last resort
 func (packager *Packager) getReleaseNumber(installPath string) (string, error) {
-	moduleFile, err := os.Open(
-		filepath.Join(installPath,
-			"LinuxNoEditor/UnrealTournament/Binaries/Linux",
-			"UE4-Linux-Shippingx86_64-unknown-linux-gnu.modules"))
+	module, err := readModules(installPath)
+	if os.IsNotExist(err) {
+		version, dirErr := versionFromTopDirs(installPath)
+		if dirErr != nil {
+			return "", fmt.Errorf("%s, %s", err.Error(), dirErr.Error())
+		}
+		log.WithFields(log.Fields{
+			"version": version,
+			"source":  "top_level_directory",
+		}).Warning("No modules file, using the version from the directory name")
+		return version, nil
+	}
 	if err != nil {
 		return "", err
 	}
-	defer moduleFile.Close()
+	// A missing changelist decodes as 0 which would create a bogus
+	// version directory
+	if module.Changelist <= 0 {
+		return "", fmt.Errorf(
+			"Modules file has a missing or invalid Changelist: %d",
+			module.Changelist)
+	}
+	log.WithFields(log.Fields{
+		"version": module.Changelist,
+		"source":  "modules",
+	}).Debug("Release version read")
+	return strconv.Itoa(module.Changelist), nil
+}
 
+// readModules reads the .modules file from an UT4 install path
+func readModules(installPath string) (UT4Modules, error) {
 	var module UT4Modules
+	moduleFile, err := os.Open(
+		filepath.Join(installPath, modulesBinaryDir, modulesFilename))
+	if err != nil {
+		return module, err
+	}
+	defer moduleFile.Close()
+
 	err = json.NewDecoder(moduleFile).Decode(&module)
 	if err != nil {
-		return "", err
+		return module, err
 	}
-	return strconv.Itoa(module.Changelist), nil
+	return module, nil
 }
 
-// getVersionHashes gets the version's hashes or generates them if
-// they don't exist
+// verifyModuleBinaries checks that every binary listed in the .modules
+// file exists, which catches truncated or incomplete downloads. Releases
+// without a .modules file pass
+func verifyModuleBinaries(installPath string) error {
+	module, err := readModules(installPath)
+	if os.IsNotExist(err) {
+		// Releases versioned by their directory name have nothing to check
+		log.WithField("path", installPath).Warning(
+			"No modules file, can't check the module binaries")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for name, filename := range module.Modules {
+		binaryPath := filepath.Join(installPath, modulesBinaryDir, filename)
+		if _, err := os.Stat(binaryPath); err != nil {
+			missing = append(missing, fmt.Sprintf("%s (%s)", filename, name))
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("Release is missing %d module binaries: %s",
+			len(missing),
+			strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// getVersionHashes gets the version's hashes from the configured
+// HashProvider, by default from the hash cache on disk. Hashes read from
+// disk are kept in memory when the memory cache is enabled
 func (packager *Packager) getVersionHashes(
 	version string) (map[string]string, error) {
-	hashes := make(map[string]string)
+	if version == "" {
+		// Full install packages start from nothing
+		return make(map[string]string), nil
+	}
+	if packager.options.HashProvider != nil {
+		return packager.options.HashProvider.VersionHashes(version)
+	}
+	if packager.hashLRU == nil {
+		return packager.diskVersionHashes(version)
+	}
+	if hashes, ok := packager.hashLRU.get(version); ok {
+		return hashes, nil
+	}
+	hashes, err := packager.diskVersionHashes(version)
+	if err != nil {
+		return hashes, err
+	}
+	packager.hashLRU.put(version, hashes)
+	return hashes, nil
+}
 
+// diskVersionHashes gets the version's hashes or generates them if
+// they don't exist
+func (packager *Packager) diskVersionHashes(
+	version string) (map[string]string, error) {
 	versionPath := filepath.Join(packager.releaseDir, version)
-	versionHashPath := filepath.Join(
-		packager.releaseDir,
-		fmt.Sprintf("%s.hashes", version))
-	hashFile, err := ioutil.ReadFile(versionHashPath)
+	hashes, err := packager.readHashCache(version)
 	if err != nil {
 		log.WithField("version", version).Debug("No hash file exist, generate")
 		// Hash file doesn't exist or we couldn't read it
+		generateStart := time.Now()
 		hashes, err = packager.generateHashes(versionPath)
 		if err != nil {
 			return hashes, err
 		}
-		// Save the cached copy
-		var hashJSON []byte
-		hashJSON, err = json.Marshal(&hashes)
+		packager.recordHashCacheMiss(version, time.Since(generateStart))
+		if packager.options.StoreFileHashes {
+			err = packager.storeFileHashes(version, hashes)
+			if err != nil {
+				return hashes, err
+			}
+			packager.fileHashVersions[version] = true
+		}
+		// Save the cached copy. Ignore the error here, if it fails we'll
+		// just try next time
+		err = packager.writeHashCache(version, hashes)
 		if err != nil {
-			// Don't worry about the error here, just return the hashes then
-			return hashes, nil
+			log.WithField("err", "write_hash_cache").Warning(err.Error())
 		}
-		// Ignore the error here, if it fails we'll just try next time
-		_ = ioutil.WriteFile(versionHashPath, hashJSON, 0644)
 		return hashes, nil
 	}
-	err = json.Unmarshal(hashFile, &hashes)
-	if err != nil {
-		return hashes, err
+	packager.recordHashCacheHit(version)
+	if packager.options.StoreFileHashes {
+		// Versions hashed before the option was enabled only have the cache
+		err = packager.ensureFileHashes(version, hashes)
+		if err != nil {
+			return hashes, err
+		}
 	}
 	return hashes, nil
 }
@@ -599,77 +1706,190 @@ func (packager *Packager) getVersionHashes(
 // files in the given searchPath
 func (packager *Packager) generateHashes(
 	searchPath string) (map[string]string, error) {
-
 	hashes := make(map[string]string)
+	err := packager.streamHashes(searchPath, func(path string, hash string) error {
+		hashes[path] = hash
+		return nil
+	})
+	return hashes, err
+}
+
+// streamHashes generates the SHA256 hash of every file in searchPath and
+// passes each to emit as soon as it is known, without keeping them
+func (packager *Packager) streamHashes(
+	searchPath string,
+	emit func(path string, hash string) error) error {
+
 	var fileList []string
+	var paths []string
+	var totalSize int64
 	err := filepath.Walk(
 		searchPath,
 		func(path string, fileInfo os.FileInfo, err error) error {
 			if fileInfo.IsDir() == false {
 				fileList = append(fileList, path)
+				totalSize += fileInfo.Size()
+			} else if packager.options.HashDirectories && path != searchPath {
+				usePath := strings.Replace(path, searchPath+"/", "", -1) + "/"
+				if !matchAnyPath(packager.options.IgnorePatterns, usePath) {
+					paths = append(paths, usePath)
+					return emit(usePath, directoryHash)
+				}
 			}
 			return nil
 		})
 	if err != nil {
-		return hashes, err
+		return err
 	}
+	worker := "hash " + searchPath
+	packager.progress.Update(worker, 0, totalSize)
 
 	// Queue jobs!
 	for _, filepath := range fileList {
 		fileInfo, err := os.Stat(filepath)
 		if err != nil {
-			return hashes, err
+			return err
 		}
 		usePath := strings.Replace(filepath, searchPath+"/", "", -1)
+		if matchAnyPath(packager.options.IgnorePatterns, usePath) {
+			continue
+		}
+		paths = append(paths, usePath)
 		if fileInfo.Size() == 0 {
 			// HACK: return this hash for a zero-byte file, writer won't write any
 			// bytes, no hash generated. Fix sometime.
-			hashes[usePath] = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+			err = emit(usePath, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855")
+			if err != nil {
+				return err
+			}
 			continue
 		}
 		file, err := os.Open(filepath)
 		if err != nil {
-			return hashes, err
+			return err
+		}
+		var reader io.Reader = file
+		if packager.options.NormalizationMode == NormalizeHashes {
+			if rule := packager.normalizationFor(usePath); rule != nil {
+				reader = &zeroRangesReader{reader: file, ranges: rule.Ranges}
+			}
 		}
-		defer file.Close()
 		// Set up an internal hash progress tracker
 		hasher := sha256.New()
-		_, err = io.Copy(hasher, file)
+		_, err = io.Copy(
+			io.MultiWriter(hasher, progressWriter{packager.progress, worker}),
+			reader)
+		file.Close()
 		if err != nil {
-			return hashes, err
+			return err
+		}
+		err = emit(usePath, fmt.Sprintf("%x", hasher.Sum(nil)))
+		if err != nil {
+			return err
 		}
-		hashes[usePath] = fmt.Sprintf("%x", hasher.Sum(nil))
 	}
-	return hashes, nil
+	// Ignored and empty files were never read
+	packager.progress.Update(worker, totalSize, totalSize)
+	return packager.checkCaseCollisions(searchPath, paths)
 }
 
-// calculateHashDeltaOperations calculates the operations to be performed
-// between two versions
+// calculateHashDeltaOperations calculates the added, modified and removed
+// operations between two versions, moves are detected by the delta post
+// processors
 func (packager *Packager) calculateHashDeltaOperations(
 	fromVersionHashes map[string]string,
-	toVersionHashes map[string]string) map[string]string {
-
-	// This will determine what needs to be done to current
-	// Modified, Removed will be done first,
-	// Added in pass 2
-	delta := make(map[string]string)
-	for file, hash := range fromVersionHashes {
-		if nextHash, ok := toVersionHashes[file]; ok {
-			if nextHash != hash {
-				// File has been modified
-				delta[file] = deltaOperationModified
-			}
-		} else {
-			// File has been removed
-			delta[file] = deltaOperationRemoved
+	toVersionHashes map[string]string) map[string]DeltaOperation {
+	builder := packager.newDeltaBuilder(fromVersionHashes)
+	for file, hash := range toVersionHashes {
+		builder.add(file, hash)
+	}
+	return builder.finish()
+}
+
+// detectMovedFiles replaces added and removed pairs with identical content
+// by a single moved operation so the client can rename the file locally
+// instead of downloading it again
+func detectMovedFiles(
+	delta map[string]DeltaOperation,
+	fromVersionHashes map[string]string,
+	toVersionHashes map[string]string) {
+
+	removedByHash := make(map[string][]string)
+	var added []string
+	for file, operation := range delta {
+		// All directories share the same marker hash so they can't be
+		// matched up as moves
+		if isDirectoryEntry(file) {
+			continue
+		}
+		switch operation.Operation {
+		case deltaOperationRemoved:
+			hash := fromVersionHashes[file]
+			removedByHash[hash] = append(removedByHash[hash], file)
+		case deltaOperationAdded:
+			added = append(added, file)
+		}
+	}
+	// Sort so that pairing is the same on every run
+	sort.Strings(added)
+	for _, files := range removedByHash {
+		sort.Strings(files)
+	}
+	for _, file := range added {
+		hash := toVersionHashes[file]
+		candidates := removedByHash[hash]
+		if len(candidates) == 0 {
+			continue
 		}
+		source := candidates[0]
+		removedByHash[hash] = candidates[1:]
+		delete(delta, source)
+		delta[file] = DeltaOperation{
+			Operation: deltaOperationMoved,
+			Source:    source,
+		}
+	}
+}
+
+// stageFile places a release file in the package staging dir. Files are
+// hardlinked when enabled, falling back to a copy when the dirs are on
+// different filesystems
+func (packager *Packager) stageFile(sourcePath string, destinationPath string) error {
+	return linkOrCopyFile(sourcePath, destinationPath, packager.options.HardlinkFiles)
+}
+
+// linkOrCopyFile places the file at sourcePath at destinationPath, as a
+// hardlink when hardlink is set and the paths share a filesystem. A file
+// already at destinationPath is removed first, it may be a hardlink kept
+// from an earlier run and copying onto it would overwrite the source
+func linkOrCopyFile(sourcePath string, destinationPath string, hardlink bool) error {
+	err := os.Remove(destinationPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
 	}
-	for file := range toVersionHashes {
-		if _, ok := fromVersionHashes[file]; !ok {
-			delta[file] = deltaOperationAdded
+	if hardlink {
+		err = os.Link(sourcePath, destinationPath)
+		if err == nil {
+			return nil
 		}
+		log.WithField("path", sourcePath).Debug("Hardlink failed, copying")
+	}
+	return CopyFile(sourcePath, destinationPath)
+}
+
+// hashFile returns the SHA256 hash of the file at path
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hasher := sha256.New()
+	_, err = io.Copy(hasher, file)
+	if err != nil {
+		return "", err
 	}
-	return delta
+	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
 }
 
 // CopyFile copies a file from source to destination and preserves permissions
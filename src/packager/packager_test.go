@@ -0,0 +1,508 @@
+package packager
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// tempDir creates a temporary dir that is removed when the test finishes
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "packager-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+	return dir
+}
+
+// writeTree writes files, keyed by their slash separated path, under dir
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		filePath := filepath.Join(dir, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(filePath), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(filePath, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// releaseFiles returns files with the .modules file and module binary of
+// an UT4 install with changelist added
+func releaseFiles(changelist int, files map[string]string) map[string]string {
+	modules, _ := json.Marshal(UT4Modules{
+		Changelist: changelist,
+		Modules:    map[string]string{"UnrealTournament": "libUE4-UnrealTournament.so"},
+	})
+	release := map[string]string{
+		path.Join(modulesBinaryDir, modulesFilename):              string(modules),
+		path.Join(modulesBinaryDir, "libUE4-UnrealTournament.so"): "binary",
+	}
+	for name, content := range files {
+		release[name] = content
+	}
+	return release
+}
+
+// zipFiles returns a zip holding files
+func zipFiles(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	for name, content := range files {
+		entry, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = entry.Write([]byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+// readPackage returns the regular files of the tar.gz package at
+// packagePath by name
+func readPackage(t *testing.T, packagePath string) map[string]string {
+	t.Helper()
+	file, err := os.Open(packagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		content, err := ioutil.ReadAll(tarReader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[path.Clean(header.Name)] = string(content)
+	}
+}
+
+// testPost is a release post served by the fixture feed
+type testPost struct {
+	Title      string
+	GUID       string
+	Content    string
+	Date       time.Time
+	Link       string
+	Categories []string
+}
+
+// fixture is a fake release environment: an HTTP server with the release
+// feed and downloads, a sqlite database and the packager dirs
+type fixture struct {
+	t          *testing.T
+	dir        string
+	workingDir string
+	releaseDir string
+	packageDir string
+	dbPath     string
+	server     *httptest.Server
+	lock       sync.Mutex
+	posts      []testPost
+	downloads  map[string][]byte
+}
+
+// newFixture creates an empty fixture that is removed when the test
+// finishes
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	dir := tempDir(t)
+	fixture := &fixture{
+		t:          t,
+		dir:        dir,
+		workingDir: filepath.Join(dir, "working"),
+		releaseDir: filepath.Join(dir, "releases"),
+		packageDir: filepath.Join(dir, "packages"),
+		dbPath:     filepath.Join(dir, "packager.db"),
+		downloads:  make(map[string][]byte),
+	}
+	fixture.server = httptest.NewServer(http.HandlerFunc(fixture.serve))
+	t.Cleanup(fixture.server.Close)
+	return fixture
+}
+
+// serve serves the feed at /feed.xml and the downloads by name
+func (fixture *fixture) serve(w http.ResponseWriter, r *http.Request) {
+	fixture.lock.Lock()
+	defer fixture.lock.Unlock()
+	if r.URL.Path == "/feed.xml" {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		io.WriteString(w, fixture.feed())
+		return
+	}
+	content, ok := fixture.downloads[strings.TrimPrefix(r.URL.Path, "/")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	http.ServeContent(w, r, r.URL.Path, time.Time{}, bytes.NewReader(content))
+}
+
+// feed renders the posts as RSS, posts with a zero date have no pubDate.
+// Requires the lock to be held
+func (fixture *fixture) feed() string {
+	var items bytes.Buffer
+	for _, post := range fixture.posts {
+		guid := ""
+		if post.GUID != "" {
+			guid = "<guid>" + post.GUID + "</guid>"
+		}
+		pubDate := ""
+		if !post.Date.IsZero() {
+			pubDate = "<pubDate>" + post.Date.Format(time.RFC1123Z) + "</pubDate>"
+		}
+		metadata := ""
+		if post.Link != "" {
+			metadata = "<link>" + post.Link + "</link>"
+		}
+		for _, category := range post.Categories {
+			metadata += "<category>" + category + "</category>"
+		}
+		fmt.Fprintf(&items,
+			"<item><title>%s</title>%s%s%s"+
+				"<description><![CDATA[%s]]></description></item>",
+			post.Title, guid, pubDate, metadata, post.Content)
+	}
+	return `<?xml version="1.0" encoding="UTF-8"?>` +
+		`<rss version="2.0"><channel><title>Unreal Tournament</title>` +
+		items.String() + `</channel></rss>`
+}
+
+// feedURL is the URL of the fixture feed
+func (fixture *fixture) feedURL() string {
+	return fixture.server.URL + "/feed.xml"
+}
+
+// serveRelease serves a release zip with changelist and files and
+// returns its download URL
+func (fixture *fixture) serveRelease(changelist int, files map[string]string) string {
+	name := fmt.Sprintf("UnrealTournament-Client-XAN-%d-Linux.zip", changelist)
+	content := zipFiles(fixture.t, releaseFiles(changelist, files))
+	fixture.lock.Lock()
+	defer fixture.lock.Unlock()
+	fixture.downloads[name] = content
+	return fixture.server.URL + "/" + name
+}
+
+// addPost publishes a release post linking downloadURL
+func (fixture *fixture) addPost(title string, guid string, downloadURL string, date time.Time) {
+	fixture.lock.Lock()
+	defer fixture.lock.Unlock()
+	fixture.posts = append(fixture.posts, testPost{
+		Title:   title,
+		GUID:    guid,
+		Content: fmt.Sprintf(`<a href="%s">Linux client</a>`, downloadURL),
+		Date:    date,
+	})
+}
+
+// installVersion places an installed release with changelist and files in
+// the release dir
+func (fixture *fixture) installVersion(changelist int, files map[string]string) {
+	writeTree(fixture.t,
+		filepath.Join(fixture.releaseDir, fmt.Sprint(changelist)),
+		releaseFiles(changelist, files))
+}
+
+// newPackager creates a Packager on the fixture with a migrated sqlite
+// database, options only needs the settings under test
+func (fixture *fixture) newPackager(options Options) *Packager {
+	fixture.t.Helper()
+	options.DatabaseDialect = DialectSQLite
+	packager, err := New(
+		fixture.feedURL(),
+		fixture.dbPath,
+		fixture.workingDir,
+		fixture.releaseDir,
+		fixture.packageDir,
+		options)
+	if err != nil {
+		fixture.t.Fatal(err)
+	}
+	err = packager.Migrate()
+	if err != nil {
+		fixture.t.Fatal(err)
+	}
+	return packager
+}
+
+// db opens the fixture database, it is closed when the test finishes
+func (fixture *fixture) db() *gorm.DB {
+	fixture.t.Helper()
+	db, err := gorm.Open(DialectSQLite, fixture.dbPath)
+	if err != nil {
+		fixture.t.Fatal(err)
+	}
+	fixture.t.Cleanup(func() {
+		db.Close()
+	})
+	return db
+}
+
+// newTestPackager creates a Packager on an empty fixture
+func newTestPackager(t *testing.T, options Options) *Packager {
+	t.Helper()
+	return newFixture(t).newPackager(options)
+}
+
+// installTestVersion places an installed release with changelist and files
+// in the release dir of packager
+func installTestVersion(t *testing.T, packager *Packager, changelist int, files map[string]string) {
+	t.Helper()
+	writeTree(t,
+		filepath.Join(packager.releaseDir, fmt.Sprint(changelist)),
+		releaseFiles(changelist, files))
+}
+
+func TestRenamedFileIsMoved(t *testing.T) {
+	packager := newTestPackager(t, Options{})
+	fromHashes := map[string]string{
+		"Content/Old.pak":  "same",
+		"Content/Kept.ini": "kept",
+	}
+	toHashes := map[string]string{
+		"Content/Paks/New.pak": "same",
+		"Content/Kept.ini":     "kept",
+	}
+	operations := packager.calculateHashDeltaOperations(fromHashes, toHashes)
+	err := packager.postProcessDelta("1", "2", operations, fromHashes, toHashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]DeltaOperation{
+		"Content/Paks/New.pak": {Operation: deltaOperationMoved, Source: "Content/Old.pak"},
+	}
+	if !reflect.DeepEqual(operations, expected) {
+		t.Errorf("Operations are %v, expected %v", operations, expected)
+	}
+}
+
+func TestRenamedAndChangedFileIsNotMoved(t *testing.T) {
+	packager := newTestPackager(t, Options{})
+	fromHashes := map[string]string{"Content/Old.pak": "old"}
+	toHashes := map[string]string{"Content/New.pak": "new"}
+	operations := packager.calculateHashDeltaOperations(fromHashes, toHashes)
+	err := packager.postProcessDelta("1", "2", operations, fromHashes, toHashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]DeltaOperation{
+		"Content/Old.pak": {Operation: deltaOperationRemoved},
+		"Content/New.pak": {Operation: deltaOperationAdded},
+	}
+	if !reflect.DeepEqual(operations, expected) {
+		t.Errorf("Operations are %v, expected %v", operations, expected)
+	}
+}
+
+func TestPackagedMoveHasNoContent(t *testing.T) {
+	packager := newTestPackager(t, Options{})
+	installTestVersion(t, packager, 1000001, map[string]string{
+		"UnrealTournament/Content/Old.txt": "renamed",
+	})
+	installTestVersion(t, packager, 1000002, map[string]string{
+		"UnrealTournament/Content/New.txt": "renamed",
+	})
+	staged, counts, err := packager.generateUpgradePath("1000001", "1000002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts.Moved != 1 || counts.Added != 0 || counts.Removed != 0 {
+		t.Errorf("Operation counts are %+v", counts)
+	}
+	files := readPackage(t, staged.path)
+	if _, ok := files["UnrealTournament/Content/New.txt"]; ok {
+		t.Error("Moved file content is in the package")
+	}
+	operations, err := ReadPackageOperations(staged.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	move := operations["UnrealTournament/Content/New.txt"]
+	if move.Operation != deltaOperationMoved ||
+		move.Source != "UnrealTournament/Content/Old.txt" {
+		t.Errorf("Move operation is %+v", move)
+	}
+}
+
+func TestGetReleaseNumber(t *testing.T) {
+	packager := newTestPackager(t, Options{})
+	tests := []struct {
+		modules string
+		version string
+	}{
+		{`{"Changelist": 3525360, "BuildId": "abc"}`, "3525360"},
+		{`{"BuildId": "abc", "Modules": {}}`, ""},
+		{`{"Changelist": 0}`, ""},
+		{`{"Changelist": -1}`, ""},
+		{`{"Changelist": "3525360"}`, ""},
+		{`not json`, ""},
+	}
+	for _, test := range tests {
+		dir := tempDir(t)
+		writeTree(t, dir, map[string]string{
+			path.Join(modulesBinaryDir, modulesFilename): test.modules,
+		})
+		version, err := packager.getReleaseNumber(dir)
+		if test.version == "" {
+			if err == nil {
+				t.Errorf("Modules %s gave version %q, expected an error",
+					test.modules, version)
+			}
+			continue
+		}
+		if err != nil || version != test.version {
+			t.Errorf("Modules %s gave version %q (%v), expected %q",
+				test.modules, version, err, test.version)
+		}
+	}
+}
+
+func TestModifiedPakIsPackagedInFull(t *testing.T) {
+	packager := newTestPackager(t, Options{})
+	installTestVersion(t, packager, 3395761, map[string]string{
+		"UnrealTournament/Content/Paks/game.pak": "old pak",
+	})
+	installTestVersion(t, packager, 3525360, map[string]string{
+		"UnrealTournament/Content/Paks/game.pak": "new pak",
+	})
+	_, err := packager.GeneratePackage("3395761", "3525360")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := readPackage(t, filepath.Join(packager.packageDir, "3395761-3525360.tar.gz"))
+	if files["UnrealTournament/Content/Paks/game.pak"] != "new pak" {
+		t.Errorf("Modified pak in package is %q",
+			files["UnrealTournament/Content/Paks/game.pak"])
+	}
+}
+
+func TestVerifyModuleBinaries(t *testing.T) {
+	dir := tempDir(t)
+	writeTree(t, dir, releaseFiles(3525360, nil))
+	err := verifyModuleBinaries(dir)
+	if err != nil {
+		t.Errorf("Complete release failed: %s", err)
+	}
+
+	modules, _ := json.Marshal(UT4Modules{
+		Changelist: 3525360,
+		Modules: map[string]string{
+			"UnrealTournament": "libUE4-UnrealTournament.so",
+			"Engine":           "libUE4-Engine.so",
+			"Core":             "libUE4-Core.so",
+		},
+	})
+	writeTree(t, dir, map[string]string{
+		path.Join(modulesBinaryDir, modulesFilename): string(modules),
+	})
+	err = verifyModuleBinaries(dir)
+	if err == nil {
+		t.Fatal("Release with missing binaries passed")
+	}
+	expected := "Release is missing 2 module binaries: " +
+		"libUE4-Core.so (Core), libUE4-Engine.so (Engine)"
+	if err.Error() != expected {
+		t.Errorf("Error is %q, expected %q", err.Error(), expected)
+	}
+
+	// Releases without a modules file have nothing to check
+	err = verifyModuleBinaries(tempDir(t))
+	if err != nil {
+		t.Errorf("Release without a modules file failed: %s", err)
+	}
+}
+
+func TestDownloadFileDetectsTruncation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			// Advertise more than is sent and close the connection cleanly
+			conn, buffer, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer conn.Close()
+			buffer.WriteString("HTTP/1.1 200 OK\r\n" +
+				"Content-Length: 100\r\n" +
+				"Content-Type: application/zip\r\n\r\n" +
+				"only part")
+			buffer.Flush()
+		}))
+	defer server.Close()
+	packager := newTestPackager(t, Options{})
+
+	err := packager.downloadFile(
+		filepath.Join(tempDir(t), "release.zip"),
+		server.URL+"/release.zip")
+	if err == nil {
+		t.Fatal("Truncated download succeeded")
+	}
+
+	server = httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "complete")
+		}))
+	defer server.Close()
+	outputPath := filepath.Join(tempDir(t), "release.zip")
+	err = packager.downloadFile(outputPath, server.URL+"/release.zip")
+	if err != nil {
+		t.Fatalf("Complete download failed: %s", err)
+	}
+	content, err := ioutil.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "complete" {
+		t.Errorf("Downloaded %q", content)
+	}
+}
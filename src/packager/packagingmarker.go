@@ -0,0 +1,152 @@
+package packager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// packagingMarkerSuffix is appended to the version for the marker that
+// exists in the release dir while the version's packages are being built
+const packagingMarkerSuffix = ".packaging"
+
+// parkedMarkerSuffix is appended to the packaging marker of a version
+// that failed to resume MaxResumeAttempts times. Parked markers aren't
+// resumed, they are left for the operator
+const parkedMarkerSuffix = ".failed"
+
+// packagingMarkerPath returns the path of the packaging marker of version
+func (packager *Packager) packagingMarkerPath(version string) string {
+	return filepath.Join(packager.releaseDir, version+packagingMarkerSuffix)
+}
+
+// writePackagingMarker marks version as being packaged. The marker holds
+// the download URL so a resumed run can still publish it, followed by the
+// number of times packaging was resumed
+func (packager *Packager) writePackagingMarker(
+	version string,
+	downloadURL string) error {
+	return packager.writePackagingMarkerAttempts(version, downloadURL, 0)
+}
+
+// writePackagingMarkerAttempts writes the packaging marker of version
+// with the number of resume attempts
+func (packager *Packager) writePackagingMarkerAttempts(
+	version string,
+	downloadURL string,
+	attempts int) error {
+	return writeFileAtomic(
+		packager.packagingMarkerPath(version),
+		[]byte(fmt.Sprintf("%s\n%d\n", downloadURL, attempts)))
+}
+
+// readPackagingMarker returns the download URL and resume attempts of the
+// marker at markerPath. Markers without attempts were never resumed
+func readPackagingMarker(markerPath string) (string, int, error) {
+	content, err := ioutil.ReadFile(markerPath)
+	if err != nil {
+		return "", 0, err
+	}
+	lines := strings.SplitN(strings.TrimSpace(string(content)), "\n", 2)
+	if len(lines) < 2 {
+		return lines[0], 0, nil
+	}
+	attempts, err := strconv.Atoi(strings.TrimSpace(lines[1]))
+	if err != nil {
+		return "", 0, fmt.Errorf("Invalid packaging marker '%s': %s", markerPath, err)
+	}
+	return lines[0], attempts, nil
+}
+
+// clearPackagingMarker removes the packaging marker of version once all
+// of its packages exist, including a parked one
+func (packager *Packager) clearPackagingMarker(version string) error {
+	markerPath := packager.packagingMarkerPath(version)
+	for _, path := range []string{markerPath, markerPath + parkedMarkerSuffix} {
+		err := os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// parkPackagingMarker renames the marker of version so it is no longer
+// resumed
+func (packager *Packager) parkPackagingMarker(version string) error {
+	markerPath := packager.packagingMarkerPath(version)
+	return os.Rename(markerPath, markerPath+parkedMarkerSuffix)
+}
+
+// resumePackaging finishes the packages of the first version with a
+// dangling packaging marker, left by a run that was interrupted after
+// moving the release into place. A version is resumed at most
+// MaxResumeAttempts times before its marker is parked, so a pair that
+// always fails doesn't keep new releases from being packaged. It returns
+// false when there was nothing to resume
+func (packager *Packager) resumePackaging(
+	startTime time.Time) (bool, RunResult, error) {
+	var result RunResult
+	markers, err := filepath.Glob(
+		filepath.Join(packager.releaseDir, "*"+packagingMarkerSuffix))
+	if err != nil {
+		return false, result, err
+	}
+	for _, marker := range markers {
+		version := strings.TrimSuffix(filepath.Base(marker), packagingMarkerSuffix)
+		fileInfo, err := os.Stat(filepath.Join(packager.releaseDir, version))
+		if err != nil || !fileInfo.IsDir() {
+			// The move never happened, the release is still new to the feed
+			log.WithField("version", version).
+				Warning("Removing packaging marker without a release")
+			err = packager.clearPackagingMarker(version)
+			if err != nil {
+				return false, result, err
+			}
+			continue
+		}
+		downloadURL, attempts, err := readPackagingMarker(marker)
+		if err != nil {
+			return false, result, err
+		}
+		if attempts >= packager.options.MaxResumeAttempts {
+			log.WithFields(log.Fields{
+				"version":  version,
+				"attempts": attempts,
+			}).Error("Packaging failed to resume, parking the marker")
+			err = packager.parkPackagingMarker(version)
+			if err != nil {
+				return false, result, err
+			}
+			continue
+		}
+		err = packager.writePackagingMarkerAttempts(version, downloadURL, attempts+1)
+		if err != nil {
+			return false, result, err
+		}
+		log.WithFields(log.Fields{
+			"version": version,
+			"attempt": attempts + 1,
+		}).Info("Resuming interrupted packaging")
+		db, err := packager.openDB()
+		if err != nil {
+			return true, result, err
+		}
+		defer db.Close()
+		result.Version = version
+		result, err = packager.packageRelease(
+			db,
+			result,
+			downloadURL,
+			UnknownDownloadSize,
+			startTime)
+		return true, result, err
+	}
+	return false, result, nil
+}
@@ -0,0 +1,99 @@
+package packager
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRunResumesDanglingPackagingMarker(t *testing.T) {
+	fixture := newFixture(t)
+	fixture.installVersion(3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+	})
+	// An earlier run moved the release into place and was killed
+	fixture.installVersion(3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+	})
+	packager := fixture.newPackager(Options{})
+	err := packager.writePackagingMarker("3525360",
+		fixture.server.URL+"/UnrealTournament-Client-XAN-3525360-Linux.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := packager.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []VersionPair{{FromVersion: "3395761", ToVersion: "3525360"}}
+	if result.Version != "3525360" || !reflect.DeepEqual(result.Packages, expected) {
+		t.Errorf("Resumed run packaged %s %v, expected %v",
+			result.Version, result.Packages, expected)
+	}
+	_, err = os.Stat(filepath.Join(fixture.packageDir, "3395761-3525360.tar.gz"))
+	if err != nil {
+		t.Errorf("Resumed package wasn't created: %s", err)
+	}
+	_, err = os.Stat(packager.packagingMarkerPath("3525360"))
+	if !os.IsNotExist(err) {
+		t.Errorf("Packaging marker wasn't cleared: %v", err)
+	}
+}
+
+func TestRunParksMarkerAfterMaxResumeAttempts(t *testing.T) {
+	fixture := newFixture(t)
+	fixture.installVersion(3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+	})
+	fixture.installVersion(3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+	})
+	downloadURL := fixture.serveRelease(3550000, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=3",
+	})
+	fixture.addPost("UT Release 3550000", "post-3550000", downloadURL, time.Now())
+	// The package from 3395761 to 3525360 fails every time
+	uploader := &failingUploader{
+		Uploader:    NewTemplateUploader(defaultPackageURLTemplate),
+		failVersion: "3395761",
+	}
+	packager := fixture.newPackager(Options{
+		MaxResumeAttempts: 2,
+		Uploader:          uploader,
+	})
+	err := packager.writePackagingMarker("3525360",
+		fixture.server.URL+"/UnrealTournament-Client-XAN-3525360-Linux.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		result, err := packager.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Version != "3525360" || len(result.Failures) != 1 {
+			t.Fatalf("Attempt %d packaged %s with failures %v",
+				attempt, result.Version, result.Failures)
+		}
+	}
+
+	// The feed is no longer blocked by the failing version
+	result, err := packager.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Version != "3550000" {
+		t.Errorf("Run after parking packaged '%s', expected 3550000", result.Version)
+	}
+	markerPath := packager.packagingMarkerPath("3525360")
+	if _, err = os.Stat(markerPath); !os.IsNotExist(err) {
+		t.Errorf("Marker wasn't parked: %v", err)
+	}
+	if _, err = os.Stat(markerPath + parkedMarkerSuffix); err != nil {
+		t.Errorf("Parked marker doesn't exist: %s", err)
+	}
+}
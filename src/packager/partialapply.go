@@ -0,0 +1,57 @@
+package packager
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ApplyPackageSubpath applies only the operations of the package at
+// packagePath under subpath, e.g. UnrealTournament/Content/Maps, to the
+// install at installPath. The install is left partially upgraded, its
+// version marker isn't advanced so a full apply can follow. Moves are only
+// applied when their source is under subpath as well
+func ApplyPackageSubpath(
+	packagePath string,
+	installPath string,
+	subpath string) error {
+	prefix := strings.Trim(path.Clean("/"+strings.Replace(subpath, "\\", "/", -1)), "/")
+	if prefix == "" {
+		return fmt.Errorf("Subpath '%s' selects the whole install", subpath)
+	}
+	operations, err := ReadPackageOperations(packagePath)
+	if err != nil {
+		return err
+	}
+	selected := make(map[string]DeltaOperation)
+	for filename, operation := range operations {
+		if !isUnderSubpath(filename, prefix) ||
+			filename == modulesBinaryDir+"/"+modulesFilename {
+			continue
+		}
+		if operation.Operation == deltaOperationMoved &&
+			!isUnderSubpath(operation.Source, prefix) {
+			log.WithFields(log.Fields{
+				"path":   filename,
+				"source": operation.Source,
+			}).Warning("Skipping move from outside the subpath")
+			continue
+		}
+		selected[filename] = operation
+	}
+	log.WithFields(log.Fields{
+		"subpath":    prefix,
+		"operations": len(selected),
+		"skipped":    len(operations) - len(selected),
+	}).Warning("Partially upgrading the install, its version isn't advanced")
+	return applyOperations(packagePath, installPath, selected)
+}
+
+// isUnderSubpath checks if the slash separated filename is prefix or in
+// the prefix dir
+func isUnderSubpath(filename string, prefix string) bool {
+	filename = strings.TrimSuffix(filename, "/")
+	return filename == prefix || strings.HasPrefix(filename, prefix+"/")
+}
@@ -0,0 +1,61 @@
+package packager
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestApplyPackageSubpath(t *testing.T) {
+	packager, packagePath := applyFixture(t)
+	fromPath := filepath.Join(packager.releaseDir, "3395761")
+	tests := []struct {
+		subpath string
+		changed map[string]string
+		removed []string
+	}{
+		{
+			subpath: "UnrealTournament/Content/Maps",
+			changed: map[string]string{
+				"UnrealTournament/Content/Maps/Added.umap": "added",
+			},
+		},
+		{
+			subpath: "UnrealTournament/Content/",
+			changed: map[string]string{
+				"UnrealTournament/Content/Maps/Added.umap": "added",
+				"UnrealTournament/Content/Paks/New.pak":    "same pak",
+			},
+			removed: []string{
+				"UnrealTournament/Content/Old.pak",
+				"UnrealTournament/Content/Removed.txt",
+			},
+		},
+	}
+	for _, test := range tests {
+		installPath := filepath.Join(tempDir(t), "install")
+		copyTree(t, fromPath, installPath)
+		expected := readTree(t, installPath)
+		for filename, content := range test.changed {
+			expected[filename] = content
+		}
+		for _, filename := range test.removed {
+			delete(expected, filename)
+		}
+
+		err := ApplyPackageSubpath(packagePath, installPath, test.subpath)
+		if err != nil {
+			t.Fatalf("%s: %s", test.subpath, err)
+		}
+		// The config and the version marker outside the subpath are untouched
+		installed := readTree(t, installPath)
+		if !reflect.DeepEqual(installed, expected) {
+			t.Errorf("%s: install is %v, expected %v", test.subpath, installed, expected)
+		}
+	}
+
+	err := ApplyPackageSubpath(packagePath, tempDir(t), "/")
+	if err == nil {
+		t.Error("Subpath selecting the whole install was accepted")
+	}
+}
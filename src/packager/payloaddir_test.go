@@ -0,0 +1,46 @@
+package packager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLargeArtifactsLandInPayloadDir(t *testing.T) {
+	fixture := newFixture(t)
+	payloadDir := filepath.Join(fixture.dir, "disk", "payload")
+	packager := fixture.newPackager(Options{PayloadDir: payloadDir})
+	if _, err := os.Stat(payloadDir); err != nil {
+		t.Fatalf("Payload dir wasn't created: %s", err)
+	}
+	downloadURL := fixture.serveRelease(3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+	})
+
+	extractPath, err := packager.DownloadAndExtract(downloadURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(extractPath, payloadDir+string(os.PathSeparator)) {
+		t.Errorf("Release extracted to %s, outside the payload dir", extractPath)
+	}
+	if _, err := os.Stat(filepath.Join(payloadDir, "newrelease.zip")); err != nil {
+		t.Errorf("Download isn't in the payload dir: %s", err)
+	}
+	entries, err := ioutil.ReadDir(fixture.workingDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		t.Errorf("%s is in the working dir", entry.Name())
+	}
+
+	_, err = New(fixture.feedURL(), fixture.dbPath, fixture.workingDir,
+		fixture.releaseDir, fixture.packageDir,
+		Options{PayloadDir: filepath.Join(fixture.releaseDir, "payload")})
+	if err == nil {
+		t.Error("Payload dir inside the release dir was accepted")
+	}
+}
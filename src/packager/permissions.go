@@ -0,0 +1,88 @@
+package packager
+
+import (
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// PermissionsOff doesn't check file permissions
+	PermissionsOff = "off"
+	// PermissionsReport reports files missing the executable bit
+	PermissionsReport = "report"
+	// PermissionsFix reports and sets the executable bit where it is missing
+	PermissionsFix = "fix"
+)
+
+// defaultExecutablePatterns match the binaries of a Linux install
+var defaultExecutablePatterns = []string{
+	"**/Binaries/Linux/*-Shipping",
+	"**/Binaries/Linux/*.so",
+	"**/Binaries/Linux/*.sh",
+}
+
+// PermissionMismatch is a file whose mode differs from the expected mode
+type PermissionMismatch struct {
+	Path     string
+	Mode     os.FileMode
+	Expected os.FileMode
+	// Fixed is set when the expected mode was applied
+	Fixed bool
+}
+
+// checkPermissions compares the modes of the files in installPath against
+// the executable patterns and reports, or with PermissionsFix also fixes,
+// the executables that can't be executed
+func (packager *Packager) checkPermissions(
+	installPath string) ([]PermissionMismatch, error) {
+	if packager.options.Permissions == PermissionsOff {
+		return nil, nil
+	}
+	var mismatches []PermissionMismatch
+	err := filepath.Walk(
+		installPath,
+		func(path string, fileInfo os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !fileInfo.Mode().IsRegular() {
+				return nil
+			}
+			relativePath, err := filepath.Rel(installPath, path)
+			if err != nil {
+				return err
+			}
+			if !matchAnyPath(packager.options.ExecutablePatterns, relativePath) {
+				return nil
+			}
+			mode := fileInfo.Mode().Perm()
+			if mode&0100 != 0 {
+				return nil
+			}
+			// Everyone who can read the file should be able to execute it
+			expected := mode | (mode&0444)>>2 | 0100
+			mismatch := PermissionMismatch{
+				Path:     relativePath,
+				Mode:     mode,
+				Expected: expected,
+			}
+			if packager.options.Permissions == PermissionsFix {
+				err = os.Chmod(path, expected)
+				if err != nil {
+					return err
+				}
+				mismatch.Fixed = true
+			}
+			log.WithFields(log.Fields{
+				"path":     relativePath,
+				"mode":     mode.String(),
+				"expected": expected.String(),
+				"fixed":    mismatch.Fixed,
+			}).Warning("Binary is not executable")
+			mismatches = append(mismatches, mismatch)
+			return nil
+		})
+	return mismatches, err
+}
@@ -0,0 +1,54 @@
+package packager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckPermissions(t *testing.T) {
+	const binary = "LinuxNoEditor/UnrealTournament/Binaries/Linux/libUE4.so"
+	for _, mode := range []string{PermissionsReport, PermissionsFix} {
+		installPath := tempDir(t)
+		writeTree(t, installPath, map[string]string{
+			binary: "binary",
+			"LinuxNoEditor/UnrealTournament/Binaries/Linux/UE4-Shipping": "binary",
+			"LinuxNoEditor/UnrealTournament/Config/Default.ini":          "setting=1",
+		})
+		// The archive dropped the executable bit of the library only
+		err := os.Chmod(filepath.Join(installPath, binary), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.Chmod(filepath.Join(installPath,
+			"LinuxNoEditor/UnrealTournament/Binaries/Linux/UE4-Shipping"), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		packager := newTestPackager(t, Options{Permissions: mode})
+
+		mismatches, err := packager.checkPermissions(installPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := PermissionMismatch{
+			Path:     binary,
+			Mode:     0644,
+			Expected: 0755,
+			Fixed:    mode == PermissionsFix,
+		}
+		if len(mismatches) != 1 || mismatches[0] != expected {
+			t.Fatalf("%s: mismatches are %+v, expected %+v", mode, mismatches, expected)
+		}
+		fileInfo, err := os.Stat(filepath.Join(installPath, binary))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fileInfo.Mode().Perm() != mismatches[0].Expected && mode == PermissionsFix {
+			t.Errorf("Fixed binary has mode %s", fileInfo.Mode())
+		}
+		if fileInfo.Mode().Perm() != 0644 && mode == PermissionsReport {
+			t.Errorf("Reported binary was changed to %s", fileInfo.Mode())
+		}
+	}
+}
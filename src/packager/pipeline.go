@@ -0,0 +1,143 @@
+package packager
+
+import (
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// deltaBuilder computes the delta operations from a version while the
+// hashes of the version it upgrades to arrive one at a time. Only the
+// hashes of added and modified files are kept
+type deltaBuilder struct {
+	fromHashes     map[string]string
+	ignorePatterns []string
+	// contentRoots limit the delta to their files when set
+	contentRoots []string
+	// seen holds the from files that exist in the to version
+	seen  map[string]bool
+	delta map[string]DeltaOperation
+	// toHashes holds the hashes of the added and modified files
+	toHashes map[string]string
+}
+
+// newDeltaBuilder creates a builder for the delta from fromHashes
+func (packager *Packager) newDeltaBuilder(
+	fromHashes map[string]string) *deltaBuilder {
+	return &deltaBuilder{
+		fromHashes:     fromHashes,
+		ignorePatterns: packager.options.IgnorePatterns,
+		contentRoots:   packager.options.ContentRoots,
+		seen:           make(map[string]bool),
+		delta:          make(map[string]DeltaOperation),
+		toHashes:       make(map[string]string),
+	}
+}
+
+// add adds file with hash of the to version
+func (builder *deltaBuilder) add(file string, hash string) {
+	if builder.skip(file) {
+		return
+	}
+	fromHash, ok := builder.fromHashes[file]
+	if !ok {
+		builder.delta[file] = DeltaOperation{Operation: deltaOperationAdded}
+		builder.toHashes[file] = hash
+		return
+	}
+	builder.seen[file] = true
+	if fromHash != hash {
+		// File has been modified
+		builder.delta[file] = DeltaOperation{Operation: deltaOperationModified}
+		builder.toHashes[file] = hash
+	}
+}
+
+// skip checks if file is left out of the delta. Cached hashes may still
+// contain ignored files
+func (builder *deltaBuilder) skip(file string) bool {
+	return matchAnyPath(builder.ignorePatterns, file) ||
+		!inContentRoots(builder.contentRoots, file)
+}
+
+// finish marks the from files that never arrived as removed and returns
+// the delta. Moves are left to the delta post processors
+func (builder *deltaBuilder) finish() map[string]DeltaOperation {
+	for file := range builder.fromHashes {
+		if builder.seen[file] || builder.skip(file) {
+			continue
+		}
+		builder.delta[file] = DeltaOperation{Operation: deltaOperationRemoved}
+	}
+	return builder.delta
+}
+
+// pipelinedDelta hashes toVersion and computes its delta from fromHashes
+// as the hashes arrive, so the hashes of toVersion are never all in
+// memory. The hashes are written to the hash cache from the same pass, so
+// the deltas from other versions read them instead of hashing again. It
+// returns the delta with the hashes of the added and modified files of
+// toVersion
+func (packager *Packager) pipelinedDelta(
+	fromHashes map[string]string,
+	toVersion string) (map[string]DeltaOperation, map[string]string, error) {
+	builder := packager.newDeltaBuilder(fromHashes)
+	// The cache is an optimisation, failing to write it isn't fatal
+	cacheWriter, err := packager.newHashCacheWriter(toVersion)
+	if err != nil {
+		log.WithField("err", "write_hash_cache").Warning(err.Error())
+	}
+	hashStart := time.Now()
+	err = packager.streamHashes(
+		filepath.Join(packager.releaseDir, toVersion),
+		func(path string, hash string) error {
+			builder.add(path, hash)
+			if cacheWriter == nil {
+				return nil
+			}
+			cacheErr := cacheWriter.add(path, hash)
+			if cacheErr != nil {
+				log.WithField("err", "write_hash_cache").Warning(cacheErr.Error())
+				cacheWriter.abort()
+				cacheWriter = nil
+			}
+			return nil
+		})
+	if err != nil {
+		if cacheWriter != nil {
+			cacheWriter.abort()
+		}
+		return nil, nil, err
+	}
+	packager.recordHashCacheMiss(toVersion, time.Since(hashStart))
+	if cacheWriter != nil {
+		err = cacheWriter.finish()
+		if err != nil {
+			log.WithField("err", "write_hash_cache").Warning(err.Error())
+		}
+	}
+	return builder.finish(), builder.toHashes, nil
+}
+
+// canPipelineDelta checks if the delta to version should be pipelined.
+// Versions whose hashes are cached are read as a whole instead of hashed
+// again
+func (packager *Packager) canPipelineDelta(version string) bool {
+	if !packager.options.PipelineDeltas ||
+		packager.options.HashProvider != nil {
+		return false
+	}
+	if packager.hashLRU != nil {
+		if _, ok := packager.hashLRU.get(version); ok {
+			return false
+		}
+	}
+	cached, err := packager.hasHashCache(version)
+	if err != nil {
+		// Reading the cache reports the error, it isn't fatal here
+		log.WithField("err", "has_hash_cache").Warning(err.Error())
+		return false
+	}
+	return !cached
+}
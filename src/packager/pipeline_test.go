@@ -0,0 +1,84 @@
+package packager
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// installPipelineVersions installs versions whose deltas to 3525360 have
+// every kind of operation
+func installPipelineVersions(t *testing.T, packager *Packager) {
+	t.Helper()
+	installTestVersion(t, packager, 3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini":  "setting=1",
+		"UnrealTournament/Content/Removed.txt": "removed",
+		"UnrealTournament/Content/Old.pak":     "moved content",
+		"UnrealTournament/Content/Kept.txt":    "kept",
+	})
+	installTestVersion(t, packager, 3450000, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+		"UnrealTournament/Content/Kept.txt":   "kept",
+	})
+	installTestVersion(t, packager, 3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=3",
+		"UnrealTournament/Content/Added.txt":  "added",
+		"UnrealTournament/Content/New.pak":    "moved content",
+		"UnrealTournament/Content/Kept.txt":   "kept",
+	})
+}
+
+func TestPipelinedDeltaMatchesBatch(t *testing.T) {
+	batch := newTestPackager(t, Options{})
+	installPipelineVersions(t, batch)
+	for _, options := range []Options{
+		{PipelineDeltas: true},
+		{PipelineDeltas: true, CompressHashCache: true},
+		{PipelineDeltas: true, HashCacheIndex: true},
+	} {
+		pipelined := newTestPackager(t, options)
+		installPipelineVersions(t, pipelined)
+		for _, fromVersion := range []string{"3395761", "3450000"} {
+			_, err := batch.GeneratePackage(fromVersion, "3525360")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = pipelined.GeneratePackage(fromVersion, "3525360")
+			if err != nil {
+				t.Fatal(err)
+			}
+			name := fromVersion + "-3525360.tar.gz"
+			batchOperations, err := ReadPackageOperations(filepath.Join(batch.packageDir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			pipelinedOperations, err := ReadPackageOperations(filepath.Join(pipelined.packageDir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(pipelinedOperations, batchOperations) {
+				t.Errorf("Options %+v: pipelined delta from %s is %v, batch %v",
+					options, fromVersion, pipelinedOperations, batchOperations)
+			}
+		}
+
+		// The version was hashed once, the second delta read the cache
+		stats := pipelined.hashCacheStats.Versions["3525360"]
+		if stats.Misses != 1 {
+			t.Errorf("Options %+v: 3525360 was hashed %d times, expected 1",
+				options, stats.Misses)
+		}
+		cached, err := pipelined.readHashCache("3525360")
+		if err != nil {
+			t.Fatalf("Options %+v: %s", options, err)
+		}
+		expected, err := batch.getVersionHashes("3525360")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(cached, expected) {
+			t.Errorf("Options %+v: cached hashes are %v, expected %v",
+				options, cached, expected)
+		}
+	}
+}
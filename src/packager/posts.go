@@ -0,0 +1,53 @@
+package packager
+
+import (
+	"time"
+)
+
+// ReleasePost is a release post from the feed with its download details
+type ReleasePost struct {
+	Title       string
+	GUID        string
+	Published   *time.Time
+	DownloadURL string
+	// DownloadSize is UnknownDownloadSize when the server doesn't report it
+	DownloadSize float64
+	// Error is set when the download link or size could not be determined
+	Error string
+}
+
+// ListReleasePosts fetches the feed and returns the release posts with
+// their download link and size. It doesn't touch the database or download
+// anything, which makes it useful to debug feed parsing
+func (packager *Packager) ListReleasePosts() ([]ReleasePost, error) {
+	feed, err := packager.fetchFeed()
+	if err != nil {
+		return nil, err
+	}
+	items, err := packager.extractReleasePosts(feed)
+	if err != nil {
+		return nil, err
+	}
+
+	var posts []ReleasePost
+	for _, item := range items {
+		post := ReleasePost{
+			Title:     item.Title,
+			GUID:      postKey(item),
+			Published: postDate(item),
+		}
+		post.DownloadURL, err = packager.extractUpdateDownloadLinkFromPost(item)
+		if err != nil {
+			post.Error = err.Error()
+			posts = append(posts, post)
+			continue
+		}
+		post.DownloadURL, post.DownloadSize, err =
+			packager.getDownloadSizeFromMirrors(post.DownloadURL)
+		if err != nil {
+			post.Error = err.Error()
+		}
+		posts = append(posts, post)
+	}
+	return posts, nil
+}
@@ -0,0 +1,55 @@
+package packager
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestListReleasePosts(t *testing.T) {
+	fixture := newFixture(t)
+	downloadURL := fixture.serveRelease(3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+	})
+	published := time.Date(2017, 7, 3, 12, 0, 0, 0, time.UTC)
+	fixture.addPost("UT Release 3525360", "post-3525360", downloadURL, published)
+	fixture.addPost("Community news", "post-news", downloadURL, published)
+	fixture.addPost("UT Release 3600000", "post-3600000",
+		fixture.server.URL+"/UnrealTournament-Client-XAN-3600000-Linux.zip", published)
+	packager := fixture.newPackager(Options{})
+
+	posts, err := packager.ListReleasePosts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 2 {
+		t.Fatalf("%d release posts listed, expected 2: %+v", len(posts), posts)
+	}
+	post := posts[0]
+	if post.Title != "UT Release 3525360" ||
+		post.GUID != "post-3525360" ||
+		post.Published == nil || !post.Published.Equal(published) ||
+		post.DownloadURL != downloadURL ||
+		post.DownloadSize <= 0 ||
+		post.Error != "" {
+		t.Errorf("Release post is %+v", post)
+	}
+	// The download of the second post doesn't exist
+	if posts[1].GUID != "post-3600000" || posts[1].Error == "" {
+		t.Errorf("Release post without a download is %+v", posts[1])
+	}
+
+	// Nothing was recorded or downloaded
+	var count int
+	fixture.db().Table("ut4_blog_posts").Count(&count)
+	if count != 0 {
+		t.Errorf("%d posts recorded", count)
+	}
+	entries, err := ioutil.ReadDir(fixture.workingDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("%d files in the working dir", len(entries))
+	}
+}
@@ -0,0 +1,61 @@
+package packager
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultAcceptedContentTypes are the content types a release download
+// may be served as
+var defaultAcceptedContentTypes = []string{
+	"application/zip",
+	"application/x-zip-compressed",
+	"application/octet-stream",
+	"binary/octet-stream",
+}
+
+// preflightDownload requests the first byte of downloadURL to confirm a
+// GET works and is served with an accepted content type before the full
+// download starts. Non-HTTP URLs are not checked
+func (packager *Packager) preflightDownload(downloadURL string) error {
+	if !isHTTPURL(downloadURL) {
+		return nil
+	}
+	request, err := http.NewRequest(http.MethodGet, downloadURL, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Range", "bytes=0-0")
+	resp, err := packager.httpClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("Download pre-flight for %s failed: %s",
+			downloadURL, err.Error())
+	}
+	drainAndClose(resp.Body)
+	if resp.StatusCode != http.StatusOK &&
+		resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("Download pre-flight for %s returned status %d",
+			downloadURL, resp.StatusCode)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		log.WithField("link", downloadURL).Debug("No content type for download")
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("Download pre-flight for %s returned an invalid "+
+			"content type '%s'", downloadURL, contentType)
+	}
+	for _, accepted := range packager.options.AcceptedContentTypes {
+		if strings.EqualFold(mediaType, accepted) {
+			return nil
+		}
+	}
+	return fmt.Errorf("Download pre-flight for %s returned content type '%s'",
+		downloadURL, mediaType)
+}
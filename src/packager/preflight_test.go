@@ -0,0 +1,46 @@
+package packager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunFailsEarlyWhenDownloadIsUnavailable(t *testing.T) {
+	getStatus := http.StatusNotFound
+	contentType := "application/zip"
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", contentType)
+			if r.Method == http.MethodHead {
+				w.Header().Set("Content-Length", "1048576")
+				return
+			}
+			w.WriteHeader(getStatus)
+		}))
+	defer server.Close()
+	downloadURL := server.URL + "/UnrealTournament-Client-XAN-3525360-Linux.zip"
+
+	fixture := newFixture(t)
+	fixture.installVersion(3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+	})
+	fixture.addPost("UT Release 3525360", "post-3525360", downloadURL, time.Now())
+	packager := fixture.newPackager(Options{})
+
+	// HEAD succeeds but GET would 404
+	_, err := packager.Run()
+	if err == nil || !strings.Contains(err.Error(), "returned status 404") {
+		t.Fatalf("Run returned %v, expected the pre-flight status error", err)
+	}
+
+	// A page served in place of the release is refused as well
+	getStatus = http.StatusOK
+	contentType = "text/html; charset=utf-8"
+	_, err = packager.Run()
+	if err == nil || !strings.Contains(err.Error(), "content type 'text/html'") {
+		t.Errorf("Run returned %v, expected the pre-flight content type error", err)
+	}
+}
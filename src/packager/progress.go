@@ -0,0 +1,121 @@
+package packager
+
+import (
+	"sort"
+	"sync"
+)
+
+// Progress is the progress of one or more operations in bytes
+type Progress struct {
+	Done  int64
+	Total int64
+}
+
+// Percent returns Done as a percentage of Total, 0 while the total is
+// unknown
+func (progress Progress) Percent() float64 {
+	if progress.Total <= 0 {
+		return 0
+	}
+	return float64(progress.Done) / float64(progress.Total) * 100
+}
+
+// ProgressAggregator merges the progress reported by concurrent workers,
+// such as downloads and hashing, into the progress of the whole run
+type ProgressAggregator struct {
+	lock     sync.Mutex
+	workers  map[string]Progress
+	callback func(Progress)
+}
+
+// NewProgressAggregator creates an aggregator calling callback, which may
+// be nil, with the overall progress on every update. Callbacks are made
+// one at a time and must not update the aggregator themselves
+func NewProgressAggregator(callback func(Progress)) *ProgressAggregator {
+	return &ProgressAggregator{
+		workers:  make(map[string]Progress),
+		callback: callback,
+	}
+}
+
+// Update sets the progress of worker, a total of 0 or less is unknown
+func (aggregator *ProgressAggregator) Update(worker string, done int64, total int64) {
+	aggregator.lock.Lock()
+	defer aggregator.lock.Unlock()
+	aggregator.workers[worker] = Progress{Done: done, Total: total}
+	if aggregator.callback != nil {
+		aggregator.callback(aggregator.sum())
+	}
+}
+
+// Add adds bytes to the done count of worker
+func (aggregator *ProgressAggregator) Add(worker string, bytes int64) {
+	aggregator.lock.Lock()
+	defer aggregator.lock.Unlock()
+	progress := aggregator.workers[worker]
+	progress.Done += bytes
+	aggregator.workers[worker] = progress
+	if aggregator.callback != nil {
+		aggregator.callback(aggregator.sum())
+	}
+}
+
+// Progress returns the overall progress
+func (aggregator *ProgressAggregator) Progress() Progress {
+	aggregator.lock.Lock()
+	defer aggregator.lock.Unlock()
+	return aggregator.sum()
+}
+
+// Workers returns the names of the workers that reported progress
+func (aggregator *ProgressAggregator) Workers() []string {
+	aggregator.lock.Lock()
+	defer aggregator.lock.Unlock()
+	workers := make([]string, 0, len(aggregator.workers))
+	for worker := range aggregator.workers {
+		workers = append(workers, worker)
+	}
+	sort.Strings(workers)
+	return workers
+}
+
+// Reset forgets all workers
+func (aggregator *ProgressAggregator) Reset() {
+	aggregator.lock.Lock()
+	defer aggregator.lock.Unlock()
+	aggregator.workers = make(map[string]Progress)
+}
+
+// sum adds up the progress of all workers. Workers without a known total
+// count their done bytes as their total so they don't hold the percentage
+// back. Requires the lock to be held
+func (aggregator *ProgressAggregator) sum() Progress {
+	var total Progress
+	for _, progress := range aggregator.workers {
+		total.Done += progress.Done
+		if progress.Total > 0 {
+			total.Total += progress.Total
+		} else {
+			total.Total += progress.Done
+		}
+	}
+	return total
+}
+
+// progressWriter reports the bytes written to it as progress of worker
+type progressWriter struct {
+	aggregator *ProgressAggregator
+	worker     string
+}
+
+// Write reports the length of buffer
+func (writer progressWriter) Write(buffer []byte) (int, error) {
+	writer.aggregator.Add(writer.worker, int64(len(buffer)))
+	return len(buffer), nil
+}
+
+// Progress returns the progress of the downloads and hashing of the
+// current run
+func (packager *Packager) Progress() Progress {
+	return packager.progress.Progress()
+}
@@ -0,0 +1,60 @@
+package packager
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestProgressAggregator(t *testing.T) {
+	var last Progress
+	aggregator := NewProgressAggregator(func(progress Progress) {
+		last = progress
+	})
+
+	// Four workers report concurrently, 100 bytes each in 10 byte steps
+	var wait sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		worker := fmt.Sprintf("hash %d", i)
+		aggregator.Update(worker, 0, 100)
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			writer := progressWriter{aggregator, worker}
+			for step := 0; step < 10; step++ {
+				writer.Write(make([]byte, 10))
+			}
+		}()
+	}
+	wait.Wait()
+	expected := Progress{Done: 400, Total: 400}
+	if progress := aggregator.Progress(); progress != expected || last != expected {
+		t.Errorf("Progress is %+v, last callback %+v, expected %+v",
+			progress, last, expected)
+	}
+
+	// A worker without a known total doesn't hold the percentage back
+	aggregator.Update("download", 50, 0)
+	aggregator.Update("package", 25, 100)
+	progress := aggregator.Progress()
+	if progress != (Progress{Done: 475, Total: 550}) {
+		t.Errorf("Progress is %+v", progress)
+	}
+	if percent := (Progress{Done: 1, Total: 4}).Percent(); percent != 25 {
+		t.Errorf("Percent is %f, expected 25", percent)
+	}
+	if percent := (Progress{Done: 1}).Percent(); percent != 0 {
+		t.Errorf("Percent of an unknown total is %f, expected 0", percent)
+	}
+
+	workers := aggregator.Workers()
+	expectedWorkers := []string{"download", "hash 0", "hash 1", "hash 2", "hash 3", "package"}
+	if !reflect.DeepEqual(workers, expectedWorkers) {
+		t.Errorf("Workers are %v, expected %v", workers, expectedWorkers)
+	}
+	aggregator.Reset()
+	if progress := aggregator.Progress(); progress != (Progress{}) {
+		t.Errorf("Progress after reset is %+v", progress)
+	}
+}
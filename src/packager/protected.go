@@ -0,0 +1,51 @@
+package packager
+
+import (
+	"fmt"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ProtectedRemovals returns the removed paths in operations that match
+// any of patterns, sorted. Clients can use it to refuse a delta before
+// applying it
+func ProtectedRemovals(
+	operations map[string]DeltaOperation,
+	patterns []string) []string {
+	var protected []string
+	for filePath, operation := range operations {
+		if operation.Operation == deltaOperationRemoved &&
+			matchAnyPath(patterns, filePath) {
+			protected = append(protected, filePath)
+		}
+	}
+	sort.Strings(protected)
+	return protected
+}
+
+// checkProtectedRemovals refuses a delta from fromVersion to toVersion
+// that removes protected paths, unless such removals are allowed. A
+// wrong delta, e.g. from an incomplete tree, could otherwise remove the
+// game binaries from clients
+func (packager *Packager) checkProtectedRemovals(
+	operations map[string]DeltaOperation,
+	fromVersion string,
+	toVersion string) error {
+	protected := ProtectedRemovals(operations, packager.options.ProtectedPaths)
+	if len(protected) == 0 {
+		return nil
+	}
+	for _, filePath := range protected {
+		log.WithFields(log.Fields{
+			"fromVersion": fromVersion,
+			"toVersion":   toVersion,
+			"path":        filePath,
+		}).Warning("Delta removes a protected path")
+	}
+	if packager.options.AllowProtectedRemovals {
+		return nil
+	}
+	return fmt.Errorf("Delta from %s to %s removes %d protected paths, e.g. '%s'",
+		fromVersion, toVersion, len(protected), protected[0])
+}
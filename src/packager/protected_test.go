@@ -0,0 +1,46 @@
+package packager
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProtectedRemovals(t *testing.T) {
+	operations := map[string]DeltaOperation{
+		"Engine/Binaries/Linux/libUE4.so":          {Operation: deltaOperationRemoved},
+		"Engine/Binaries/Linux/UE4-Shipping":       {Operation: deltaOperationModified},
+		"UnrealTournament/Content/Removed.txt":     {Operation: deltaOperationRemoved},
+		"UnrealTournament/Binaries/Linux/Added.so": {Operation: deltaOperationAdded},
+	}
+	protected := ProtectedRemovals(operations, []string{"**/Binaries/**"})
+	expected := []string{"Engine/Binaries/Linux/libUE4.so"}
+	if !reflect.DeepEqual(protected, expected) {
+		t.Errorf("Protected removals are %v, expected %v", protected, expected)
+	}
+}
+
+func TestPackagingRefusesProtectedRemovals(t *testing.T) {
+	const binary = "Engine/Binaries/Linux/libUE4.so"
+	for _, allow := range []bool{false, true} {
+		packager := newTestPackager(t, Options{
+			ProtectedPaths:         []string{"**/Binaries/**"},
+			AllowProtectedRemovals: allow,
+		})
+		installTestVersion(t, packager, 3395761, map[string]string{
+			binary:                                "binary",
+			"UnrealTournament/Config/Default.ini": "setting=1",
+		})
+		// The delta would remove the binary from clients
+		installTestVersion(t, packager, 3525360, map[string]string{
+			"UnrealTournament/Config/Default.ini": "setting=2",
+		})
+		_, err := packager.GeneratePackage("3395761", "3525360")
+		if !allow && (err == nil || !strings.Contains(err.Error(), binary)) {
+			t.Errorf("Removing a protected binary returned %v", err)
+		}
+		if allow && err != nil {
+			t.Errorf("Allowed protected removal failed: %s", err)
+		}
+	}
+}
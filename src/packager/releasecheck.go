@@ -0,0 +1,141 @@
+package packager
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	// releaseSampleFiles is the number of files compared before and after
+	// moving a release into the release dir
+	releaseSampleFiles = 32
+	// releaseSampleBytes is read from the start and end of each sample
+	releaseSampleBytes = 64 * 1024
+)
+
+// releaseSnapshot describes a release tree well enough to notice a move
+// that lost or damaged files
+type releaseSnapshot struct {
+	files   int
+	size    int64
+	samples map[string]string
+}
+
+// snapshotRelease records the layout of the release at releasePath with
+// the sample hashes of evenly spread files
+func snapshotRelease(releasePath string) (releaseSnapshot, error) {
+	snapshot := releaseSnapshot{samples: make(map[string]string)}
+	var files []string
+	err := filepath.Walk(releasePath, func(path string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fileInfo.IsDir() {
+			relativePath, err := filepath.Rel(releasePath, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, relativePath)
+			snapshot.size += fileInfo.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return snapshot, err
+	}
+	snapshot.files = len(files)
+	sort.Strings(files)
+	step := 1
+	if len(files) > releaseSampleFiles {
+		step = len(files) / releaseSampleFiles
+	}
+	for i := 0; i < len(files); i += step {
+		hash, err := sampleHash(filepath.Join(releasePath, files[i]))
+		if err != nil {
+			return snapshot, err
+		}
+		snapshot.samples[files[i]] = hash
+	}
+	return snapshot, nil
+}
+
+// verify checks that the release at releasePath matches the snapshot
+func (snapshot releaseSnapshot) verify(releasePath string) error {
+	moved, err := snapshotRelease(releasePath)
+	if err != nil {
+		return err
+	}
+	if moved.files != snapshot.files || moved.size != snapshot.size {
+		return fmt.Errorf("Release has %d files of %d bytes, expected %d files of %d bytes",
+			moved.files, moved.size, snapshot.files, snapshot.size)
+	}
+	for path, hash := range snapshot.samples {
+		movedHash, err := sampleHash(filepath.Join(releasePath, path))
+		if err != nil {
+			return err
+		}
+		if movedHash != hash {
+			return fmt.Errorf("Release file '%s' changed while moving", path)
+		}
+	}
+	return nil
+}
+
+// sampleHash hashes the size with the first and last bytes of the file at
+// path, which catches truncation without reading multi GB paks
+func sampleHash(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	hasher := sha256.New()
+	fmt.Fprintf(hasher, "%d\n", fileInfo.Size())
+	_, err = io.CopyN(hasher, file, releaseSampleBytes)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	if fileInfo.Size() > 2*releaseSampleBytes {
+		_, err = file.Seek(-releaseSampleBytes, io.SeekEnd)
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(hasher, file)
+		if err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
+
+// verifyMovedRelease checks the release moved to newReleasePath against
+// the snapshot taken before the move and that its version still reads
+// as version. A bad release is removed so it isn't packaged
+func (packager *Packager) verifyMovedRelease(
+	snapshot releaseSnapshot,
+	newReleasePath string,
+	version string) error {
+	err := snapshot.verify(newReleasePath)
+	if err == nil {
+		var movedVersion string
+		movedVersion, err = packager.getReleaseNumber(newReleasePath)
+		if err == nil && movedVersion != version {
+			err = fmt.Errorf("Release version reads as %s", movedVersion)
+		}
+	}
+	if err == nil {
+		return nil
+	}
+	os.RemoveAll(newReleasePath)
+	packager.clearPackagingMarker(version)
+	return fmt.Errorf("Release moved to %s is unusable, removed it: %s",
+		newReleasePath, err.Error())
+}
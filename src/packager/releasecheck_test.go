@@ -0,0 +1,102 @@
+package packager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyMovedRelease(t *testing.T) {
+	const version = "3525360"
+	files := releaseFiles(3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini":    "setting=1",
+		"UnrealTournament/Content/Paks/Game.pak": strings.Repeat("pak", 3*releaseSampleBytes),
+	})
+	for _, test := range []struct {
+		description string
+		damage      func(releasePath string) error
+	}{
+		{"intact move", nil},
+		{"lost file", func(releasePath string) error {
+			return os.Remove(filepath.Join(releasePath, "UnrealTournament/Config/Default.ini"))
+		}},
+		{"truncated file", func(releasePath string) error {
+			return os.Truncate(
+				filepath.Join(releasePath, "UnrealTournament/Content/Paks/Game.pak"),
+				releaseSampleBytes)
+		}},
+		{"changed tail", func(releasePath string) error {
+			file, err := os.OpenFile(
+				filepath.Join(releasePath, "UnrealTournament/Content/Paks/Game.pak"),
+				os.O_WRONLY, 0)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			_, err = file.WriteAt([]byte("bad"), 9*releaseSampleBytes-3)
+			return err
+		}},
+	} {
+		packager := newTestPackager(t, Options{})
+		tempPath := filepath.Join(packager.workingDir, "extracted")
+		writeTree(t, tempPath, files)
+		snapshot, err := snapshotRelease(tempPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		releasePath := filepath.Join(packager.releaseDir, version)
+		err = os.Rename(tempPath, releasePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = packager.writePackagingMarker(version, "http://example.com/release.zip")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.damage != nil {
+			err = test.damage(releasePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err = packager.verifyMovedRelease(snapshot, releasePath, version)
+		if test.damage == nil {
+			if err != nil {
+				t.Errorf("%s: %s", test.description, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: bad move wasn't caught", test.description)
+			continue
+		}
+		for _, path := range []string{releasePath, packager.packagingMarkerPath(version)} {
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("%s: %s wasn't removed", test.description, path)
+			}
+		}
+	}
+}
+
+func TestSnapshotReleaseSamplesLargeTrees(t *testing.T) {
+	files := make(map[string]string)
+	for i := 0; i < 10*releaseSampleFiles; i++ {
+		files[fmt.Sprintf("UnrealTournament/Content/%04d.txt", i)] = fmt.Sprint(i)
+	}
+	dir := tempDir(t)
+	writeTree(t, dir, files)
+	snapshot, err := snapshotRelease(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.files != len(files) {
+		t.Errorf("Snapshot has %d files, expected %d", snapshot.files, len(files))
+	}
+	if len(snapshot.samples) > releaseSampleFiles {
+		t.Errorf("Sampled %d files, at most %d expected",
+			len(snapshot.samples), releaseSampleFiles)
+	}
+}
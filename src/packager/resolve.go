@@ -0,0 +1,108 @@
+package packager
+
+import (
+	"github.com/donovansolms/ut4-update-packager/src/packager/models"
+)
+
+// UpgradePath is the resolved list of upgrade packages that takes
+// FromVersion to the latest version
+type UpgradePath struct {
+	FromVersion string
+	ToVersion   string
+	Packages    []models.Ut4UpdatePackages
+	// Error is set when no path is available
+	Error string `json:",omitempty"`
+}
+
+// ResolveUpgradePaths resolves the upgrade packages from each of
+// fromVersions to the latest version in channel. Only packages of the
+// scope this Packager builds are used, so content packages never stand in
+// for whole-install ones. Each path uses the fewest packages, following
+// chains where no direct package exists
+func (packager *Packager) ResolveUpgradePaths(
+	fromVersions []string,
+	channel string) ([]UpgradePath, error) {
+	db, err := packager.openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var updatePackages []models.Ut4UpdatePackages
+	query := db.Where(
+		"channel = ? AND scope = ? AND is_deleted = 0",
+		channel,
+		packager.packageScope(),
+	).Find(&updatePackages)
+	if query.Error != nil {
+		return nil, query.Error
+	}
+	latestVersion := ""
+	packagesFrom := make(map[string][]models.Ut4UpdatePackages)
+	for _, updatePackage := range updatePackages {
+		packagesFrom[updatePackage.FromVersion] = append(
+			packagesFrom[updatePackage.FromVersion], updatePackage)
+		if latestVersion == "" ||
+			packager.compareVersions(updatePackage.ToVersion, latestVersion) > 0 {
+			latestVersion = updatePackage.ToVersion
+		}
+	}
+
+	paths := make([]UpgradePath, 0, len(fromVersions))
+	for _, fromVersion := range fromVersions {
+		path := UpgradePath{
+			FromVersion: fromVersion,
+			ToVersion:   latestVersion,
+		}
+		switch {
+		case latestVersion == "":
+			path.Error = "No upgrade packages are available"
+		case fromVersion == latestVersion:
+			// Already up to date, nothing to apply
+		default:
+			path.Packages = shortestUpgradePath(
+				packagesFrom,
+				fromVersion,
+				latestVersion)
+			if path.Packages == nil {
+				path.Error = "No upgrade path available"
+			}
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// shortestUpgradePath does a breadth first search for the fewest packages
+// from fromVersion to toVersion. Returns nil when there is no path
+func shortestUpgradePath(
+	packagesFrom map[string][]models.Ut4UpdatePackages,
+	fromVersion string,
+	toVersion string) []models.Ut4UpdatePackages {
+	previous := map[string]models.Ut4UpdatePackages{}
+	visited := map[string]bool{fromVersion: true}
+	queue := []string{fromVersion}
+	for len(queue) > 0 {
+		version := queue[0]
+		queue = queue[1:]
+		for _, updatePackage := range packagesFrom[version] {
+			if visited[updatePackage.ToVersion] {
+				continue
+			}
+			visited[updatePackage.ToVersion] = true
+			previous[updatePackage.ToVersion] = updatePackage
+			if updatePackage.ToVersion != toVersion {
+				queue = append(queue, updatePackage.ToVersion)
+				continue
+			}
+			var path []models.Ut4UpdatePackages
+			for at := toVersion; at != fromVersion; {
+				step := previous[at]
+				path = append([]models.Ut4UpdatePackages{step}, path...)
+				at = step.FromVersion
+			}
+			return path
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package packager
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/donovansolms/ut4-update-packager/src/packager/models"
+)
+
+// addUpdatePackages records update packages between the version pairs in
+// the stable channel
+func addUpdatePackages(t *testing.T, fixture *fixture, pairs []VersionPair) {
+	t.Helper()
+	db := fixture.db()
+	for _, pair := range pairs {
+		err := db.Create(&models.Ut4UpdatePackages{
+			FromVersion: pair.FromVersion,
+			ToVersion:   pair.ToVersion,
+			UpdateURL: fmt.Sprintf("http://update.donovansolms.com/%s-%s.tar.gz",
+				pair.FromVersion, pair.ToVersion),
+			Channel:     ChannelStable,
+			DateCreated: time.Now(),
+		}).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestResolveUpgradePaths(t *testing.T) {
+	fixture := newFixture(t)
+	packager := fixture.newPackager(Options{})
+	addUpdatePackages(t, fixture, []VersionPair{
+		{FromVersion: "3395761", ToVersion: "3450000"},
+		{FromVersion: "3450000", ToVersion: "3525360"},
+		{FromVersion: "3420000", ToVersion: "3525360"},
+	})
+
+	paths, err := packager.ResolveUpgradePaths(
+		[]string{"3395761", "3420000", "3525360", "3000000"},
+		ChannelStable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		steps []string
+		err   bool
+	}{
+		{steps: []string{"3395761-3450000", "3450000-3525360"}},
+		{steps: []string{"3420000-3525360"}},
+		{},
+		{err: true},
+	}
+	if len(paths) != len(expected) {
+		t.Fatalf("Resolved %d paths, expected %d", len(paths), len(expected))
+	}
+	for i, path := range paths {
+		if path.ToVersion != "3525360" {
+			t.Errorf("%s: path leads to %s", path.FromVersion, path.ToVersion)
+		}
+		if (path.Error != "") != expected[i].err {
+			t.Errorf("%s: error is %q", path.FromVersion, path.Error)
+		}
+		var steps []string
+		for _, updatePackage := range path.Packages {
+			steps = append(steps, updatePackage.FromVersion+"-"+updatePackage.ToVersion)
+		}
+		if !reflect.DeepEqual(steps, expected[i].steps) {
+			t.Errorf("%s: path is %v, expected %v",
+				path.FromVersion, steps, expected[i].steps)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package packager
+
+import (
+	"os"
+	"sort"
+
+	"github.com/donovansolms/ut4-update-packager/src/packager/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// PruneBlogPosts keeps the newest keep processed blog posts by published
+// date and soft-deletes the older ones. Posts still in the release feed
+// are never deleted, the GUID check would otherwise process them again.
+// Returns the number of pruned posts
+func (packager *Packager) PruneBlogPosts(keep int) (int, error) {
+	if keep < 0 {
+		keep = 0
+	}
+	feed, err := packager.fetchFeed()
+	if err != nil {
+		return 0, err
+	}
+	referenced := make(map[string]bool)
+	for _, item := range feed.Items {
+		referenced[postKey(item)] = true
+	}
+
+	db, err := packager.openDB()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var blogPosts []models.Ut4BlogPost
+	query := db.Where("is_deleted = 0").
+		Order("date_published desc, id desc").
+		Find(&blogPosts)
+	if query.Error != nil {
+		return 0, query.Error
+	}
+	if len(blogPosts) <= keep {
+		return 0, nil
+	}
+
+	pruned := 0
+	for _, blogPost := range blogPosts[keep:] {
+		if referenced[blogPost.GUID] {
+			continue
+		}
+		query = db.Model(&blogPost).Update("is_deleted", 1)
+		if query.Error != nil {
+			return pruned, query.Error
+		}
+		pruned++
+	}
+	log.WithFields(log.Fields{
+		"kept":   len(blogPosts) - pruned,
+		"pruned": pruned,
+	}).Info("Pruned blog post history")
+	return pruned, nil
+}
+
+// PrunePackages keeps the packages to the newest keep versions from every
+// version, channel and scope and soft-deletes the older ones. At least one
+// package is kept, which is the one to the latest version. Pruned
+// packages are removed from the package dir, and from storage when the
+// Uploader is a PackageRemover, unless a kept package shares them. Chunks
+// no remaining package lists are removed the same way. Returns the number
+// of pruned packages
+func (packager *Packager) PrunePackages(keep int) (int, error) {
+	if keep < 1 {
+		keep = 1
+	}
+	db, err := packager.openDB()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var updatePackages []models.Ut4UpdatePackages
+	query := db.Where("is_deleted = 0").Find(&updatePackages)
+	if query.Error != nil {
+		return 0, query.Error
+	}
+	// Newest first within each from version, channel and scope
+	sort.SliceStable(updatePackages, func(i, j int) bool {
+		a, b := updatePackages[i], updatePackages[j]
+		if a.FromVersion != b.FromVersion {
+			return a.FromVersion < b.FromVersion
+		}
+		if a.Channel != b.Channel {
+			return a.Channel < b.Channel
+		}
+		if a.Scope != b.Scope {
+			return a.Scope < b.Scope
+		}
+		if order := packager.compareVersions(a.ToVersion, b.ToVersion); order != 0 {
+			return order > 0
+		}
+		return a.ID > b.ID
+	})
+
+	keptURLs := make(map[string]bool)
+	var pruned []models.Ut4UpdatePackages
+	kept := 0
+	for i, updatePackage := range updatePackages {
+		if i == 0 ||
+			updatePackage.FromVersion != updatePackages[i-1].FromVersion ||
+			updatePackage.Channel != updatePackages[i-1].Channel ||
+			updatePackage.Scope != updatePackages[i-1].Scope {
+			kept = 0
+		}
+		if kept < keep {
+			keptURLs[updatePackage.UpdateURL] = true
+			kept++
+			continue
+		}
+		pruned = append(pruned, updatePackage)
+	}
+
+	for i, updatePackage := range pruned {
+		// Delete the row first so it never points at a removed package
+		query = db.Model(&updatePackage).Update("is_deleted", 1)
+		if query.Error != nil {
+			return i, query.Error
+		}
+		if keptURLs[updatePackage.UpdateURL] {
+			continue
+		}
+		err = packager.removePackage(updatePackage)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"fromVersion": updatePackage.FromVersion,
+				"toVersion":   updatePackage.ToVersion,
+				"err":         "remove_package",
+			}).Warning(err.Error())
+		}
+	}
+	log.WithFields(log.Fields{
+		"kept":   len(updatePackages) - len(pruned),
+		"pruned": len(pruned),
+	}).Info("Pruned upgrade packages")
+
+	// Chunks only the pruned packages listed aren't needed anymore
+	_, err = packager.pruneChunks()
+	if err != nil {
+		log.WithField("err", "prune_chunks").Warning(err.Error())
+	}
+	return len(pruned), nil
+}
+
+// removePackage removes the package of updatePackage with its signature,
+// operations and chunk sidecars and any multipart upload state from the
+// package dir and, when supported, from storage
+func (packager *Packager) removePackage(updatePackage models.Ut4UpdatePackages) error {
+	if remover, ok := packager.options.Uploader.(PackageRemover); ok {
+		err := remover.Remove(updatePackage.UpdateURL)
+		if err != nil {
+			return err
+		}
+	}
+	packagePath, err := packager.findLocalPackage(
+		updatePackage.FromVersion,
+		updatePackage.ToVersion)
+	if err != nil && updatePackage.DeltaHash != "" {
+		packagePath, err = packager.packagePathFromURL(updatePackage.UpdateURL)
+	}
+	if err != nil {
+		// Streamed packages were never stored locally
+		return nil
+	}
+	for _, suffix := range []string{
+		signatureSuffix,
+		operationsSidecarSuffix,
+		chunkRefsSuffix,
+		multipartStateSuffix,
+	} {
+		err = os.Remove(packagePath + suffix)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	err = os.Remove(packagePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package packager
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/donovansolms/ut4-update-packager/src/packager/models"
+)
+
+func TestPruneBlogPostsKeepsNewestAndReferenced(t *testing.T) {
+	fixture := newFixture(t)
+	packager := fixture.newPackager(Options{})
+	db := fixture.db()
+	now := time.Now().Truncate(time.Second)
+	for i, guid := range []string{"post-1", "post-2", "post-3", "post-4", "post-5"} {
+		blogPost := models.Ut4BlogPost{
+			Title:         "UT Release " + guid,
+			GUID:          guid,
+			DatePublished: now.Add(time.Duration(i) * time.Hour),
+			DateCreated:   now,
+		}
+		err := db.Create(&blogPost).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Posts still in the feed are referenced and never pruned
+	fixture.addPost("UT Release post-1", "post-1", "", now)
+
+	pruned, err := packager.PruneBlogPosts(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned != 2 {
+		t.Errorf("Pruned %d posts, expected 2", pruned)
+	}
+	var kept []string
+	err = db.Table("ut4_blog_posts").
+		Where("is_deleted = 0").
+		Order("guid").
+		Pluck("guid", &kept).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"post-1", "post-4", "post-5"}
+	if !reflect.DeepEqual(kept, expected) {
+		t.Errorf("Kept posts %v, expected %v", kept, expected)
+	}
+}
+
+func TestPrunePackagesKeepsNewestPerFromVersion(t *testing.T) {
+	fixture := newFixture(t)
+	packager := fixture.newPackager(Options{})
+	releases := []int{3395761, 3420000, 3450000, 3525360}
+	for _, changelist := range releases {
+		installTestVersion(t, packager, changelist, map[string]string{
+			"UnrealTournament/Content/a.txt": fmt.Sprint(changelist),
+		})
+	}
+	// Every release adds a package from each older version
+	for i, fromVersion := range releases[:2] {
+		for _, toVersion := range releases[i+1:] {
+			_, err := packager.GeneratePackage(fmt.Sprint(fromVersion), fmt.Sprint(toVersion))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	prunedPath, err := packager.findLocalPackage("3395761", "3420000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An interrupted multipart upload leaves its state next to the package
+	err = os.WriteFile(prunedPath+multipartStateSuffix, []byte("{}"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pruned, err := packager.PrunePackages(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned != 1 {
+		t.Errorf("Pruned %d packages, expected 1", pruned)
+	}
+	var kept []models.Ut4UpdatePackages
+	err = fixture.db().
+		Where("is_deleted = 0").
+		Order("from_version, to_version").
+		Find(&kept).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keptPairs []string
+	for _, updatePackage := range kept {
+		keptPairs = append(keptPairs, updatePackage.FromVersion+"-"+updatePackage.ToVersion)
+	}
+	expected := []string{
+		"3395761-3450000",
+		"3395761-3525360",
+		"3420000-3450000",
+		"3420000-3525360",
+	}
+	if !reflect.DeepEqual(keptPairs, expected) {
+		t.Errorf("Kept packages %v, expected %v", keptPairs, expected)
+	}
+	for _, path := range []string{prunedPath, prunedPath + multipartStateSuffix} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s of the pruned package wasn't removed", path)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package packager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/donovansolms/ut4-update-packager/src/packager/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// ReuploadMissing finds the upgrade packages whose UpdateURL is empty or
+// unreachable and uploads their local package again, updating the URL.
+// Packages sharing a delta are uploaded once from the file of the package
+// they share. Packages without a local file, like streamed ones, are
+// logged and skipped, and reported together in the returned error
+func (packager *Packager) ReuploadMissing() error {
+	db, err := packager.openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var updatePackages []models.Ut4UpdatePackages
+	query := db.Where("is_deleted = 0").Find(&updatePackages)
+	if query.Error != nil {
+		return query.Error
+	}
+	// uploaded holds the new URL of every package file uploaded this run
+	uploaded := make(map[string]string)
+	reuploaded := 0
+	var failed []string
+	for _, updatePackage := range updatePackages {
+		if updatePackage.UpdateURL != "" && packager.urlReachable(updatePackage.UpdateURL) {
+			continue
+		}
+		logFields := log.Fields{
+			"fromVersion": updatePackage.FromVersion,
+			"toVersion":   updatePackage.ToVersion,
+			"url":         updatePackage.UpdateURL,
+		}
+		log.WithFields(logFields).Info("Package URL is missing or unreachable")
+		updateURL, err := packager.reuploadPackage(updatePackage, updatePackages, uploaded)
+		if err == nil {
+			err = db.Model(&updatePackage).Update("update_url", updateURL).Error
+		}
+		if err != nil {
+			logFields["err"] = "reupload_package"
+			log.WithFields(logFields).Error(err.Error())
+			failed = append(failed, fmt.Sprintf("%s to %s: %s",
+				templateFromVersion(updatePackage.FromVersion),
+				updatePackage.ToVersion,
+				err.Error()))
+			continue
+		}
+		reuploaded++
+	}
+	log.WithFields(log.Fields{
+		"packages": reuploaded,
+		"failed":   len(failed),
+	}).Info("Reuploaded packages")
+	if len(failed) > 0 {
+		return fmt.Errorf("%d package(s) couldn't be reuploaded: %s",
+			len(failed), strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// reuploadPackage uploads the local file of updatePackage and returns its
+// URL. Rows sharing a delta are resolved through the row of updatePackages
+// whose file it is. Files already in uploaded aren't uploaded again
+func (packager *Packager) reuploadPackage(
+	updatePackage models.Ut4UpdatePackages,
+	updatePackages []models.Ut4UpdatePackages,
+	uploaded map[string]string) (string, error) {
+	owner := updatePackage
+	packagePath, err := packager.findLocalPackage(
+		updatePackage.FromVersion,
+		updatePackage.ToVersion)
+	if err != nil && updatePackage.DeltaHash != "" {
+		for _, candidate := range updatePackages {
+			if candidate.DeltaHash != updatePackage.DeltaHash ||
+				candidate.Scope != updatePackage.Scope ||
+				candidate.ID == updatePackage.ID {
+				continue
+			}
+			candidatePath, candidateErr := packager.findLocalPackage(
+				candidate.FromVersion,
+				candidate.ToVersion)
+			if candidateErr == nil {
+				owner, packagePath, err = candidate, candidatePath, nil
+				break
+			}
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	if updateURL, ok := uploaded[packagePath]; ok {
+		return updateURL, nil
+	}
+	packageHash, err := hashFile(packagePath)
+	if err != nil {
+		return "", err
+	}
+	// The file is uploaded under the pair it was built for
+	updateURL, err := packager.options.Uploader.Upload(
+		packagePath,
+		TemplateValues{
+			FromVersion: templateFromVersion(owner.FromVersion),
+			ToVersion:   owner.ToVersion,
+			Platform:    packagePlatform,
+			Hash:        packageHash,
+		})
+	if err != nil {
+		return "", err
+	}
+	uploaded[packagePath] = updateURL
+	return updateURL, nil
+}
+
+// urlReachable checks if a HEAD request to url succeeds
+func (packager *Packager) urlReachable(url string) bool {
+	resp, err := packager.httpClient.Head(url)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode >= 200 && resp.StatusCode < 300
+}
+
+// findLocalPackage returns the path of the package from fromVersion to
+// toVersion in the package dir. A {hash} in the name template matches any
+// hash
+func (packager *Packager) findLocalPackage(
+	fromVersion string,
+	toVersion string) (string, error) {
+	pattern := RenderTemplate(
+		strings.Replace(packager.options.PackageNameTemplate, "{hash}", "*", -1),
+		TemplateValues{
+			FromVersion: templateFromVersion(fromVersion),
+			ToVersion:   toVersion,
+			Platform:    packagePlatform,
+		})
+	matches, err := filepath.Glob(filepath.Join(packager.packageDir, pattern))
+	if err != nil {
+		return "", err
+	}
+	var packagePaths []string
+	for _, match := range matches {
+		if strings.HasSuffix(match, signatureSuffix) ||
+			strings.HasSuffix(match, operationsSidecarSuffix) ||
+			strings.HasSuffix(match, chunkRefsSuffix) ||
+			strings.HasSuffix(match, multipartStateSuffix) {
+			continue
+		}
+		packagePaths = append(packagePaths, match)
+	}
+	switch len(packagePaths) {
+	case 0:
+		return "", fmt.Errorf("No local package from %s to %s", fromVersion, toVersion)
+	case 1:
+		_, err = os.Stat(packagePaths[0])
+		return packagePaths[0], err
+	}
+	return "", fmt.Errorf("%d local packages from %s to %s",
+		len(packagePaths), fromVersion, toVersion)
+}
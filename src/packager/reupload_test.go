@@ -0,0 +1,130 @@
+package packager
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/donovansolms/ut4-update-packager/src/packager/models"
+)
+
+func TestReuploadMissingRefreshesDeadURL(t *testing.T) {
+	fixture := newFixture(t)
+	packager := fixture.newPackager(Options{})
+	fixture.installVersion(3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+	})
+	fixture.installVersion(3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+	})
+	_, err := packager.GeneratePackage("3395761", "3525360")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := fixture.db()
+	deadURL := fixture.server.URL + "/dead/3395761-3525360.tar.gz"
+	err = db.Model(&models.Ut4UpdatePackages{}).
+		Where("from_version = ?", "3395761").
+		Update("update_url", deadURL).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The package is uploaded to where the fixture serves it
+	packager = fixture.newPackager(Options{
+		Uploader: NewTemplateUploader(fixture.server.URL + "/{from}-{to}.tar.gz"),
+	})
+	fixture.downloads["3395761-3525360.tar.gz"] = []byte("package")
+	err = packager.ReuploadMissing()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var updatePackage models.Ut4UpdatePackages
+	err = db.Where("from_version = ?", "3395761").First(&updatePackage).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedURL := fixture.server.URL + "/3395761-3525360.tar.gz"
+	if updatePackage.UpdateURL != expectedURL {
+		t.Fatalf("URL is %s, expected %s", updatePackage.UpdateURL, expectedURL)
+	}
+
+	// Reachable URLs are left alone, without the local package uploading
+	// again would fail
+	err = os.Remove(filepath.Join(fixture.packageDir, "3395761-3525360.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = packager.ReuploadMissing()
+	if err != nil {
+		t.Errorf("Reachable package was uploaded again: %s", err)
+	}
+}
+
+func TestReuploadMissingSharedDelta(t *testing.T) {
+	fixture := newFixture(t)
+	files := map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+	}
+	fixture.installVersion(3395761, files)
+	fixture.installVersion(3450000, files)
+	downloadURL := fixture.serveRelease(3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+	})
+	fixture.addPost("UT Release 3525360", "post-3525360", downloadURL, time.Now())
+	packager := fixture.newPackager(Options{ShareDeltas: true})
+	_, err := packager.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both shared rows and a row without a local file point nowhere
+	db := fixture.db()
+	err = db.Create(&models.Ut4UpdatePackages{
+		FromVersion: "3000000",
+		ToVersion:   "3525360",
+		Channel:     "stable",
+		DateCreated: time.Now(),
+	}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadURL := fixture.server.URL + "/dead/package.tar.gz"
+	err = db.Model(&models.Ut4UpdatePackages{}).
+		Where("to_version = ?", "3525360").
+		Update("update_url", deadURL).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packager = fixture.newPackager(Options{
+		ShareDeltas: true,
+		Uploader:    NewTemplateUploader(fixture.server.URL + "/{from}-{to}.tar.gz"),
+	})
+	fixture.downloads["3395761-3525360.tar.gz"] = []byte("package")
+	fixture.downloads["3450000-3525360.tar.gz"] = []byte("package")
+	err = packager.ReuploadMissing()
+	if err == nil {
+		t.Fatal("The row without a local package wasn't reported")
+	}
+	if !strings.Contains(err.Error(), "3000000") {
+		t.Errorf("Error doesn't name the missing package: %s", err)
+	}
+
+	var rows []models.Ut4UpdatePackages
+	db.Where("to_version = ? AND delta_hash != ''", "3525360").Find(&rows)
+	if len(rows) != 2 {
+		t.Fatalf("Found %d shared rows, expected 2", len(rows))
+	}
+	if rows[0].UpdateURL == deadURL || rows[0].UpdateURL != rows[1].UpdateURL {
+		t.Errorf("Shared rows have URLs %s and %s, expected one new URL",
+			rows[0].UpdateURL, rows[1].UpdateURL)
+	}
+	var missing models.Ut4UpdatePackages
+	db.Where("from_version = ?", "3000000").First(&missing)
+	if missing.UpdateURL != deadURL {
+		t.Errorf("Row without a local package got URL %s", missing.UpdateURL)
+	}
+}
@@ -0,0 +1,276 @@
+package packager
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/donovansolms/ut4-update-packager/src/packager/models"
+)
+
+func TestRunPackagesNewRelease(t *testing.T) {
+	fixture := newFixture(t)
+	fixture.installVersion(3395761, map[string]string{
+		"UnrealTournament/Content/Paks/game.pak": "old pak",
+		"UnrealTournament/Config/Default.ini":    "setting=1",
+		"UnrealTournament/Content/Removed.txt":   "removed",
+	})
+	downloadURL := fixture.serveRelease(3525360, map[string]string{
+		"UnrealTournament/Content/Paks/game.pak": "old pak",
+		"UnrealTournament/Config/Default.ini":    "setting=2",
+		"UnrealTournament/Content/Added.txt":     "added",
+	})
+	fixture.addPost("UT Release 3525360", "post-3525360", downloadURL, time.Now())
+	packager := fixture.newPackager(Options{})
+
+	result, err := packager.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Version != "3525360" {
+		t.Fatalf("Run packaged version %q", result.Version)
+	}
+	expectedPairs := []VersionPair{{FromVersion: "3395761", ToVersion: "3525360"}}
+	if !reflect.DeepEqual(result.Packages, expectedPairs) {
+		t.Fatalf("Run packaged %v, expected %v", result.Packages, expectedPairs)
+	}
+
+	packagePath := filepath.Join(fixture.packageDir, "3395761-3525360.tar.gz")
+	files := readPackage(t, packagePath)
+	if files["UnrealTournament/Config/Default.ini"] != "setting=2" {
+		t.Errorf("Modified file in package is %q",
+			files["UnrealTournament/Config/Default.ini"])
+	}
+	if files["UnrealTournament/Content/Added.txt"] != "added" {
+		t.Errorf("Added file in package is %q",
+			files["UnrealTournament/Content/Added.txt"])
+	}
+	if _, ok := files["UnrealTournament/Content/Paks/game.pak"]; ok {
+		t.Error("Unchanged file is in the package")
+	}
+	var operations map[string]DeltaOperation
+	err = json.Unmarshal([]byte(files[operationsFilename]), &operations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedOperations := map[string]DeltaOperation{
+		modulesBinaryDir + "/" + modulesFilename: {Operation: deltaOperationModified},
+		"UnrealTournament/Config/Default.ini":    {Operation: deltaOperationModified},
+		"UnrealTournament/Content/Added.txt":     {Operation: deltaOperationAdded},
+		"UnrealTournament/Content/Removed.txt":   {Operation: deltaOperationRemoved},
+	}
+	if !reflect.DeepEqual(operations, expectedOperations) {
+		t.Errorf("Operations are %v, expected %v", operations, expectedOperations)
+	}
+
+	db := fixture.db()
+	var updatePackages []models.Ut4UpdatePackages
+	err = db.Find(&updatePackages).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updatePackages) != 1 {
+		t.Fatalf("%d packages recorded, expected 1", len(updatePackages))
+	}
+	updatePackage := updatePackages[0]
+	if updatePackage.FromVersion != "3395761" ||
+		updatePackage.ToVersion != "3525360" ||
+		updatePackage.Channel != ChannelStable ||
+		updatePackage.UpdateURL != "http://update.donovansolms.com/3395761-3525360.tar.gz" {
+		t.Errorf("Recorded package is %+v", updatePackage)
+	}
+	var blogPost models.Ut4BlogPost
+	err = db.Where("guid = ?", "post-3525360").First(&blogPost).Error
+	if err != nil {
+		t.Fatalf("Release post not recorded: %s", err)
+	}
+	var runStats []models.Ut4RunStats
+	db.Find(&runStats)
+	if len(runStats) != 1 || runStats[0].PackageCount != 1 {
+		t.Errorf("Run stats are %+v", runStats)
+	}
+
+	// The post is processed, the next run has nothing to do
+	result, err = packager.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Version != "" || len(result.Packages) != 0 {
+		t.Errorf("Second run packaged %+v", result)
+	}
+}
+
+// failingUploader fails every upload from failVersion and counts the
+// attempts
+type failingUploader struct {
+	Uploader
+	failVersion string
+	attempts    int
+}
+
+func (uploader *failingUploader) Upload(
+	packagePath string,
+	values TemplateValues) (string, error) {
+	if values.FromVersion == uploader.failVersion {
+		uploader.attempts++
+		return "", errors.New("Upload failed")
+	}
+	return uploader.Uploader.Upload(packagePath, values)
+}
+
+func TestRunRetriesAndReportsFailedPackages(t *testing.T) {
+	fixture := newFixture(t)
+	fixture.installVersion(3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+	})
+	fixture.installVersion(3450000, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+	})
+	downloadURL := fixture.serveRelease(3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=3",
+	})
+	fixture.addPost("UT Release 3525360", "post-3525360", downloadURL, time.Now())
+	uploader := &failingUploader{
+		Uploader:    NewTemplateUploader(defaultPackageURLTemplate),
+		failVersion: "3395761",
+	}
+	packager := fixture.newPackager(Options{
+		PackageRetries: 2,
+		Uploader:       uploader,
+	})
+
+	result, err := packager.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uploader.attempts != 3 {
+		t.Errorf("Failed package was attempted %d times, expected 3", uploader.attempts)
+	}
+	if len(result.Failures) != 1 {
+		t.Fatalf("Run reported failures %+v", result.Failures)
+	}
+	failure := result.Failures[0]
+	if failure.FromVersion != "3395761" || failure.ToVersion != "3525360" ||
+		failure.Attempts != 3 || failure.Error == "" {
+		t.Errorf("Failure is %+v", failure)
+	}
+	expectedPairs := []VersionPair{{FromVersion: "3450000", ToVersion: "3525360"}}
+	if !reflect.DeepEqual(result.Packages, expectedPairs) {
+		t.Errorf("Run packaged %v, expected %v", result.Packages, expectedPairs)
+	}
+
+	// The post stays unprocessed so the failed pair is picked up again
+	var count int
+	fixture.db().Table("ut4_blog_posts").Where("guid = ?", "post-3525360").Count(&count)
+	if count != 0 {
+		t.Error("Post with a failed package was marked processed")
+	}
+}
+
+func TestRunSkipsCurrentVersion(t *testing.T) {
+	fixture := newFixture(t)
+	fixture.installVersion(3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+	})
+	downloadURL := fixture.serveRelease(3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+	})
+	fixture.addPost("UT Release 3525360", "post-3525360", downloadURL, time.Now())
+	packager := fixture.newPackager(Options{})
+	_, err := packager.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A file only in the installed release shows whether it was replaced
+	untouchedPath := filepath.Join(fixture.releaseDir, "3525360", "untouched")
+	err = ioutil.WriteFile(untouchedPath, nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixture.addPost("UT Release 3525360 again", "post-3525360-again",
+		downloadURL, time.Now().Add(time.Minute))
+	result, err := packager.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Packages) != 0 {
+		t.Errorf("Current version was packaged again: %v", result.Packages)
+	}
+	if _, err := os.Stat(untouchedPath); err != nil {
+		t.Error("Current version was replaced")
+	}
+	var count int
+	fixture.db().Table("ut4_blog_posts").
+		Where("guid = ?", "post-3525360-again").
+		Count(&count)
+	if count != 1 {
+		t.Error("Post of the current version wasn't marked processed")
+	}
+
+	// Reprocessing is opt-in
+	fixture.addPost("UT Release 3525360 rebuild", "post-3525360-rebuild",
+		downloadURL, time.Now().Add(2*time.Minute))
+	packager = fixture.newPackager(Options{Reprocess: true})
+	_, err = packager.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(untouchedPath); !os.IsNotExist(err) {
+		t.Error("Reprocessing didn't replace the current version")
+	}
+}
+
+func TestRunSkipsOlderRelease(t *testing.T) {
+	fixture := newFixture(t)
+	fixture.installVersion(3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+	})
+	// The link shows the version, so the release is skipped before it is
+	// downloaded
+	downloadURL := fixture.serveRelease(3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+	})
+	fixture.addPost("UT Release 3395761", "post-3395761", downloadURL, time.Now())
+	packager := fixture.newPackager(Options{})
+
+	result, err := packager.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Packages) != 0 {
+		t.Errorf("Older release was packaged: %v", result.Packages)
+	}
+
+	// Without a version in the link the release is checked after extracting
+	name := "UnrealTournament-Client-XAN-Linux.zip"
+	fixture.downloads[name] = zipFiles(t, releaseFiles(3420000, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+	}))
+	fixture.addPost("UT Release 3420000", "post-3420000",
+		fixture.server.URL+"/"+name, time.Now().Add(time.Minute))
+	result, err = packager.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Packages) != 0 {
+		t.Errorf("Older release was packaged: %v", result.Packages)
+	}
+	for _, version := range []string{"3395761", "3420000"} {
+		if _, err := os.Stat(filepath.Join(fixture.releaseDir, version)); !os.IsNotExist(err) {
+			t.Errorf("Older release %s was installed", version)
+		}
+	}
+	var count int
+	fixture.db().Table("ut4_blog_posts").
+		Where("guid IN (?)", []string{"post-3395761", "post-3420000"}).
+		Count(&count)
+	if count != 2 {
+		t.Errorf("%d of the older release posts were marked processed, expected 2", count)
+	}
+}
@@ -0,0 +1,106 @@
+package packager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// SelfTestCheck is the outcome of a single self-test check
+type SelfTestCheck struct {
+	Name string
+	// Err is nil when the check passed
+	Err error
+}
+
+// SelfTest checks that the configured dirs are writable, the database
+// connects and migrates and the feed parses. When checkDownload is set the
+// download link of the newest release post is checked to be reachable as
+// well. Nothing is changed apart from creating the dirs and migrating
+func (packager *Packager) SelfTest(checkDownload bool) []SelfTestCheck {
+	var checks []SelfTestCheck
+	dirs := []struct {
+		name string
+		path string
+	}{
+		{"working dir", packager.workingDir},
+		{"payload dir", packager.payloadDir},
+		{"release dir", packager.releaseDir},
+		{"package dir", packager.packageDir},
+	}
+	for _, dir := range dirs {
+		checks = append(checks, SelfTestCheck{
+			Name: fmt.Sprintf("%s is writable", dir.name),
+			Err:  checkWritable(dir.path),
+		})
+	}
+
+	checks = append(checks, SelfTestCheck{
+		Name: "database connects and migrates",
+		Err:  packager.Migrate(),
+	})
+
+	parser := gofeed.NewParser()
+	parser.Client = packager.httpClient
+	feed, err := parser.ParseURL(packager.releaseFeedURL)
+	checks = append(checks, SelfTestCheck{
+		Name: "release feed parses",
+		Err:  err,
+	})
+	if !checkDownload {
+		return checks
+	}
+	if err != nil {
+		checks = append(checks, SelfTestCheck{
+			Name: "latest download link is reachable",
+			Err:  fmt.Errorf("Release feed didn't parse"),
+		})
+		return checks
+	}
+	checks = append(checks, SelfTestCheck{
+		Name: "latest download link is reachable",
+		Err:  packager.checkLatestDownload(feed),
+	})
+	return checks
+}
+
+// checkLatestDownload checks that the download link of the newest release
+// post in feed responds to a HEAD request
+func (packager *Packager) checkLatestDownload(feed *gofeed.Feed) error {
+	items, err := packager.extractReleasePosts(feed)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return fmt.Errorf("No release posts in the feed")
+	}
+	downloadURL, err := packager.extractUpdateDownloadLinkFromPost(items[0])
+	if err != nil {
+		return err
+	}
+	if !isHTTPURL(downloadURL) {
+		return nil
+	}
+	_, err = packager.getDownloadSize(downloadURL)
+	return err
+}
+
+// checkWritable creates dir when missing and checks a file can be written
+// to it
+func checkWritable(dir string) error {
+	if dir == "" {
+		return fmt.Errorf("Not configured")
+	}
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	file, err := ioutil.TempFile(dir, ".selftest")
+	if err != nil {
+		return err
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
@@ -0,0 +1,60 @@
+package packager
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSelfTestReportsUnreachableDatabase(t *testing.T) {
+	fixture := newFixture(t)
+	// The database is in a dir that doesn't exist
+	fixture.dbPath = filepath.Join(fixture.dir, "missing", "packager.db")
+	packager, err := New(
+		fixture.feedURL(),
+		fixture.dbPath,
+		fixture.workingDir,
+		fixture.releaseDir,
+		fixture.packageDir,
+		Options{DatabaseDialect: DialectSQLite})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failed := make(map[string]bool)
+	for _, check := range packager.SelfTest(false) {
+		if check.Err != nil {
+			failed[check.Name] = true
+		}
+	}
+	if !failed["database connects and migrates"] {
+		t.Error("Unreachable database wasn't reported")
+	}
+	if len(failed) != 1 {
+		t.Errorf("Other checks failed: %v", failed)
+	}
+}
+
+func TestSelfTestChecksDownload(t *testing.T) {
+	fixture := newFixture(t)
+	downloadURL := fixture.serveRelease(3525360, nil)
+	fixture.addPost("UT Release 3525360", "post-3525360", downloadURL, time.Now())
+	packager := fixture.newPackager(Options{})
+	for _, check := range packager.SelfTest(true) {
+		if check.Err != nil {
+			t.Errorf("Check '%s' failed: %s", check.Name, check.Err)
+		}
+	}
+
+	// The download of this release isn't served
+	fixture = newFixture(t)
+	fixture.addPost("UT Release 3525360", "post-3525360",
+		fixture.server.URL+"/UnrealTournament-Client-XAN-3525360-Linux.zip",
+		time.Now())
+	packager = fixture.newPackager(Options{})
+	checks := packager.SelfTest(true)
+	last := checks[len(checks)-1]
+	if last.Name != "latest download link is reachable" || last.Err == nil {
+		t.Errorf("Missing download wasn't reported: %+v", last)
+	}
+}
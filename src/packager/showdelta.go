@@ -0,0 +1,91 @@
+package packager
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ShowDelta returns a human readable summary of the changes between
+// fromVersion and the newest installed version. Nothing is packaged
+func (packager *Packager) ShowDelta(fromVersion string) (string, error) {
+	versions, err := packager.GetVersionList()
+	if err != nil {
+		return "", err
+	}
+	if len(versions) == 0 {
+		return "", errors.New("No versions are installed")
+	}
+	packager.sortVersions(versions)
+	toVersion := versions[len(versions)-1]
+	err = packager.validateVersionPair(fromVersion, toVersion)
+	if err != nil {
+		return "", err
+	}
+
+	fromVersionHashes, err := packager.getVersionHashes(fromVersion)
+	if err != nil {
+		return "", err
+	}
+	toVersionHashes, err := packager.getVersionHashes(toVersion)
+	if err != nil {
+		return "", err
+	}
+	deltaOperations := packager.calculateHashDeltaOperations(
+		fromVersionHashes,
+		toVersionHashes)
+	err = packager.postProcessDelta(
+		fromVersion,
+		toVersion,
+		deltaOperations,
+		fromVersionHashes,
+		toVersionHashes)
+	if err != nil {
+		return "", err
+	}
+	_, err = packager.demoteNormalizedModified(deltaOperations, fromVersion, toVersion)
+	if err != nil {
+		return "", err
+	}
+	return formatDelta(fromVersion, toVersion, deltaOperations), nil
+}
+
+// formatDelta formats the delta operations grouped by operation
+func formatDelta(
+	fromVersion string,
+	toVersion string,
+	deltaOperations map[string]DeltaOperation) string {
+	groups := make(map[string][]string)
+	for filename, operation := range deltaOperations {
+		line := filename
+		if operation.Source != "" {
+			line = fmt.Sprintf("%s -> %s", operation.Source, filename)
+		}
+		groups[operation.Operation] = append(groups[operation.Operation], line)
+	}
+	order := []string{
+		deltaOperationAdded,
+		deltaOperationModified,
+		deltaOperationRemoved,
+		deltaOperationMoved,
+	}
+
+	var output bytes.Buffer
+	fmt.Fprintf(&output, "Delta from %s to %s\n", fromVersion, toVersion)
+	for _, operation := range order {
+		fmt.Fprintf(&output, "  %s: %d\n", operation, len(groups[operation]))
+	}
+	for _, operation := range order {
+		lines := groups[operation]
+		if len(lines) == 0 {
+			continue
+		}
+		sort.Strings(lines)
+		fmt.Fprintf(&output, "\n%s:\n", operation)
+		for _, line := range lines {
+			fmt.Fprintf(&output, "  %s\n", line)
+		}
+	}
+	return output.String()
+}
@@ -0,0 +1,46 @@
+package packager
+
+import "testing"
+
+func TestShowDelta(t *testing.T) {
+	packager := newTestPackager(t, Options{})
+	installTestVersion(t, packager, 3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini":  "setting=1",
+		"UnrealTournament/Content/Old.txt":     "moved",
+		"UnrealTournament/Content/Removed.txt": "removed",
+		"UnrealTournament/Content/Kept.txt":    "kept",
+	})
+	installTestVersion(t, packager, 3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+		"UnrealTournament/Content/New.txt":    "moved",
+		"UnrealTournament/Content/Kept.txt":   "kept",
+		"UnrealTournament/Content/Added.txt":  "added",
+	})
+
+	summary, err := packager.ShowDelta("3395761")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "Delta from 3395761 to 3525360\n" +
+		"  added: 1\n" +
+		"  modified: 2\n" +
+		"  removed: 1\n" +
+		"  moved: 1\n" +
+		"\nadded:\n" +
+		"  UnrealTournament/Content/Added.txt\n" +
+		"\nmodified:\n" +
+		"  " + modulesBinaryDir + "/" + modulesFilename + "\n" +
+		"  UnrealTournament/Config/Default.ini\n" +
+		"\nremoved:\n" +
+		"  UnrealTournament/Content/Removed.txt\n" +
+		"\nmoved:\n" +
+		"  UnrealTournament/Content/Old.txt -> UnrealTournament/Content/New.txt\n"
+	if summary != expected {
+		t.Errorf("Summary is\n%s\nexpected\n%s", summary, expected)
+	}
+
+	_, err = packager.ShowDelta("3000000")
+	if err == nil {
+		t.Error("Delta from a version that isn't installed succeeded")
+	}
+}
@@ -0,0 +1,100 @@
+package packager
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// signatureSuffix is appended to the package path for its signed manifest
+const signatureSuffix = ".sig"
+
+// PackageManifest describes a package, it is what gets signed
+type PackageManifest struct {
+	FromVersion string `json:"from_version"`
+	ToVersion   string `json:"to_version"`
+	PackageHash string `json:"package_hash"`
+}
+
+// SignedManifest is the content of a package's .sig file. The signature is
+// over the exact manifest bytes
+type SignedManifest struct {
+	Manifest  json.RawMessage `json:"manifest"`
+	Signature []byte          `json:"signature"`
+}
+
+// loadSigningKey reads a hex encoded Ed25519 seed or private key
+func loadSigningKey(path string) (ed25519.PrivateKey, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil {
+		return nil, fmt.Errorf("Signing key must be hex encoded: %s", err)
+	}
+	switch len(key) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(key), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(key), nil
+	}
+	return nil, fmt.Errorf("Signing key has an invalid length of %d bytes", len(key))
+}
+
+// signPackage writes the signed manifest for the package at packagePath
+func signPackage(
+	key ed25519.PrivateKey,
+	packagePath string,
+	manifest PackageManifest) error {
+	manifestBytes, err := json.Marshal(&manifest)
+	if err != nil {
+		return err
+	}
+	signed := SignedManifest{
+		Manifest:  manifestBytes,
+		Signature: ed25519.Sign(key, manifestBytes),
+	}
+	signedBytes, err := json.Marshal(&signed)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(packagePath+signatureSuffix, signedBytes, 0644)
+}
+
+// VerifySignature checks that the package at packagePath matches its signed
+// manifest and that the manifest was signed by pubKey
+func VerifySignature(packagePath string, pubKey []byte) error {
+	if len(pubKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("Public key has an invalid length of %d bytes", len(pubKey))
+	}
+	signedBytes, err := ioutil.ReadFile(packagePath + signatureSuffix)
+	if err != nil {
+		return err
+	}
+	var signed SignedManifest
+	err = json.Unmarshal(signedBytes, &signed)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(ed25519.PublicKey(pubKey), signed.Manifest, signed.Signature) {
+		return errors.New("Package manifest signature is invalid")
+	}
+	var manifest PackageManifest
+	err = json.Unmarshal(signed.Manifest, &manifest)
+	if err != nil {
+		return err
+	}
+	packageHash, err := hashFile(packagePath)
+	if err != nil {
+		return err
+	}
+	if packageHash != manifest.PackageHash {
+		return errors.New("Package doesn't match the signed manifest")
+	}
+	return nil
+}
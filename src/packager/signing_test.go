@@ -0,0 +1,135 @@
+package packager
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeSigningKey writes a new hex encoded signing key to dir and returns
+// its path with the public key
+func writeSigningKey(t *testing.T, dir string) (string, ed25519.PublicKey) {
+	t.Helper()
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(dir, "signing.key")
+	err = ioutil.WriteFile(keyPath, []byte(hex.EncodeToString(privateKey.Seed())), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyPath, publicKey
+}
+
+func TestSignedPackageVerifies(t *testing.T) {
+	keyPath, publicKey := writeSigningKey(t, tempDir(t))
+	uploader := &recordingUploader{
+		Uploader: NewTemplateUploader(defaultPackageURLTemplate),
+	}
+	packager := newTestPackager(t, Options{
+		SigningKeyPath: keyPath,
+		Uploader:       uploader,
+	})
+	installTestVersion(t, packager, 3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+	})
+	installTestVersion(t, packager, 3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+	})
+	updatePackage, err := packager.GeneratePackage("3395761", "3525360")
+	if err != nil {
+		t.Fatal(err)
+	}
+	packagePath := filepath.Join(packager.packageDir, "3395761-3525360.tar.gz")
+	// The signature is uploaded apart from the package and its URL recorded
+	expectedSignatureURL := updatePackage.UpdateURL + signatureSuffix
+	if updatePackage.SignatureURL != expectedSignatureURL {
+		t.Errorf("Signature URL is %q, expected %q",
+			updatePackage.SignatureURL, expectedSignatureURL)
+	}
+
+	err = VerifySignature(packagePath, publicKey)
+	if err != nil {
+		t.Fatalf("Signed package doesn't verify: %s", err)
+	}
+	expectedUploads := []string{
+		"3395761-3525360.tar.gz" + signatureSuffix,
+		"3395761-3525360.tar.gz",
+	}
+	if len(uploader.uploaded) != 2 ||
+		uploader.uploaded[0] != expectedUploads[0] ||
+		uploader.uploaded[1] != expectedUploads[1] {
+		t.Errorf("Uploads are %v, expected %v", uploader.uploaded, expectedUploads)
+	}
+
+	otherPublicKey, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if VerifySignature(packagePath, otherPublicKey) == nil {
+		t.Error("Package verified with another key")
+	}
+}
+
+func TestTamperedPackageFailsVerification(t *testing.T) {
+	dir := tempDir(t)
+	keyPath, publicKey := writeSigningKey(t, dir)
+	key, err := loadSigningKey(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packagePath := filepath.Join(dir, "3395761-3525360.tar.gz")
+	err = ioutil.WriteFile(packagePath, []byte("package"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packageHash, err := hashFile(packagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = signPackage(key, packagePath, PackageManifest{
+		FromVersion: "3395761",
+		ToVersion:   "3525360",
+		PackageHash: packageHash,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = VerifySignature(packagePath, publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.OpenFile(packagePath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte("tampered"))
+	file.Close()
+	if VerifySignature(packagePath, publicKey) == nil {
+		t.Error("Tampered package verified")
+	}
+}
+
+func TestSignatureURLWithDefaultUploader(t *testing.T) {
+	keyPath, _ := writeSigningKey(t, tempDir(t))
+	packager := newTestPackager(t, Options{SigningKeyPath: keyPath})
+	installTestVersion(t, packager, 3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+	})
+	installTestVersion(t, packager, 3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+	})
+	updatePackage, err := packager.GeneratePackage("3395761", "3525360")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "http://update.donovansolms.com/3395761-3525360.tar.gz" + signatureSuffix
+	if updatePackage.SignatureURL != expected {
+		t.Errorf("Signature URL is %q, expected %q", updatePackage.SignatureURL, expected)
+	}
+}
@@ -0,0 +1,51 @@
+package packager
+
+import (
+	"errors"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// SmallPackagesFlag creates packages below MinPackageBytes and lists
+	// them in RunResult.Small
+	SmallPackagesFlag = "flag"
+	// SmallPackagesSkip doesn't create packages below MinPackageBytes,
+	// clients use the full install instead
+	SmallPackagesSkip = "skip"
+)
+
+// ErrPackageTooSmall is returned when a package is below MinPackageBytes
+// and small packages are skipped
+var ErrPackageTooSmall = errors.New("Package is below the minimum package size")
+
+// checkPackageSize compares the size of the package at packagePath with
+// MinPackageBytes. Small packages are logged, or removed when they are
+// skipped
+func (packager *Packager) checkPackageSize(packagePath string) error {
+	if packager.options.MinPackageBytes <= 0 {
+		return nil
+	}
+	packageInfo, err := os.Stat(packagePath)
+	if err != nil {
+		return err
+	}
+	if packageInfo.Size() >= packager.options.MinPackageBytes {
+		return nil
+	}
+	log.WithFields(log.Fields{
+		"path":    packagePath,
+		"size":    packageInfo.Size(),
+		"minimum": packager.options.MinPackageBytes,
+	}).Warning("Package is below the minimum package size")
+	if packager.options.SmallPackages != SmallPackagesSkip {
+		return nil
+	}
+	os.Remove(packagePath + operationsSidecarSuffix)
+	err = os.Remove(packagePath)
+	if err != nil {
+		return err
+	}
+	return ErrPackageTooSmall
+}
@@ -0,0 +1,54 @@
+package packager
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSmallPackages(t *testing.T) {
+	pairs := []VersionPair{{FromVersion: "3395761", ToVersion: "3525360"}}
+	for _, mode := range []string{SmallPackagesFlag, SmallPackagesSkip} {
+		fixture := newFixture(t)
+		fixture.installVersion(3395761, map[string]string{
+			"UnrealTournament/Config/Default.ini": "setting=1",
+		})
+		downloadURL := fixture.serveRelease(3525360, map[string]string{
+			"UnrealTournament/Config/Default.ini": "setting=2",
+		})
+		fixture.addPost("UT Release 3525360", "post-3525360", downloadURL, time.Now())
+		packager := fixture.newPackager(Options{
+			MinPackageBytes: 1024 * 1024,
+			SmallPackages:   mode,
+		})
+
+		result, err := packager.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(result.Small, pairs) {
+			t.Errorf("%s: small pairs are %v, expected %v", mode, result.Small, pairs)
+		}
+		_, err = os.Stat(filepath.Join(fixture.packageDir, "3395761-3525360.tar.gz"))
+		var count int
+		fixture.db().Table("ut4_update_packages").Count(&count)
+		switch mode {
+		case SmallPackagesFlag:
+			if err != nil || count != 1 {
+				t.Errorf("Flagged small package wasn't kept, %d rows: %v", count, err)
+			}
+			if !reflect.DeepEqual(result.Packages, pairs) {
+				t.Errorf("Flagged small package isn't in the packages: %v", result.Packages)
+			}
+		case SmallPackagesSkip:
+			if !os.IsNotExist(err) || count != 0 {
+				t.Errorf("Skipped small package was kept, %d rows: %v", count, err)
+			}
+			if len(result.Packages) != 0 {
+				t.Errorf("Skipped small package is in the packages: %v", result.Packages)
+			}
+		}
+	}
+}
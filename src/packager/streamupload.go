@@ -0,0 +1,142 @@
+package packager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/donovansolms/ut4-update-packager/src/packager/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// validateStreamUploads checks that options can be used with streaming
+// uploads. Everything that needs the package as a local file is excluded
+func validateStreamUploads(options Options) error {
+	if _, ok := options.Uploader.(StreamUploader); !ok {
+		return errors.New("Streaming uploads require a StreamUploader")
+	}
+	if _, ok := options.NewArchiver().(StreamArchiver); !ok {
+		return errors.New("Streaming uploads require a StreamArchiver")
+	}
+	if options.SigningKeyPath != "" {
+		return errors.New("Streamed packages can't be signed")
+	}
+	if options.OperationsPlacement == OperationsSidecar {
+		return errors.New("Streamed packages can't have a sidecar operations file")
+	}
+	if options.ChunkFiles {
+		return errors.New("Streamed packages can't use chunk files, " +
+			"their chunks are published next to the local package")
+	}
+	if options.MinPackageBytes > 0 && options.SmallPackages == SmallPackagesSkip {
+		return errors.New("Small streamed packages can't be skipped, " +
+			"their size is only known after the upload")
+	}
+	return nil
+}
+
+// countingWriter counts the bytes written to it
+type countingWriter struct {
+	written int64
+}
+
+// Write counts buffer
+func (counter *countingWriter) Write(buffer []byte) (int, error) {
+	counter.written += int64(len(buffer))
+	return len(buffer), nil
+}
+
+// buildStreamedPackage stages the upgrade package from fromVersion to
+// toVersion and archives it straight into the StreamUploader. The hash the
+// uploader received is checked against the hash of the archive written
+func (packager *Packager) buildStreamedPackage(
+	fromVersion string,
+	toVersion string,
+	deltaHash string) (models.Ut4UpdatePackages, OperationCounts, error) {
+	staged, counts, err := packager.stageUpgradePath(fromVersion, toVersion)
+	if err != nil {
+		return models.Ut4UpdatePackages{}, counts, err
+	}
+	err = packager.measureStaged(&staged)
+	if err != nil {
+		return models.Ut4UpdatePackages{}, counts, err
+	}
+	// The hash is only known once the package is uploaded
+	templateValues := TemplateValues{
+		FromVersion: templateFromVersion(fromVersion),
+		ToVersion:   toVersion,
+		Platform:    packagePlatform,
+	}
+	archiver := packager.options.NewArchiver().(StreamArchiver)
+	uploader := packager.options.Uploader.(StreamUploader)
+
+	reader, writer := io.Pipe()
+	hasher := sha256.New()
+	counter := &countingWriter{}
+	archived := make(chan error, 1)
+	go func() {
+		err := archiver.CreateWriter(
+			filepath.Base(staged.path),
+			io.MultiWriter(writer, hasher, counter))
+		if err == nil {
+			err = packager.writePackageArchive(archiver, staged)
+		}
+		writer.CloseWithError(err)
+		archived <- err
+	}()
+	updateURL, receivedHash, err := uploader.UploadStream(reader, templateValues)
+	// Unblock the archiver when the upload stopped reading early
+	reader.Close()
+	archiveErr := <-archived
+	if err != nil {
+		return models.Ut4UpdatePackages{}, counts, err
+	}
+	if archiveErr != nil {
+		return models.Ut4UpdatePackages{}, counts, archiveErr
+	}
+	packageHash := hex.EncodeToString(hasher.Sum(nil))
+	if receivedHash != packageHash {
+		return models.Ut4UpdatePackages{}, counts, fmt.Errorf(
+			"Uploaded package hash %s doesn't match the archive hash %s",
+			receivedHash, packageHash)
+	}
+	log.WithFields(log.Fields{
+		"fromVersion": fromVersion,
+		"toVersion":   toVersion,
+		"url":         updateURL,
+		"size":        counter.written,
+		"added":       counts.Added,
+		"modified":    counts.Modified,
+		"removed":     counts.Removed,
+		"moved":       counts.Moved,
+	}).Info("Upgrade package streamed")
+	logCompression(fromVersion, toVersion, staged.size, counter.written)
+	// The staging dir is only kept to resume a failed package
+	os.RemoveAll(staged.dir)
+
+	templateValues.Hash = packageHash
+	err = packager.runPackageHooks("", updateURL, templateValues)
+	if err != nil {
+		return models.Ut4UpdatePackages{}, counts, err
+	}
+	updatePackage := models.Ut4UpdatePackages{
+		FromVersion:      fromVersion,
+		ToVersion:        toVersion,
+		UpdateURL:        updateURL,
+		Channel:          packager.releaseChannel(),
+		Size:             counter.written,
+		Scope:            packager.packageScope(),
+		DeltaHash:        deltaHash,
+		DateCreated:      time.Now(),
+		UncompressedSize: staged.size,
+	}
+	if deltaHash != "" {
+		packager.sharedDeltas[deltaHash] = updatePackage
+	}
+	return updatePackage, counts, nil
+}
@@ -0,0 +1,130 @@
+package packager
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeStreamUploader keeps the streamed package in memory. It reports
+// hash instead of the real hash when set
+type fakeStreamUploader struct {
+	Uploader
+	received []byte
+	hash     string
+}
+
+func (uploader *fakeStreamUploader) UploadStream(
+	reader io.Reader,
+	values TemplateValues) (string, string, error) {
+	received, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return "", "", err
+	}
+	uploader.received = received
+	hash := uploader.hash
+	if hash == "" {
+		sum := sha256.Sum256(received)
+		hash = hex.EncodeToString(sum[:])
+	}
+	return "http://cdn.example.com/" + values.FromVersion + "-" + values.ToVersion +
+		".tar.gz", hash, nil
+}
+
+// installStreamVersions installs the versions packaged in the streaming
+// tests
+func installStreamVersions(t *testing.T, packager *Packager) {
+	t.Helper()
+	installTestVersion(t, packager, 3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini":  "setting=1",
+		"UnrealTournament/Content/Removed.txt": "removed",
+	})
+	installTestVersion(t, packager, 3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+		"UnrealTournament/Content/Added.txt":  "added",
+	})
+}
+
+func TestStreamUploadMatchesLocalArchive(t *testing.T) {
+	uploader := &fakeStreamUploader{Uploader: NewTemplateUploader("")}
+	packager := newTestPackager(t, Options{
+		StreamUploads: true,
+		Uploader:      uploader,
+	})
+	installStreamVersions(t, packager)
+	updatePackage, err := packager.GeneratePackage("3395761", "3525360")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updatePackage.Size != int64(len(uploader.received)) {
+		t.Errorf("Recorded size %d, uploaded %d bytes",
+			updatePackage.Size, len(uploader.received))
+	}
+	entries, err := ioutil.ReadDir(packager.packageDir)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Streamed package left %d files in the package dir", len(entries))
+	}
+	_, err = os.Stat(filepath.Join(packager.workingDir, "3395761-3525360-package"))
+	if !os.IsNotExist(err) {
+		t.Errorf("Streamed package left its staging dir: %v", err)
+	}
+
+	// The same package built locally has the same content
+	local := newTestPackager(t, Options{})
+	installStreamVersions(t, local)
+	_, err = local.GeneratePackage("3395761", "3525360")
+	if err != nil {
+		t.Fatal(err)
+	}
+	streamedPath := filepath.Join(tempDir(t), "streamed.tar.gz")
+	err = ioutil.WriteFile(streamedPath, uploader.received, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	streamed := readPackage(t, streamedPath)
+	expected := readPackage(t, filepath.Join(local.packageDir, "3395761-3525360.tar.gz"))
+	if !reflect.DeepEqual(streamed, expected) {
+		t.Errorf("Streamed package is %v, expected %v", streamed, expected)
+	}
+}
+
+func TestStreamUploadChecksumMismatch(t *testing.T) {
+	uploader := &fakeStreamUploader{
+		Uploader: NewTemplateUploader(""),
+		hash:     hex.EncodeToString(bytes.Repeat([]byte{0}, sha256.Size)),
+	}
+	packager := newTestPackager(t, Options{
+		StreamUploads: true,
+		Uploader:      uploader,
+	})
+	installStreamVersions(t, packager)
+	_, err := packager.GeneratePackage("3395761", "3525360")
+	if err == nil {
+		t.Error("Upload with a mismatched checksum didn't fail")
+	}
+}
+
+func TestStreamUploadRejectsChunkFiles(t *testing.T) {
+	_, err := New("http://localhost/feed", "", tempDir(t), tempDir(t), tempDir(t),
+		Options{
+			StreamUploads: true,
+			ChunkFiles:    true,
+			Uploader:      &fakeStreamUploader{Uploader: NewTemplateUploader("")},
+		})
+	if err == nil {
+		t.Fatal("Streamed packages with chunk files were accepted")
+	}
+	if !strings.Contains(err.Error(), "chunk files") {
+		t.Errorf("Rejected for another reason: %s", err)
+	}
+}
@@ -1,9 +1,89 @@
 package packager
 
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	defaultDatabaseDialect = "mysql"
+	// DialectSQLite keeps the database in a single file, which needs no
+	// database server
+	DialectSQLite = "sqlite3"
+)
+
+const (
+	// ChannelStable is the default release channel
+	ChannelStable = "stable"
+	// ChannelBeta is the channel for experimental builds
+	ChannelBeta = "beta"
+)
+
+const (
+	// CoverageFanOut builds a package from every older version directly
+	// to the new version
+	CoverageFanOut = "fanout"
+	// CoverageChain builds a package from each version to the next one,
+	// clients upgrade by applying the chain in order
+	CoverageChain = "chain"
+)
+
 const (
 	deltaOperationAdded    = "added"
 	deltaOperationModified = "modified"
 	deltaOperationRemoved  = "removed"
+	deltaOperationMoved    = "moved"
+)
+
+// DeltaOperation is a single operation in operations.json. Moved files
+// also carry the path they were moved from
+type DeltaOperation struct {
+	Operation string
+	Source    string
+}
+
+// deltaOperationJSON is the object form of a moved DeltaOperation
+type deltaOperationJSON struct {
+	Operation string `json:"operation"`
+	Source    string `json:"source"`
+}
+
+// MarshalJSON writes operations without a source as a plain string to stay
+// compatible with existing clients
+func (operation DeltaOperation) MarshalJSON() ([]byte, error) {
+	if operation.Source == "" {
+		return json.Marshal(operation.Operation)
+	}
+	return json.Marshal(deltaOperationJSON{
+		Operation: operation.Operation,
+		Source:    operation.Source,
+	})
+}
+
+// UnmarshalJSON reads both the plain string and object forms
+func (operation *DeltaOperation) UnmarshalJSON(data []byte) error {
+	var plain string
+	if json.Unmarshal(data, &plain) == nil {
+		*operation = DeltaOperation{Operation: plain}
+		return nil
+	}
+	var object deltaOperationJSON
+	err := json.Unmarshal(data, &object)
+	if err != nil {
+		return err
+	}
+	*operation = DeltaOperation{
+		Operation: object.Operation,
+		Source:    object.Source,
+	}
+	return nil
+}
+
+const (
+	// modulesBinaryDir is the path of the binaries in an install
+	modulesBinaryDir = "LinuxNoEditor/UnrealTournament/Binaries/Linux"
+	// modulesFilename is the .modules file in modulesBinaryDir
+	modulesFilename = "UE4-Linux-Shippingx86_64-unknown-linux-gnu.modules"
 )
 
 // UT4Modules is the structure of the .modules file
@@ -11,4 +91,329 @@ type UT4Modules struct {
 	Changelist           int
 	CompatibleChangelist int
 	BuildID              string
+	// Modules maps module names to their binary in modulesBinaryDir
+	Modules map[string]string
+}
+
+// Options holds the optional behaviour settings for a Packager
+type Options struct {
+	// PackageNameTemplate is the on-disk filename of a package, relative
+	// to the package dir
+	PackageNameTemplate string
+	// PackageURLTemplate is the public URL a package is served from
+	PackageURLTemplate string
+	// DatabaseDialect is the gorm dialect used for the connection string,
+	// mysql (default) or sqlite3 whose connection string is the database
+	// file. The driver for other dialects must be imported by the caller
+	DatabaseDialect string
+	// CoverageStrategy selects which upgrade packages are built, either
+	// CoverageFanOut (default) or CoverageChain
+	CoverageStrategy string
+	// PublishLatest writes latest.json to the package dir and uploads it
+	// after each run without failures
+	PublishLatest bool
+	// PackageRetries is how many times a failed package is retried within
+	// a single run
+	PackageRetries int
+	// MaxResumeAttempts is how many runs try to finish the packages of a
+	// version left by an interrupted run before giving up on it, 3 by
+	// default
+	MaxResumeAttempts int
+	// CleanWorkingDirOnStart removes stale artifacts from the working dir
+	// when the Packager is created
+	CleanWorkingDirOnStart bool
+	// WorkingDirCleaner does the cleaning, defaults to CleanStaleArtifacts,
+	// or CleanStaleArtifactsKeepStaging with ResumePackaging. CleanAll can
+	// be used to empty the working dir completely
+	WorkingDirCleaner func(workingDir string) error
+	// ChunkFiles stores added and modified files as content-defined chunks
+	// in the chunks dir of the package dir. Packages then contain a
+	// chunks.json listing the chunks of each file instead of the files.
+	// New chunks are uploaded with their package and PrunePackages removes
+	// the chunks no remaining package lists
+	ChunkFiles bool
+	// SigningKeyPath is a file holding a hex encoded Ed25519 private key.
+	// When set, every package gets a signed manifest next to it that is
+	// uploaded before the package with the .sig Suffix in its values. Its
+	// URL is recorded as the package's SignatureURL
+	SigningKeyPath string
+	// ExtractDepth is how many levels of archives are extracted from a
+	// release, 1 (default) only extracts the release zip itself
+	ExtractDepth int
+	// MaxExtractBytes caps the bytes extracted from a single archive,
+	// 0 means no cap
+	MaxExtractBytes int64
+	// Reprocess rebuilds a release even when its version is installed
+	// and all of its packages exist
+	Reprocess bool
+	// StoreFileHashes also stores every file hash as a row in the
+	// ut4_file_hashes table when a version's hashes are generated or
+	// first read from the hash cache
+	StoreFileHashes bool
+	// RequireValidDate ignores release posts without a parseable
+	// published or updated date
+	RequireValidDate bool
+	// IgnorePatterns are paths, relative to the version dir, that are
+	// neither hashed nor packaged, such as caches and logs. "**" matches
+	// any number of directories. Ignored files are never added, modified
+	// or removed on clients
+	IgnorePatterns []string
+	// MirrorURLs are base URLs tried in order when the download URL fails.
+	// The path of the download URL is appended to each mirror
+	MirrorURLs []string
+	// Channel is the release channel packages are tagged with, defaults
+	// to ChannelStable
+	Channel string
+	// BetaKeywords put a release in ChannelBeta when its post title
+	// contains any of them
+	BetaKeywords []string
+	// VersionMismatch is what happens when the version in the download
+	// link differs from the release version, either VersionMismatchWarn
+	// (default) or VersionMismatchFail
+	VersionMismatch string
+	// HardlinkFiles hardlinks release files into the package staging dir,
+	// and unchanged from-version files into the trees of AssembleVersion,
+	// instead of copying them when the dirs share a filesystem
+	HardlinkFiles bool
+	// WatchDir is polled for release zips dropped in manually, used by
+	// RunWatchDir instead of the feed
+	WatchDir string
+	// ResumePackaging keeps the staging dir of a failed package and skips
+	// files it already staged on the next attempt, also in later runs
+	ResumePackaging bool
+	// NewArchiver creates the Archiver for each package, defaults to a
+	// tar.gz archiver
+	NewArchiver func() Archiver
+	// ReleasePublicKey is a minisign public key. When set, the detached
+	// signature at the download URL plus ReleaseSignatureSuffix (default
+	// .minisig) must verify before a release is extracted
+	ReleasePublicKey       string
+	ReleaseSignatureSuffix string
+	// OperationsPlacement is payload (default), first or sidecar. first
+	// makes operations.json the first package entry, sidecar writes it
+	// next to the package as <package>.operations.json
+	OperationsPlacement string
+	// VersionComparator orders versions, defaults to CompareChangelists.
+	// Forks with a different version scheme can supply their own
+	VersionComparator VersionComparator
+	// VersionValidator decides which release dir entries are versions,
+	// defaults to IsChangelistVersion. Other dirs are ignored
+	VersionValidator func(version string) bool
+	// StorageMode is archive (default) or files. files stores each added
+	// and modified file compressed under the files dir of the package dir
+	// and packages list them in files.json
+	StorageMode string
+	// CaseCollisions is warn (default) or fail for release files whose
+	// paths only differ by case
+	CaseCollisions string
+	// MinReleaseFiles, MaxReleaseFiles, MinReleaseBytes and
+	// MaxReleaseBytes bound the file count and size of an extracted
+	// release to catch broken downloads. 0 disables a bound
+	MinReleaseFiles int
+	MaxReleaseFiles int
+	MinReleaseBytes int64
+	MaxReleaseBytes int64
+	// Uploader publishes packages once they are in the package dir,
+	// defaults to serving them from the package dir at PackageURLTemplate
+	Uploader Uploader
+	// HashDirectories adds directory entries, keyed by their path with a
+	// trailing slash, to the hashes so added and removed directories show
+	// up in the delta even when they are empty
+	HashDirectories bool
+	// RecordEmptyDeltas stores version pairs without changes in the
+	// database so they aren't checked again on every run
+	RecordEmptyDeltas bool
+	// Downloaders maps lowercase URI schemes, e.g. magnet or ipfs, to the
+	// Downloader for them. http and https default to the HTTP downloader
+	Downloaders map[string]Downloader
+	// AcceptedContentTypes are the content types the download pre-flight
+	// accepts, defaults to zip and octet-stream types
+	AcceptedContentTypes []string
+	// VersionManifests writes <version>.manifest.json with the hash of
+	// every file of a new version to the package dir, signed like the
+	// packages when SigningKeyPath is set
+	VersionManifests bool
+	// DBBatchSize writes the upgrade package rows of a run in transactions
+	// of this many rows. 0 saves each row as soon as its package is built
+	DBBatchSize int
+	// ResumeExtraction skips zip entries that were already extracted with
+	// the same size by an interrupted run. ResumeExtractionCRC also
+	// compares their CRC-32 with the zip header. Like ResumePackaging,
+	// this needs the working dir to be kept on start
+	ResumeExtraction    bool
+	ResumeExtractionCRC bool
+	// FeedCacheMaxAge enables caching the last fetched feed. When a fetch
+	// fails, a cached feed up to this old is used instead
+	FeedCacheMaxAge time.Duration
+	// PayloadDir is where releases are downloaded and extracted, for when
+	// the working dir is too small for them, e.g. on tmpfs. Defaults to
+	// the working dir
+	PayloadDir string
+	// HashProvider supplies the file hashes of versions instead of the
+	// release dir and its hash cache
+	HashProvider HashProvider
+	// FanOutMaxVersions only builds packages from the newest this many
+	// older versions and FanOutMaxAge only from versions installed within
+	// this long. Clients outside the window use the full install
+	FanOutMaxVersions int
+	FanOutMaxAge      time.Duration
+	// MinPackageBytes is the size below which a package is considered too
+	// small to be worth it. SmallPackages is flag (default) to still
+	// create them or skip to leave those clients on the full install
+	MinPackageBytes int64
+	SmallPackages   string
+	// Normalizations zero byte ranges of matching files before hashing so
+	// cosmetic differences such as build timestamps don't show up as
+	// modified. This is an advanced option, the hashes no longer match
+	// the file contents and the hash caches have to be removed after
+	// changing it
+	Normalizations []NormalizationRule
+	// NormalizationMode is hash (default) to normalize before hashing or
+	// demote to keep the real hashes and only leave modified files out of
+	// the delta when they are identical after normalization
+	NormalizationMode string
+	// DownloadLinkElement is a namespaced feed element, e.g. ut:download,
+	// holding the download link. Enclosures and this element are preferred
+	// over scraping the link from the post content
+	DownloadLinkElement string
+	// ShareDeltas lets version pairs with an identical delta reference the
+	// same package instead of archiving it again
+	ShareDeltas bool
+	// HashMemoryCacheSize is the number of versions whose hashes are kept
+	// in memory, 0 disables the memory cache
+	HashMemoryCacheSize int
+	// ReleaseGracePeriod is how long a new release post whose download
+	// isn't available yet is retried before it is treated as an error
+	ReleaseGracePeriod time.Duration
+	// Permissions is off (default), report or fix to check that the files
+	// matching ExecutablePatterns are executable after extraction
+	Permissions        string
+	ExecutablePatterns []string
+	// CompressHashCache writes the hash caches zstd compressed as
+	// <version>.hashes.zst, both formats are always read
+	CompressHashCache bool
+	// PostPackageCommand is run after each package is produced. Its
+	// arguments are package templates that may also use {path} and {url}
+	PostPackageCommand []string
+	// PostPackageWebhook receives a PackageHookPayload POST after each
+	// package is produced
+	PostPackageWebhook string
+	// PostPackageHookFailure is warn (default) or fail
+	PostPackageHookFailure string
+	// StreamUploads pipes packages straight into the Uploader, which must
+	// be a StreamUploader, without writing them to the package dir. Signing,
+	// sidecar operations and chunk files need the local package and are
+	// rejected
+	StreamUploads bool
+	// CompressionStats records the uncompressed size of every package to
+	// report its compression ratio, at the cost of a walk of the staged
+	// files
+	CompressionStats bool
+	// PostMetadata lists the metadata of release posts stored with them,
+	// any of link, categories and description. Defaults to link and
+	// categories
+	PostMetadata []string
+	// Progress is called with the overall progress of the downloads and
+	// hashing of a run whenever any of them progresses
+	Progress func(Progress)
+	// ProtectedPaths are patterns of files a delta may not remove, e.g.
+	// Engine/Binaries/**. Packaging such a delta fails unless
+	// AllowProtectedRemovals is set, which only logs them
+	ProtectedPaths         []string
+	AllowProtectedRemovals bool
+	// PipelineDeltas computes deltas to versions without cached hashes
+	// while hashing them, so their hashes are never all in memory. The
+	// hash cache is written while hashing, other deltas to the version
+	// read it
+	PipelineDeltas bool
+	// DownloadArtifact is the build whose link is taken from release posts,
+	// client (default), server, editor or symbols. ArtifactPatterns
+	// classify the links, the first matching pattern wins
+	DownloadArtifact string
+	ArtifactPatterns []ArtifactPattern
+	// CompressOperations stores the operations in the package gzipped as
+	// operations.json.gz, older clients only read operations.json
+	CompressOperations bool
+	// ContentRoots limit deltas to the files under these install relative
+	// dirs, e.g. UnrealTournament/Content/Paks. Such packages are recorded
+	// with the content scope, use a separate package dir or name template
+	// when whole install packages are built as well
+	ContentRoots []string
+	// DeltaPostProcessors transform every delta in order before it is
+	// packaged. Defaults to move detection only, an empty list disables it
+	DeltaPostProcessors []DeltaPostProcessor
+	// HashCacheIndex keeps the hash caches of all versions in a single
+	// index file in the release dir instead of a file per version. Per
+	// version files are still read until CompactHashCache moves them
+	HashCacheIndex bool
+	// HTTPIdleConnsPerHost is the number of idle connections kept per
+	// host for reuse, 8 by default. HTTPIdleConnTimeout closes idle
+	// connections, 90s by default. HTTPKeepAlive is the TCP keep-alive
+	// period, 30s by default
+	HTTPIdleConnsPerHost int
+	HTTPIdleConnTimeout  time.Duration
+	HTTPKeepAlive        time.Duration
+	// DisableHTTP2 only uses HTTP/1.1, by default HTTP/2 is used with
+	// servers that support it
+	DisableHTTP2 bool
+}
+
+// HashProvider returns the hash of every file in a version, keyed by the
+// path relative to the version dir
+type HashProvider interface {
+	VersionHashes(version string) (map[string]string, error)
+}
+
+// VersionPair is an upgrade from FromVersion to ToVersion
+type VersionPair struct {
+	FromVersion string
+	ToVersion   string
+}
+
+// RunResult summarises what a single Run produced
+type RunResult struct {
+	// Version is the newly released version
+	Version string
+	// Packages are the upgrade packages that were created
+	Packages []VersionPair
+	// Failures are the upgrade packages that could not be created
+	Failures []PackageFailure
+	// Unchanged are the pairs without changes that got no package
+	Unchanged []VersionPair
+	// Small are the pairs with a package below MinPackageBytes, they only
+	// have a package when small packages are flagged
+	Small []VersionPair
+	// Operations are the operation counts of each created package
+	Operations []PackageOperations
+	// TotalPackageSize is the size in bytes of all created packages
+	TotalPackageSize int64
+	// HashCache is the hash cache use of the Packager up to this run
+	HashCache HashCacheStats
+	// PermissionMismatches are the binaries of the release that weren't
+	// executable
+	PermissionMismatches []PermissionMismatch
+	// Compression are the package sizes before and after compression when
+	// compression stats are enabled
+	Compression []PackageCompression
+}
+
+// OperationCounts are the number of operations of each kind in a delta
+type OperationCounts struct {
+	Added    int
+	Modified int
+	Removed  int
+	Moved    int
+}
+
+// PackageOperations are the operation counts of a single package
+type PackageOperations struct {
+	VersionPair
+	OperationCounts
+}
+
+// PackageFailure is an upgrade package that failed after all retries
+type PackageFailure struct {
+	VersionPair
+	Attempts int
+	Error    string
 }
@@ -0,0 +1,126 @@
+package packager
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Supervisor runs several Packagers concurrently, e.g. one per feed. The
+// Packagers share nothing, each needs its own dirs and database. A
+// Packager whose run fails or panics is restarted after a delay
+type Supervisor struct {
+	packagers []supervisedPackager
+	// slots limits the number of concurrent runs
+	slots        chan struct{}
+	interval     time.Duration
+	restartDelay time.Duration
+}
+
+// supervisedPackager is a Packager with the name it is logged under
+type supervisedPackager struct {
+	name     string
+	packager *Packager
+}
+
+// NewSupervisor creates a Supervisor running each Packager every
+// interval, at most maxConcurrentRuns at a time. Failed runs are retried
+// after restartDelay
+func NewSupervisor(
+	maxConcurrentRuns int,
+	interval time.Duration,
+	restartDelay time.Duration) *Supervisor {
+	if maxConcurrentRuns < 1 {
+		maxConcurrentRuns = 1
+	}
+	return &Supervisor{
+		slots:        make(chan struct{}, maxConcurrentRuns),
+		interval:     interval,
+		restartDelay: restartDelay,
+	}
+}
+
+// Add adds packager under name, Packagers can't be added once Run started
+func (supervisor *Supervisor) Add(name string, packager *Packager) {
+	supervisor.packagers = append(supervisor.packagers, supervisedPackager{
+		name:     name,
+		packager: packager,
+	})
+}
+
+// Run runs all Packagers until stop is closed and their current runs
+// finished
+func (supervisor *Supervisor) Run(stop <-chan struct{}) error {
+	if len(supervisor.packagers) == 0 {
+		return errors.New("No packagers to supervise")
+	}
+	var wait sync.WaitGroup
+	for _, supervised := range supervisor.packagers {
+		wait.Add(1)
+		go func(supervised supervisedPackager) {
+			defer wait.Done()
+			supervisor.loop(supervised, stop)
+		}(supervised)
+	}
+	wait.Wait()
+	return nil
+}
+
+// loop runs supervised every interval, or after the restart delay when
+// the run failed, until stop is closed
+func (supervisor *Supervisor) loop(
+	supervised supervisedPackager,
+	stop <-chan struct{}) {
+	migrated := false
+	for {
+		select {
+		case <-stop:
+			return
+		case supervisor.slots <- struct{}{}:
+		}
+		var err error
+		if !migrated {
+			err = supervisor.runSafely(supervised.packager.Migrate)
+			migrated = err == nil
+		}
+		if err == nil {
+			err = supervisor.runSafely(func() error {
+				result, err := supervised.packager.Run()
+				if err == nil && len(result.Failures) > 0 {
+					err = fmt.Errorf("%d upgrade package(s) failed", len(result.Failures))
+				}
+				return err
+			})
+		}
+		<-supervisor.slots
+
+		delay := supervisor.interval
+		if err != nil {
+			log.WithFields(log.Fields{
+				"packager": supervised.name,
+				"restart":  supervisor.restartDelay.String(),
+				"err":      "supervised_run",
+			}).Error(err.Error())
+			delay = supervisor.restartDelay
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// runSafely calls run, returning a panic as an error so a crashing
+// Packager doesn't take the others down
+func (supervisor *Supervisor) runSafely(run func() error) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("Packager crashed: %v", recovered)
+		}
+	}()
+	return run()
+}
@@ -0,0 +1,127 @@
+package packager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/donovansolms/ut4-update-packager/src/packager/models"
+)
+
+// panicOnceUploader is an Uploader that crashes on its first upload
+type panicOnceUploader struct {
+	Uploader
+	calls int32
+}
+
+func (uploader *panicOnceUploader) Upload(
+	packagePath string,
+	values TemplateValues) (string, error) {
+	if atomic.AddInt32(&uploader.calls, 1) == 1 {
+		panic("upload crashed")
+	}
+	return uploader.Uploader.Upload(packagePath, values)
+}
+
+// supervisedFixture is a fixture with a release to package from
+// fromVersion to toVersion
+func supervisedFixture(t *testing.T, fromVersion int, toVersion int) *fixture {
+	fixture := newFixture(t)
+	fixture.installVersion(fromVersion, map[string]string{
+		"UnrealTournament/Config/Default.ini": fmt.Sprint(fromVersion),
+	})
+	downloadURL := fixture.serveRelease(toVersion, map[string]string{
+		"UnrealTournament/Config/Default.ini": fmt.Sprint(toVersion),
+	})
+	fixture.addPost(fmt.Sprintf("UT Release %d", toVersion),
+		fmt.Sprintf("post-%d", toVersion), downloadURL, time.Now())
+	return fixture
+}
+
+// waitForPackage waits until fixture recorded a package or the timeout
+// passes
+func waitForPackage(t *testing.T, fixture *fixture, timeout time.Duration) bool {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		var count int
+		err := fixture.db().Model(&models.Ut4UpdatePackages{}).Count(&count).Error
+		if err == nil && count > 0 {
+			return true
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return false
+}
+
+func TestSupervisorRunsIsolatedPackagers(t *testing.T) {
+	first := supervisedFixture(t, 3395761, 3450000)
+	second := supervisedFixture(t, 3420000, 3525360)
+	supervisor := NewSupervisor(2, time.Hour, 10*time.Millisecond)
+	crashing := &panicOnceUploader{
+		Uploader: NewTemplateUploader(defaultPackageURLTemplate),
+	}
+	supervisor.Add("first", first.newPackager(Options{}))
+	supervisor.Add("second", second.newPackager(Options{Uploader: crashing}))
+
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- supervisor.Run(stop)
+	}()
+	// The crashed packager is restarted and finishes its package
+	for _, fixture := range []*fixture{first, second} {
+		if !waitForPackage(t, fixture, 10*time.Second) {
+			t.Errorf("No package recorded in %s", fixture.dir)
+		}
+	}
+	close(stop)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Supervisor didn't stop")
+	}
+	if atomic.LoadInt32(&crashing.calls) < 2 {
+		t.Error("Crashed packager wasn't restarted")
+	}
+
+	for fixture, expected := range map[*fixture][]string{
+		first:  {"3395761", "3450000"},
+		second: {"3420000", "3525360"},
+	} {
+		versions, err := ioutil.ReadDir(fixture.releaseDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, version := range versions {
+			if version.IsDir() {
+				names = append(names, version.Name())
+			}
+		}
+		sort.Strings(names)
+		if fmt.Sprint(names) != fmt.Sprint(expected) {
+			t.Errorf("Releases of %s are %v, expected %v",
+				filepath.Base(fixture.dir), names, expected)
+		}
+		packagePath := filepath.Join(fixture.packageDir,
+			fmt.Sprintf("%s-%s.tar.gz", expected[0], expected[1]))
+		if len(readPackage(t, packagePath)) == 0 {
+			t.Errorf("Package %s is empty", packagePath)
+		}
+	}
+}
+
+func TestSupervisorWithoutPackagers(t *testing.T) {
+	err := NewSupervisor(1, time.Hour, time.Hour).Run(make(chan struct{}))
+	if err == nil {
+		t.Error("Supervisor without packagers didn't fail")
+	}
+}
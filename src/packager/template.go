@@ -0,0 +1,100 @@
+package packager
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	// defaultPackageNameTemplate is the package filename used when none
+	// is configured
+	defaultPackageNameTemplate = "{from}-{to}.tar.gz"
+	// defaultPackageURLTemplate is the package URL used when none is configured
+	defaultPackageURLTemplate = "http://update.donovansolms.com/{from}-{to}.tar.gz"
+	// packagePlatform is the only platform currently packaged
+	packagePlatform = "linux"
+)
+
+// templateVariablePattern matches a single {variable} in a template
+var templateVariablePattern = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// templateVariables are the variables available to package templates
+var templateVariables = map[string]bool{
+	"from":     true,
+	"to":       true,
+	"version":  true,
+	"platform": true,
+	"hash":     true,
+}
+
+// TemplateValues holds the values substituted into package templates
+type TemplateValues struct {
+	FromVersion string
+	ToVersion   string
+	Platform    string
+	Hash        string
+	// Suffix is appended to the rendered name of a file published along
+	// with a package, .sig for its signature, so uploaders keep it apart
+	// from the package. It is empty for the package itself
+	Suffix string
+}
+
+// ValidateTemplate checks that template only uses known variables and
+// that all braces are balanced
+func ValidateTemplate(template string) error {
+	if strings.TrimSpace(template) == "" {
+		return fmt.Errorf("Template can't be empty")
+	}
+	for _, match := range templateVariablePattern.FindAllStringSubmatch(template, -1) {
+		if !templateVariables[match[1]] {
+			return fmt.Errorf("Unknown template variable '{%s}' in '%s'",
+				match[1], template)
+		}
+	}
+	stripped := templateVariablePattern.ReplaceAllString(template, "")
+	if strings.ContainsAny(stripped, "{}") {
+		return fmt.Errorf("Unbalanced braces in template '%s'", template)
+	}
+	return nil
+}
+
+// validatePackageNameTemplate validates the template and ensures the
+// rendered name will stay inside the package dir and differs between
+// version pairs. That takes {from} with {to} or {version}, or {hash}
+func validatePackageNameTemplate(template string) error {
+	err := ValidateTemplate(template)
+	if err != nil {
+		return err
+	}
+	namesPair := strings.Contains(template, "{from}") &&
+		(strings.Contains(template, "{to}") || strings.Contains(template, "{version}"))
+	if !namesPair && !strings.Contains(template, "{hash}") {
+		return fmt.Errorf(
+			"Package name template must use {from} and {to}, or {hash}: '%s'", template)
+	}
+	if filepath.IsAbs(template) {
+		return fmt.Errorf("Package name template must be relative: '%s'", template)
+	}
+	for _, part := range strings.Split(filepath.ToSlash(template), "/") {
+		if part == ".." {
+			return fmt.Errorf(
+				"Package name template can't leave the package dir: '%s'", template)
+		}
+	}
+	return nil
+}
+
+// RenderTemplate replaces the template variables with the given values and
+// appends the suffix. {version} is an alias for {to}
+func RenderTemplate(template string, values TemplateValues) string {
+	replacer := strings.NewReplacer(
+		"{from}", values.FromVersion,
+		"{to}", values.ToVersion,
+		"{version}", values.ToVersion,
+		"{platform}", values.Platform,
+		"{hash}", values.Hash,
+	)
+	return replacer.Replace(template) + values.Suffix
+}
@@ -0,0 +1,112 @@
+package packager
+
+import (
+	"testing"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	values := TemplateValues{
+		FromVersion: "3395761",
+		ToVersion:   "3525360",
+		Platform:    "linux",
+		Hash:        "abc123",
+	}
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{defaultPackageNameTemplate, "3395761-3525360.tar.gz"},
+		{defaultPackageURLTemplate,
+			"http://update.donovansolms.com/3395761-3525360.tar.gz"},
+		{"{platform}/{version}/{from}.tar.gz", "linux/3525360/3395761.tar.gz"},
+		{"{hash}.tar.gz", "abc123.tar.gz"},
+		{"https://cdn.example.com/{platform}/{from}-{to}-{hash}.tar.gz",
+			"https://cdn.example.com/linux/3395761-3525360-abc123.tar.gz"},
+		{"static-name.tar.gz", "static-name.tar.gz"},
+		{"{to}-{to}", "3525360-3525360"},
+	}
+	for _, test := range tests {
+		rendered := RenderTemplate(test.template, values)
+		if rendered != test.expected {
+			t.Errorf("RenderTemplate(%q) = %q, expected %q",
+				test.template, rendered, test.expected)
+		}
+	}
+}
+
+func TestRenderTemplateFullPackage(t *testing.T) {
+	rendered := RenderTemplate("{from}-{to}.tar.gz", TemplateValues{
+		FromVersion: templateFromVersion(""),
+		ToVersion:   "3525360",
+	})
+	if rendered != "full-3525360.tar.gz" {
+		t.Errorf("Full package name is %q", rendered)
+	}
+}
+
+func TestValidateTemplate(t *testing.T) {
+	valid := []string{
+		defaultPackageNameTemplate,
+		defaultPackageURLTemplate,
+		"{platform}/{version}/{hash}.tar.gz",
+		"no-variables.tar.gz",
+	}
+	for _, template := range valid {
+		if err := ValidateTemplate(template); err != nil {
+			t.Errorf("ValidateTemplate(%q) failed: %s", template, err)
+		}
+	}
+	invalid := []string{
+		"",
+		"   ",
+		"{unknown}.tar.gz",
+		"{from-{to}.tar.gz",
+		"{from}}.tar.gz",
+		"{}",
+	}
+	for _, template := range invalid {
+		if err := ValidateTemplate(template); err == nil {
+			t.Errorf("ValidateTemplate(%q) should fail", template)
+		}
+	}
+}
+
+func TestValidatePackageNameTemplate(t *testing.T) {
+	for _, template := range []string{
+		"{platform}/{from}-{to}.tar.gz",
+		"{from}-{version}.tar.gz",
+		"{hash}.tar.gz",
+	} {
+		if err := validatePackageNameTemplate(template); err != nil {
+			t.Errorf("Template %q failed: %s", template, err)
+		}
+	}
+	invalid := []string{
+		"update.tar.gz",
+		"{from}.tar.gz",
+		"{platform}/{to}.tar.gz",
+		"/var/packages/{from}-{to}.tar.gz",
+		"../{from}-{to}.tar.gz",
+		"{platform}/../../{to}.tar.gz",
+	}
+	for _, template := range invalid {
+		if err := validatePackageNameTemplate(template); err == nil {
+			t.Errorf("validatePackageNameTemplate(%q) should fail", template)
+		}
+	}
+}
+
+func TestNewRejectsInvalidTemplates(t *testing.T) {
+	dir := tempDir(t)
+	options := []Options{
+		{PackageNameTemplate: "{unknown}.tar.gz"},
+		{PackageNameTemplate: "../{from}-{to}.tar.gz"},
+		{PackageURLTemplate: "http://example.com/{from"},
+	}
+	for _, option := range options {
+		_, err := New("", "", dir+"/working", dir+"/releases", dir+"/packages", option)
+		if err == nil {
+			t.Errorf("New accepted %+v", option)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package packager
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// UpgradesPath is where UpgradesHandler resolves upgrades
+	UpgradesPath = "/upgrades"
+	// maxUpgradesRequestBytes limits the body of an upgrades request
+	maxUpgradesRequestBytes = 1024 * 1024
+)
+
+// UpgradeEntry is the upgrade of a single from version in the response
+// of POST /upgrades. Packages are applied in order, Error is set when no
+// path to the latest version is available
+type UpgradeEntry struct {
+	FromVersion string          `json:"from_version"`
+	ToVersion   string          `json:"to_version,omitempty"`
+	Packages    []LatestPackage `json:"packages"`
+	Error       string          `json:"error,omitempty"`
+}
+
+// UpgradesHandler serves POST /upgrades. The body is a JSON array of from
+// versions and the response holds an UpgradeEntry for each, in the same
+// order. The channel query parameter selects the channel, the configured
+// one by default
+func (packager *Packager) UpgradesHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(UpgradesPath, packager.serveUpgrades)
+	return mux
+}
+
+// serveUpgrades resolves the upgrades of the from versions in the body
+func (packager *Packager) serveUpgrades(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeUpgradesError(w, http.StatusMethodNotAllowed, "Only POST is supported")
+		return
+	}
+	var fromVersions []string
+	decoder := json.NewDecoder(io.LimitReader(r.Body, maxUpgradesRequestBytes))
+	err := decoder.Decode(&fromVersions)
+	if err != nil {
+		writeUpgradesError(w, http.StatusBadRequest,
+			fmt.Sprintf("Body must be a JSON array of versions: %s", err))
+		return
+	}
+	channel := r.URL.Query().Get("channel")
+	if channel == "" {
+		channel = packager.options.Channel
+	}
+
+	paths, err := packager.ResolveUpgradePaths(fromVersions, channel)
+	if err != nil {
+		log.WithField("err", "resolve_upgrade_paths").Error(err.Error())
+		writeUpgradesError(w, http.StatusInternalServerError,
+			"Upgrade paths couldn't be resolved")
+		return
+	}
+	entries := make([]UpgradeEntry, 0, len(paths))
+	for _, path := range paths {
+		entry := UpgradeEntry{
+			FromVersion: path.FromVersion,
+			ToVersion:   path.ToVersion,
+			Packages:    []LatestPackage{},
+			Error:       path.Error,
+		}
+		for _, updatePackage := range path.Packages {
+			entry.Packages = append(entry.Packages, LatestPackage{
+				FromVersion:  updatePackage.FromVersion,
+				ToVersion:    updatePackage.ToVersion,
+				URL:          updatePackage.UpdateURL,
+				SignatureURL: updatePackage.SignatureURL,
+				Channel:      updatePackage.Channel,
+			})
+		}
+		entries = append(entries, entry)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// writeUpgradesError writes message as a JSON error with status
+func writeUpgradesError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
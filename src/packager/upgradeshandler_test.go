@@ -0,0 +1,94 @@
+package packager
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUpgradesHandler(t *testing.T) {
+	fixture := newFixture(t)
+	packager := fixture.newPackager(Options{})
+	addUpdatePackages(t, fixture, []VersionPair{
+		{FromVersion: "3395761", ToVersion: "3450000"},
+		{FromVersion: "3450000", ToVersion: "3525360"},
+		{FromVersion: "3420000", ToVersion: "3525360"},
+	})
+	handler := packager.UpgradesHandler()
+
+	request := httptest.NewRequest(http.MethodPost, UpgradesPath,
+		strings.NewReader(`["3395761", "3420000", "3525360", "3000000"]`))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Status is %d: %s", recorder.Code, recorder.Body)
+	}
+	var entries []UpgradeEntry
+	err := json.Unmarshal(recorder.Body.Bytes(), &entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		from string
+		urls []string
+		err  bool
+	}{
+		{"3395761", []string{
+			"http://update.donovansolms.com/3395761-3450000.tar.gz",
+			"http://update.donovansolms.com/3450000-3525360.tar.gz",
+		}, false},
+		{"3420000", []string{
+			"http://update.donovansolms.com/3420000-3525360.tar.gz",
+		}, false},
+		{"3525360", nil, false},
+		{"3000000", nil, true},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("Got %d entries, expected %d", len(entries), len(expected))
+	}
+	for i, entry := range entries {
+		if entry.FromVersion != expected[i].from || entry.ToVersion != "3525360" {
+			t.Errorf("Entry %d is %s to %s", i, entry.FromVersion, entry.ToVersion)
+		}
+		if (entry.Error != "") != expected[i].err {
+			t.Errorf("%s: error is %q", entry.FromVersion, entry.Error)
+		}
+		var urls []string
+		for _, updatePackage := range entry.Packages {
+			urls = append(urls, updatePackage.URL)
+		}
+		if !reflect.DeepEqual(urls, expected[i].urls) {
+			t.Errorf("%s: packages are %v, expected %v",
+				entry.FromVersion, urls, expected[i].urls)
+		}
+	}
+	// Entries without packages still list an empty array
+	if !strings.Contains(recorder.Body.String(), `"packages":[]`) {
+		t.Errorf("Entries without packages don't have an empty list: %s", recorder.Body)
+	}
+}
+
+func TestUpgradesHandlerRejectsBadRequests(t *testing.T) {
+	packager := newTestPackager(t, Options{})
+	handler := packager.UpgradesHandler()
+	for _, test := range []struct {
+		method string
+		body   string
+		status int
+	}{
+		{http.MethodGet, "", http.StatusMethodNotAllowed},
+		{http.MethodPost, `{"from": "3395761"}`, http.StatusBadRequest},
+		{http.MethodPost, `not json`, http.StatusBadRequest},
+	} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder,
+			httptest.NewRequest(test.method, UpgradesPath, strings.NewReader(test.body)))
+		if recorder.Code != test.status {
+			t.Errorf("%s %q: status is %d, expected %d",
+				test.method, test.body, recorder.Code, test.status)
+		}
+	}
+}
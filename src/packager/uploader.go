@@ -0,0 +1,56 @@
+package packager
+
+import "io"
+
+// Uploader publishes a package that was moved to the package dir and
+// returns the URL it is available at
+type Uploader interface {
+	Upload(packagePath string, values TemplateValues) (string, error)
+}
+
+// StreamUploader is an Uploader that can also upload a package while it
+// is being written, so it never has to be stored locally
+type StreamUploader interface {
+	Uploader
+	// UploadStream uploads the package read from reader until EOF and
+	// returns its URL with the hex SHA256 of the bytes it received
+	UploadStream(reader io.Reader, values TemplateValues) (string, string, error)
+}
+
+// PackageRemover is an Uploader that can remove the packages it uploaded,
+// pruned packages are removed from storage through it
+type PackageRemover interface {
+	Uploader
+	Remove(updateURL string) error
+}
+
+// templateUploader is the default Uploader. Packages are served from the
+// package dir so uploading only renders the package URL template
+type templateUploader struct {
+	urlTemplate string
+}
+
+// NewTemplateUploader creates an Uploader for packages that are served
+// from the package dir at the URLs rendered from urlTemplate
+func NewTemplateUploader(urlTemplate string) Uploader {
+	return &templateUploader{urlTemplate: urlTemplate}
+}
+
+// Upload returns the URL for the package
+func (uploader *templateUploader) Upload(
+	packagePath string,
+	values TemplateValues) (string, error) {
+	return RenderTemplate(uploader.urlTemplate, values), nil
+}
+
+// uploadFile uploads a file published along with the packages, like a
+// signature, and returns its URL. The default uploader serves the package
+// dir as is, so there is nothing to upload and the URL is empty
+func (packager *Packager) uploadFile(
+	path string,
+	values TemplateValues) (string, error) {
+	if _, ok := packager.options.Uploader.(*templateUploader); ok {
+		return "", nil
+	}
+	return packager.options.Uploader.Upload(path, values)
+}
@@ -0,0 +1,56 @@
+package packager
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// VersionMismatchWarn logs a warning when the download URL and the
+	// modules file disagree on the version
+	VersionMismatchWarn = "warn"
+	// VersionMismatchFail fails the run when they disagree
+	VersionMismatchFail = "fail"
+)
+
+// urlVersionPattern matches a changelist number in a download filename
+var urlVersionPattern = regexp.MustCompile(`\d{6,}`)
+
+// versionFromURL returns the changelist embedded in the filename of
+// downloadURL or an empty string if there is none
+func versionFromURL(downloadURL string) string {
+	parsedURL, err := url.Parse(downloadURL)
+	if err != nil {
+		return ""
+	}
+	return urlVersionPattern.FindString(path.Base(parsedURL.Path))
+}
+
+// checkDownloadVersion compares the version in the download URL with the
+// version from the modules file. Depending on the configuration a
+// mismatch is logged or returned as an error
+func (packager *Packager) checkDownloadVersion(
+	downloadURL string,
+	version string) error {
+	urlVersion := versionFromURL(downloadURL)
+	if urlVersion == "" {
+		log.WithField("link", downloadURL).Debug("No version in download link")
+		return nil
+	}
+	if urlVersion == version {
+		return nil
+	}
+	err := fmt.Errorf(
+		"Download link is for version %s but the release is version %s",
+		urlVersion,
+		version)
+	if packager.options.VersionMismatch == VersionMismatchFail {
+		return err
+	}
+	log.WithField("link", downloadURL).Warning(err.Error())
+	return nil
+}
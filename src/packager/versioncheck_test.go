@@ -0,0 +1,59 @@
+package packager
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestVersionFromURL(t *testing.T) {
+	tests := map[string]string{
+		"https://s3.amazonaws.com/ut/UnrealTournament-Client-XAN-3525360-Linux.zip": "3525360",
+		"https://s3.amazonaws.com/ut/3395761/UnrealTournament-Linux.zip":            "",
+		"https://s3.amazonaws.com/ut/UnrealTournament-Linux.zip?build=3525360":      "",
+		"not a url\x7f": "",
+	}
+	for downloadURL, expected := range tests {
+		if version := versionFromURL(downloadURL); version != expected {
+			t.Errorf("Version from %q is %q, expected %q", downloadURL, version, expected)
+		}
+	}
+}
+
+// serveMislabeledRelease serves and posts the release of changelist under
+// the name of the release of linkChangelist
+func serveMislabeledRelease(fixture *fixture, changelist int, linkChangelist int) {
+	name := fmt.Sprintf("UnrealTournament-Client-XAN-%d-Linux.zip", linkChangelist)
+	content := zipFiles(fixture.t, releaseFiles(changelist, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+	}))
+	fixture.lock.Lock()
+	fixture.downloads[name] = content
+	fixture.lock.Unlock()
+	fixture.addPost("UT Release", "post-release", fixture.server.URL+"/"+name, time.Now())
+}
+
+func TestRunWithMismatchedDownloadVersion(t *testing.T) {
+	for _, mode := range []string{VersionMismatchWarn, VersionMismatchFail} {
+		fixture := newFixture(t)
+		fixture.installVersion(3395761, map[string]string{
+			"UnrealTournament/Config/Default.ini": "setting=1",
+		})
+		serveMislabeledRelease(fixture, 3525360, 3600000)
+		packager := fixture.newPackager(Options{VersionMismatch: mode})
+
+		result, err := packager.Run()
+		if mode == VersionMismatchFail {
+			if err == nil {
+				t.Error("Mismatched download version didn't fail")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Version != "3525360" {
+			t.Errorf("Release version is %q, the modules changelist wins", result.Version)
+		}
+	}
+}
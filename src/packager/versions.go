@@ -0,0 +1,56 @@
+package packager
+
+import (
+	"regexp"
+	"strings"
+)
+
+// VersionComparator compares two versions, returning -1 when a is older
+// than b, 1 when it is newer and 0 when they are the same
+type VersionComparator func(a string, b string) int
+
+// changelistVersionPattern is the accepted version grammar: a changelist
+// number, optionally followed by a dash and a suffix, e.g. 3525360 or
+// 3525360-hotfix
+var changelistVersionPattern = regexp.MustCompile(`^([0-9]+)(?:-([0-9A-Za-z.-]+))?$`)
+
+// IsChangelistVersion checks if version follows the changelist version
+// grammar accepted by CompareChangelists
+func IsChangelistVersion(version string) bool {
+	return changelistVersionPattern.MatchString(version)
+}
+
+// CompareChangelists is the default VersionComparator. Changelists are
+// compared numerically so leading zeros are ignored, 04567 and 4567 only
+// differ by their string order. For equal changelists the version without
+// a suffix is older than a suffixed one and suffixes are compared as
+// strings. Versions outside the grammar fall back to a string comparison
+func CompareChangelists(a string, b string) int {
+	aMatch := changelistVersionPattern.FindStringSubmatch(a)
+	bMatch := changelistVersionPattern.FindStringSubmatch(b)
+	if aMatch == nil || bMatch == nil {
+		return strings.Compare(a, b)
+	}
+	aNumber := strings.TrimLeft(aMatch[1], "0")
+	bNumber := strings.TrimLeft(bMatch[1], "0")
+	// Compare by length first so changelists beyond int range still work
+	switch {
+	case len(aNumber) < len(bNumber):
+		return -1
+	case len(aNumber) > len(bNumber):
+		return 1
+	}
+	if result := strings.Compare(aNumber, bNumber); result != 0 {
+		return result
+	}
+	switch {
+	case aMatch[2] == "" && bMatch[2] != "":
+		return -1
+	case aMatch[2] != "" && bMatch[2] == "":
+		return 1
+	}
+	if result := strings.Compare(aMatch[2], bMatch[2]); result != 0 {
+		return result
+	}
+	return strings.Compare(a, b)
+}
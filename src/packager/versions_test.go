@@ -0,0 +1,126 @@
+package packager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCompareChangelists(t *testing.T) {
+	tests := []struct {
+		a        string
+		b        string
+		expected int
+	}{
+		{"3395761", "3525360", -1},
+		{"999999", "3525360", -1},
+		{"3525360", "3525360", 0},
+		// Leading zeros don't change the changelist
+		{"04567", "4568", -1},
+		{"04567", "4566", 1},
+		{"04567", "4567", -1},
+		// A suffixed version is newer than its plain changelist
+		{"3525360", "3525360-hotfix", -1},
+		{"3525360-hotfix", "3525361", -1},
+		{"3525360-hotfix", "3525360-hotfix2", -1},
+		// Versions outside the grammar compare as strings
+		{"beta", "alpha", 1},
+	}
+	for _, test := range tests {
+		result := CompareChangelists(test.a, test.b)
+		if result != test.expected {
+			t.Errorf("CompareChangelists(%q, %q) is %d, expected %d",
+				test.a, test.b, result, test.expected)
+		}
+		reverse := CompareChangelists(test.b, test.a)
+		if reverse != -test.expected {
+			t.Errorf("CompareChangelists(%q, %q) is %d, expected %d",
+				test.b, test.a, reverse, -test.expected)
+		}
+	}
+
+	for version, valid := range map[string]bool{
+		"3525360":        true,
+		"04567":          true,
+		"3525360-hotfix": true,
+		"3525360-":       false,
+		"hotfix":         false,
+		"3525360 hotfix": false,
+	} {
+		if IsChangelistVersion(version) != valid {
+			t.Errorf("IsChangelistVersion(%q) is %t", version, !valid)
+		}
+	}
+}
+
+// compareSemver orders dotted versions by their numeric parts
+func compareSemver(a string, b string) int {
+	aParts := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bParts := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(aParts) && i < len(bParts); i++ {
+		aNumber, _ := strconv.Atoi(aParts[i])
+		bNumber, _ := strconv.Atoi(bParts[i])
+		switch {
+		case aNumber < bNumber:
+			return -1
+		case aNumber > bNumber:
+			return 1
+		}
+	}
+	switch {
+	case len(aParts) < len(bParts):
+		return -1
+	case len(aParts) > len(bParts):
+		return 1
+	}
+	return 0
+}
+
+func TestCustomVersionComparator(t *testing.T) {
+	packager := newTestPackager(t, Options{VersionComparator: compareSemver})
+	versions := []string{"v1.10.0", "v1.2.0", "v1.02.1", "v1.9"}
+	packager.sortVersions(versions)
+	expected := []string{"v1.2.0", "v1.02.1", "v1.9", "v1.10.0"}
+	if !reflect.DeepEqual(versions, expected) {
+		t.Errorf("Sorted versions are %v, expected %v", versions, expected)
+	}
+
+	// The default orders changelists with leading zeros and suffixes
+	packager = newTestPackager(t, Options{})
+	versions = []string{"3525360-hotfix", "04567", "3525360", "999999"}
+	packager.sortVersions(versions)
+	expected = []string{"04567", "999999", "3525360", "3525360-hotfix"}
+	if !reflect.DeepEqual(versions, expected) {
+		t.Errorf("Sorted versions are %v, expected %v", versions, expected)
+	}
+}
+
+func TestGetVersionListSkipsNonVersionDirs(t *testing.T) {
+	packager := newTestPackager(t, Options{})
+	for _, dir := range []string{
+		"3395761", "3525360-hotfix", ".git", "tmp", "lost+found", "3525360.packaging",
+	} {
+		err := os.MkdirAll(filepath.Join(packager.releaseDir, dir), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Files are never versions
+	err := ioutil.WriteFile(filepath.Join(packager.releaseDir, "3450000"), nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := packager.GetVersionList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"3395761", "3525360-hotfix"}
+	if !reflect.DeepEqual(versions, expected) {
+		t.Errorf("Versions are %v, expected %v", versions, expected)
+	}
+}
@@ -0,0 +1,178 @@
+package packager
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// watchProcessedFilename lists the release zips from the watch dir that
+// have been processed
+const watchProcessedFilename = ".watch-processed"
+
+// watchQuarantineDir is where release zips that fail to process are moved
+// to, relative to the watch dir
+const watchQuarantineDir = "failed"
+
+// RunWatchDir processes every new *.zip in the watch dir as a release,
+// without using the feed. Processed zips are remembered by name, size and
+// modification time so they are only processed once. A zip is only
+// processed once its size is the same as on the previous poll, so zips
+// still being copied in are left alone. Zips that fail to process are
+// moved to the quarantine dir
+func (packager *Packager) RunWatchDir() ([]RunResult, error) {
+	if packager.options.WatchDir == "" {
+		return nil, fmt.Errorf("No watch dir configured")
+	}
+	zipPaths, err := filepath.Glob(filepath.Join(packager.options.WatchDir, "*.zip"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(zipPaths)
+	processed, err := packager.readWatchProcessed()
+	if err != nil {
+		return nil, err
+	}
+
+	sizes := make(map[string]int64)
+	var results []RunResult
+	for _, zipPath := range zipPaths {
+		fileInfo, err := os.Stat(zipPath)
+		if err != nil {
+			log.WithField("zip", zipPath).Warning(
+				"Unable to stat watched zip: " + err.Error())
+			continue
+		}
+		key := watchKey(fileInfo)
+		if processed[key] {
+			continue
+		}
+		sizes[zipPath] = fileInfo.Size()
+		previousSize, seen := packager.watchSizes[zipPath]
+		if !seen || previousSize != fileInfo.Size() {
+			log.WithField("zip", zipPath).Debug("Waiting for the zip size to settle")
+			continue
+		}
+		log.WithField("zip", zipPath).Info("New release found in watch dir")
+
+		result, err := packager.processWatchZip(zipPath, fileInfo)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"err": "process_watch_zip",
+				"zip": zipPath,
+			}).Error(err.Error())
+			delete(sizes, zipPath)
+			err = packager.quarantineWatchZip(zipPath)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"err": "quarantine_watch_zip",
+					"zip": zipPath,
+				}).Error(err.Error())
+			}
+			continue
+		}
+		results = append(results, result)
+		if len(result.Failures) > 0 {
+			// Leave it unprocessed so it's retried on the next poll
+			continue
+		}
+		err = packager.addWatchProcessed(key)
+		if err != nil {
+			return results, err
+		}
+	}
+	packager.watchSizes = sizes
+	return results, nil
+}
+
+// processWatchZip extracts the release zip at zipPath and packages it
+func (packager *Packager) processWatchZip(
+	zipPath string,
+	fileInfo os.FileInfo) (RunResult, error) {
+	// Releases from the watch dir have no post
+	packager.releasePost = nil
+	startTime := time.Now()
+	extractPath := filepath.Join(packager.payloadDir, "newrelease")
+	err := packager.extract(extractPath, zipPath)
+	if err != nil {
+		return RunResult{}, err
+	}
+	return packager.processRelease(
+		extractPath,
+		"",
+		float64(fileInfo.Size()),
+		startTime)
+}
+
+// quarantineWatchZip moves the zip at zipPath to the quarantine dir so it
+// isn't picked up again
+func (packager *Packager) quarantineWatchZip(zipPath string) error {
+	quarantineDir := filepath.Join(packager.options.WatchDir, watchQuarantineDir)
+	err := os.MkdirAll(quarantineDir, 0755)
+	if err != nil {
+		return err
+	}
+	quarantinePath := filepath.Join(quarantineDir, filepath.Base(zipPath))
+	log.WithField("path", quarantinePath).Warning("Moving failed zip to quarantine")
+	return os.Rename(zipPath, quarantinePath)
+}
+
+// Watch polls the watch dir forever, errors are logged and the next poll
+// tries again. It only returns when no watch dir is configured
+func (packager *Packager) Watch(interval time.Duration) error {
+	if packager.options.WatchDir == "" {
+		return fmt.Errorf("No watch dir configured")
+	}
+	for {
+		_, err := packager.RunWatchDir()
+		if err != nil {
+			log.WithField("err", "run_watch_dir").Error(err.Error())
+		}
+		time.Sleep(interval)
+	}
+}
+
+// watchKey identifies a release zip in the watch dir
+func watchKey(fileInfo os.FileInfo) string {
+	return fmt.Sprintf("%s\t%d\t%d",
+		fileInfo.Name(),
+		fileInfo.Size(),
+		fileInfo.ModTime().Unix())
+}
+
+// readWatchProcessed returns the keys of processed release zips
+func (packager *Packager) readWatchProcessed() (map[string]bool, error) {
+	processed := make(map[string]bool)
+	file, err := os.Open(filepath.Join(packager.releaseDir, watchProcessedFilename))
+	if os.IsNotExist(err) {
+		return processed, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		processed[scanner.Text()] = true
+	}
+	return processed, scanner.Err()
+}
+
+// addWatchProcessed records a release zip as processed
+func (packager *Packager) addWatchProcessed(key string) error {
+	file, err := os.OpenFile(
+		filepath.Join(packager.releaseDir, watchProcessedFilename),
+		os.O_APPEND|os.O_WRONLY|os.O_CREATE,
+		0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = fmt.Fprintln(file, key)
+	return err
+}
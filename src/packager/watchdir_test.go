@@ -0,0 +1,74 @@
+package packager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunWatchDirPackagesDroppedZip(t *testing.T) {
+	fixture := newFixture(t)
+	fixture.installVersion(3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+	})
+	watchDir := filepath.Join(fixture.dir, "watch")
+	err := os.MkdirAll(watchDir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packager := fixture.newPackager(Options{WatchDir: watchDir})
+
+	// An unreadable zip is quarantined without blocking the release
+	brokenPath := filepath.Join(watchDir, "broken.zip")
+	err = ioutil.WriteFile(brokenPath, []byte("not a zip"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zipPath := filepath.Join(watchDir, "UnrealTournament-Client-XAN-3525360-Linux.zip")
+	err = ioutil.WriteFile(zipPath, zipFiles(t, releaseFiles(3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+	})), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first poll waits for the zip sizes to settle
+	results, err := packager.RunWatchDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 0 {
+		t.Fatalf("Unsettled zips were processed: %+v", results)
+	}
+
+	results, err = packager.RunWatchDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Version != "3525360" {
+		t.Fatalf("Watch dir run returned %+v", results)
+	}
+	packagePath := filepath.Join(fixture.packageDir, "3395761-3525360.tar.gz")
+	files := readPackage(t, packagePath)
+	if files["UnrealTournament/Config/Default.ini"] != "setting=2" {
+		t.Errorf("Modified file in package is %q",
+			files["UnrealTournament/Config/Default.ini"])
+	}
+	if _, err := os.Stat(brokenPath); !os.IsNotExist(err) {
+		t.Error("Broken zip is still in the watch dir")
+	}
+	_, err = os.Stat(filepath.Join(watchDir, watchQuarantineDir, "broken.zip"))
+	if err != nil {
+		t.Errorf("Broken zip wasn't quarantined: %s", err)
+	}
+
+	// Processed zips are skipped
+	results, err = packager.RunWatchDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 0 {
+		t.Errorf("Processed zip was processed again: %+v", results)
+	}
+}
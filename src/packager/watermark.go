@@ -0,0 +1,151 @@
+package packager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/donovansolms/ut4-update-packager/src/packager/models"
+	"github.com/jinzhu/gorm"
+	"github.com/mmcdole/gofeed"
+	log "github.com/sirupsen/logrus"
+)
+
+// watermarkFilename stores the date of the newest processed release post
+const watermarkFilename = ".feed-watermark"
+
+// readWatermark returns the date of the newest processed release post.
+// A zero time is returned when nothing has been processed yet
+func (packager *Packager) readWatermark() time.Time {
+	content, err := ioutil.ReadFile(
+		filepath.Join(packager.releaseDir, watermarkFilename))
+	if err != nil {
+		return time.Time{}
+	}
+	watermark, err := time.Parse(time.RFC3339, strings.TrimSpace(string(content)))
+	if err != nil {
+		log.WithField("err", "read_watermark").Warning(err.Error())
+		return time.Time{}
+	}
+	return watermark
+}
+
+// writeWatermark persists the watermark, it is written to a temporary file
+// first so a crash can't leave a corrupt watermark
+func (packager *Packager) writeWatermark(watermark time.Time) error {
+	watermarkPath := filepath.Join(packager.releaseDir, watermarkFilename)
+	err := ioutil.WriteFile(
+		watermarkPath+".tmp",
+		[]byte(watermark.UTC().Format(time.RFC3339)),
+		0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(watermarkPath+".tmp", watermarkPath)
+}
+
+// postDate returns the published date of a post, falling back to the
+// updated date. Nil is returned when the post has no usable date
+func postDate(post *gofeed.Item) *time.Time {
+	if post.PublishedParsed != nil {
+		return post.PublishedParsed
+	}
+	return post.UpdatedParsed
+}
+
+// postKey returns the key a post is deduplicated on. This is the GUID, or
+// for feeds that omit it, a hash of the link, title and date
+func postKey(post *gofeed.Item) string {
+	if post.GUID != "" {
+		return post.GUID
+	}
+	date := post.Published
+	if parsedDate := postDate(post); parsedDate != nil {
+		date = parsedDate.UTC().Format(time.RFC3339)
+	}
+	hash := sha256.Sum256([]byte(post.Link + "\n" + post.Title + "\n" + date))
+	return "sha256:" + hex.EncodeToString(hash[:])
+}
+
+// markReleaseProcessed records the release post of version with its
+// metadata in the database and advances the watermark so the post isn't
+// examined again
+func (packager *Packager) markReleaseProcessed(
+	db *gorm.DB,
+	releasePost *gofeed.Item,
+	version string) error {
+	blogPost := models.Ut4BlogPost{
+		Title:       releasePost.Title,
+		GUID:        postKey(releasePost),
+		Version:     version,
+		DateCreated: time.Now(),
+	}
+	packager.setPostMetadata(&blogPost, releasePost)
+	date := postDate(releasePost)
+	if date != nil {
+		blogPost.DatePublished = *date
+	}
+	err := saveBlogPostOnce(db, blogPost)
+	if err != nil {
+		return err
+	}
+	if date == nil || !date.After(packager.readWatermark()) {
+		return nil
+	}
+	return packager.writeWatermark(*date)
+}
+
+// unprocessedPosts returns the posts that aren't recorded in the database
+// yet, in feed order. Posts older than the watermark are skipped without
+// a lookup, so an old post that keeps failing can't hold back newer
+// releases. Posts at or after the watermark and posts without a date are
+// checked against the recorded GUIDs in a single query
+func (packager *Packager) unprocessedPosts(
+	db *gorm.DB,
+	posts []*gofeed.Item) ([]*gofeed.Item, error) {
+	watermark := packager.readWatermark()
+	var candidates []*gofeed.Item
+	var keys []string
+	for _, post := range posts {
+		date := postDate(post)
+		if !watermark.IsZero() && date != nil && date.Before(watermark) {
+			log.WithFields(log.Fields{
+				"title": post.Title,
+				"guid":  postKey(post),
+			}).Debug("Skipping post older than the watermark")
+			continue
+		}
+		candidates = append(candidates, post)
+		keys = append(keys, postKey(post))
+	}
+	recorded := make(map[string]bool)
+	if len(keys) > 0 {
+		var recordedKeys []string
+		query := db.Model(&models.Ut4BlogPost{}).
+			Where("guid IN (?) AND is_deleted = 0", keys).
+			Pluck("guid", &recordedKeys)
+		if query.Error != nil {
+			return nil, query.Error
+		}
+		for _, key := range recordedKeys {
+			recorded[key] = true
+		}
+	}
+
+	var unprocessed []*gofeed.Item
+	for _, post := range candidates {
+		if recorded[postKey(post)] {
+			log.WithFields(log.Fields{
+				"title": post.Title,
+				"guid":  postKey(post),
+			}).Debug("Skipping processed post")
+			continue
+		}
+		unprocessed = append(unprocessed, post)
+	}
+	return unprocessed, nil
+}
@@ -0,0 +1,127 @@
+package packager
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func testFeedPost(guid string, date time.Time) *gofeed.Item {
+	return &gofeed.Item{
+		Title:           "UT Release " + guid,
+		GUID:            guid,
+		PublishedParsed: &date,
+	}
+}
+
+func postGUIDs(posts []*gofeed.Item) []string {
+	var guids []string
+	for _, post := range posts {
+		guids = append(guids, post.GUID)
+	}
+	return guids
+}
+
+func TestUnprocessedPosts(t *testing.T) {
+	fixture := newFixture(t)
+	packager := fixture.newPackager(Options{})
+	db := fixture.db()
+	base := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	// Before anything is processed every post is examined
+	older := testFeedPost("older", base.Add(-time.Hour))
+	processed := testFeedPost("processed", base)
+	unprocessed, err := packager.unprocessedPosts(db, []*gofeed.Item{processed, older})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(postGUIDs(unprocessed), []string{"processed", "older"}) {
+		t.Fatalf("Unprocessed posts are %v without a watermark", postGUIDs(unprocessed))
+	}
+
+	err = packager.markReleaseProcessed(db, processed, "3395761")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !packager.readWatermark().Equal(base) {
+		t.Fatalf("Watermark is %s, expected %s", packager.readWatermark(), base)
+	}
+
+	// Posts older than the watermark are skipped, posts in the same second
+	// and undated posts fall back to the GUID check
+	sameSecond := testFeedPost("same-second", base)
+	newer := testFeedPost("newer", base.Add(time.Hour))
+	undated := &gofeed.Item{Title: "UT Release undated", GUID: "undated"}
+	posts := []*gofeed.Item{newer, sameSecond, processed, undated, older}
+	unprocessed, err = packager.unprocessedPosts(db, posts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"newer", "same-second", "undated"}
+	if !reflect.DeepEqual(postGUIDs(unprocessed), expected) {
+		t.Fatalf("Unprocessed posts are %v, expected %v", postGUIDs(unprocessed), expected)
+	}
+
+	// Once the watermark advances the posts before it are skipped too
+	err = packager.markReleaseProcessed(db, newer, "3525360")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unprocessed, err = packager.unprocessedPosts(db, posts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"undated"}
+	if !reflect.DeepEqual(postGUIDs(unprocessed), expected) {
+		t.Errorf("Unprocessed posts are %v, expected %v", postGUIDs(unprocessed), expected)
+	}
+}
+
+func TestRunDeduplicatesPostsWithoutGUID(t *testing.T) {
+	fixture := newFixture(t)
+	fixture.installVersion(3395761, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=1",
+	})
+	downloadURL := fixture.serveRelease(3525360, map[string]string{
+		"UnrealTournament/Config/Default.ini": "setting=2",
+	})
+	published := time.Now().Truncate(time.Second)
+	fixture.addPost("UT Release 3525360", "", downloadURL, published)
+	packager := fixture.newPackager(Options{})
+
+	result, err := packager.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Version != "3525360" {
+		t.Fatalf("Run packaged %q", result.Version)
+	}
+	var guids []string
+	fixture.db().Table("ut4_blog_posts").Pluck("guid", &guids)
+	if len(guids) != 1 || !strings.HasPrefix(guids[0], "sha256:") {
+		t.Fatalf("Recorded post keys are %v, expected one synthetic key", guids)
+	}
+
+	// The same post is recognised by its synthetic key
+	result, err = packager.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Version != "" {
+		t.Errorf("Post without a GUID was processed again as %q", result.Version)
+	}
+
+	// Posts that differ get different keys
+	first := testFeedPost("", published)
+	second := testFeedPost("", published)
+	second.Title = "UT Release 3525361"
+	if postKey(first) == postKey(second) {
+		t.Error("Different posts without a GUID share a key")
+	}
+	if postKey(first) != postKey(testFeedPost("", published)) {
+		t.Error("Key of a post without a GUID isn't stable")
+	}
+}